@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// newCompletionFlags は completion サブコマンドのフラグを定義する
+func newCompletionFlags() *flag.FlagSet {
+	return newCommandFlags("completion", "<bash|zsh|fish>")
+}
+
+// runCompletion はシェル補完のスクリプトを標準出力に書き出す
+// 例: source <(video_concator completion bash)
+func runCompletion(args []string) {
+	fs := newCompletionFlags()
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	switch fs.Arg(0) {
+	case "bash":
+		writeBashCompletion(os.Stdout)
+	case "zsh":
+		// zshではbashの補完関数をbashcompinit経由で読み込む
+		fmt.Fprintln(os.Stdout, "autoload -U +X bashcompinit && bashcompinit")
+		writeBashCompletion(os.Stdout)
+	case "fish":
+		writeFishCompletion(os.Stdout)
+	default:
+		fatalf("エラー: 対応していないシェルです: %s (bash, zsh, fish のいずれかを指定してください)", fs.Arg(0))
+	}
+}
+
+// commandFlagNames はサブコマンドのフラグ名を "-" 付きで返す
+func commandFlagNames(cmd command) []string {
+	var names []string
+	cmd.newFlags().VisitAll(func(f *flag.Flag) { names = append(names, "-"+f.Name) })
+	return names
+}
+
+// commandNames はサブコマンド名の一覧を返す
+func commandNames() []string {
+	var names []string
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+// writeBashCompletion はbash用の補完スクリプトを書き出す
+func writeBashCompletion(w io.Writer) {
+	fmt.Fprintln(w, `_video_concator() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local cmd="concat"
+    if [ "$COMP_CWORD" -gt 1 ] && [[ "${COMP_WORDS[1]}" != -* ]]; then
+        cmd="${COMP_WORDS[1]}"
+    fi
+    local opts=""
+    local args=""`)
+	fmt.Fprintf(w, "    if [ \"$COMP_CWORD\" -eq 1 ] && [[ \"$cur\" != -* ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %q -- \"$cur\") $(compgen -f -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, "        return\n    fi\n    case \"$cmd\" in")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "        %s)\n            opts=%q\n", cmd.name, strings.Join(commandFlagNames(cmd), " "))
+		switch cmd.name {
+		case "completion":
+			fmt.Fprintln(w, `            args="bash zsh fish"`)
+		case "help":
+			fmt.Fprintf(w, "            args=%q\n", strings.Join(commandNames(), " "))
+		}
+		fmt.Fprintln(w, "            ;;")
+	}
+	fmt.Fprintln(w, `    esac
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+    elif [ -n "$args" ]; then
+        COMPREPLY=($(compgen -W "$args" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+}
+complete -o filenames -F _video_concator video_concator`)
+}
+
+// fishQuote はfishの単一引用符で囲んだ文字列を返す
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+// writeFishCompletion はfish用の補完スクリプトを書き出す
+func writeFishCompletion(w io.Writer) {
+	names := strings.Join(commandNames(), " ")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "complete -c video_concator -n __fish_use_subcommand -a %s -d %s\n", cmd.name, fishQuote(cmd.summary))
+	}
+	for _, cmd := range commands {
+		cond := "__fish_seen_subcommand_from " + cmd.name
+		if cmd.name == "concat" {
+			// サブコマンドを省略した場合も concat のオプションを補完する
+			cond = "not __fish_seen_subcommand_from " + strings.Join(commandNames()[1:], " ")
+		}
+		cmd.newFlags().VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(w, "complete -c video_concator -n %s -o %s -d %s\n", fishQuote(cond), f.Name, fishQuote(f.Usage))
+		})
+		switch cmd.name {
+		case "completion":
+			fmt.Fprintf(w, "complete -c video_concator -n %s -f -a 'bash zsh fish'\n", fishQuote(cond))
+		case "help":
+			fmt.Fprintf(w, "complete -c video_concator -n %s -f -a %s\n", fishQuote(cond), fishQuote(names))
+		}
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rkun123/video_concator/concator"
+)
+
+// concatOptions は concat・watch・config サブコマンドのオプション
+// ジョブに直接対応しないオプションはここで受け取り、parse後にジョブへ反映する
+type concatOptions struct {
+	job           *concator.Job
+	strict        bool
+	fromManifest  string
+	preflightOnly bool
+	memLimit      string
+	cpuLimit      float64
+	configPath    string
+	recipeName    string
+	recipePath    string
+	listRecipes   bool
+	useCache      bool
+	cacheDir      string
+	jsonEvents    bool
+}
+
+// bindInputFlags は入力ファイルの検索と並び順に関するフラグを定義する
+// (concat・watch・list・probe で共通)
+func bindInputFlags(fs *flag.FlagSet, job *concator.Job) {
+	fs.Var(dirsValue{&job.Dir, &job.Dirs}, "dir", "動画ファイルが含まれるディレクトリ (繰り返し指定可。複数の場合は全てのファイルをまとめて並べ替える)")
+	fs.StringVar(&job.ListFile, "list", job.ListFile, "結合する動画ファイルを1行に1つずつ並べたプレイリスト (M3U形式も可)。記載順に結合し、-dir の検索は行わない")
+	fs.StringVar(&job.OnEmpty, "on-empty", job.OnEmpty, "動画ファイルが見つからない場合の動作 (error: エラー終了, skip: 正常終了, wait: 見つかるまで待機)")
+	fs.StringVar(&job.TimeSource, "time-source", job.TimeSource, "ソートに使用する日時 (mtime: 更新日時, btime: 作成日時)")
+	fs.StringVar(&job.Sort, "sort", job.Sort, "並び順 (time: -time-source の日時順, mtime: 更新日時順, ctime: 作成日時順, name: ファイル名順, metadata: 撮影日時順, weighted-shuffle: サイドカー (<動画ファイル名>.concat.json) のweightで重み付けしたランダム順)")
+	fs.Uint64Var(&job.Seed, "seed", job.Seed, "ランダムな並び順に使うシード値 (0の場合は実行ごとに変わる)")
+	fs.BoolVar(&job.Reverse, "reverse", job.Reverse, "並び順を逆にする")
+	fs.BoolVar(&job.SkipOpenFiles, "skip-open-files", job.SkipOpenFiles, "他のプロセスが書き込み中のファイル (録画中など) を除外する")
+	fs.BoolVar(&job.KeepDuplicates, "keep-duplicates", job.KeepDuplicates, "大きさと先頭・末尾の内容が同じファイル (別名のコピーやバックアップ) も除外せずに結合する")
+	fs.DurationVar(&job.MinDuration, "min-duration", job.MinDuration, "長さがこれ未満のファイルを除外する (例: 3s)。0の場合は制限しない")
+	fs.DurationVar(&job.MaxDuration, "max-duration", job.MaxDuration, "長さがこれを超えるファイルを除外する (例: 30m)。0の場合は制限しない")
+	fs.StringVar(&job.Since, "since", job.Since, "-dir のうち、この日時以降のファイルのみを結合する (例: 2024-05-01、2024-05-01 13:30)。日時は -sort の日時 (name の場合は更新日時) で判定する")
+	fs.StringVar(&job.Until, "until", job.Until, "-dir のうち、この日時より前のファイルのみを結合する (日付のみの場合はその日を含む)")
+	fs.StringVar(&job.Include, "include", job.Include, "-dir のうち、ファイル名または相対パスがglobパターンにマッチするファイルのみを結合する (カンマ区切り、例: \"GX*.MP4,*.mov\")")
+	fs.StringVar(&job.Exclude, "exclude", job.Exclude, "-dir のうち、ファイル名または相対パスがglobパターンにマッチするファイルを除外する (カンマ区切り)")
+	fs.StringVar(&job.IgnoreFile, "ignore-file", job.IgnoreFile, "-dir の各ディレクトリで読み込む、除外するファイルのパターンを1行に1つずつ記述したファイルの名前 (gitignoreと同じ書式。空の場合は使用しない)")
+	fs.IntVar(&job.MaxDepth, "max-depth", job.MaxDepth, "-dir を検索するディレクトリの深さの上限 (1: 直下のファイルのみ、2: 1階層下のサブディレクトリまで、0: 無制限)")
+	fs.BoolVar(&job.FollowSymlinks, "follow-symlinks", job.FollowSymlinks, "-dir の検索でディレクトリへのシンボリックリンクもたどる (同じディレクトリは1回のみ)")
+	fs.BoolVar(&job.IncludeHidden, "include-hidden", job.IncludeHidden, "-dir の検索で . で始まる名前の隠しファイル・ディレクトリ (macOSが作る ._ のファイルなど) も対象にする")
+	fs.StringVar(&job.Source, "source", job.Source, "チャプター一覧で分割して再編集する単一の動画ファイル (-chapters-text と併用)")
+	fs.StringVar(&job.ChaptersText, "chapters-text", job.ChaptersText, "YouTube形式のチャプター一覧 (\"0:00 Intro\" の形式) のファイル")
+	fs.StringVar(&job.ChaptersSelect, "chapters-select", job.ChaptersSelect, "結合するチャプターの番号をカンマ区切りで並べた順序 (例: 3,1,2)。省略時は全て")
+}
+
+// checkInputFlags は入力の指定に関するフラグの組み合わせを確認する
+func checkInputFlags(fs *flag.FlagSet, job *concator.Job, hasManifest bool) {
+	hasInput := job.Dir != "" || hasManifest || job.Source != "" || job.ListFile != "" || len(job.Files) > 0
+	if !hasInput {
+		fmt.Println("エラー: -dir (または -from-manifest、-source、-list、動画ファイルやディレクトリの引数) は必須です。")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if (job.Source == "") != (job.ChaptersText == "") {
+		fmt.Println("エラー: -source と -chapters-text は一緒に指定してください。")
+		fs.Usage()
+		os.Exit(1)
+	}
+}
+
+// ffmpegArgsValue はffmpegにそのまま渡す引数のフラグ
+// シェルと同じく空白で区切って複数の引数を指定でき (空白を含む引数はクォートする)、フラグを繰り返すと後ろに追加する
+type ffmpegArgsValue struct {
+	args *[]string
+}
+
+func (v ffmpegArgsValue) String() string {
+	if v.args == nil {
+		return ""
+	}
+	return concator.JoinShellArgs(*v.args)
+}
+
+func (v ffmpegArgsValue) Set(s string) error {
+	args, err := concator.SplitShellArgs(s)
+	if err != nil {
+		return err
+	}
+	*v.args = append(*v.args, args...)
+	return nil
+}
+
+// Get は設定の表示用に、設定ファイルから読み込み直せる1つの文字列を返す
+func (v ffmpegArgsValue) Get() any {
+	return v.String()
+}
+
+// metadataValue は出力に書き込むメタデータ (key=value) のフラグ
+// フラグを繰り返すと後ろに追加する。設定ファイルでは改行で区切って複数指定できる
+type metadataValue struct {
+	pairs *[]string
+}
+
+func (v metadataValue) String() string {
+	if v.pairs == nil {
+		return ""
+	}
+	return strings.Join(*v.pairs, "\n")
+}
+
+func (v metadataValue) Set(s string) error {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if key, _, ok := strings.Cut(line, "="); !ok || key == "" {
+			return fmt.Errorf("key=value の形式で指定してください: %s", line)
+		}
+		*v.pairs = append(*v.pairs, line)
+	}
+	return nil
+}
+
+// Get は設定の表示用に、設定ファイルから読み込み直せる1つの文字列を返す
+func (v metadataValue) Get() any {
+	return v.String()
+}
+
+// dirsValue は入力ディレクトリのフラグ
+// 最初の指定を Dir に、フラグを繰り返した2つ目以降を Dirs に追加する。設定ファイルでは改行で区切って複数指定できる
+type dirsValue struct {
+	dir  *string
+	dirs *[]string
+}
+
+func (v dirsValue) String() string {
+	if v.dir == nil {
+		return ""
+	}
+	return strings.Join(append([]string{*v.dir}, *v.dirs...), "\n")
+}
+
+func (v dirsValue) Set(s string) error {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if *v.dir == "" {
+			*v.dir = line
+		} else {
+			*v.dirs = append(*v.dirs, line)
+		}
+	}
+	return nil
+}
+
+// Get は設定の表示用に、設定ファイルから読み込み直せる1つの文字列を返す
+func (v dirsValue) Get() any {
+	return v.String()
+}
+
+// newConcatFlags は concat・watch・config サブコマンドのフラグを定義する
+func newConcatFlags(name string) (*flag.FlagSet, *concatOptions) {
+	fs, o := newJobFlags(name)
+	bindCommonFlags(fs)
+	return fs, o
+}
+
+// newJobFlags は結合ジョブのフラグを定義する (ログとffmpegのパスに関するフラグは含まない)
+// 既定値はライブラリの既定値に合わせる
+func newJobFlags(name string) (*flag.FlagSet, *concatOptions) {
+	job := concator.NewJob()
+	o := &concatOptions{job: job}
+	fs := newCommandFlags(name, "[オプション] [動画ファイルまたはディレクトリ...]")
+	bindInputFlags(fs, job)
+	fs.StringVar(&job.Output, "output", job.Output, "出力ファイル名 (必須)。Goのテンプレートで {{.Date}} (-group-by のグループ)、{{.FirstDate}}、{{.LastDate}}、{{.ClipCount}}、{{.TotalDuration}}、{{.DirName}} を使える (例: trip_{{.FirstDate}}_{{.ClipCount}}.mp4)")
+	fs.StringVar(&job.GroupBy, "group-by", job.GroupBy, "入力を日時ごと (hour, day, week) のグループに分け、グループごとに出力ファイルを作成する。日時は -sort の日時 (name の場合は -time-source) を使う")
+	fs.DurationVar(&job.SplitDuration, "split-duration", job.SplitDuration, "出力の長さの上限 (例: 2h)。超える場合はクリップの境目で分割し、_part01、_part02 … を付けた別々のファイルに出力する")
+	fs.StringVar(&job.SplitSize, "split-size", job.SplitSize, "出力のサイズの上限 (例: 4GB)。超える場合はクリップの境目で分割する。-copy 以外ではビットレートから見積もり、指定が無い場合は入力ファイルのサイズで見積もる")
+	fs.StringVar(&job.Resolution, "resolution", job.Resolution, "解像度 (例: 1920x1080、auto で入力に最も多い解像度)")
+	fs.IntVar(&job.Framerate, "framerate", job.Framerate, "フレームレート")
+	fs.StringVar(&job.Container, "container", job.Container, "出力のコンテナ形式 (auto, mp4, mov, mkv, webm, gif)。auto は -output の拡張子から判定し、それ以外で -output に拡張子が無い場合は補う。webm の音声は Opus、gif はパレットを生成して減色し音声は出力しない")
+	fs.StringVar(&job.Codec, "codec", job.Codec, "映像コーデック (h265, h264, vp9, av1)。省略時はコンテナ形式の既定 (webm は vp9、それ以外は h265)。-encoder を省略した場合、h265 と h264 はハードウェアエンコーダーを含めて自動選択し、vp9 と av1 はソフトウェアエンコーダー (libvpx-vp9、libaom-av1) を使う")
+	fs.StringVar(&job.Encoder, "encoder", job.Encoder, "ビデオエンコーダー (デフォルトは hevc_nvenc → hevc_qsv → hevc_amf → hevc_vaapi → hevc_videotoolbox → libx265 の順に動作するものを自動選択。-codec h264 では h264_ の各エンコーダーと libx264)")
+	fs.StringVar(&job.Poster, "poster", job.Poster, "出力に埋め込むカバー画像 (jpg/png)")
+	fs.StringVar(&job.Intro, "intro", job.Intro, "先頭に追加するクリップ (出力の解像度に合わせて結合する)")
+	fs.StringVar(&job.Outro, "outro", job.Outro, "末尾に追加するクリップ (出力の解像度に合わせて結合する)")
+	fs.IntVar(&job.CRF, "crf", job.CRF, "固定品質の値 (0〜51、小さいほど高画質、-1は指定しない)。NVENCでは -cq、QSVでは -global_quality、AMFでは -qp_i/-qp_p、VAAPIでは -qp に変換する")
+	fs.StringVar(&job.VideoBitrate, "vbitrate", job.VideoBitrate, "映像の平均ビットレート (例: 8M)。-crf とは同時に指定できない")
+	fs.BoolVar(&job.TwoPass, "two-pass", job.TwoPass, "解析のパスと本番のパスの2回に分けてエンコードし、-vbitrate の平均ビットレートを正確に守る (ソフトウェアエンコーダーのみ)")
+	fs.StringVar(&job.TargetSize, "target-size", job.TargetSize, "出力の目標サイズ (例: 100M)。出力の長さから映像のビットレートを求め、2パスでエンコードする")
+	fs.StringVar(&job.Preset, "preset", job.Preset, "エンコードのプリセット (ultrafast〜veryslow。NVENCでは p1〜p7、AMFでは speed/balanced/quality に変換する)")
+	fs.StringVar(&job.Tune, "tune", job.Tune, "映像の種類に応じたチューニング (film, animation, grain, zerolatency など。NVENCでは hq/ll/ull に変換する)")
+	fs.StringVar(&job.MaxBitrate, "max-bitrate", job.MaxBitrate, "VBVの最大ビットレート (例: 8M)。-maxrate として渡される")
+	fs.StringVar(&job.Bufsize, "bufsize", job.Bufsize, "VBVのバッファサイズ (例: 16M)。省略時は -max-bitrate の2倍")
+	fs.IntVar(&job.ThreadQueueSize, "thread-queue-size", job.ThreadQueueSize, "入力のスレッドキューのパケット数。\"Thread message queue blocking\" の警告やカクつきが出る場合に増やす (0はffmpegのデフォルト)")
+	fs.Var(ffmpegArgsValue{&job.ExtraInputArgs}, "ff-input-args", "各入力の -i の前にそのまま渡すffmpegの入力オプション (空白区切りで空白を含む値はクォートする、繰り返し指定可。例: \"-hwaccel auto\")")
+	fs.Var(ffmpegArgsValue{&job.ExtraArgs}, "ff-output-args", "出力ファイルの直前にそのまま渡すffmpegの出力オプション (空白区切りで空白を含む値はクォートする、繰り返し指定可。例: \"-movflags +faststart\" \"-metadata 'title=My Video'\")")
+	fs.StringVar(&job.ProbeSize, "probesize", job.ProbeSize, "入力の解析に読み込むバイト数 (例: 50M)。ストリームが検出されない・情報が不足する場合に増やす")
+	fs.StringVar(&job.AnalyzeDuration, "analyzeduration", job.AnalyzeDuration, "入力の解析に使う時間 (マイクロ秒、例: 10000000)。タイムスタンプやストリーム情報が不正確な場合に増やす")
+	fs.StringVar(&job.ListEOL, "list-eol", job.ListEOL, "結合リストファイルの改行コード (lf または crlf)")
+	fs.StringVar(&job.CutsFile, "cuts", job.CutsFile, "クリップごとに結合する範囲を記述したカットリスト (\"ファイル,開始,終了,速度\" のCSV、または .json)。終了に負の値を指定すると末尾からの秒数、速度 (例: 8x) は省略可")
+	fs.StringVar(&job.Speed, "speed", job.Speed, "全てのクリップの再生速度の倍率 (例: 8x でタイムラプス、0.5x でスローモーション)。カットリストで速度を指定したクリップはそちらを優先する")
+	fs.StringVar(&job.SpeedAudio, "speed-audio", job.SpeedAudio, "再生速度を変えたクリップの音声の扱い (tempo: 音程を変えずに速度を合わせる、drop: 無音にする。全てのクリップの速度を変える場合は音声を出力しない)")
+	fs.BoolVar(&job.TrimBlack, "trim-black", job.TrimBlack, "各クリップの先頭・末尾の黒画面を除外する")
+	fs.Float64Var(&job.BlackThreshold, "black-threshold", job.BlackThreshold, "-trim-black で黒とみなす画素の明るさの閾値 (0.0〜1.0)")
+	fs.Float64Var(&job.BlackMinDuration, "black-min-duration", job.BlackMinDuration, "-trim-black で検出する黒画面の最小の長さ (秒)")
+	fs.Var(metadataValue{&job.Metadata}, "metadata", "出力に書き込むメタデータ (key=value、繰り返し指定可。例: \"title=夏の旅行\" \"artist=山田\" \"comment=...\")。入力から引き継いだ値より優先する")
+	fs.BoolVar(&job.StripMetadata, "strip-metadata", job.StripMetadata, "入力の撮影日時・位置情報・機器の情報を出力に引き継がない (既定では最初のクリップの撮影日時を creation_time とし、位置情報と機器の情報も引き継ぐ)")
+	fs.StringVar(&job.DumpMetadata, "dump-metadata", job.DumpMetadata, "完了後に出力のメタデータをffmetadata形式で書き出すパス")
+	fs.BoolVar(&job.Verify, "verify", job.Verify, "完了後に出力の長さを入力から想定される長さと比較し、最後までデコードできるかを確認する (問題がある場合はエラー終了する)")
+	fs.Float64Var(&job.VerifyTolerance, "verify-tolerance", job.VerifyTolerance, "-verify で許容する出力の長さの差 (秒)")
+	fs.BoolVar(&job.WriteManifest, "write-manifest", job.WriteManifest, "完了後に出力ファイルの隣に、各クリップの出力での位置と長さ・設定・チェックサムを記録した <出力ファイル名>.json を書き出す (-from-manifest で同じ結合を再現できる)")
+	fs.IntVar(&job.Jobs, "jobs", job.Jobs, "クリップごとの解析処理と -normalize のエンコードの並列数")
+	fs.IntVar(&job.IOJobs, "io-jobs", job.IOJobs, "ディスクを読み書きする処理の同時実行数 (0はストレージの種類から自動判定: HDDは1、SSDは4)")
+	fs.StringVar(&job.Audio, "audio", job.Audio, "音声の出力方法 (aac: AAC 192kで再エンコード、copy: 再エンコードせずにコピー、none: 音声を出力しない)。copy できない場合はaacで再エンコードする")
+	fs.StringVar(&job.AudioLayout, "audio-layout", job.AudioLayout, "音声形式が混在する場合に揃えるチャンネルレイアウト (例: stereo, mono, 5.1)")
+	fs.BoolVar(&job.Describe, "describe", job.Describe, "実行内容を文章で説明し、エンコードせずに終了する")
+	fs.StringVar(&job.Subtitles, "subtitles", job.Subtitles, "入力の字幕の扱い (none: 引き継がない、copy: 結合後の時刻に合わせて1つの字幕トラックとして格納する、burn: 映像に焼き込む)。各クリップと同じ名前の .srt/.ass ファイルがあれば埋め込まれた字幕より優先して使う。画像ベースの字幕は引き継げない")
+	fs.BoolVar(&job.KeepSubtitles, "keep-subtitles", job.KeepSubtitles, "-subtitles copy と同じ (互換性のため残している)")
+	fs.BoolVar(&job.EmbedChapters, "embed-chapters", job.EmbedChapters, "クリップの境界ごとに、ファイル名をタイトルとしたチャプターを出力に埋め込む (mp4/mov/mkv)")
+	fs.StringVar(&job.WebVTTChapters, "webvtt-chapters", job.WebVTTChapters, "クリップごとのチャプターをWebVTT形式で書き出すパス")
+	fs.StringVar(&job.OnError, "on-error", job.OnError, "空・破損・ビデオストリームの無い入力ファイルがある場合の動作 (skip: 除外して続行, abort: 全て報告してエラー終了)")
+	fs.BoolVar(&o.strict, "strict", false, "-on-error abort と同じ")
+	fs.Int64Var(&job.TotalFrames, "total-frames", job.TotalFrames, "出力のフレーム数を指定した値に制限する (0は無制限)")
+	fs.IntVar(&job.GPU, "gpu", job.GPU, "エンコードに使用するGPUの番号 (nvenc/vaapi/qsv のみ)")
+	fs.StringVar(&o.fromManifest, "from-manifest", "", "以前の実行で書き出したマニフェストから入力順序と設定を再現する")
+	fs.BoolVar(&o.preflightOnly, "preflight-only", false, "エンコードせずに実行前の全ての確認を行い、結果を表示して終了する")
+	fs.BoolVar(&job.MotionOnly, "motion-only", job.MotionOnly, "各クリップのうち動きのある区間のみを結合する (シーン変化量による簡易的な検出)")
+	fs.Float64Var(&job.MotionThreshold, "motion-threshold", job.MotionThreshold, "-motion-only で動きとみなすシーン変化量の閾値 (0.0〜1.0)")
+	fs.Float64Var(&job.MotionMinLength, "motion-min-length", job.MotionMinLength, "-motion-only で残す区間の最小の長さ (秒)")
+	fs.StringVar(&job.DumpGraph, "dump-graph", job.DumpGraph, "フィルターグラフを書き出すパス (拡張子 .dot でGraphviz形式)")
+	fs.StringVar(&o.memLimit, "mem-limit", "", "ffmpegのメモリ使用量の上限 (例: 4G、Linuxのみ)")
+	fs.Float64Var(&o.cpuLimit, "cpu-limit", 0, "ffmpegが使用できるCPUコア数の上限 (例: 2.5、Linuxのcgroup v2のみ)")
+	fs.StringVar(&job.Fit, "fit", job.Fit, "出力と向き (縦長・横長) が異なるクリップの収め方 (pad: 余白を付ける、crop: はみ出す部分を切り取る、stretch: 引き伸ばす)")
+	fs.StringVar(&job.ScaleMode, "scale-mode", job.ScaleMode, "縦横比が出力と異なるクリップの収め方 (pad: 黒帯を付ける、crop: はみ出す部分を切り取る、stretch: 引き伸ばす)。向きが異なるクリップは -fit に従う")
+	fs.StringVar(&job.VFRPolicy, "vfr-policy", job.VFRPolicy, "可変フレームレートの入力 (スマートフォンの録画など) の扱い (cfr: -framerate の固定フレームレートに変換する、vsync-passthrough: 入力のタイムスタンプのまま出力する)。どちらも音声をタイムスタンプに同期させてずれを防ぐ")
+	fs.StringVar(&job.Tonemap, "tonemap", job.Tonemap, "HDR (HDR10、HLG) の入力の扱い (auto: 全て同じ種類のHDRなら色の情報を保持して10bitで出力し、SDRと混在する場合はSDRに変換する、sdr: 常にSDRに変換する、none: 変換しない)")
+	fs.BoolVar(&job.Deinterlace, "deinterlace", job.Deinterlace, "インターレースのクリップ (古いビデオカメラの映像など) をインターレース解除してから結合する (ffprobeが必要)")
+	fs.StringVar(&job.Denoise, "denoise", job.Denoise, "クリップのノイズを除去してから結合する (light, medium, strong)")
+	fs.BoolVar(&job.Stabilize, "stabilize", job.Stabilize, "クリップの手ぶれを補正してから結合する (vid.stabで揺れを解析してから補正する2パス処理、libvidstab付きのffmpegが必要)")
+	fs.StringVar(&job.CleanupInclude, "cleanup-include", job.CleanupInclude, "-deinterlace、-denoise、-stabilize を適用するクリップのglobパターン (カンマ区切り、省略時は全てのクリップ)")
+	fs.BoolVar(&job.OrientationGroups, "orientation-groups", job.OrientationGroups, "横長と縦長のクリップを分け、向きごとに別々の出力ファイルを作成する")
+	fs.Float64Var(&job.AVTolerance, "av-tolerance", job.AVTolerance, "クリップの映像と音声の長さのずれを補正する閾値 (秒、0で補正しない)")
+	fs.BoolVar(&job.NormalizeAudio, "normalize-audio", job.NormalizeAudio, "各クリップのラウドネスを測定し、-loudness-target に揃えるよう音量を補正する (EBU R128、ffprobeが必要)")
+	fs.Float64Var(&job.LoudnessTarget, "loudness-target", job.LoudnessTarget, "-normalize-audio の目標ラウドネス (LUFS)")
+	fs.StringVar(&job.Music, "music", job.Music, "結合した動画の全体に流すBGMの音声ファイル (動画の長さに合わせてループ・カットする、ffprobeが必要)")
+	fs.Float64Var(&job.MusicVolume, "music-volume", job.MusicVolume, "-music の音量の補正 (dB)")
+	fs.StringVar(&job.MusicMode, "music-mode", job.MusicMode, "-music の合成方法 (mix: 元の音声に重ねる、replace: 元の音声を置き換える)")
+	fs.BoolVar(&job.MusicDuck, "music-duck", job.MusicDuck, "元の音声がある間は -music の音量を下げる (ダッキング)")
+	fs.Float64Var(&job.MusicDuckRatio, "music-duck-ratio", job.MusicDuckRatio, "-music-duck でBGMを圧縮する比率 (1〜20、大きいほど強く下げる)")
+	fs.StringVar(&job.Watermark, "watermark", job.Watermark, "出力の全体に重ねるロゴ画像 (PNGなど、透過に対応)")
+	fs.StringVar(&job.WatermarkPosition, "watermark-position", job.WatermarkPosition, "-watermark の位置 (top-left, top-right, bottom-left, bottom-right, center)")
+	fs.Float64Var(&job.WatermarkOpacity, "watermark-opacity", job.WatermarkOpacity, "-watermark の不透明度 (0より大きく1以下)")
+	fs.IntVar(&job.WatermarkMargin, "watermark-margin", job.WatermarkMargin, "-watermark と画面の端との余白 (ピクセル)")
+	fs.BoolVar(&job.BurnTimestamp, "burn-timestamp", job.BurnTimestamp, "各クリップの録画日時 (撮影日時のメタデータ、無ければ更新日時から算出) を映像の左上に焼き込む (ffprobeが必要)")
+	fs.StringVar(&job.TimestampFormat, "timestamp-format", job.TimestampFormat, "-burn-timestamp の日時の書式 (strftime形式)")
+	fs.StringVar(&job.TimestampFont, "timestamp-font", job.TimestampFont, "-burn-timestamp で使うフォントファイル (省略時はffmpegの既定のフォント)")
+	fs.BoolVar(&job.TitleCards, "title-cards", job.TitleCards, "各クリップの前にファイル名と撮影日時を表示するタイトルカードを挿入する (ffmpegのdrawtextフィルターが必要)")
+	fs.Float64Var(&job.TitleCardDuration, "title-card-duration", job.TitleCardDuration, "-title-cards のタイトルカードを表示する秒数")
+	fs.StringVar(&job.TitleCardBackground, "title-card-background", job.TitleCardBackground, "-title-cards の背景色 (black、#202020 など)、または背景にする画像ファイル")
+	fs.StringVar(&job.TitleCardText, "title-card-text", job.TitleCardText, "-title-cards に表示する文字列 ({name}: ファイル名、{date}: 撮影日時、{index}: クリップの番号、\\n: 改行)")
+	fs.StringVar(&job.TitleCardDateFormat, "title-card-date-format", job.TitleCardDateFormat, "-title-cards の {date} の書式 (strftime形式の %Y %y %m %d %H %M %S %b %a)")
+	fs.StringVar(&job.TitleCardFont, "title-card-font", job.TitleCardFont, "-title-cards で使うフォントファイル (省略時はffmpegの既定のフォント)")
+	fs.StringVar(&job.TitleCardColor, "title-card-color", job.TitleCardColor, "-title-cards の文字の色")
+	fs.BoolVar(&job.ScrubSprites, "scrub-sprites", job.ScrubSprites, "完了後にシークプレビュー用のスプライトシートとWebVTTを作成する")
+	fs.Float64Var(&job.SpriteInterval, "sprite-interval", job.SpriteInterval, "-scrub-sprites のサムネイルの間隔 (秒)")
+	fs.IntVar(&job.SpriteWidth, "sprite-width", job.SpriteWidth, "-scrub-sprites のサムネイルの幅 (ピクセル)")
+	fs.IntVar(&job.SpriteColumns, "sprite-columns", job.SpriteColumns, "-scrub-sprites のスプライトシートの列数")
+	fs.StringVar(&job.Thumbnail, "thumbnail", job.Thumbnail, "完了後に出力の1フレームをサムネイル画像 (.jpg または .png) として書き出す")
+	fs.StringVar(&job.ThumbnailTime, "thumbnail-time", job.ThumbnailTime, "-thumbnail のフレームの時刻 (秒数、H:MM:SS、出力の長さに対する割合の 50% など。負の秒数は末尾から)")
+	fs.StringVar(&job.ContactSheet, "contact-sheet", job.ContactSheet, "完了後に出力の全体から等間隔に抜き出したフレームを格子状に並べた画像 (.jpg または .png) を書き出す")
+	fs.IntVar(&job.ContactSheetColumns, "contact-sheet-columns", job.ContactSheetColumns, "-contact-sheet の列数")
+	fs.IntVar(&job.ContactSheetRows, "contact-sheet-rows", job.ContactSheetRows, "-contact-sheet の行数")
+	fs.IntVar(&job.ContactSheetWidth, "contact-sheet-width", job.ContactSheetWidth, "-contact-sheet の1コマの幅 (ピクセル)")
+	fs.StringVar(&o.configPath, "config", "", "オプションを記述した設定ファイル (YAML または .toml)。コマンドラインで指定したオプションが優先される")
+	fs.StringVar(&o.recipeName, "recipe", "", "レシピファイルに定義したオプションの組み合わせを適用する")
+	fs.StringVar(&o.recipePath, "recipe-file", defaultRecipePath(), "レシピファイルのパス")
+	fs.BoolVar(&o.listRecipes, "list-recipes", false, "レシピの一覧を表示して終了する")
+	fs.BoolVar(&job.Normalize, "normalize", job.Normalize, "各クリップを -jobs 個並列に同じ形式の中間ファイルへエンコードしてから、ストリームコピーで結合する")
+	fs.BoolVar(&o.useCache, "cache", false, "-normalize の中間ファイルを -cache-dir に残し、次回以降の実行で同じ入力・設定の区間のエンコードを省略する")
+	fs.StringVar(&o.cacheDir, "cache-dir", concator.DefaultCacheDir(), "-cache で中間ファイルを保存するディレクトリ")
+	fs.BoolVar(&job.Checkpoint, "checkpoint", job.Checkpoint, "クリップごとに中間ファイルへエンコードし、中断後の再実行で完了済みの区間を再利用する")
+	fs.DurationVar(&job.StatsPeriod, "stats-period", job.StatsPeriod, "進捗の表示間隔 (例: 1s, 30s)。0の場合は端末では1秒、それ以外では10秒")
+	fs.BoolVar(&job.ScenesMontage, "scenes-montage", job.ScenesMontage, "シーンの切り替わりごとに1フレームを並べた短いダイジェスト映像を出力する")
+	fs.Float64Var(&job.SceneThreshold, "scene-threshold", job.SceneThreshold, "-scenes-montage でシーンの切り替わりとみなす変化量の閾値 (0.0〜1.0)")
+	fs.Float64Var(&job.SceneHold, "scene-hold", job.SceneHold, "-scenes-montage で各フレームを表示する時間 (秒)")
+	fs.BoolVar(&job.DryRun, "dry-run", job.DryRun, "結合するファイルの順序と実行するffmpegコマンドを表示し、エンコードせずに終了する")
+	fs.BoolVar(&job.Interactive, "interactive", job.Interactive, "エンコード前にクリップの長さと解像度の一覧を表示し、順序の入れ替え・除外・ffplayでの再生を対話的に行ってから結合する")
+	fs.StringVar(&job.Format, "format", job.Format, "出力形式 (file: 1つの動画ファイル、hls: -output の .m3u8 とセグメント、dash: -output の .mpd とセグメント)")
+	fs.Float64Var(&job.SegmentDuration, "segment-duration", job.SegmentDuration, "-format hls、dash の1セグメントの長さ (秒)")
+	fs.BoolVar(&job.MasterPlaylist, "master-playlist", job.MasterPlaylist, "-format hls で、プレイリストと同じディレクトリにマスタープレイリスト (<名前>_master.m3u8) も書き出す")
+	fs.StringVar(&job.Renditions, "renditions", job.Renditions, "1回の読み込みで同時に出力する解像度のカンマ区切りの一覧 (例: 1080p,720p,480p または 1280x720)。file では <名前>_720p.mp4 のように解像度ごとのファイル、hls では -output をマスタープレイリストとして書き出す")
+	fs.BoolVar(&job.Force, "force", job.Force, "出力サイズの見積もりが出力先の空き容量を超える場合も、中止せずに警告を表示して続行する")
+	fs.BoolVar(&job.Overwrite, "overwrite", job.Overwrite, "出力ファイルが既に存在する場合も、確認せずに上書きする (指定しない場合は端末では確認し、それ以外ではエラーにする)")
+	fs.BoolVar(&job.OutputSuffix, "output-suffix", job.OutputSuffix, "出力ファイルが既に存在する場合は、_1、_2 などの連番を付けた名前で出力する")
+	fs.StringVar(&job.PreHook, "pre-hook", job.PreHook, "入力の検索の前に実行するシェルのコマンド (例: ストレージのマウント)。失敗した場合は結合しない。環境変数 VIDEO_CONCATOR_OUTPUT、VIDEO_CONCATOR_DIR を渡す")
+	fs.StringVar(&job.PostHook, "post-hook", job.PostHook, "完了後に成功・失敗に関わらず実行するシェルのコマンド (例: rcloneでのアップロード)。環境変数 VIDEO_CONCATOR_STATUS (success, failure, interrupted)、VIDEO_CONCATOR_OUTPUT、VIDEO_CONCATOR_DURATION (秒)、VIDEO_CONCATOR_ERROR を渡す")
+	fs.StringVar(&job.NotifyURL, "notify-url", job.NotifyURL, "完了・失敗時に結果 (status、output、duration、error) をJSONでPOSTするWebhookのURL")
+	fs.StringVar(&job.NotifyFormat, "notify-format", job.NotifyFormat, "-notify-url に送る形式 (auto: URLから判定、generic: 結果のJSON、slack: SlackのIncoming Webhook、discord: DiscordのWebhook)")
+	fs.BoolVar(&job.Copy, "copy", job.Copy, "再エンコードせずにストリームコピーで結合する (全ての入力のコーデックと解像度が一致している必要がある)")
+	fs.StringVar(&job.Transition, "transition", job.Transition, "クリップ間のトランジション (xfade: 前後のクリップを重ねて切り替える)。省略時は単純に結合する")
+	fs.StringVar(&job.TransitionEffect, "transition-effect", job.TransitionEffect, "-transition xfade の効果 (fade, dissolve, wipeleft, slideright など)")
+	fs.DurationVar(&job.TransitionDuration, "transition-duration", job.TransitionDuration, "-transition の長さ (例: 1s, 500ms)")
+	fs.DurationVar(&job.FadeIn, "fade-in", job.FadeIn, "出力の先頭で黒と無音からフェードインする長さ (例: 1s)")
+	fs.DurationVar(&job.FadeOut, "fade-out", job.FadeOut, "出力の末尾で黒と無音へフェードアウトする長さ (例: 2s)")
+	fs.BoolVar(&o.jsonEvents, "json", false, "入力の一覧・各入力の情報・進捗・完了時の結果を1行に1つのJSONとして標準出力に書き出す (ログは標準エラー出力のまま)")
+	fs.BoolVar(&job.Progress, "progress", job.Progress, "ffmpegのログの代わりに進捗率・速度・残り時間を表示する (ffprobeが必要)")
+	// watch でのみ使うが、同じ設定ファイルを concat と watch の両方で読み込めるよう共通で定義する
+	fs.DurationVar(&job.WatchSettle, "watch-settle", job.WatchSettle, "watch で新しいファイルの書き込みが止まってから再結合するまでの待機時間")
+	return fs, o
+}
+
+// parseConcatArgs は引数を解析し、設定ファイルとレシピを反映したオプションを返す
+func parseConcatArgs(name string, args []string) (*flag.FlagSet, *concatOptions) {
+	fs, o := newConcatFlags(name)
+	fs.Parse(args)
+	// コマンドラインで指定したオプションは、設定ファイルやレシピより優先する
+	cliFlags := setFlagNames(fs)
+	// 引数で指定されたファイルは指定順に結合する
+	o.job.Files = fs.Args()
+
+	// 設定ファイルの読み込み
+	if o.configPath != "" {
+		values, err := loadConfig(o.configPath)
+		if err != nil {
+			fatalf("設定ファイルの読み込みに失敗しました: %v", err)
+		}
+		if err := applyFlagValues(fs, values, cliFlags, "設定ファイル"); err != nil {
+			fatalf("エラー: %v", err)
+		}
+	}
+
+	// レシピの読み込み (レシピの値は設定ファイルより優先する)
+	if o.listRecipes || o.recipeName != "" {
+		recipes, err := loadRecipes(o.recipePath)
+		if err != nil {
+			fatalf("レシピファイルの読み込みに失敗しました: %v", err)
+		}
+		if o.listRecipes {
+			printRecipes(recipes)
+			os.Exit(0)
+		}
+		recipe, ok := recipes[o.recipeName]
+		if !ok {
+			fatalf("エラー: レシピ '%s' が %s に見つかりません。", o.recipeName, o.recipePath)
+		}
+		if err := applyRecipe(fs, recipe, cliFlags); err != nil {
+			fatalf("エラー: %v", err)
+		}
+		// レシピの引数の後にコマンドラインや設定ファイルの -ff-output-args を続ける
+		o.job.ExtraArgs = append(slices.Clone(recipe.FFmpegArgs), o.job.ExtraArgs...)
+	}
+	applyCommonFlags()
+	return fs, o
+}
+
+// prepareJob はジョブに対応しないオプションを確認し、ジョブに反映する
+func prepareJob(fs *flag.FlagSet, o *concatOptions) *concator.Job {
+	job := o.job
+	if o.useCache {
+		if !job.Normalize {
+			fmt.Println("エラー: -cache は -normalize と一緒に指定してください。")
+			fs.Usage()
+			os.Exit(1)
+		}
+		job.CacheDir = o.cacheDir
+	}
+	if o.strict {
+		job.OnError = "abort"
+	}
+	if o.jsonEvents {
+		if job.Describe || job.DryRun || o.preflightOnly {
+			fmt.Println("エラー: -json は -describe、-dry-run、-preflight-only と同時に指定できません。")
+			fs.Usage()
+			os.Exit(1)
+		}
+		job.Events = concator.NewEventWriter(os.Stdout)
+	}
+
+	// 必須引数のチェック
+	checkInputFlags(fs, job, o.fromManifest != "")
+	if job.Output == "" {
+		fmt.Println("エラー: -output は必須です。")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// マニフェストの読み込み (明示的に指定されたフラグはマニフェストの設定より優先する)
+	if o.fromManifest != "" {
+		manifest, err := concator.LoadManifest(o.fromManifest)
+		if err != nil {
+			fatalf("マニフェストの読み込みに失敗しました: %v", err)
+		}
+		setFlags := setFlagNames(fs)
+		ms := manifest.Settings
+		if !setFlags["resolution"] && ms.Resolution != "" {
+			job.Resolution = ms.Resolution
+		}
+		if !setFlags["framerate"] && ms.Framerate != 0 {
+			job.Framerate = ms.Framerate
+		}
+		if !setFlags["encoder"] && ms.Encoder != "" {
+			job.Encoder = ms.Encoder
+		}
+		if !setFlags["poster"] && ms.Poster != "" {
+			job.Poster = ms.Poster
+		}
+		if ms.Transition != "" {
+			if !setFlags["transition"] {
+				job.Transition = "xfade"
+			}
+			if !setFlags["transition-effect"] {
+				job.TransitionEffect = ms.Transition
+			}
+			if !setFlags["transition-duration"] && ms.TransitionDuration > 0 {
+				job.TransitionDuration = time.Duration(ms.TransitionDuration * float64(time.Second))
+			}
+		}
+		job.Manifest = manifest
+		job.ManifestPath = o.fromManifest
+	}
+
+	// リソース上限の確認
+	if o.memLimit != "" {
+		var err error
+		job.Limits.MemoryBytes, err = concator.ParseByteSize(o.memLimit)
+		if err != nil {
+			fatalf("エラー: %v", err)
+		}
+	}
+	job.Limits.CPUs = o.cpuLimit
+
+	// 事前確認のみを行って終了
+	if o.preflightOnly {
+		ok, err := job.Preflight()
+		if err != nil {
+			fatalf("エラー: %v", err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	return job
+}
+
+// runWithSignals はSIGINT/SIGTERMを受け取ったら実行中のffmpegを終了させ、書きかけの出力を削除する
+// 失敗した場合は -json のイベントとしてもエラーを書き出す
+func runWithSignals(run func(ctx context.Context) error, events *concator.EventWriter) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := run(ctx)
+	if ctx.Err() != nil {
+		events.Error(ctx.Err())
+		infof("中断されました。")
+		os.Exit(exitInterrupted)
+	}
+	if err != nil {
+		events.Error(err)
+		fatalf("エラー: %v", err)
+	}
+}
+
+// runConcat は concat サブコマンドを実行する
+func runConcat(args []string) {
+	job := prepareJob(parseConcatArgs("concat", args))
+	runWithSignals(job.Run, job.Events)
+}
+
+// runWatch は watch サブコマンドを実行する
+func runWatch(args []string) {
+	job := prepareJob(parseConcatArgs("watch", args))
+	runWithSignals(job.Watch, job.Events)
+}
+
+// runConfig は config サブコマンドを実行する
+func runConfig(args []string) {
+	fs, _ := parseConcatArgs("config", args)
+	if err := dumpConfig(fs, os.Stdout); err != nil {
+		fatalf("設定の表示に失敗しました: %v", err)
+	}
+}
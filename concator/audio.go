@@ -0,0 +1,111 @@
+package concator
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultAudioSampleRate は音声形式を揃える際のサンプルレート
+const defaultAudioSampleRate = 48000
+
+// hasMixedAudioLayouts は入力ファイルの音声のチャンネルレイアウトまたはサンプルレートが混在しているかを返す
+func hasMixedAudioLayouts(files []string) (bool, error) {
+	var first *AudioFormat
+	for _, file := range files {
+		format, err := probeAudioFormat(file)
+		if err != nil {
+			return false, err
+		}
+		if format == nil {
+			continue
+		}
+		if first == nil {
+			first = format
+			continue
+		}
+		if format.ChannelLayout != first.ChannelLayout || format.Channels != first.Channels || format.SampleRate != first.SampleRate {
+			infof("音声形式が混在しています: %s (%s, %dHz)、最初のファイルは %s, %dHz",
+				file, format.ChannelLayout, format.SampleRate, first.ChannelLayout, first.SampleRate)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// buildAudioNormalizeFilter は全クリップの音声を指定したチャンネルレイアウトに揃えるフィルターを返す
+func buildAudioNormalizeFilter(layout string) string {
+	return fmt.Sprintf("aresample=%d,aformat=channel_layouts=%s:sample_rates=%d:sample_fmts=fltp",
+		defaultAudioSampleRate, layout, defaultAudioSampleRate)
+}
+
+// balanceAVDurations は映像と音声の長さがtolerance秒以上ずれているクリップについて、
+// 長い方のストリームを短い方に合わせてoutpointで切り詰める
+// 各クリップの長さを揃えることで、多数のクリップを結合した際の音ズレの蓄積を防ぐ
+func balanceAVDurations(entries []ConcatEntry, tolerance float64) error {
+	for i := range entries {
+		if entries[i].Outpoint > 0 {
+			// 既に区間が指定されているエントリは対象外
+			continue
+		}
+		video, audio, err := probeStreamDurations(entries[i].Path)
+		if err != nil {
+			return err
+		}
+		if video == 0 || audio == 0 || math.Abs(video-audio) < tolerance {
+			continue
+		}
+		shorter := min(video, audio)
+		warnf("映像と音声の長さが異なるため %.3f秒に揃えます: %s (映像 %.3f秒、音声 %.3f秒)",
+			shorter, filepath.Base(entries[i].Path), video, audio)
+		entries[i].Outpoint = shorter
+	}
+	return nil
+}
+
+// audioCopyCodecs は出力コンテナごとに、再エンコードせずに格納できる音声コーデック
+// Matroska は任意のコーデックを格納できるため含めない
+var audioCopyCodecs = map[string][]string{
+	".mp4":  {"aac", "mp3", "ac3", "eac3", "alac", "flac", "opus"},
+	".m4v":  {"aac", "mp3", "ac3", "eac3", "alac", "flac", "opus"},
+	".mov":  {"aac", "mp3", "ac3", "eac3", "alac", "pcm_s16le", "pcm_s16be", "pcm_s24le", "pcm_s24be"},
+	".avi":  {"mp3", "ac3", "aac", "pcm_s16le"},
+	".webm": {"opus", "vorbis"},
+}
+
+// audioCopyIncompatibility は入力の音声を再エンコードせずに出力へコピーできない理由を返す
+// コピーできる場合は空文字列を返す
+func audioCopyIncompatibility(files []string, output string) (string, error) {
+	codec := ""
+	for _, file := range files {
+		format, err := probeAudioFormat(file)
+		if err != nil {
+			return "", err
+		}
+		if format == nil {
+			continue
+		}
+		if codec == "" {
+			codec = format.Codec
+		} else if format.Codec != codec {
+			return fmt.Sprintf("音声コーデックが混在している (%s と %s)", codec, format.Codec), nil
+		}
+	}
+	if codec == "" {
+		return "", nil
+	}
+	ext := strings.ToLower(filepath.Ext(output))
+	if ext == ".mkv" {
+		return "", nil
+	}
+	codecs, ok := audioCopyCodecs[ext]
+	if !ok {
+		return fmt.Sprintf("出力形式 '%s' が %s を格納できるか確認できない", ext, codec), nil
+	}
+	if !slices.Contains(codecs, codec) {
+		return fmt.Sprintf("出力形式 '%s' は %s を格納できない", ext, codec), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,55 @@
+package concator
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// blackRegionPattern はblackdetectフィルターのログから黒画面区間を抽出する正規表現
+var blackRegionPattern = regexp.MustCompile(`black_start:\s*([0-9.]+)\s+black_end:\s*([0-9.]+)`)
+
+// blackEdgeTolerance は黒画面区間がクリップの先頭・末尾に接しているとみなす誤差 (秒)
+const blackEdgeTolerance = 0.1
+
+// detectBlackTrim はblackdetectでクリップ先頭・末尾の黒画面区間を検出し、
+// それを除外するためのinpointとoutpointを返す。除外する区間が無い場合はそれぞれ0を返す
+func detectBlackTrim(path string, threshold, minDuration float64, limits ResourceLimits) (inpoint, outpoint float64, err error) {
+	duration, err := probeDuration(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(
+		ffmpegPath,
+		"-hide_banner",
+		"-i", path,
+		"-vf", fmt.Sprintf("blackdetect=d=%g:pix_th=%g", minDuration, threshold),
+		"-an",
+		"-f", "null",
+		"-",
+	)
+	cmd.Stderr = &stderr
+	if err := runLimited(cmd, limits); err != nil {
+		return 0, 0, fmt.Errorf("黒画面の検出に失敗しました: %s, %v", path, err)
+	}
+
+	for _, m := range blackRegionPattern.FindAllStringSubmatch(stderr.String(), -1) {
+		start, _ := strconv.ParseFloat(m[1], 64)
+		end, _ := strconv.ParseFloat(m[2], 64)
+		if start <= blackEdgeTolerance {
+			inpoint = end
+		}
+		if end >= duration-blackEdgeTolerance {
+			outpoint = start
+		}
+	}
+	// クリップ全体が黒画面の場合はトリミングしない
+	if outpoint != 0 && outpoint <= inpoint {
+		return 0, 0, nil
+	}
+	return inpoint, outpoint, nil
+}
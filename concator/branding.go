@@ -0,0 +1,36 @@
+package concator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// resolveBrandingClip はイントロ・アウトロのクリップを絶対パスに変換し、結合できるかを確認する
+// pathが空の場合はnilを返す
+func resolveBrandingClip(path, flagName string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("絶対パスの取得に失敗しました: %s, %v", path, err)
+	}
+	if isFFprobeAvailable() {
+		if reason := checkInput(absPath); reason != "" {
+			return nil, fmt.Errorf("%s のファイルを結合できません: %s (%s)", flagName, path, reason)
+		}
+	} else if _, err := os.Stat(absPath); err != nil {
+		return nil, fmt.Errorf("%s のファイルを開けません: %v", flagName, err)
+	}
+	return []string{absPath}, nil
+}
+
+// fileEntries はファイル全体を結合するconcatリストのエントリを返す
+func fileEntries(files []string) []ConcatEntry {
+	entries := make([]ConcatEntry, len(files))
+	for i, file := range files {
+		entries[i] = ConcatEntry{Path: file}
+	}
+	return entries
+}
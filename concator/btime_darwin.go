@@ -0,0 +1,19 @@
+//go:build darwin
+
+package concator
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// getBirthTime はstat構造体のBirthtimespecからファイルの作成日時を取得する
+func getBirthTime(path string, info os.FileInfo) (time.Time, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: %s", errBirthTimeUnavailable, path)
+	}
+	return time.Unix(stat.Birthtimespec.Sec, stat.Birthtimespec.Nsec), nil
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package concator
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// getBirthTime はstatxシステムコールでファイルの作成日時(btime)を取得する
+// カーネルやファイルシステムがbtimeに対応していない場合はerrBirthTimeUnavailableを返す
+func getBirthTime(path string, _ os.FileInfo) (time.Time, error) {
+	var stx unix.Statx_t
+	err := unix.Statx(unix.AT_FDCWD, path, unix.AT_STATX_SYNC_AS_STAT, unix.STATX_BTIME, &stx)
+	if err != nil {
+		if err == unix.ENOSYS {
+			// statx自体が存在しない古いカーネル (Linux 4.11未満)
+			return time.Time{}, fmt.Errorf("%w: %s (statxが利用できないカーネルです)", errBirthTimeUnavailable, path)
+		}
+		return time.Time{}, fmt.Errorf("statxに失敗しました: %s, %v", path, err)
+	}
+	// statxは要求されたフィールドを返せない場合、maskからそのビットを落とす
+	if stx.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}, fmt.Errorf("%w: %s", errBirthTimeUnavailable, path)
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), nil
+}
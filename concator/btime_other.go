@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !windows
+
+package concator
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// getBirthTime はこのOSではファイルの作成日時を取得できないため常にエラーを返す
+func getBirthTime(path string, _ os.FileInfo) (time.Time, error) {
+	return time.Time{}, fmt.Errorf("%w: %s (%sは未対応です)", errBirthTimeUnavailable, path, runtime.GOOS)
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package concator
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// getBirthTime はWin32のファイル属性からファイルの作成日時を取得する
+func getBirthTime(path string, info os.FileInfo) (time.Time, error) {
+	attr, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: %s", errBirthTimeUnavailable, path)
+	}
+	return time.Unix(0, attr.CreationTime.Nanoseconds()), nil
+}
@@ -0,0 +1,72 @@
+package concator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fingerprintSampleSize はファイルの内容のハッシュに使う先頭・末尾それぞれのバイト数
+// 数GBの動画全体を読むと時間がかかるため、サイズと先頭・末尾の内容で同一性を判定する
+const fingerprintSampleSize = 8 << 20
+
+// DefaultCacheDir は中間ファイルのキャッシュを置くユーザーのキャッシュディレクトリを返す
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "video_concator", "segments")
+}
+
+// contentFingerprint はファイルのサイズと先頭・末尾の内容からハッシュを計算する
+// ファイルの移動や名前の変更、更新日時の変化では値が変わらない
+func contentFingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintln(h, info.Size())
+	if _, err := io.CopyN(h, f, fingerprintSampleSize); err != nil && err != io.EOF {
+		return "", err
+	}
+	if info.Size() > 2*fingerprintSampleSize {
+		if _, err := f.Seek(-fingerprintSampleSize, io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// segmentCacheKey は入力の内容と区間、エンコード設定から中間ファイルのキャッシュのキーを求める
+// 同じ入力を同じ設定でエンコードした中間ファイルは、出力先や他の入力に関わらず再利用できる
+func segmentCacheKey(job EncodeJob) (string, error) {
+	h := sha256.New()
+	fmt.Fprintln(h, applyOverlays(job.VideoFilter, job), job.AudioFilter, job.Encoder, strings.Join(job.RateControlArgs, " "), strings.Join(job.GPUArgs.Output, " "), strings.Join(job.ExtraArgs, " "))
+	if job.NoAudio || job.AudioCopy {
+		// 音声を再エンコードする場合はキーを変えない (以前のキャッシュを引き続き使えるようにする)
+		fmt.Fprintln(h, job.NoAudio, job.AudioCopy)
+	}
+	for _, e := range job.Entries {
+		fp, err := contentFingerprint(e.Path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(h, fp, e.Inpoint, e.Outpoint, e.Gain)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32], nil
+}
@@ -0,0 +1,97 @@
+package concator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// chapterLinePattern はYouTube形式のチャプター行 ("0:00 Intro"、"1:02:03 - Part" など) にマッチする正規表現
+var chapterLinePattern = regexp.MustCompile(`^\s*[\[(]?(\d{1,2}(?::\d{1,2}){1,2})[\])]?\s*[-–—|:]?\s*(.*)$`)
+
+// PastedChapter はチャプター一覧の1行分
+type PastedChapter struct {
+	Start float64
+	Title string
+}
+
+// parseChapterTimestamp は "M:SS" または "H:MM:SS" 形式の時刻を秒数に変換する
+func parseChapterTimestamp(s string) (float64, error) {
+	var seconds float64
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("時刻の形式が正しくありません: %s", s)
+		}
+		seconds = seconds*60 + float64(n)
+	}
+	return seconds, nil
+}
+
+// parseChapterPaste はYouTube形式のチャプター一覧を読み込み、開始時刻順に並べて返す
+// 時刻で始まらない行は無視する
+func parseChapterPaste(path string) ([]PastedChapter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var chapters []PastedChapter
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\uFEFF"))
+		if line == "" {
+			continue
+		}
+		m := chapterLinePattern.FindStringSubmatch(line)
+		if m == nil {
+			warnf("チャプターとして解釈できない行を無視します (%d行目): %s", lineNo, line)
+			continue
+		}
+		start, err := parseChapterTimestamp(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("%d行目: %v", lineNo, err)
+		}
+		chapters = append(chapters, PastedChapter{Start: start, Title: strings.TrimSpace(m[2])})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(chapters) == 0 {
+		return nil, fmt.Errorf("チャプターが見つかりません: %s", path)
+	}
+	sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].Start < chapters[j].Start })
+	return chapters, nil
+}
+
+// buildChapterEntries は1つの動画をチャプターごとの仮想クリップに分割し、
+// selectionで指定された順序 (1始まりの番号、カンマ区切り) でconcatリストのエントリを返す
+// selectionが空の場合は全てのチャプターを時刻順に並べる
+func buildChapterEntries(source string, chapters []PastedChapter, selection string) ([]ConcatEntry, error) {
+	all := make([]ConcatEntry, len(chapters))
+	for i, ch := range chapters {
+		all[i] = ConcatEntry{Path: source, Inpoint: ch.Start, Title: ch.Title}
+		if i+1 < len(chapters) {
+			all[i].Outpoint = chapters[i+1].Start
+		}
+	}
+	if selection == "" {
+		return all, nil
+	}
+
+	var entries []ConcatEntry
+	for _, field := range strings.Split(selection, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 || n > len(all) {
+			return nil, fmt.Errorf("チャプター番号が正しくありません: %s (1〜%d)", field, len(all))
+		}
+		entries = append(entries, all[n-1])
+		debugf("チャプター %d: %s", n, chapters[n-1].Title)
+	}
+	return entries, nil
+}
@@ -0,0 +1,116 @@
+package concator
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Chapter は出力動画内の1クリップ分の区間を表す構造体
+type Chapter struct {
+	Title string
+	Start float64 // 開始時刻 (秒)
+	End   float64 // 終了時刻 (秒)
+}
+
+// computeChapters は各エントリの長さを累積し、クリップごとのチャプターを計算する
+// overlapはトランジションで隣り合うクリップが重なる長さ(秒)で、重なりの中間をチャプターの境界とする
+// タイトルはエントリのタイトル (無ければファイル名) で、同じタイトルのクリップは連番を付けて区別する
+func computeChapters(entries []ConcatEntry, overlap float64) ([]Chapter, error) {
+	durations, err := entryDurations(entries)
+	if err != nil {
+		return nil, err
+	}
+	var chapters []Chapter
+	seen := map[string]int{}
+	var offset float64
+	for i, entry := range entries {
+		title := entry.Title
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(entry.Path), filepath.Ext(entry.Path))
+		}
+		seen[title]++
+		if n := seen[title]; n > 1 {
+			title = fmt.Sprintf("%s (%d)", title, n)
+		}
+		start, end := offset, offset+durations[i]
+		if i > 0 {
+			start += overlap / 2
+		}
+		if i < len(entries)-1 {
+			end -= overlap / 2
+		}
+		chapters = append(chapters, Chapter{Title: title, Start: start, End: end})
+		offset += durations[i] - overlap
+	}
+	return chapters, nil
+}
+
+// chapterContainer は出力形式がffmetadataのチャプターを格納できるかを返す
+func chapterContainer(outputFile string) bool {
+	switch strings.ToLower(filepath.Ext(outputFile)) {
+	case ".mp4", ".m4v", ".mov", ".mkv":
+		return true
+	default:
+		return false
+	}
+}
+
+// escapeFFMetadata はffmetadata形式で特別な意味を持つ文字をエスケープする
+func escapeFFMetadata(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "=", "\\=", ";", "\\;", "#", "\\#", "\n", "\\\n").Replace(s)
+}
+
+// formatFFMetadataChapters はチャプターをffmetadata形式に変換する
+func formatFFMetadataChapters(chapters []Chapter) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, ch := range chapters {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(math.Round(ch.Start*1000)), int64(math.Round(ch.End*1000)), escapeFFMetadata(ch.Title))
+	}
+	return b.String()
+}
+
+// createChapterMetadataFile は出力に埋め込むチャプターを一時的なffmetadataファイルに書き出す
+func createChapterMetadataFile(chapters []Chapter) (string, error) {
+	tempFile, err := os.CreateTemp("", "chapters-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer tempFile.Close()
+
+	if _, err := tempFile.WriteString(formatFFMetadataChapters(chapters)); err != nil {
+		os.Remove(tempFile.Name())
+		return "", err
+	}
+	return tempFile.Name(), nil
+}
+
+// formatVTTTimestamp は秒数をWebVTTのタイムスタンプ形式 (HH:MM:SS.mmm) に変換する
+func formatVTTTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	h := ms / 3600000
+	m := ms % 3600000 / 60000
+	s := ms % 60000 / 1000
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms%1000)
+}
+
+// writeWebVTTChapters はチャプターをWebVTTのチャプターファイルとして書き出す
+func writeWebVTTChapters(path string, chapters []Chapter) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprint(writer, "WEBVTT\n")
+	for i, ch := range chapters {
+		fmt.Fprintf(writer, "\n%d\n%s --> %s\n%s\n", i+1, formatVTTTimestamp(ch.Start), formatVTTTimestamp(ch.End), ch.Title)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,93 @@
+package concator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkpointDir は出力と設定から決まるチェックポイント用の一時ディレクトリのパスを返す
+// 同じ出力・入力・設定で再実行した場合は同じディレクトリになる
+func checkpointDir(job EncodeJob) string {
+	h := sha256.New()
+	fmt.Fprintln(h, job.Output, applyOverlays(job.VideoFilter, job), job.AudioFilter, job.Encoder, strings.Join(job.RateControlArgs, " "), strings.Join(job.ExtraArgs, " "))
+	if job.NoAudio || job.AudioCopy {
+		fmt.Fprintln(h, job.NoAudio, job.AudioCopy)
+	}
+	for _, e := range job.Entries {
+		fmt.Fprintln(h, e.Path, e.Inpoint, e.Outpoint, e.Gain)
+		if e.VideoFilter != "" || e.AudioFilter != "" {
+			// クリップ固有のフィルターが無い場合はキーを変えない
+			fmt.Fprintln(h, e.VideoFilter, e.AudioFilter)
+		}
+	}
+	return filepath.Join(os.TempDir(), "video_concator-checkpoint-"+hex.EncodeToString(h.Sum(nil))[:16])
+}
+
+// segmentJob は1クリップ分を中間ファイルへエンコードする設定を返す
+// 中間ファイルは後でストリームコピーで結合するため、出力全体に対する設定は適用しない
+func segmentJob(job EncodeJob, entry ConcatEntry, output string) EncodeJob {
+	segJob := job
+	segJob.Entries = []ConcatEntry{entry}
+	segJob.Output = output
+	segJob.VideoFilter = joinFilters(entry.VideoFilter, job.VideoFilter)
+	segJob.AudioFilter = joinFilters(entry.AudioFilter, job.AudioFilter)
+	segJob.Poster, segJob.PosterMode = "", ""
+	segJob.TotalFrames = 0
+	segJob.SubtitleCodec = ""
+	segJob.SubtitleFile, segJob.BurnSubtitles = "", false
+	segJob.ChaptersFile = ""
+	segJob.Transition = ""
+	segJob.Music = nil
+	segJob.Streaming = nil
+	segJob.Renditions = nil
+	segJob.FadeIn, segJob.FadeOut = 0, 0
+	return segJob
+}
+
+// runCheckpointEncode はクリップごとに中間ファイルへエンコードしてから、それらをストリームコピーで結合する
+// 完了した中間ファイルは再実行時に再利用されるため、途中で中断しても残りの区間だけをエンコードすれば済む
+func runCheckpointEncode(ctx context.Context, job EncodeJob) error {
+	dir := checkpointDir(job)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	debugf("チェックポイントのディレクトリ: %s", dir)
+
+	var segments []string
+	for i, entry := range job.Entries {
+		segment := filepath.Join(dir, fmt.Sprintf("segment_%04d.mkv", i))
+		segments = append(segments, segment)
+		if _, err := os.Stat(segment); err == nil {
+			infof("区間 %d/%d は完了済みのためスキップします。", i+1, len(job.Entries))
+			continue
+		}
+
+		infof("区間 %d/%d をエンコード中: %s", i+1, len(job.Entries), filepath.Base(entry.Path))
+		// 中断時に不完全なファイルが完了済みと誤認されないよう、一時的な名前で書き出してから名前を変更する
+		partial := segment + ".partial.mkv"
+		segJob := segmentJob(job, entry, partial)
+		segmentFade(&segJob, job, i)
+		if err := runEncode(ctx, segJob); err != nil {
+			os.Remove(partial)
+			return fmt.Errorf("区間 %d のエンコードに失敗しました: %v", i+1, err)
+		}
+		if err := os.Rename(partial, segment); err != nil {
+			return err
+		}
+	}
+
+	infof("中間ファイルを結合中...")
+	entries := make([]ConcatEntry, len(segments))
+	for i, segment := range segments {
+		entries[i] = ConcatEntry{Path: segment}
+	}
+	if err := concatCopy(ctx, entries, job.Output, job.EOL, nil, job.MetadataArgs, job.Limits); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,237 @@
+package concator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// deinterlaceFilter はインターレースのクリップを、フレームレートを変えずにインターレース解除するフィルター
+// コンテナによってはフレームにインターレースの情報が付いていないため、ffprobeで判定したクリップの全てのフレームに適用する
+const deinterlaceFilter = "bwdif=mode=send_frame:deint=all"
+
+// denoiseFilters は -denoise の強さごとのノイズ除去のフィルター (hqdn3d)
+var denoiseFilters = map[string]string{
+	"light":  "hqdn3d=2:1.5:3:2.25",
+	"medium": "hqdn3d=4:3:6:4.5",
+	"strong": "hqdn3d=8:6:12:9",
+}
+
+// stabilizeDetectArgs と stabilizeTransformArgs は vid.stab の解析と補正の設定
+// 補正で生じる画面の端の欠けは拡大して隠し、拡大によるぼやけをunsharpで補う
+const (
+	stabilizeDetectArgs    = "shakiness=5:accuracy=15"
+	stabilizeTransformArgs = "smoothing=30:optzoom=1:interpol=bicubic"
+	stabilizeSharpen       = "unsharp=5:5:0.8:3:3:0.4"
+)
+
+// shakeDetection は手ぶれ補正の1パス目 (揺れの解析) で解析するクリップと、結果を書き出すファイル
+type shakeDetection struct {
+	Entry  ConcatEntry // 補正するクリップ (VideoFilter は解析の前に適用するフィルター)
+	Result string      // 解析結果の .trf ファイル
+}
+
+// cleanupFilters は -deinterlace、-denoise、-stabilize が指定されているかを返す
+func (j *Job) cleanupFilters() bool {
+	return j.Deinterlace || j.Denoise != "" || j.Stabilize
+}
+
+// checkCleanup は -deinterlace、-denoise、-stabilize、-cleanup-include の指定と、必要なフィルターを確認する
+func (j *Job) checkCleanup() error {
+	if j.Denoise != "" && denoiseFilters[j.Denoise] == "" {
+		return fmt.Errorf("-denoise には light、medium、strong のいずれかを指定してください: %s", j.Denoise)
+	}
+	if _, err := splitPatterns(j.CleanupInclude); err != nil {
+		return fmt.Errorf("-cleanup-include: %v", err)
+	}
+	if !j.cleanupFilters() {
+		return nil
+	}
+	if j.Copy {
+		return errors.New("-deinterlace、-denoise、-stabilize は -copy と同時に指定できません。")
+	}
+	if j.Deinterlace && !isFFprobeAvailable() {
+		return errors.New("-deinterlace にはffprobeが必要です。")
+	}
+	var names []string
+	if j.Deinterlace {
+		names = append(names, "bwdif")
+	}
+	if j.Denoise != "" {
+		names = append(names, "hqdn3d")
+	}
+	if j.Stabilize {
+		names = append(names, "vidstabdetect", "vidstabtransform", "unsharp")
+	}
+	missing, err := checkFilters(names...)
+	if err != nil {
+		return err
+	}
+	if missing == "vidstabdetect" || missing == "vidstabtransform" {
+		return errors.New("-stabilize には vid.stab に対応したffmpeg (libvidstab付きのビルド) が必要です。")
+	}
+	if missing != "" {
+		return fmt.Errorf("ffmpegが %s フィルターに対応していません。", missing)
+	}
+	return nil
+}
+
+// isInterlaced はffprobeで動画ファイルがインターレースかを判定する
+func isInterlaced(path string) (bool, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=field_order",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return false, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+	switch strings.TrimSpace(string(out)) {
+	case "tt", "bb", "tb", "bt":
+		return true, nil
+	}
+	return false, nil
+}
+
+// applyCleanup は -cleanup-include に一致するクリップのエントリに、インターレース解除・ノイズ除去・手ぶれ補正のフィルターを設定する
+// 手ぶれ補正は事前に揺れを解析する必要があるため、解析するクリップを返す (runShakeDetection で解析する)
+func (j *Job) applyCleanup(entries []ConcatEntry) ([]shakeDetection, error) {
+	patterns, _ := splitPatterns(j.CleanupInclude)
+	targets := make([]bool, len(entries))
+	var paths []string
+	for i, entry := range entries {
+		rel, err := filepath.Rel(j.Dir, entry.Path)
+		if err != nil || j.Dir == "" {
+			rel = filepath.Base(entry.Path)
+		}
+		targets[i] = len(patterns) == 0 || matchAny(patterns, rel)
+		if targets[i] && !slices.Contains(paths, entry.Path) {
+			paths = append(paths, entry.Path)
+		}
+	}
+	if len(paths) == 0 {
+		warnf("-cleanup-include に一致するクリップがありません。")
+		return nil, nil
+	}
+
+	interlaced := map[string]bool{}
+	if j.Deinterlace {
+		results := make([]bool, len(paths))
+		err := runParallel(len(paths), j.Jobs, func(i int) error {
+			var err error
+			results[i], err = isInterlaced(paths[i])
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("インターレースの判定に失敗しました: %v", err)
+		}
+		for i, path := range paths {
+			if results[i] {
+				interlaced[path] = true
+				debugf("インターレースを解除します: %s", filepath.Base(path))
+			}
+		}
+		if len(interlaced) == 0 {
+			infof("インターレースのクリップが無いため、インターレース解除は行いません。")
+		} else {
+			infof("インターレースのクリップ%d個をインターレース解除します。", len(interlaced))
+		}
+	}
+
+	var dir string
+	var detections []shakeDetection
+	for i := range entries {
+		if !targets[i] {
+			continue
+		}
+		if interlaced[entries[i].Path] {
+			entries[i].VideoFilter = joinFilters(entries[i].VideoFilter, deinterlaceFilter)
+		}
+		if j.Denoise != "" {
+			entries[i].VideoFilter = joinFilters(entries[i].VideoFilter, denoiseFilters[j.Denoise])
+		}
+		if !j.Stabilize {
+			continue
+		}
+		if dir == "" {
+			if dir = j.CacheDir; dir == "" {
+				// 解析結果は入力と設定から決まる名前で残し、再実行やチェックポイントからの再開で再利用する
+				dir = filepath.Join(os.TempDir(), "video_concator-vidstab")
+			}
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				return nil, err
+			}
+		}
+		key, err := shakeDetectionKey(entries[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s のハッシュの計算に失敗しました: %v", filepath.Base(entries[i].Path), err)
+		}
+		result := filepath.Join(dir, key+".trf")
+		detections = append(detections, shakeDetection{Entry: entries[i], Result: result})
+		entries[i].VideoFilter = joinFilters(entries[i].VideoFilter,
+			fmt.Sprintf("vidstabtransform=input=%s:%s", escapeFilterArg(result), stabilizeTransformArgs), stabilizeSharpen)
+	}
+	if j.Denoise != "" {
+		infof("%d個のクリップのノイズを除去します (%s)。", len(paths), j.Denoise)
+	}
+	if j.Stabilize {
+		infof("%d個のクリップの手ぶれを補正します。", len(paths))
+	}
+	return detections, nil
+}
+
+// shakeDetectionKey は入力の内容と区間、解析の前に適用するフィルターから揺れの解析結果のファイル名を求める
+func shakeDetectionKey(entry ConcatEntry) (string, error) {
+	fp, err := contentFingerprint(entry.Path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintln(h, fp, entry.Inpoint, entry.Outpoint, entry.VideoFilter, stabilizeDetectArgs)
+	return hex.EncodeToString(h.Sum(nil))[:32], nil
+}
+
+// runShakeDetection は手ぶれ補正の1パス目として、各クリップの揺れを並列に解析する
+// 解析済みの結果がある場合は再利用する
+// 補正のパスと同じフレームを解析するよう、エンコードと同じくconcat demuxerでクリップの区間を読み込む
+func runShakeDetection(ctx context.Context, detections []shakeDetection, workers int, limits ResourceLimits) error {
+	infof("手ぶれを解析中...")
+	return runParallel(len(detections), workers, func(i int) error {
+		d := detections[i]
+		name := filepath.Base(d.Entry.Path)
+		if _, err := os.Stat(d.Result); err == nil {
+			debugf("揺れの解析結果を再利用します: %s", name)
+			return nil
+		}
+		listFile, err := createConcatListFile([]ConcatEntry{d.Entry}, "\n")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(listFile)
+		// 中断時に不完全な解析結果が残らないよう、一時的な名前で書き出してから名前を変更する
+		partial := d.Result + ".partial"
+		cmd := newFFmpegCommand(ctx,
+			"-hide_banner", "-nostats", "-loglevel", "error",
+			"-f", "concat", "-safe", "0", "-i", listFile,
+			"-map", "0:v:0",
+			"-vf", joinFilters(d.Entry.VideoFilter, fmt.Sprintf("vidstabdetect=%s:result=%s", stabilizeDetectArgs, escapeFilterArg(partial))),
+			"-f", "null", "-",
+		)
+		if out, err := combinedOutputLimited(cmd, limits); err != nil {
+			os.Remove(partial)
+			return fmt.Errorf("%s の揺れの解析に失敗しました: %v\n%s", name, err, strings.TrimSpace(string(out)))
+		}
+		debugf("揺れを解析しました: %s", name)
+		return os.Rename(partial, d.Result)
+	})
+}
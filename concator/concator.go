@@ -0,0 +1,245 @@
+// Package concator はディレクトリ内の動画ファイルを検索し、ffmpegで1つの動画に結合する
+package concator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VideoInfo は動画ファイルの情報を格納する構造体
+type VideoInfo struct {
+	Path    string
+	ModTime time.Time // ソートに使用する日時 (並び順に応じて更新日時、作成日時、撮影日時のいずれか)
+}
+
+// sortKeys は -sort に指定できる値と、findAndSortVideos に渡す並び順の対応
+// time と weighted-shuffle は -time-source の日時を使う
+var sortKeys = map[string]string{
+	"mtime":    "mtime",
+	"ctime":    "btime",
+	"name":     "name",
+	"metadata": "metadata",
+}
+
+// ConcatEntry はconcatリストファイルの1クリップ分のエントリ
+type ConcatEntry struct {
+	Path       string
+	Inpoint    float64   // 0の場合は先頭から
+	Outpoint   float64   // 0の場合は末尾まで
+	Gain       float64   // 音量の補正 (dB、-normalize-audio で使用)
+	RecordedAt time.Time // 録画を開始した日時 (-burn-timestamp で使用、ゼロ値の場合は表示しない)
+	Speed      float64   // 再生速度の倍率 (-speed、カットリストで指定。0の場合は等速)
+	TitleCard  bool      // -title-cards で生成したタイトルカード
+	Title      string    // チャプターのタイトル (-chapters-text で指定。空の場合はファイル名を使う)
+	// クリップ固有の映像・音声フィルター (HDRの変換、再生速度など)。出力全体のフィルターより前に適用する
+	// concat demuxerでは入力ごとにフィルターを適用できないため、クリップごとに正規化する場合とトランジションでのみ使用する
+	VideoFilter string
+	AudioFilter string
+}
+
+// uniformEntryFilters は全てのエントリのクリップ固有の映像・音声フィルターが同じであれば、それらのフィルターとtrueを返す
+func uniformEntryFilters(entries []ConcatEntry) (video, audio string, ok bool) {
+	if len(entries) == 0 {
+		return "", "", true
+	}
+	for _, entry := range entries[1:] {
+		if entry.VideoFilter != entries[0].VideoFilter || entry.AudioFilter != entries[0].AudioFilter {
+			return "", "", false
+		}
+	}
+	return entries[0].VideoFilter, entries[0].AudioFilter, true
+}
+
+// videoExtensions は入力として扱う動画ファイルの拡張子
+var videoExtensions = map[string]bool{
+	".mp4": true,
+	".mov": true,
+	".mkv": true,
+	".avi": true,
+}
+
+// isVideoFile はパスの拡張子が入力として扱う動画ファイルのものかを返す
+func isVideoFile(path string) bool {
+	return videoExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// emptyPollInterval は -on-empty wait で動画ファイルの出現を確認する間隔
+const emptyPollInterval = 10 * time.Second
+
+// errBirthTimeUnavailable はOSやファイルシステムが作成日時(btime)を提供しない場合のエラー
+var errBirthTimeUnavailable = errors.New("作成日時(btime)を取得できません")
+
+// findAndSortVideos は指定されたディレクトリ内の動画ファイルを検索し、filesで個別に指定されたファイルと合わせて
+// sortKeyで指定された順にソートする
+// sortKeyは mtime (更新日時)、btime (作成日時)、name (ファイル名)、metadata (撮影日時) のいずれか
+// filterの日時の範囲はソートに使う日時 (name の場合は更新日時) で判定する。個別に指定されたファイルはfilterで除外しない
+// 複数のディレクトリに同じファイルが含まれる場合は1つにまとめる
+func findAndSortVideos(dirs, files []string, sortKey string, filter InputFilter) ([]string, error) {
+	var videos []VideoInfo
+	seen := map[string]bool{}
+	// add は重複していないファイルを日時と共に追加する。filterを適用する場合は範囲外の日時のファイルを除外する
+	add := func(path string, info os.FileInfo, applyFilter bool) error {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("絶対パスの取得に失敗しました: %s, %v", path, err)
+		}
+		if seen[absPath] {
+			return nil
+		}
+		t, err := fileTime(absPath, info, sortKey)
+		if err != nil {
+			return err
+		}
+		if applyFilter && !filter.matchTime(t) {
+			return nil
+		}
+		seen[absPath] = true
+		videos = append(videos, VideoInfo{Path: absPath, ModTime: t})
+		return nil
+	}
+
+	for _, dir := range dirs {
+		// 各ディレクトリ (入力ディレクトリからの相対パス) に適用する除外ファイルのパターン (親ディレクトリのものを引き継ぐ)
+		rules := map[string]ignoreRules{}
+		err := walkInputDir(dir, filter, func(path, rel string, info os.FileInfo) error {
+			if info.IsDir() {
+				if filter.IgnoreFile == "" {
+					return nil
+				}
+				parent := rules[filepath.Dir(rel)]
+				if rel != "." && parent.ignored(rel, true) {
+					debugf("%s により除外します: %s", filter.IgnoreFile, path)
+					return filepath.SkipDir
+				}
+				base := ""
+				if rel != "." {
+					base = filepath.ToSlash(rel)
+				}
+				var err error
+				rules[rel], err = loadIgnoreFile(path, base, filter.IgnoreFile, parent)
+				return err
+			}
+			if !isVideoFile(path) || !filter.matchName(rel) {
+				return nil
+			}
+			if rules[filepath.Dir(rel)].ignored(rel, false) {
+				debugf("%s により除外します: %s", filter.IgnoreFile, path)
+				return nil
+			}
+			return add(path, info, true)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range files {
+		if isCompanionFile(file) {
+			infof("カメラの付属ファイルのためスキップします: %s", file)
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("動画ファイルを開けません: %v", err)
+		}
+		if err := add(file, info, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if sortKey == "name" {
+		// ファイル名でソート (同名の場合はパス全体で比較)
+		sort.SliceStable(videos, func(i, j int) bool {
+			ni, nj := filepath.Base(videos[i].Path), filepath.Base(videos[j].Path)
+			if ni != nj {
+				return ni < nj
+			}
+			return videos[i].Path < videos[j].Path
+		})
+	} else {
+		// ModTime（更新日時、作成日時、または撮影日時）でソート
+		sort.SliceStable(videos, func(i, j int) bool {
+			return videos[i].ModTime.Before(videos[j].ModTime)
+		})
+	}
+
+	var sortedPaths []string
+	for _, v := range videos {
+		sortedPaths = append(sortedPaths, v.Path)
+	}
+
+	return sortedPaths, nil
+}
+
+// fileTime はsortKeyに対応する動画ファイルの日時を返す (name の場合は更新日時)
+func fileTime(path string, info os.FileInfo, sortKey string) (time.Time, error) {
+	switch sortKey {
+	case "btime":
+		return getBirthTime(path, info)
+	case "metadata":
+		return metadataTime(path, info)
+	default:
+		return info.ModTime(), nil
+	}
+}
+
+// metadataTime は動画ファイルのメタデータから撮影日時を取得する
+// 記録されていない場合は更新日時で代用する
+func metadataTime(path string, info os.FileInfo) (time.Time, error) {
+	t, err := probeCreationTime(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.IsZero() {
+		warnf("撮影日時が記録されていないため更新日時を使用します: %s", path)
+		return info.ModTime(), nil
+	}
+	return t, nil
+}
+
+// createConcatListFile はffmpegのconcat demuxerが読み込むための一時的なリストファイルを作成する
+// eolは各行の改行コード ("\n" または "\r\n")。BOMは書き込まない
+func createConcatListFile(entries []ConcatEntry, eol string) (string, error) {
+	tempFile, err := os.CreateTemp("", "concat-list-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer tempFile.Close()
+
+	if _, err := tempFile.WriteString(formatConcatList(entries, eol)); err != nil {
+		os.Remove(tempFile.Name())
+		return "", err
+	}
+	return tempFile.Name(), nil
+}
+
+// formatConcatList はconcat demuxer用のリストファイルの内容を組み立てる
+func formatConcatList(entries []ConcatEntry, eol string) string {
+	var b strings.Builder
+	for _, entry := range entries {
+		// パスに含まれるシングルクォートをエスケープ
+		escapedPath := strings.ReplaceAll(entry.Path, "'", "'\\''")
+		// file 'path' というフォーマットで書き込む
+		fmt.Fprintf(&b, "file '%s'%s", escapedPath, eol)
+		if entry.Inpoint > 0 {
+			fmt.Fprintf(&b, "inpoint %.3f%s", entry.Inpoint, eol)
+		}
+		if entry.Outpoint > 0 {
+			fmt.Fprintf(&b, "outpoint %.3f%s", entry.Outpoint, eol)
+		}
+	}
+	return b.String()
+}
+
+// DefaultListEOL は実行中のOSに応じたリストファイルの改行コードの種類を返す
+func DefaultListEOL() string {
+	if runtime.GOOS == "windows" {
+		return "crlf"
+	}
+	return "lf"
+}
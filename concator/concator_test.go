@@ -0,0 +1,64 @@
+package concator
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFormatConcatList(t *testing.T) {
+	entries := []ConcatEntry{
+		{Path: "/videos/a.mp4"},
+		{Path: "/videos/it's.mp4", Inpoint: 1.5},
+		{Path: "/videos/c.mp4", Inpoint: 2, Outpoint: 12.25},
+	}
+	tests := []struct {
+		name string
+		eol  string
+		want string
+	}{
+		{
+			name: "lf",
+			eol:  "\n",
+			want: "file '/videos/a.mp4'\n" +
+				"file '/videos/it'\\''s.mp4'\n" +
+				"inpoint 1.500\n" +
+				"file '/videos/c.mp4'\n" +
+				"inpoint 2.000\n" +
+				"outpoint 12.250\n",
+		},
+		{
+			name: "crlf",
+			eol:  "\r\n",
+			want: "file '/videos/a.mp4'\r\n" +
+				"file '/videos/it'\\''s.mp4'\r\n" +
+				"inpoint 1.500\r\n" +
+				"file '/videos/c.mp4'\r\n" +
+				"inpoint 2.000\r\n" +
+				"outpoint 12.250\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatConcatList(entries, tt.eol)
+			if got != tt.want {
+				t.Errorf("formatConcatList(%q) =\n%q\nwant\n%q", tt.eol, got, tt.want)
+			}
+			if len(got) >= 3 && got[:3] == "\xef\xbb\xbf" {
+				t.Error("BOMが書き込まれています")
+			}
+
+			file, err := createConcatListFile(entries, tt.eol)
+			if err != nil {
+				t.Fatalf("createConcatListFile: %v", err)
+			}
+			defer os.Remove(file)
+			written, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(written) != tt.want {
+				t.Errorf("リストファイルの内容 =\n%q\nwant\n%q", written, tt.want)
+			}
+		})
+	}
+}
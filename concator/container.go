@@ -0,0 +1,112 @@
+package concator
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// containerFormat は出力のコンテナ形式ごとの設定
+type containerFormat struct {
+	Exts       []string // 拡張子 (先頭が既定)
+	Codecs     []string // 格納できる映像コーデック (先頭が既定)。空の場合は映像コーデックを選べない
+	AudioCodec string   // 音声を再エンコードする場合のコーデック (空の場合は音声を格納しない)
+}
+
+// containerFormats は -container で指定できるコンテナ形式
+var containerFormats = map[string]containerFormat{
+	"mp4":  {Exts: []string{".mp4", ".m4v"}, Codecs: []string{"h265", "h264", "av1"}, AudioCodec: "aac"},
+	"mov":  {Exts: []string{".mov"}, Codecs: []string{"h265", "h264"}, AudioCodec: "aac"},
+	"mkv":  {Exts: []string{".mkv"}, Codecs: []string{"h265", "h264", "vp9", "av1"}, AudioCodec: "aac"},
+	"webm": {Exts: []string{".webm"}, Codecs: []string{"vp9", "av1"}, AudioCodec: "libopus"},
+	"gif":  {Exts: []string{".gif"}},
+}
+
+// codecEncoders は -codec ごとに、-encoder を省略した場合に使うエンコーダー
+// h265・h264 はハードウェアエンコーダーを含めて自動選択するため含めない (encoderFallbackChains を参照)
+var codecEncoders = map[string]string{
+	"vp9": "libvpx-vp9",
+	"av1": "libaom-av1",
+}
+
+// defaultVP9AV1CRF はVP9/AV1で -crf と -vbitrate のどちらも指定されていない場合に使う固定品質の値
+// libvpx/libaomの既定のビットレートは低く、フルHDでは画質が大きく劣化するため
+const defaultVP9AV1CRF = 31
+
+// resolveContainer は -container と出力ファイル名から出力のコンテナ形式を決める
+// auto の場合は拡張子から判定し、該当しない拡張子では空文字列を返す (コーデックを制限しない)
+// 明示した場合は、拡張子が無ければ補い、コンテナ形式と異なる拡張子であればエラーにする
+func resolveContainer(name, output string) (string, string, error) {
+	ext := strings.ToLower(filepath.Ext(output))
+	if name == "auto" {
+		for key, format := range containerFormats {
+			if slices.Contains(format.Exts, ext) {
+				return key, output, nil
+			}
+		}
+		return "", output, nil
+	}
+	format, ok := containerFormats[name]
+	if !ok {
+		return "", "", fmt.Errorf("-container には auto、mp4、mov、mkv、webm、gif のいずれかを指定してください: %s", name)
+	}
+	if ext == "" {
+		return name, output + format.Exts[0], nil
+	}
+	if !slices.Contains(format.Exts, ext) {
+		return "", "", fmt.Errorf("出力ファイルの拡張子 '%s' が -container %s と一致しません", filepath.Ext(output), name)
+	}
+	return name, output, nil
+}
+
+// encoderCodec はエンコーダー名から映像コーデックを判定する (判定できない場合は空文字列)
+func encoderCodec(encoder string) string {
+	switch {
+	case strings.Contains(encoder, "hevc") || strings.Contains(encoder, "265"):
+		return "h265"
+	case strings.Contains(encoder, "h264") || strings.Contains(encoder, "264"):
+		return "h264"
+	case strings.Contains(encoder, "vp9"):
+		return "vp9"
+	case strings.Contains(encoder, "av1"):
+		return "av1"
+	}
+	return ""
+}
+
+// containerCodec はコンテナ形式に格納する映像コーデックを決め、-codec と -encoder の組み合わせを確認する
+// コンテナ形式が不明な場合は -codec をそのまま使う (省略時は h265)
+func containerCodec(container, codec, encoder string) (string, error) {
+	if codec != "" && encoderFallbackChains[codec] == nil && codecEncoders[codec] == "" {
+		return "", fmt.Errorf("-codec には h265、h264、vp9、av1 のいずれかを指定してください: %s", codec)
+	}
+	if codec == "" {
+		codec = encoderCodec(encoder)
+	} else if c := encoderCodec(encoder); encoder != "" && c != "" && c != codec {
+		return "", fmt.Errorf("-encoder %s は -codec %s のエンコーダーではありません", encoder, codec)
+	}
+	format, ok := containerFormats[container]
+	if !ok {
+		if codec == "" {
+			codec = "h265"
+		}
+		return codec, nil
+	}
+	if len(format.Codecs) == 0 {
+		return "", nil
+	}
+	if codec == "" {
+		return format.Codecs[0], nil
+	}
+	if !slices.Contains(format.Codecs, codec) {
+		return "", fmt.Errorf("%s には %s の映像を格納できません (%s のいずれかを指定してください)", container, codec, strings.Join(format.Codecs, "、"))
+	}
+	return codec, nil
+}
+
+// appendGIFPalette は映像フィルターの後に、映像全体から256色のパレットを生成して減色するフィルターを繋げる
+// GIFの既定の減色より色の再現性が高く、ディザリングによるノイズも少ない
+func appendGIFPalette(videoFilter string) string {
+	return videoFilter + ",split[gifsrc][gifpal];[gifpal]palettegen=stats_mode=diff[palette];[gifsrc][palette]paletteuse=dither=bayer:bayer_scale=5:diff_mode=rectangle"
+}
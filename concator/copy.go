@@ -0,0 +1,116 @@
+package concator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// streamSignature はストリームコピーで結合できるかを判定するためのストリーム構成
+type streamSignature struct {
+	VideoCodec string
+	Width      int
+	Height     int
+	PixFmt     string
+	TimeBase   string
+	Rotation   int
+	AudioCodec string
+	SampleRate int
+	Channels   int
+}
+
+// probeStreamSignature はffprobeで動画ファイルのストリーム構成を取得する
+func probeStreamSignature(path string) (streamSignature, error) {
+	video, err := probeVideo(path)
+	if err != nil {
+		return streamSignature{}, err
+	}
+	sig := streamSignature{
+		VideoCodec: video.Codec,
+		Width:      video.Width,
+		Height:     video.Height,
+		PixFmt:     video.PixFmt,
+		TimeBase:   video.TimeBase,
+		Rotation:   normalizeRotation(video.Rotation),
+	}
+	audio, err := probeAudioFormat(path)
+	if err != nil {
+		return streamSignature{}, err
+	}
+	if audio != nil {
+		sig.AudioCodec = audio.Codec
+		sig.SampleRate = audio.SampleRate
+		sig.Channels = audio.Channels
+	}
+	return sig, nil
+}
+
+// String はストリーム構成を表示用の文字列に変換する
+func (s streamSignature) String() string {
+	audio := "音声なし"
+	if s.AudioCodec != "" {
+		audio = fmt.Sprintf("%s %dHz %dch", s.AudioCodec, s.SampleRate, s.Channels)
+	}
+	return fmt.Sprintf("%s %dx%d %s tb=%s rotate=%d / %s", s.VideoCodec, s.Width, s.Height, s.PixFmt, s.TimeBase, s.Rotation, audio)
+}
+
+// checkCopyCompatible は全ての入力ファイルのストリーム構成が一致し、再エンコードせずに結合できるかを確認する
+func checkCopyCompatible(files []string) error {
+	var first streamSignature
+	for i, file := range files {
+		sig, err := probeStreamSignature(file)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			first = sig
+			continue
+		}
+		if sig != first {
+			return fmt.Errorf("ストリーム構成が一致しません: %s (%s)、最初のファイル %s は %s",
+				filepath.Base(file), sig, filepath.Base(files[0]), first)
+		}
+	}
+	return nil
+}
+
+// buildCopyArgs はストリームコピーで結合するffmpegの引数を組み立てる
+// inputArgs、outputArgs はユーザーが指定した入力・出力オプション
+func buildCopyArgs(listFilePath, output string, inputArgs, outputArgs []string) []string {
+	args := slices.Clone(inputArgs)
+	args = append(args,
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listFilePath,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-c", "copy",
+	)
+	args = append(args, outputArgs...)
+	return append(args, "-y", output)
+}
+
+// concatCopy はエンコード済みのファイルを再エンコードせずにストリームコピーで結合する
+// limitsは1回の実行で起動する他のffmpegと同じリソースの上限
+func concatCopy(ctx context.Context, entries []ConcatEntry, output, eol string, inputArgs, outputArgs []string, limits ResourceLimits) error {
+	listFilePath, err := createConcatListFile(entries, eol)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(listFilePath)
+
+	cmd := newFFmpegCommand(ctx, buildCopyArgs(listFilePath, output, inputArgs, outputArgs)...)
+	cmd.Stdout = os.Stdout
+	stderr, reportStderr := ffmpegStderr(false)
+	cmd.Stderr = stderr
+	if err := runLimited(cmd, limits); err != nil {
+		if ctx.Err() == nil {
+			reportStderr()
+		}
+		removePartialOutput(ctx, output)
+		return err
+	}
+	return nil
+}
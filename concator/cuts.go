@@ -0,0 +1,223 @@
+package concator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Cut はカットリストの1クリップ分の設定
+// 指定した範囲のみを結合し、前後は除外する
+type Cut struct {
+	File  string // 動画ファイル名、またはカットリストのあるディレクトリからの相対パス
+	Start float64
+	End   float64 // 0の場合は末尾まで、負の場合は末尾からの秒数
+	Speed float64 // 再生速度の倍率 (0の場合は -speed に従う)
+}
+
+// cutEntry はJSON形式のカットリストの1要素。時刻は秒数または "H:MM:SS.mmm" 形式の文字列で指定する
+type cutEntry struct {
+	File  string `json:"file"`
+	Start any    `json:"start"`
+	End   any    `json:"end"`
+	Speed any    `json:"speed"` // 倍率の数値、または "8x" 形式の文字列
+}
+
+// parseCutTime は秒数 ("12.5") または "M:SS"、"H:MM:SS" 形式 (小数可) の時刻を秒数に変換する
+// 空文字列は0として扱う
+func parseCutTime(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	negative := strings.HasPrefix(s, "-")
+	var seconds float64
+	for _, part := range strings.Split(strings.TrimPrefix(s, "-"), ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("時刻の形式が正しくありません: %s", s)
+		}
+		seconds = seconds*60 + n
+	}
+	if negative {
+		seconds = -seconds
+	}
+	return seconds, nil
+}
+
+// cutSpeedValue はJSONの数値または文字列の再生速度を倍率に変換する (省略時は0)
+func cutSpeedValue(v any) (float64, error) {
+	switch t := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return parseSpeed(strconv.FormatFloat(t, 'f', -1, 64))
+	case string:
+		return parseSpeed(t)
+	default:
+		return 0, fmt.Errorf("再生速度には倍率の数値または文字列を指定してください: %v", v)
+	}
+}
+
+// cutTimeValue はJSONの数値または文字列の時刻を秒数に変換する
+func cutTimeValue(v any) (float64, error) {
+	switch t := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return t, nil
+	case string:
+		return parseCutTime(t)
+	default:
+		return 0, fmt.Errorf("時刻には秒数または文字列を指定してください: %v", v)
+	}
+}
+
+// loadCuts はカットリストを読み込む
+// 拡張子が .json の場合は {"file", "start", "end", "speed"} の配列、それ以外は "ファイル,開始,終了,速度" のCSVとして解析する
+// 速度は省略できる
+func loadCuts(path string) ([]Cut, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cuts []Cut
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		var raw []cutEntry
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("カットリストの解析に失敗しました: %s, %v", path, err)
+		}
+		for _, e := range raw {
+			start, err := cutTimeValue(e.Start)
+			if err != nil {
+				return nil, fmt.Errorf("カットリストの %s の開始時刻が正しくありません: %v", e.File, err)
+			}
+			end, err := cutTimeValue(e.End)
+			if err != nil {
+				return nil, fmt.Errorf("カットリストの %s の終了時刻が正しくありません: %v", e.File, err)
+			}
+			speed, err := cutSpeedValue(e.Speed)
+			if err != nil {
+				return nil, fmt.Errorf("カットリストの %s の再生速度が正しくありません: %v", e.File, err)
+			}
+			cuts = append(cuts, Cut{File: e.File, Start: start, End: end, Speed: speed})
+		}
+	} else {
+		reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(data), "\uFEFF")))
+		reader.Comment = '#'
+		reader.FieldsPerRecord = -1
+		for line := 1; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("カットリストの解析に失敗しました: %s, %v", path, err)
+			}
+			if len(record) < 2 || len(record) > 4 {
+				return nil, fmt.Errorf("カットリストの%d行目は \"ファイル,開始,終了,速度\" の形式で指定してください: %s", line, path)
+			}
+			for len(record) < 4 {
+				record = append(record, "")
+			}
+			start, err := parseCutTime(record[1])
+			if err != nil {
+				if line == 1 {
+					// 見出し行は読み飛ばす
+					continue
+				}
+				return nil, fmt.Errorf("カットリストの%d行目の開始時刻が正しくありません: %v", line, err)
+			}
+			end, err := parseCutTime(record[2])
+			if err != nil {
+				return nil, fmt.Errorf("カットリストの%d行目の終了時刻が正しくありません: %v", line, err)
+			}
+			var speed float64
+			if strings.TrimSpace(record[3]) != "" {
+				if speed, err = parseSpeed(record[3]); err != nil {
+					return nil, fmt.Errorf("カットリストの%d行目の再生速度が正しくありません: %v", line, err)
+				}
+			}
+			cuts = append(cuts, Cut{File: strings.TrimSpace(record[0]), Start: start, End: end, Speed: speed})
+		}
+	}
+
+	for _, cut := range cuts {
+		if cut.File == "" {
+			return nil, errors.New("カットリストにファイル名の無い行があります。")
+		}
+		if cut.Start < 0 {
+			return nil, fmt.Errorf("カットリストの %s の開始時刻には0以上の値を指定してください。", cut.File)
+		}
+		if cut.End > 0 && cut.End <= cut.Start {
+			return nil, fmt.Errorf("カットリストの %s の終了時刻が開始時刻以前です。", cut.File)
+		}
+	}
+	return cuts, nil
+}
+
+// findCut はエントリのファイルに対応するカットを返す
+// カットリストのファイル名は、カットリストのあるディレクトリからの相対パスかファイル名で照合する
+func findCut(cuts []Cut, cutsDir, path string) (Cut, bool) {
+	for _, cut := range cuts {
+		file := cut.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(cutsDir, file)
+		}
+		if file == path || cut.File == filepath.Base(path) {
+			return cut, true
+		}
+	}
+	return Cut{}, false
+}
+
+// applyCuts はカットリストの範囲を各エントリのinpoint/outpointに設定する
+// カットリストに記載の無いエントリは変更しない
+func applyCuts(entries []ConcatEntry, cutsPath string) error {
+	cuts, err := loadCuts(cutsPath)
+	if err != nil {
+		return err
+	}
+	cutsDir, err := filepath.Abs(filepath.Dir(cutsPath))
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for i := range entries {
+		cut, ok := findCut(cuts, cutsDir, entries[i].Path)
+		if !ok {
+			continue
+		}
+		used[cut.File] = true
+		end := cut.End
+		if end < 0 {
+			// 末尾からの秒数は動画の長さから求める
+			if !isFFprobeAvailable() {
+				return errors.New("カットリストで終了時刻に負の値を指定する場合はffprobeが必要です。")
+			}
+			duration, err := probeDuration(entries[i].Path)
+			if err != nil {
+				return err
+			}
+			end = duration + end
+			if end <= cut.Start {
+				return fmt.Errorf("カットリストの %s の範囲が空になります (長さ %.1f秒)。", cut.File, duration)
+			}
+		}
+		entries[i].Inpoint, entries[i].Outpoint = cut.Start, end
+		entries[i].Speed = cut.Speed
+		debugf("カットリストの範囲を適用します: %s (inpoint=%.3f, outpoint=%.3f, speed=%g)", filepath.Base(entries[i].Path), cut.Start, end, entries[i].playbackSpeed())
+	}
+	for _, cut := range cuts {
+		if !used[cut.File] {
+			warnf("カットリストの %s に対応する入力ファイルがありません。", cut.File)
+		}
+	}
+	return nil
+}
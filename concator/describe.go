@@ -0,0 +1,60 @@
+package concator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PlanDescription は -describe で説明する実行計画の内容
+type PlanDescription struct {
+	ClipCount      int
+	TotalDuration  float64 // 秒 (不明な場合は0)
+	Source         string
+	Order          string
+	Resolution     string
+	Framerate      int
+	Encoder        string
+	Output         string
+	EstimatedBytes int64 // 推定出力サイズ (不明な場合は0)
+}
+
+// describePlan は実行計画を専門用語の少ない文章で説明する
+func describePlan(p PlanDescription) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d個のクリップ", p.ClipCount)
+	if p.TotalDuration > 0 {
+		fmt.Fprintf(&b, " (合計 約%s)", formatApproxDuration(p.TotalDuration))
+	}
+	fmt.Fprintf(&b, "を %s から読み込み、%sに並べて結合します。\n", p.Source, p.Order)
+	fmt.Fprintf(&b, "映像は %s、%dfps に揃え、%s でエンコードします。\n", p.Resolution, p.Framerate, p.Encoder)
+	fmt.Fprintf(&b, "出力先は %s です", p.Output)
+	if p.EstimatedBytes > 0 {
+		fmt.Fprintf(&b, " (推定 約%s)", formatApproxSize(p.EstimatedBytes))
+	}
+	b.WriteString("。\n")
+	return b.String()
+}
+
+// formatApproxDuration は秒数をおおよその時間表記に変換する
+func formatApproxDuration(seconds float64) string {
+	minutes := int(seconds/60 + 0.5)
+	if minutes < 1 {
+		return fmt.Sprintf("%d秒", int(seconds+0.5))
+	}
+	if minutes < 60 {
+		return fmt.Sprintf("%d分", minutes)
+	}
+	return fmt.Sprintf("%d時間%d分", minutes/60, minutes%60)
+}
+
+// formatApproxSize はバイト数をおおよそのサイズ表記に変換する
+func formatApproxSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit*unit {
+		return fmt.Sprintf("%.0f KB", float64(bytes)/unit)
+	}
+	if bytes < unit*unit*unit {
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(unit*unit))
+	}
+	return fmt.Sprintf("%.1f GB", float64(bytes)/(unit*unit*unit))
+}
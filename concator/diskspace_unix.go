@@ -0,0 +1,14 @@
+//go:build !windows
+
+package concator
+
+import "golang.org/x/sys/unix"
+
+// freeDiskSpace はパスが置かれたファイルシステムの空き容量 (バイト) を返す
+func freeDiskSpace(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,53 @@
+package concator
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// dryRunListFile は -dry-run の表示でリストファイルの代わりに使う名前
+const dryRunListFile = "concat-list.txt"
+
+// shellQuote はコマンドラインに貼り付けられるよう、必要に応じて引数をシングルクォートで囲む
+func shellQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// printDryRun は結合するファイルの順序、リストファイルの内容、実行するffmpegコマンドを表示する
+// commandsはリストファイルのパスを dryRunListFile として組み立てたffmpegの引数で、複数の場合は順に実行するコマンド
+func printDryRun(w io.Writer, files []string, entries []ConcatEntry, commands ...[]string) {
+	fmt.Fprintln(w, "結合するファイル:")
+	for i, file := range files {
+		fmt.Fprintf(w, "  %3d. %s\n", i+1, file)
+	}
+
+	fmt.Fprintf(w, "\nリストファイル (%s) の内容:\n", dryRunListFile)
+	fmt.Fprint(w, formatConcatList(entries, "\n"))
+
+	// クリップ固有の映像フィルターはリストファイルに書けないため、別に表示する
+	if _, _, uniform := uniformEntryFilters(entries); !uniform {
+		fmt.Fprintln(w, "\nクリップごとのフィルター:")
+		for i, entry := range entries {
+			if entry.VideoFilter != "" {
+				fmt.Fprintf(w, "  %3d. %s (映像): %s\n", i+1, filepath.Base(entry.Path), entry.VideoFilter)
+			}
+			if entry.AudioFilter != "" {
+				fmt.Fprintf(w, "  %3d. %s (音声): %s\n", i+1, filepath.Base(entry.Path), entry.AudioFilter)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "\n実行するコマンド:")
+	for _, args := range commands {
+		quoted := []string{shellQuote(ffmpegPath)}
+		for _, arg := range args {
+			quoted = append(quoted, shellQuote(arg))
+		}
+		fmt.Fprintln(w, strings.Join(quoted, " "))
+	}
+}
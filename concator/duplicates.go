@@ -0,0 +1,57 @@
+package concator
+
+import "os"
+
+// DuplicateFile は内容が同じため除外した入力ファイル
+type DuplicateFile struct {
+	Path     string // 除外したファイル
+	Original string // 同じ内容で、結合に使うファイル
+}
+
+// removeDuplicates は大きさと先頭・末尾の内容 (contentFingerprint) が同じファイルを重複とみなし、最初の1つのみを残す
+// 同じパスが複数回指定されている場合は意図的な指定として残す
+func removeDuplicates(files []string) ([]string, []DuplicateFile, error) {
+	sizes := make([]int64, len(files))
+	bySize := map[int64]int{}
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		sizes[i] = info.Size()
+		bySize[sizes[i]]++
+	}
+
+	type seenFile struct {
+		path        string
+		fingerprint string
+	}
+	seen := map[int64][]seenFile{}
+	var kept []string
+	var duplicates []DuplicateFile
+	for i, file := range files {
+		// 大きさが同じファイルが他に無ければ内容は読まない
+		if bySize[sizes[i]] < 2 {
+			kept = append(kept, file)
+			continue
+		}
+		fingerprint, err := contentFingerprint(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		original := ""
+		for _, s := range seen[sizes[i]] {
+			if s.path != file && s.fingerprint == fingerprint {
+				original = s.path
+				break
+			}
+		}
+		if original != "" {
+			duplicates = append(duplicates, DuplicateFile{Path: file, Original: original})
+			continue
+		}
+		seen[sizes[i]] = append(seen[sizes[i]], seenFile{path: file, fingerprint: fingerprint})
+		kept = append(kept, file)
+	}
+	return kept, duplicates, nil
+}
@@ -0,0 +1,54 @@
+package concator
+
+import (
+	"errors"
+	"time"
+)
+
+// checkDurationFilter は -min-duration と -max-duration の指定を確認する
+func checkDurationFilter(minDuration, maxDuration time.Duration) error {
+	if minDuration < 0 || maxDuration < 0 {
+		return errors.New("-min-duration と -max-duration には0以上の値を指定してください。")
+	}
+	if maxDuration > 0 && minDuration > maxDuration {
+		return errors.New("-min-duration には -max-duration 以下の値を指定してください。")
+	}
+	if !isFFprobeAvailable() {
+		return errors.New("-min-duration と -max-duration にはffprobeが必要です。")
+	}
+	return nil
+}
+
+// filterByDuration は長さが minDuration 未満、または maxDuration を超えるファイルを除外する (0の場合はその側を制限しない)
+// 長さを取得できないファイルは残し、-on-error による入力の確認に任せる
+func filterByDuration(files []string, minDuration, maxDuration time.Duration, jobs int) []string {
+	durations := make([]float64, len(files))
+	failed := make([]bool, len(files))
+	runParallel(len(files), jobs, func(i int) error {
+		var err error
+		if durations[i], err = probeDuration(files[i]); err != nil {
+			failed[i] = true
+		}
+		return nil
+	})
+
+	var kept []string
+	for i, file := range files {
+		d := time.Duration(durations[i] * float64(time.Second))
+		switch {
+		case failed[i]:
+			warnf("長さを取得できないため、長さによる除外を行いません: %s", file)
+		case minDuration > 0 && d < minDuration:
+			infof("短すぎるためスキップします: %s (%.1f秒 < -min-duration %s)", file, durations[i], minDuration)
+			continue
+		case maxDuration > 0 && d > maxDuration:
+			infof("長すぎるためスキップします: %s (%.1f秒 > -max-duration %s)", file, durations[i], maxDuration)
+			continue
+		}
+		kept = append(kept, file)
+	}
+	if skipped := len(files) - len(kept); skipped > 0 {
+		infof("長さの範囲外のファイル%d個を除外しました。", skipped)
+	}
+	return kept
+}
@@ -0,0 +1,306 @@
+package concator
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// EncodeJob は1つの出力ファイルを生成するための結合・エンコードの設定
+type EncodeJob struct {
+	Entries         []ConcatEntry
+	Output          string
+	VideoFilter     string
+	AudioFilter     string
+	Encoder         string
+	EOL             string
+	InputArgs       []string // -i より前に置く入力オプション
+	Poster          string
+	PosterMode      string
+	SubtitleCodec   string // 字幕を格納する際のコーデック (空の場合は字幕を格納しない)
+	SubtitleFile    string // 結合後の時刻に合わせた字幕のSRTファイル
+	BurnSubtitles   bool   // SubtitleFileを映像に焼き込む
+	ChaptersFile    string // 出力に埋め込むチャプターのffmetadataファイル
+	TotalFrames     int64
+	RateControlArgs []string
+	GPUArgs         *GPUArgs
+	Limits          ResourceLimits
+	MetadataArgs    []string         // 出力のメタデータを設定するffmpegの引数
+	ExtraArgs       []string         // 出力ファイルの直前に追加するffmpegの引数
+	NoAudio         bool             // 音声を出力しない
+	AudioCopy       bool             // 音声を再エンコードせずにコピーする
+	AudioCodec      string           // 音声を再エンコードする場合のコーデック
+	GIF             bool             // パレットを生成してアニメーションGIFとして出力する
+	Music           *Music           // 全体に流すBGM (nilの場合は流さない)
+	Streaming       *StreamingOutput // HLS/DASHのプレイリストとセグメントに分割して出力する (nilの場合は1つのファイル)
+	Renditions      []Rendition      // 同時に出力する解像度違いの出力 (空の場合は1つの解像度のみ)
+	Watermark       *Watermark       // 映像に重ねるロゴ (nilの場合は重ねない)
+	TimestampFormat string           // 各クリップの録画日時を焼き込む書式 (空の場合は焼き込まない)
+	TimestampFont   string           // 録画日時のフォントファイル (空の場合はffmpegの既定)
+	Progress        bool             // ffmpegのログの代わりに進捗バーを表示する
+	Quiet           bool             // ffmpegのログをエラーのみにする (複数のffmpegを並列に実行する場合など)
+	StatsPeriod     time.Duration
+	Framerate       int          // TotalFramesから出力の長さを求める際のフレームレート
+	Events          *EventWriter // 進捗をイベントとして書き出す (nilの場合は進捗バーを表示する)
+
+	// 2パスエンコード (TwoPassの場合、runEncodeが解析のパスと本番のパスを続けて実行する)
+	TwoPass     bool
+	Pass        int    // 実行するパス (1か2。0の場合は1パス)
+	PassLogFile string // パスログのファイル名の接頭辞
+
+	// クリップ間のトランジション (空の場合はconcat demuxerで単純に結合する)
+	Transition         string    // xfadeのトランジション名 (例: fade)
+	TransitionDuration float64   // トランジションの長さ(秒)
+	EntryDurations     []float64 // 各エントリの長さ(秒)。トランジションの開始位置の計算に使う
+
+	// 出力の先頭と末尾のフェード (0の場合はフェードしない)
+	FadeIn       float64 // フェードインの長さ(秒)
+	FadeOut      float64 // フェードアウトの長さ(秒)
+	FadeOutStart float64 // フェードアウトを開始する出力の時刻(秒)
+}
+
+// ffmpegStopTimeout は中断時にffmpegへ終了を要求してから強制終了するまでの待機時間
+const ffmpegStopTimeout = 10 * time.Second
+
+// newFFmpegCommand はctxが取り消された際にffmpegを終了させるコマンドを作成する
+// いきなり強制終了せずに割り込みを送り、ffmpegが自身で終了処理を行えるようにする
+func newFFmpegCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	cmd.Cancel = func() error {
+		// Windowsなど割り込みを送れない環境では強制終了する
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	cmd.WaitDelay = ffmpegStopTimeout
+	return cmd
+}
+
+// removePartialOutput は中断された場合に書きかけの出力ファイルを削除する
+func removePartialOutput(ctx context.Context, output string) {
+	if ctx.Err() == nil {
+		return
+	}
+	if err := os.Remove(output); err == nil {
+		infof("書きかけの出力ファイルを削除しました: %s", output)
+	}
+}
+
+// runEncode はconcatリストファイルを作成し、ffmpegで結合とエンコードを行う
+func runEncode(ctx context.Context, job EncodeJob) error {
+	if job.TwoPass && job.Pass == 0 {
+		return runTwoPassEncode(ctx, job)
+	}
+	// ffmpegのconcat demuxer用のリストファイルを作成 (トランジションを使う場合は各クリップを直接入力する)
+	listFilePath := ""
+	if job.Transition == "" {
+		var err error
+		listFilePath, err = createConcatListFile(job.Entries, job.EOL)
+		if err != nil {
+			return err
+		}
+		// 終了時にリストファイルを削除
+		defer os.Remove(listFilePath)
+	}
+
+	cmd := newFFmpegCommand(ctx, buildEncodeArgs(job, listFilePath)...)
+	releaseLimits, err := limitCommand(cmd, job.Limits)
+	if err != nil {
+		return err
+	}
+	defer releaseLimits()
+
+	// ffmpegのログは進捗バーの代わりに表示する場合のみそのまま表示し、それ以外は失敗した場合にのみ表示する
+	stderr, reportStderr := ffmpegStderr(!job.Progress && !job.Quiet)
+	cmd.Stderr = stderr
+
+	// 進捗を表示する場合は、標準出力に書き出される -progress の内容を解析する
+	var progressDone chan struct{}
+	if !job.Progress {
+		cmd.Stdout = os.Stdout
+	} else {
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		// 進捗率の計算に使う出力の想定される長さ
+		total, err := outputDuration(job, job.Framerate)
+		if err != nil {
+			return err
+		}
+		reporter := newProgressReporter(total, job.StatsPeriod)
+		reporter.events = job.Events
+		progressDone = make(chan struct{})
+		go func() {
+			reporter.consume(stdout)
+			close(progressDone)
+		}()
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if progressDone != nil {
+		// パイプを読み切ってからWaitを呼ぶ
+		<-progressDone
+	}
+	err = cmd.Wait()
+	if err != nil && ctx.Err() == nil {
+		reportStderr()
+	}
+	// 2パスエンコードの1パス目は出力を破棄するため削除しない
+	if err != nil && job.Output != os.DevNull {
+		removePartialOutput(ctx, job.Output)
+		for _, r := range job.Renditions {
+			if r.Output != "" {
+				removePartialOutput(ctx, r.Output)
+			}
+		}
+	}
+	return err
+}
+
+// buildEncodeArgs は結合とエンコードを行うffmpegの引数を組み立てる
+func buildEncodeArgs(job EncodeJob, listFilePath string) []string {
+	if len(job.Renditions) > 0 {
+		return buildRenditionArgs(job, listFilePath)
+	}
+	args, chaptersInput, subtitlesInput := buildEncodeInputArgs(job, listFilePath)
+	if chaptersInput >= 0 {
+		args = append(args, "-map_chapters", strconv.Itoa(chaptersInput))
+	}
+	posterInput := "1"
+	if job.Transition != "" {
+		posterInput = strconv.Itoa(len(job.Entries))
+		// 映像・音声ともにfilter_complexの出力を使う
+		args = append(args, "-filter_complex", buildTransitionFilter(job), "-map", "[vout]")
+		if !job.NoAudio || job.Music != nil {
+			args = append(args, "-map", "[aout]")
+		}
+	} else {
+		// コンテナ内のストリーム順に関わらず、最初の映像と最初の音声を選択する
+		// 音声の無い入力にも対応できるよう、音声は "?" で省略可能にする
+		args = append(args, "-map", "0:v:0")
+		if job.Music != nil {
+			args = append(args, "-filter_complex", buildConcatMusicFilter(job), "-map", "[aout]")
+		} else if !job.NoAudio {
+			args = append(args, "-map", "0:a:0?")
+		}
+	}
+	if subtitlesInput >= 0 {
+		args = append(args, "-map", strconv.Itoa(subtitlesInput)+":s:0", "-c:s", job.SubtitleCodec)
+	}
+	if job.PosterMode == "attached_pic" {
+		args = append(args, "-map", posterInput+":v:0")
+		if job.Transition == "" {
+			args = append(args, "-filter:v:0", applyOverlays(job.VideoFilter, job))
+		}
+		args = append(args,
+			"-c:v:0", job.Encoder,
+			"-c:v:1", posterCodec(job.Poster),
+			"-disposition:v:1", "attached_pic",
+		)
+	} else {
+		if job.Transition == "" {
+			vf := applyOverlays(job.VideoFilter, job)
+			if job.GIF {
+				vf = appendGIFPalette(vf)
+			}
+			args = append(args, "-vf", vf)
+		}
+		args = append(args, "-c:v", job.Encoder) // ビデオエンコーダー
+	}
+	if job.TotalFrames > 0 {
+		args = append(args, "-frames:v:0", strconv.FormatInt(job.TotalFrames, 10))
+	}
+	args = append(args, job.RateControlArgs...)
+	if job.Pass > 0 {
+		args = append(args, passArgs(job.Encoder, job.Pass, job.PassLogFile)...)
+	}
+	args = append(args, job.GPUArgs.Output...)
+	if job.PosterMode == "attachment" {
+		args = append(args, buildPosterAttachArgs(job.Poster)...)
+	}
+	if job.NoAudio && job.Music == nil {
+		args = append(args, "-an")
+	} else if job.AudioCopy {
+		args = append(args, "-c:a", "copy")
+	} else {
+		if job.Transition == "" && job.Music == nil {
+			if af := joinFilters(job.AudioFilter, buildLoudnessFilter(job), audioFadeFilter(job)); af != "" {
+				args = append(args, "-af", af)
+			}
+		}
+		args = append(args,
+			"-c:a", job.AudioCodec, // 音声コーデック（再エンコード）
+			"-b:a", "192k", // 音声ビットレート
+		)
+	}
+	if job.Streaming != nil {
+		args = append(args, job.Streaming.outputArgs(job.Output)...)
+	}
+	args = append(args, job.MetadataArgs...)
+	args = append(args, job.ExtraArgs...)
+	if job.Pass == 1 {
+		// 1パス目は統計のみを書き出し、映像は破棄する
+		args = append(args, "-f", "null")
+	}
+	args = append(args,
+		"-y", // 既存の出力ファイルの扱いは実行前に確認済みのため、ffmpegでは確認せずに上書きする
+		job.Output,
+	)
+	return args
+}
+
+// buildEncodeInputArgs はffmpegのログの設定と入力の引数を組み立てる
+// チャプターと字幕を読み込む入力の番号も返す (埋め込まない場合は -1)
+func buildEncodeInputArgs(job EncodeJob, listFilePath string) ([]string, int, int) {
+	var args []string
+	if job.Progress {
+		// 進捗は標準出力に機械可読な形式で出力させ、標準エラー出力には警告以上のみを表示する
+		args = append(args, "-progress", "pipe:1", "-nostats", "-loglevel", "warning")
+	} else if job.Quiet {
+		args = append(args, "-nostats", "-loglevel", "error")
+	}
+	args = append(args, job.GPUArgs.Input...)
+	if job.Transition != "" {
+		args = append(args, buildTransitionInputArgs(job)...)
+	} else {
+		args = append(args, job.InputArgs...)
+		args = append(args,
+			"-f", "concat", // concat demuxerを使用
+			"-safe", "0", // 絶対パスを許可
+			"-i", listFilePath, // 入力リストファイル
+		)
+	}
+	nextInput := 1
+	if job.Transition != "" {
+		nextInput = len(job.Entries)
+	}
+	if job.PosterMode == "attached_pic" {
+		// ポスター画像を動画の後の入力として追加し、カバーアートとして扱う
+		args = append(args, "-i", job.Poster)
+		nextInput++
+	}
+	if job.Music != nil {
+		// BGMの入力はチャプターより前に置く (musicInputIndex と番号を合わせる)
+		args = append(args, musicInputArgs(job.Music)...)
+		nextInput++
+	}
+	subtitlesInput := -1
+	if job.SubtitleFile != "" && job.SubtitleCodec != "" {
+		args = append(args, "-i", job.SubtitleFile)
+		subtitlesInput = nextInput
+		nextInput++
+	}
+	chaptersInput := -1
+	if job.ChaptersFile != "" {
+		// チャプターのみを読み込むための入力
+		args = append(args, "-f", "ffmetadata", "-i", job.ChaptersFile)
+		chaptersInput = nextInput
+	}
+	return args, chaptersInput, subtitlesInput
+}
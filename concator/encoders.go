@@ -0,0 +1,122 @@
+package concator
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// encoderFallbackChains はコーデックごとに、エンコーダーを自動選択する際に試す順序
+// ハードウェアエンコーダー (NVIDIA、Intel、AMD、VAAPI、Apple) を優先し、どれも使えない場合はソフトウェアエンコーダーを使う
+var encoderFallbackChains = map[string][]string{
+	"h265": {"hevc_nvenc", "hevc_qsv", "hevc_amf", "hevc_vaapi", "hevc_videotoolbox", "libx265"},
+	"h264": {"h264_nvenc", "h264_qsv", "h264_amf", "h264_vaapi", "h264_videotoolbox", "libx264"},
+}
+
+// listEncoders はffmpegが対応しているエンコーダーの一覧を取得する
+func listEncoders() (map[string]bool, error) {
+	out, err := exec.Command(ffmpegPath, "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return nil, err
+	}
+	encoders := map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		// 各行は " V....D libx264  説明" の形式
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			encoders[fields[1]] = true
+		}
+	}
+	return encoders, nil
+}
+
+// checkFilters はffmpegが指定したフィルターに全て対応しているかを確認し、対応していないフィルターの名前を返す
+func checkFilters(names ...string) (string, error) {
+	out, err := exec.Command(ffmpegPath, "-hide_banner", "-filters").Output()
+	if err != nil {
+		return "", fmt.Errorf("フィルターの一覧を取得できません: %v", err)
+	}
+	filters := map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		// 各行は " ... zscale            V->V       説明" の形式
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			filters[fields[1]] = true
+		}
+	}
+	for _, name := range names {
+		if !filters[name] {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// isEncoderAvailable はffmpegが指定したエンコーダーに対応しているかを確認する
+func isEncoderAvailable(name string) (bool, error) {
+	encoders, err := listEncoders()
+	if err != nil {
+		return false, err
+	}
+	return encoders[name], nil
+}
+
+// encoderGPUIndex はエンコーダーに渡すGPUの番号を決める
+// VAAPIはデバイスの指定が必須のため、指定が無い場合は最初のレンダーノードを使う
+func encoderGPUIndex(encoder string, index int) int {
+	if index < 0 && strings.HasSuffix(encoder, "_vaapi") {
+		return 0
+	}
+	return index
+}
+
+// testEncoder は1フレームだけのテストエンコードを行い、エンコーダーが実際に動作するかを確認する
+// ffmpegがエンコーダーに対応していても、GPUやドライバーが無い環境では失敗する
+func testEncoder(name string, limits ResourceLimits) error {
+	gpuArgs, err := buildGPUArgs(name, encoderGPUIndex(name, -1))
+	if err != nil {
+		return err
+	}
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	args = append(args, gpuArgs.Input...)
+	args = append(args,
+		"-f", "lavfi",
+		"-i", "color=c=black:s=256x256:r=1",
+		"-frames:v", "1",
+		"-vf", "format=yuv420p"+gpuArgs.FilterSuffix,
+		"-c:v", name,
+		"-f", "null", "-",
+	)
+	out, err := combinedOutputLimited(exec.Command(ffmpegPath, args...), limits)
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		return fmt.Errorf("%v: %s", err, lines[len(lines)-1])
+	}
+	return nil
+}
+
+// detectEncoder は encoderFallbackChains の順にコーデックのエンコーダーを試し、最初に動作したものを返す
+// 対応するハードウェアが無いと分かっているエンコーダーはテストエンコードを省略する
+func detectEncoder(codec string, limits ResourceLimits) (string, error) {
+	encoders, err := listEncoders()
+	if err != nil {
+		return "", fmt.Errorf("エンコーダーの一覧を取得できません: %v", err)
+	}
+	hw := detectHardware()
+	debugf("検出したハードウェア: %s", hw)
+	for _, name := range encoderFallbackChains[codec] {
+		if !encoders[name] {
+			continue
+		}
+		if reason := hw.unsupported(name); reason != "" {
+			debugf("エンコーダー %s は使用できません: %s", name, reason)
+			continue
+		}
+		if err := testEncoder(name, limits); err != nil {
+			debugf("エンコーダー %s は使用できません: %v", name, err)
+			continue
+		}
+		return name, nil
+	}
+	return "", errors.New("使用できるエンコーダーが見つかりません。-encoder で指定してください。")
+}
@@ -0,0 +1,124 @@
+package concator
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// EventWriter は処理の経過を1行に1つのJSONオブジェクト (JSON Lines) として書き出す
+// 他のプログラムから実行する場合に、ログの代わりに機械可読な形式で結果を受け取るために使う
+// nilのEventWriterは何も書き出さない
+type EventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewEventWriter はwにイベントを書き出すEventWriterを作成する
+func NewEventWriter(w io.Writer) *EventWriter {
+	return &EventWriter{enc: json.NewEncoder(w)}
+}
+
+// emit はイベントを1行のJSONとして書き出す。並列に呼び出しても行が混ざらない
+func (e *EventWriter) emit(v any) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Encode(v)
+}
+
+// inputsEvent は結合する入力ファイルの一覧 (結合する順)
+type inputsEvent struct {
+	Event   string       `json:"event"` // "inputs"
+	Entries []inputEntry `json:"entries"`
+}
+
+// inputEntry はinputsEventの1クリップ分
+type inputEntry struct {
+	Path     string  `json:"path"`
+	Inpoint  float64 `json:"inpoint,omitempty"`
+	Outpoint float64 `json:"outpoint,omitempty"`
+	Gain     float64 `json:"gain_db,omitempty"`
+}
+
+// probeEvent は1つの入力ファイルをffprobeで調べた結果
+type probeEvent struct {
+	Event string `json:"event"` // "probe"
+	*MediaInfo
+}
+
+// progressEvent はエンコードの進捗
+type progressEvent struct {
+	Event   string  `json:"event"`    // "progress"
+	OutTime float64 `json:"out_time"` // エンコード済みの出力の長さ (秒)
+	Total   float64 `json:"total"`    // 出力の想定される長さ (秒)
+	Percent float64 `json:"percent"`
+	Speed   float64 `json:"speed,omitempty"` // 再生速度に対する倍率
+	ETA     float64 `json:"eta,omitempty"`   // 残り時間 (秒)
+	Done    bool    `json:"done"`
+}
+
+// summaryEvent は出力ファイルの作成が完了した際の結果
+type summaryEvent struct {
+	Event      string  `json:"event"` // "summary"
+	Output     string  `json:"output"`
+	Duration   float64 `json:"duration,omitempty"` // 出力の長さ (秒、ffprobeが無い場合は省略)
+	Size       int64   `json:"size"`               // 出力のバイト数
+	EncodeTime float64 `json:"encode_time"`        // エンコードにかかった時間 (秒)
+}
+
+// errorEvent は処理が失敗した際のエラー
+type errorEvent struct {
+	Event   string `json:"event"` // "error"
+	Message string `json:"message"`
+}
+
+// Error は処理が失敗したことを書き出す
+func (e *EventWriter) Error(err error) {
+	e.emit(errorEvent{Event: "error", Message: err.Error()})
+}
+
+// emitInputs は結合するクリップの一覧を書き出す
+func (e *EventWriter) emitInputs(entries []ConcatEntry) {
+	if e == nil {
+		return
+	}
+	ev := inputsEvent{Event: "inputs", Entries: []inputEntry{}}
+	for _, entry := range entries {
+		ev.Entries = append(ev.Entries, inputEntry{Path: entry.Path, Inpoint: entry.Inpoint, Outpoint: entry.Outpoint, Gain: entry.Gain})
+	}
+	e.emit(ev)
+}
+
+// emitProbes は各入力ファイルをffprobeで調べた結果を書き出す (ffprobeが無い場合は何もしない)
+func (e *EventWriter) emitProbes(files []string) {
+	if e == nil || !isFFprobeAvailable() {
+		return
+	}
+	for _, file := range files {
+		info, err := Probe(file)
+		if err != nil {
+			info = &MediaInfo{Path: file, Problem: err.Error()}
+		}
+		e.emit(probeEvent{Event: "probe", MediaInfo: info})
+	}
+}
+
+// emitSummary は出力ファイルの長さ・サイズとエンコードにかかった時間を書き出す
+func (e *EventWriter) emitSummary(output string, encodeTime time.Duration) {
+	if e == nil {
+		return
+	}
+	ev := summaryEvent{Event: "summary", Output: output, EncodeTime: encodeTime.Seconds()}
+	if info, err := os.Stat(output); err == nil {
+		ev.Size = info.Size()
+	}
+	if isFFprobeAvailable() {
+		ev.Duration, _ = probeDuration(output)
+	}
+	e.emit(ev)
+}
@@ -0,0 +1,44 @@
+package concator
+
+import "fmt"
+
+// videoFadeFilter は出力の先頭でフェードイン、末尾でフェードアウトする映像のフィルターを返す (フェードしない場合は空)
+func videoFadeFilter(job EncodeJob) string {
+	var filters []string
+	if job.FadeIn > 0 {
+		filters = append(filters, fmt.Sprintf("fade=t=in:st=0:d=%.3f", job.FadeIn))
+	}
+	if job.FadeOut > 0 {
+		filters = append(filters, fmt.Sprintf("fade=t=out:st=%.3f:d=%.3f", job.FadeOutStart, job.FadeOut))
+	}
+	return joinFilters(filters...)
+}
+
+// audioFadeFilter は出力の先頭でフェードイン、末尾でフェードアウトする音声のフィルターを返す (フェードしない場合は空)
+func audioFadeFilter(job EncodeJob) string {
+	var filters []string
+	if job.FadeIn > 0 {
+		filters = append(filters, fmt.Sprintf("afade=t=in:st=0:d=%.3f", job.FadeIn))
+	}
+	if job.FadeOut > 0 {
+		filters = append(filters, fmt.Sprintf("afade=t=out:st=%.3f:d=%.3f", job.FadeOutStart, job.FadeOut))
+	}
+	return joinFilters(filters...)
+}
+
+// segmentFade はクリップごとにエンコードする場合に、i番目のクリップの中間ファイルに適用するフェードを設定する
+// フェードインは最初のクリップ、フェードアウトは最後のクリップの中で行う
+func segmentFade(segJob *EncodeJob, job EncodeJob, i int) {
+	if i == 0 {
+		segJob.FadeIn = job.FadeIn
+	}
+	if i == len(job.Entries)-1 && job.FadeOut > 0 {
+		// 出力の時刻でのフェードアウトの開始位置を、最後のクリップの中の時刻に直す
+		start := job.FadeOutStart
+		for _, d := range job.EntryDurations[:min(i, len(job.EntryDurations))] {
+			start -= d
+		}
+		segJob.FadeOut = job.FadeOut
+		segJob.FadeOutStart = max(start, 0)
+	}
+}
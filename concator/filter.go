@@ -0,0 +1,99 @@
+package concator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// InputFilter は入力ディレクトリから検索する動画ファイルの絞り込み条件
+// ゼロ値の場合は全てのファイルを対象にする
+type InputFilter struct {
+	Since   time.Time // この日時以降のファイルのみ (ゼロ値の場合は制限しない)
+	Until   time.Time // この日時より前のファイルのみ (ゼロ値の場合は制限しない)
+	Include []string  // いずれかにマッチするファイルのみ (空の場合は全て)
+	Exclude []string  // いずれかにマッチするファイルを除外する
+
+	IgnoreFile string // 各ディレクトリで読み込む除外ファイルの名前 (空の場合は使用しない)
+
+	// ディレクトリのたどり方
+	MaxDepth       int  // 検索する深さの上限 (1: 入力ディレクトリの直下のみ、0: 無制限)
+	FollowSymlinks bool // ディレクトリへのシンボリックリンクもたどる
+	IncludeHidden  bool // . で始まる名前の隠しファイル・ディレクトリも検索する
+}
+
+// timestampLayouts は -since/-until に指定できる日時の形式 (ローカル時刻として解釈する)
+var timestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+}
+
+// parseTimestamp は -since/-until の日時を解析する
+// 日付のみ ("2006-01-02") の場合、endOfDayがtrueならその日の終わり (翌日の0時) とする
+func parseTimestamp(s string, endOfDay bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("日時の形式が正しくありません (例: 2024-05-01, 2024-05-01 13:30): %s", s)
+}
+
+// splitPatterns はカンマ区切りのglobパターンを分割し、形式を確認する
+func splitPatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("globパターンの形式が正しくありません: %s", p)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// matchAny はファイル名、または入力ディレクトリからの相対パスがいずれかのパターンにマッチするかを返す
+func matchAny(patterns []string, relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, filepath.Base(relPath)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(filepath.ToSlash(p), relPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchName はファイルが -include/-exclude の条件を満たすかを返す
+func (f InputFilter) matchName(relPath string) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, relPath) {
+		return false
+	}
+	return !matchAny(f.Exclude, relPath)
+}
+
+// matchTime はファイルの日時が -since/-until の範囲内かを返す
+func (f InputFilter) matchTime(t time.Time) bool {
+	if !f.Since.IsZero() && t.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !t.Before(f.Until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package concator
+
+import "fmt"
+
+// fitModes は -fit と -scale-mode に指定できる値
+var fitModes = map[string]bool{
+	"pad":     true, // 縦横比を保ったまま縮小し、余白を黒で埋める
+	"crop":    true, // 縦横比を保ったまま拡大し、はみ出した部分を切り取る
+	"stretch": true, // 出力の解像度に合わせて引き伸ばす
+}
+
+// buildScaleFilter は出力の解像度に合わせるscaleフィルターを組み立てる
+// 出力と向き (縦長・横長) が異なるクリップは fit、向きが同じで縦横比が異なるクリップは scaleMode に従って出力の枠に収める
+func buildScaleFilter(res, fit, scaleMode string) (string, error) {
+	if !fitModes[fit] {
+		return "", fmt.Errorf("-fit には pad、crop、stretch のいずれかを指定してください: %s", fit)
+	}
+	if !fitModes[scaleMode] {
+		return "", fmt.Errorf("-scale-mode には pad、crop、stretch のいずれかを指定してください: %s", scaleMode)
+	}
+	w, h, err := parseResolution(res)
+	if err != nil {
+		return "", err
+	}
+
+	// 全てのクリップを同じ方法で収める場合は、scaleフィルターの縦横比の維持をそのまま使う
+	if fit == scaleMode {
+		switch fit {
+		case "pad":
+			return fmt.Sprintf("scale=%[1]d:%[2]d:force_original_aspect_ratio=decrease,pad=%[1]d:%[2]d:(ow-iw)/2:(oh-ih)/2,setsar=1", w, h), nil
+		case "crop":
+			return fmt.Sprintf("scale=%[1]d:%[2]d:force_original_aspect_ratio=increase,crop=%[1]d:%[2]d,setsar=1", w, h), nil
+		default:
+			return fmt.Sprintf("scale=%dx%d", w, h), nil
+		}
+	}
+
+	// concat demuxerではクリップごとにフィルターを分けられないため、入力の表示上の縦横比 (dar) の式で切り替える
+	// 出力と向きが異なるクリップの判定 (正方形の出力は横長として扱う)
+	mismatch := "lt(dar,1)"
+	if h > w {
+		mismatch = "gt(dar,1)"
+	}
+	scale := fmt.Sprintf("scale=w='if(%s,%s,%s)':h='if(%s,%s,%s)'",
+		mismatch, scaledSize(fit, w, h, "*"), scaledSize(scaleMode, w, h, "*"),
+		mismatch, scaledSize(fit, h, w, "/"), scaledSize(scaleMode, h, w, "/"))
+	// crop で枠からはみ出した部分を切り取り、pad で枠に足りない部分を埋める (枠と同じ大きさのクリップには影響しない)
+	return fmt.Sprintf("%[1]s,crop=w='min(iw,%[2]d)':h='min(ih,%[3]d)',pad=%[2]d:%[3]d:(ow-iw)/2:(oh-ih)/2,setsar=1", scale, w, h), nil
+}
+
+// scaledSize は収め方に応じた拡大・縮小後の幅または高さの式を返す
+// size は求める辺の出力の大きさ、other はもう一方の辺の出力の大きさで、op で縦横比 (dar) を掛けるか割るかを指定する
+func scaledSize(mode string, size, other int, op string) string {
+	switch mode {
+	case "pad":
+		return fmt.Sprintf("trunc(min(%d,%d%sdar)/2)*2", size, other, op)
+	case "crop":
+		return fmt.Sprintf("trunc(max(%d,%d%sdar)/2)*2", size, other, op)
+	default:
+		return fmt.Sprint(size)
+	}
+}
@@ -0,0 +1,167 @@
+package concator
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// GPUArgs はGPUを指定するために必要なffmpegオプションをまとめた構造体
+type GPUArgs struct {
+	Input        []string // -i より前に置く入力オプション
+	Output       []string // 出力オプション
+	FilterSuffix string   // ビデオフィルターの末尾に追加するフィルター
+}
+
+// countNvidiaGPUs はnvidia-smiでNVIDIA GPUの数を取得する。取得できない場合は-1を返す
+func countNvidiaGPUs() int {
+	out, err := exec.Command("nvidia-smi", "-L").Output()
+	if err != nil {
+		return -1
+	}
+	count := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "GPU ") {
+			count++
+		}
+	}
+	return count
+}
+
+// renderNodePath はLinuxのDRMレンダーノードのパスを返す (GPU 0 が renderD128)
+func renderNodePath(index int) string {
+	return fmt.Sprintf("/dev/dri/renderD%d", 128+index)
+}
+
+// countRenderNodes はLinuxのDRMレンダーノードの数を取得する
+func countRenderNodes() int {
+	matches, err := filepath.Glob("/dev/dri/renderD*")
+	if err != nil || len(matches) == 0 {
+		return -1
+	}
+	return len(matches)
+}
+
+// buildGPUArgs はエンコーダーの種類に応じて、指定したGPUでエンコードするためのオプションを組み立てる
+func buildGPUArgs(encoder string, index int) (*GPUArgs, error) {
+	if index < 0 {
+		return &GPUArgs{}, nil
+	}
+
+	switch {
+	case strings.HasSuffix(encoder, "_nvenc"):
+		if count := countNvidiaGPUs(); count >= 0 && index >= count {
+			return nil, fmt.Errorf("GPU %d は存在しません (検出されたNVIDIA GPU: %d個)", index, count)
+		}
+		// デコードはCPUで行うため、エンコーダー側のGPUのみ指定する
+		return &GPUArgs{
+			Output: []string{"-gpu", strconv.Itoa(index)},
+		}, nil
+	case strings.HasSuffix(encoder, "_vaapi"):
+		if count := countRenderNodes(); count >= 0 && index >= count {
+			return nil, fmt.Errorf("GPU %d は存在しません (検出されたレンダーノード: %d個)", index, count)
+		}
+		// VAAPIはフレームをGPUメモリへアップロードしてからエンコードする
+		return &GPUArgs{
+			Input:        []string{"-vaapi_device", renderNodePath(index)},
+			FilterSuffix: ",format=nv12,hwupload",
+		}, nil
+	case strings.HasSuffix(encoder, "_qsv"):
+		device := strconv.Itoa(index)
+		if runtime.GOOS == "linux" {
+			if count := countRenderNodes(); count >= 0 && index >= count {
+				return nil, fmt.Errorf("GPU %d は存在しません (検出されたレンダーノード: %d個)", index, count)
+			}
+			device = renderNodePath(index)
+		}
+		return &GPUArgs{
+			Input: []string{"-qsv_device", device},
+		}, nil
+	case strings.HasSuffix(encoder, "_amf"):
+		// ffmpegのAMFエンコーダーにはデバイスを選ぶオプションが無く、常に既定のGPUでエンコードする
+		return nil, fmt.Errorf("エンコーダー %s ではGPUを指定できません。-gpu を外すか、別のエンコーダーを指定してください", encoder)
+	default:
+		warnf("エンコーダー %s はGPUの指定に対応していないため、-gpu を無視します。", encoder)
+		return &GPUArgs{}, nil
+	}
+}
+
+// hardwareInfo はハードウェアエンコーダーを使えるかの判断に使う、検出したGPUとドライバーの情報
+type hardwareInfo struct {
+	nvidiaGPUs  int  // NVIDIA GPUの数 (nvidia-smiが無い場合は-1)
+	renderNodes int  // LinuxのDRMレンダーノードの数 (無い場合は-1)
+	amfRuntime  bool // AMDのAMFランタイムがインストールされているか
+}
+
+// amfRuntimePaths はOSごとにAMFランタイムのライブラリを探すパス
+var amfRuntimePaths = map[string][]string{
+	"windows": {`C:\Windows\System32\amfrt64.dll`},
+	"linux": {
+		"/usr/lib/x86_64-linux-gnu/libamfrt64.so.1",
+		"/usr/lib64/libamfrt64.so.1",
+		"/usr/lib/libamfrt64.so.1",
+		"/opt/amdgpu-pro/lib/x86_64-linux-gnu/libamfrt64.so.1",
+		"/opt/amdgpu-pro/lib64/libamfrt64.so.1",
+	},
+}
+
+// detectHardware はGPUとドライバーの有無を調べる
+func detectHardware() hardwareInfo {
+	hw := hardwareInfo{nvidiaGPUs: countNvidiaGPUs(), renderNodes: -1}
+	if runtime.GOOS == "linux" {
+		hw.renderNodes = countRenderNodes()
+	}
+	for _, path := range amfRuntimePaths[runtime.GOOS] {
+		if _, err := os.Stat(path); err == nil {
+			hw.amfRuntime = true
+			break
+		}
+	}
+	return hw
+}
+
+// String はログに表示するための要約を返す
+func (hw hardwareInfo) String() string {
+	return fmt.Sprintf("NVIDIA GPU %d個、レンダーノード %d個、AMF %t (%s/%s)", max(hw.nvidiaGPUs, 0), max(hw.renderNodes, 0), hw.amfRuntime, runtime.GOOS, runtime.GOARCH)
+}
+
+// unsupported はエンコーダーに必要なハードウェアやドライバーが無いと分かっている場合に、その理由を返す
+// 判断できない場合は空文字列を返し、テストエンコードで確認する
+func (hw hardwareInfo) unsupported(encoder string) string {
+	switch {
+	case strings.HasSuffix(encoder, "_nvenc"):
+		if hw.nvidiaGPUs < 1 {
+			return "NVIDIA GPUが見つかりません"
+		}
+	case strings.HasSuffix(encoder, "_vaapi"):
+		if runtime.GOOS != "linux" {
+			return "VAAPIはLinuxでのみ使用できます"
+		}
+		if hw.renderNodes < 1 {
+			return "レンダーノード (/dev/dri/renderD*) が見つかりません"
+		}
+	case strings.HasSuffix(encoder, "_qsv"):
+		if runtime.GOOS == "linux" && hw.renderNodes < 1 {
+			return "レンダーノード (/dev/dri/renderD*) が見つかりません"
+		}
+		if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+			return "QSVはLinuxとWindowsでのみ使用できます"
+		}
+	case strings.HasSuffix(encoder, "_amf"):
+		if _, ok := amfRuntimePaths[runtime.GOOS]; !ok {
+			return "AMFはLinuxとWindowsでのみ使用できます"
+		}
+		if !hw.amfRuntime {
+			return "AMFのランタイム (AMDのドライバー) が見つかりません"
+		}
+	case strings.HasSuffix(encoder, "_videotoolbox"):
+		if runtime.GOOS != "darwin" {
+			return "VideoToolboxはmacOSでのみ使用できます"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package concator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// splitFilterChain はフィルターチェーンを個々のフィルターに分割する
+// シングルクォートやバックスラッシュでエスケープされたカンマでは分割しない
+func splitFilterChain(chain string) []string {
+	var filters []string
+	var current strings.Builder
+	quoted := false
+	escaped := false
+	for _, r := range chain {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '\'':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			filters = append(filters, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		filters = append(filters, current.String())
+	}
+	return filters
+}
+
+// writeFilterGraph は映像・音声のフィルターグラフをファイルに書き出す
+// 拡張子が .dot の場合は入力→フィルター→出力の構成をGraphviz形式で書き出す
+func writeFilterGraph(path, videoFilter, audioFilter string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if strings.ToLower(filepath.Ext(path)) != ".dot" {
+		fmt.Fprintf(writer, "[video] %s\n", videoFilter)
+		if audioFilter != "" {
+			fmt.Fprintf(writer, "[audio] %s\n", audioFilter)
+		}
+		return writer.Flush()
+	}
+
+	fmt.Fprintln(writer, "digraph filtergraph {")
+	fmt.Fprintln(writer, "  rankdir=LR;")
+	fmt.Fprintln(writer, "  node [shape=box];")
+	fmt.Fprintln(writer, `  input [label="concat", shape=ellipse];`)
+	fmt.Fprintln(writer, `  output [label="output", shape=ellipse];`)
+	writeDotChain(writer, "v", videoFilter)
+	if audioFilter != "" {
+		writeDotChain(writer, "a", audioFilter)
+	} else {
+		fmt.Fprintln(writer, `  input -> output [label="a"];`)
+	}
+	fmt.Fprintln(writer, "}")
+	return writer.Flush()
+}
+
+// writeDotChain はフィルターチェーンをGraphvizのノードとエッジとして書き出す
+func writeDotChain(writer *bufio.Writer, stream, chain string) {
+	prev := "input"
+	for i, f := range splitFilterChain(chain) {
+		node := fmt.Sprintf("%s%d", stream, i)
+		label := strings.ReplaceAll(f, `"`, `\"`)
+		fmt.Fprintf(writer, "  %s [label=\"%s\"];\n", node, label)
+		fmt.Fprintf(writer, "  %s -> %s;\n", prev, node)
+		prev = node
+	}
+	fmt.Fprintf(writer, "  %s -> output [label=\"%s\"];\n", prev, stream)
+}
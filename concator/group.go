@@ -0,0 +1,70 @@
+package concator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// groupKey は -group-by の単位に応じたグループの名前を返す (例: 2024-05-01、2024-05-01_13、2024-W18)
+func groupKey(t time.Time, groupBy string) (string, error) {
+	switch groupBy {
+	case "hour":
+		return t.Format("2006-01-02_15"), nil
+	case "day":
+		return t.Format("2006-01-02"), nil
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week), nil
+	default:
+		return "", fmt.Errorf("-group-by には hour、day、week のいずれかを指定してください: %s", groupBy)
+	}
+}
+
+// runGroups は入力ファイルを日時ごとのグループに分け、グループごとに別々の出力ファイルを作成する
+// グループ内のクリップは通常と同じ順序で結合する
+func (j *Job) runGroups(ctx context.Context, sortKey string, explicitFiles []string) error {
+	if j.Source != "" || j.OrientationGroups {
+		return errors.New("-group-by は -source、-orientation-groups と同時に指定できません。")
+	}
+	if _, err := groupKey(time.Time{}, j.GroupBy); err != nil {
+		return err
+	}
+	files, _, err := j.discoverInputs(ctx, sortKey, explicitFiles)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	times, err := clipTimes(files, j.clipTimeKey(sortKey))
+	if err != nil {
+		return err
+	}
+	var keys []string
+	groups := map[string][]string{}
+	for i, file := range files {
+		key, _ := groupKey(times[i], j.GroupBy)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], file)
+	}
+	infof("%d個の動画ファイルを%d個のグループに分けて結合します。", len(files), len(keys))
+
+	for _, key := range keys {
+		groupJob := *j
+		groupJob.GroupBy = ""
+		groupJob.groupName = key
+		// 検索済みのファイルを指定順に結合する
+		groupJob.Files, groupJob.ListFile, groupJob.Manifest = groups[key], "", nil
+		if !isOutputTemplate(j.Output) {
+			// テンプレートが無い場合もグループ同士で上書きしないよう、名前を付け加える
+			groupJob.Output = suffixedOutputPath(j.Output, "_"+key)
+		}
+		infof("グループ %s (%d個) を結合します...", key, len(groups[key]))
+		if err := groupJob.Run(ctx); err != nil {
+			return fmt.Errorf("グループ %s: %v", key, err)
+		}
+	}
+	return nil
+}
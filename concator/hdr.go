@@ -0,0 +1,268 @@
+package concator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// hdrTransfers はHDRの伝達特性 (ffprobeの color_transfer) と表示名
+var hdrTransfers = map[string]string{
+	"smpte2084":    "HDR10 (PQ)",
+	"arib-std-b67": "HLG",
+}
+
+// ColorInfo はffprobeで取得した映像の色の情報
+type ColorInfo struct {
+	PixFmt    string // ピクセルフォーマット (例: "yuv420p10le")
+	Primaries string // 色域 (例: "bt2020")
+	Transfer  string // 伝達特性 (例: "smpte2084")
+	Space     string // 色空間の行列 (例: "bt2020nc")
+
+	MasterDisplay string // マスタリングディスプレイの情報 (x265の master-display の形式、無い場合は空)
+	MaxCLL        string // 最大コンテンツ輝度と最大フレーム平均輝度 (x265の max-cll の形式、無い場合は空)
+}
+
+// IsHDR はHDRの伝達特性を持つかを返す
+func (c *ColorInfo) IsHDR() bool {
+	_, ok := hdrTransfers[c.Transfer]
+	return ok
+}
+
+// sameHDR は色域・伝達特性・色空間が一致するかを返す (マスタリングの情報は比較しない)
+func (c *ColorInfo) sameHDR(other *ColorInfo) bool {
+	return c.Primaries == other.Primaries && c.Transfer == other.Transfer && c.Space == other.Space
+}
+
+// colorProbeOutput はffprobeのJSON出力のうち、色の情報と最初のフレームのサイドデータ
+type colorProbeOutput struct {
+	Streams []struct {
+		PixFmt    string `json:"pix_fmt"`
+		Primaries string `json:"color_primaries"`
+		Transfer  string `json:"color_transfer"`
+		Space     string `json:"color_space"`
+	} `json:"streams"`
+	Frames []struct {
+		SideData []struct {
+			Type         string `json:"side_data_type"`
+			RedX         string `json:"red_x"`
+			RedY         string `json:"red_y"`
+			GreenX       string `json:"green_x"`
+			GreenY       string `json:"green_y"`
+			BlueX        string `json:"blue_x"`
+			BlueY        string `json:"blue_y"`
+			WhiteX       string `json:"white_point_x"`
+			WhiteY       string `json:"white_point_y"`
+			MaxLuminance string `json:"max_luminance"`
+			MinLuminance string `json:"min_luminance"`
+			MaxContent   int    `json:"max_content"`
+			MaxAverage   int    `json:"max_average"`
+		} `json:"side_data_list"`
+	} `json:"frames"`
+}
+
+// probeColor はffprobeで動画ファイルの最初のビデオストリームの色の情報を取得する
+// マスタリングディスプレイとコンテンツ輝度の情報は最初のフレームのサイドデータから取得する
+func probeColor(path string) (*ColorInfo, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-read_intervals", "%+#1",
+		"-show_entries", "stream=pix_fmt,color_primaries,color_transfer,color_space:frame=side_data_list",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+	var parsed colorProbeOutput
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, fmt.Errorf("ffprobeの出力の解析に失敗しました: %s, %v", path, err)
+	}
+	if len(parsed.Streams) == 0 {
+		return nil, fmt.Errorf("ビデオストリームが見つかりません: %s", path)
+	}
+	stream := parsed.Streams[0]
+	info := &ColorInfo{
+		PixFmt:    stream.PixFmt,
+		Primaries: stream.Primaries,
+		Transfer:  stream.Transfer,
+		Space:     stream.Space,
+	}
+	for _, frame := range parsed.Frames {
+		for _, sd := range frame.SideData {
+			switch sd.Type {
+			case "Mastering display metadata":
+				// x265の master-display は色度を0.00002単位、輝度を0.0001cd/m²単位の整数で指定する
+				c := func(s string) int64 { return int64(parseFrameRate(s)*50000 + 0.5) }
+				l := func(s string) int64 { return int64(parseFrameRate(s)*10000 + 0.5) }
+				if sd.MaxLuminance != "" {
+					info.MasterDisplay = fmt.Sprintf("G(%d,%d)B(%d,%d)R(%d,%d)WP(%d,%d)L(%d,%d)",
+						c(sd.GreenX), c(sd.GreenY), c(sd.BlueX), c(sd.BlueY), c(sd.RedX), c(sd.RedY),
+						c(sd.WhiteX), c(sd.WhiteY), l(sd.MaxLuminance), l(sd.MinLuminance))
+				}
+			case "Content light level metadata":
+				info.MaxCLL = fmt.Sprintf("%d,%d", sd.MaxContent, sd.MaxAverage)
+			}
+		}
+	}
+	return info, nil
+}
+
+// probeColors は各ファイルの色の情報を並列に取得する
+func probeColors(files []string, jobs int) (map[string]*ColorInfo, error) {
+	infos := make([]*ColorInfo, len(files))
+	err := runParallel(len(files), jobs, func(i int) error {
+		var err error
+		infos[i], err = probeColor(files[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	colors := make(map[string]*ColorInfo, len(files))
+	for i, file := range files {
+		colors[file] = infos[i]
+	}
+	return colors, nil
+}
+
+// checkTonemapFilters はHDRからSDRへの変換に使うフィルター (zscale、tonemap) にffmpegが対応しているかを確認する
+func checkTonemapFilters() error {
+	missing, err := checkFilters("zscale", "tonemap")
+	if err != nil {
+		return err
+	}
+	if missing != "" {
+		return fmt.Errorf("HDRをSDRに変換するには %s フィルターに対応したffmpeg (libzimg付きのビルド) が必要です。-tonemap none で変換せずに結合できます。", missing)
+	}
+	return nil
+}
+
+// tonemapFilter はHDRのクリップをBT.709のSDRに変換するフィルターを返す
+// 入力の色の情報がフレームに付いていない場合に備え、zscaleに入力の特性を明示する
+func tonemapFilter(c *ColorInfo) string {
+	primaries, space := c.Primaries, c.Space
+	if primaries == "" || primaries == "unknown" {
+		primaries = "bt2020"
+	}
+	if space == "" || space == "unknown" {
+		space = "bt2020nc"
+	}
+	return fmt.Sprintf("zscale=tin=%s:pin=%s:min=%s:t=linear:npl=100,format=gbrpf32le,zscale=p=bt709,tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p",
+		c.Transfer, primaries, space)
+}
+
+// sdrColorArgs はSDRに変換した出力にBT.709の色の情報を付けるffmpegの引数
+var sdrColorArgs = []string{"-color_primaries", "bt709", "-color_trc", "bt709", "-colorspace", "bt709"}
+
+// hdrOutputArgs はHDRの色の情報を保持して10bitでエンコードするためのffmpegの引数を返す
+// マスタリングディスプレイとコンテンツ輝度の情報はlibx265でのみビットストリームに書き込める
+func hdrOutputArgs(encoder string, c *ColorInfo) ([]string, error) {
+	var pixFmt string
+	switch {
+	case encoder == "libx265", encoder == "libaom-av1", encoder == "libvpx-vp9":
+		pixFmt = "yuv420p10le"
+	case encoder == "hevc_nvenc", encoder == "hevc_qsv", encoder == "hevc_amf", encoder == "hevc_videotoolbox":
+		pixFmt = "p010le"
+	case encoder == "hevc_vaapi":
+		// VAAPIはフィルターでアップロードする際の形式で決まる (hdrGPUArgs を参照)
+	default:
+		return nil, fmt.Errorf("エンコーダー %s は10bitのHDRの出力に対応していません。-codec h265 などを指定するか、-tonemap sdr でSDRに変換してください。", encoder)
+	}
+	var args []string
+	if pixFmt != "" {
+		args = append(args, "-pix_fmt", pixFmt)
+	}
+	args = append(args, hdrColorTags(c)...)
+	if encoder == "libx265" {
+		params := []string{"repeat-headers=1"}
+		if c.Transfer == "smpte2084" {
+			// HDR10のSEIを出力し、PQ向けの量子化の最適化を行う (HLGでは不要)
+			params = append(params, "hdr10=1", "hdr10-opt=1")
+		}
+		if c.MasterDisplay != "" {
+			params = append(params, "master-display="+c.MasterDisplay)
+		}
+		if c.MaxCLL != "" {
+			params = append(params, "max-cll="+c.MaxCLL)
+		}
+		args = append(args, "-x265-params", strings.Join(params, ":"))
+	} else if c.MasterDisplay != "" {
+		debugf("%s はマスタリングディスプレイの情報の書き込みに対応していないため、色域と伝達特性のみを保持します。", encoder)
+	}
+	return args, nil
+}
+
+// hdrColorTags はHDRの色域・伝達特性・色空間を出力に付けるffmpegの引数を返す
+func hdrColorTags(c *ColorInfo) []string {
+	return []string{"-color_primaries", c.Primaries, "-color_trc", c.Transfer, "-colorspace", c.Space}
+}
+
+// hdrGPUArgs はHDRを保持する場合に、VAAPIでフレームを10bitのままアップロードするようにする
+func hdrGPUArgs(gpuArgs *GPUArgs) *GPUArgs {
+	hdr := *gpuArgs
+	hdr.FilterSuffix = strings.Replace(hdr.FilterSuffix, "format=nv12", "format=p010", 1)
+	return &hdr
+}
+
+// applyHDRPolicy は -tonemap に従ってHDRの入力の扱いを決める
+// 全ての入力が同じ種類のHDRで auto の場合は、色の情報を保持するための出力の引数と、保持するHDRの色の情報を返す
+// SDRに変換する場合は、HDRのクリップのエントリに変換のフィルターを設定し、色の情報はnilを返す
+func (j *Job) applyHDRPolicy(entries []ConcatEntry, encoder string) (args []string, hdr *ColorInfo, err error) {
+	var paths []string
+	for _, entry := range entries {
+		if !slices.Contains(paths, entry.Path) {
+			paths = append(paths, entry.Path)
+		}
+	}
+	colors, err := probeColors(paths, j.Jobs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("色の情報の取得に失敗しました: %v", err)
+	}
+	var first *ColorInfo
+	hdrCount, same := 0, true
+	for _, path := range paths {
+		c := colors[path]
+		if !c.IsHDR() {
+			continue
+		}
+		hdrCount++
+		if first == nil {
+			first = c
+		} else if !first.sameHDR(c) {
+			same = false
+		}
+	}
+	if hdrCount == 0 {
+		return nil, nil, nil
+	}
+
+	if j.Tonemap == "auto" && hdrCount == len(paths) && same {
+		infof("全ての入力が%sのため、HDRの色の情報を保持して10bitでエンコードします。", hdrTransfers[first.Transfer])
+		args, err := hdrOutputArgs(encoder, first)
+		return args, first, err
+	}
+	switch {
+	case j.Tonemap == "sdr":
+		infof("HDRの入力%d個をSDRに変換します。", hdrCount)
+	case hdrCount == len(paths):
+		infof("種類の異なるHDRの入力が混在しているため、SDRに変換します。HDRのまま出力するには入力を揃えてください。")
+	default:
+		infof("HDRとSDRの入力が混在しているため、HDRの入力%d個をSDRに変換します。", hdrCount)
+	}
+	if err := checkTonemapFilters(); err != nil {
+		return nil, nil, err
+	}
+	for i, entry := range entries {
+		if c := colors[entry.Path]; c.IsHDR() {
+			debugf("SDRに変換します: %s (%s)", filepath.Base(entry.Path), hdrTransfers[c.Transfer])
+			entries[i].VideoFilter = joinFilters(entries[i].VideoFilter, tonemapFilter(c))
+		}
+	}
+	return sdrColorArgs, nil, nil
+}
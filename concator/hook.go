@@ -0,0 +1,99 @@
+package concator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// runHook はフックのコマンドを環境変数envを追加して実行し、出力をログに表示する
+func runHook(ctx context.Context, name, command string, env []string) error {
+	infof("%s を実行中: %s", name, command)
+	cmd := hookCommand(ctx, command)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			infof("%s: %s", name, line)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s が失敗しました: %v", name, err)
+	}
+	return nil
+}
+
+// runWithHooks は PreHook を実行してから結合を行い、結果に関わらず PostHook の実行と NotifyURL への通知を行う
+// PostHook には結果を環境変数 VIDEO_CONCATOR_STATUS (success, failure, interrupted)、VIDEO_CONCATOR_OUTPUT、
+// VIDEO_CONCATOR_DURATION (処理にかかった秒数)、VIDEO_CONCATOR_ERROR (失敗した場合のエラー) で渡す
+func (j *Job) runWithHooks(ctx context.Context) error {
+	preHook, postHook, notifyURL := j.PreHook, j.PostHook, j.NotifyURL
+	// グループやパートごとに改めて実行する場合に、フックと通知を繰り返さない
+	j.PreHook, j.PostHook, j.NotifyURL = "", "", ""
+	notifyFormat := ""
+	if notifyURL != "" {
+		var err error
+		if notifyFormat, err = validateNotify(notifyURL, j.NotifyFormat); err != nil {
+			return err
+		}
+	}
+	if j.DryRun || j.Describe {
+		infof("エンコードしないため、フックの実行と通知は行いません。")
+		return j.run(ctx)
+	}
+
+	started := time.Now()
+	env := []string{"VIDEO_CONCATOR_OUTPUT=" + j.Output, "VIDEO_CONCATOR_DIR=" + j.Dir}
+	var err error
+	if preHook != "" {
+		err = runHook(ctx, "-pre-hook", preHook, env)
+	}
+	if err == nil {
+		err = j.run(ctx)
+	}
+
+	status := "success"
+	switch {
+	case ctx.Err() != nil:
+		status = "interrupted"
+	case err != nil:
+		status = "failure"
+	}
+	// 中断された場合も実行できるよう、ctxの取り消しは引き継がない
+	afterCtx := context.WithoutCancel(ctx)
+	if postHook != "" {
+		env = []string{
+			"VIDEO_CONCATOR_STATUS=" + status,
+			// テンプレートや -output-suffix で決まった出力ファイル名を渡す
+			"VIDEO_CONCATOR_OUTPUT=" + j.Output,
+			"VIDEO_CONCATOR_DIR=" + j.Dir,
+			fmt.Sprintf("VIDEO_CONCATOR_DURATION=%.1f", time.Since(started).Seconds()),
+		}
+		if err != nil {
+			env = append(env, "VIDEO_CONCATOR_ERROR="+err.Error())
+		}
+		if hookErr := runHook(afterCtx, "-post-hook", postHook, env); hookErr != nil {
+			if err != nil {
+				warnf("%v", hookErr)
+			} else {
+				status, err = "failure", hookErr
+			}
+		}
+	}
+
+	if notifyURL != "" {
+		n := notification{Status: status, Output: j.Output, Duration: time.Since(started).Seconds()}
+		if err != nil {
+			n.Error = err.Error()
+		}
+		// 通知に失敗しても結合の結果は変えない
+		if notifyErr := sendNotification(afterCtx, notifyURL, notifyFormat, n); notifyErr != nil {
+			warnf("完了の通知に失敗しました: %v", notifyErr)
+		} else {
+			debugf("完了を通知しました (%s)", notifyFormat)
+		}
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package concator
+
+import (
+	"context"
+	"os/exec"
+)
+
+// hookCommand はフックのコマンドをコマンドプロンプトで実行するコマンドを作成する
+func hookCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
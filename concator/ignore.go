@@ -0,0 +1,133 @@
+package concator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultIgnoreFile は -ignore-file の既定のファイル名
+const defaultIgnoreFile = ".concatignore"
+
+// ignoreRule は除外ファイル (.concatignore) の1行のパターン
+type ignoreRule struct {
+	base     string // 除外ファイルのあるディレクトリの、入力ディレクトリからの相対パス ("/" 区切り、直下は "")
+	pattern  string
+	negate   bool // "!" で始まり、除外を取り消す
+	dirOnly  bool // "/" で終わり、ディレクトリのみにマッチする
+	anchored bool // "/" を含み、除外ファイルのあるディレクトリからの相対パスでマッチする
+}
+
+// ignoreRules は入力ディレクトリから各ディレクトリまでにある除外ファイルのパターン (後のものほど優先する)
+type ignoreRules []ignoreRule
+
+// loadIgnoreFile はdir内の除外ファイルを読み込み、parentの後に続けたパターンを返す
+// 除外ファイルの書式はgitignoreと同じく、1行に1つのglobパターン (# で始まる行はコメント、! で始まる行は除外の取り消し、
+// / で終わるパターンはディレクトリのみ、途中に / を含むパターンは除外ファイルのあるディレクトリからの相対パス、** は任意の深さのディレクトリ)
+func loadIgnoreFile(dir, base, name string, parent ignoreRules) (ignoreRules, error) {
+	file := filepath.Join(dir, name)
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return parent, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// 同じ親を持つディレクトリ同士でパターンを共有しないよう、新しいスライスに追加する
+	rules := append(ignoreRules(nil), parent...)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if rule.negate = strings.HasPrefix(line, "!"); rule.negate {
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		if rule.dirOnly = strings.HasSuffix(line, "/"); rule.dirOnly {
+			line = strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern == "" {
+			continue
+		}
+		if _, err := path.Match(rule.pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s の%d行目のパターンの形式が正しくありません: %s", file, n, line)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	debugf("除外ファイルを読み込みました: %s", file)
+	return rules, nil
+}
+
+// ignored はrelPath (入力ディレクトリからの相対パス) のファイルまたはディレクトリを除外するかを返す
+// gitignoreと同じく、最後にマッチしたパターンに従う
+func (rules ignoreRules) ignored(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(relPath)
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		p := relPath
+		if rule.base != "" {
+			var ok bool
+			if p, ok = strings.CutPrefix(relPath, rule.base+"/"); !ok {
+				continue
+			}
+		}
+		var matched bool
+		if rule.anchored {
+			matched = matchPathPattern(rule.pattern, p)
+		} else {
+			matched, _ = path.Match(rule.pattern, path.Base(p))
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchPathPattern は "/" 区切りのパスがパターンにマッチするかを返す
+// パターンの "**" の要素は0個以上のディレクトリにマッチする
+func matchPathPattern(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments はパスの要素ごとにパターンの要素と照合する
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
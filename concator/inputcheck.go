@@ -0,0 +1,53 @@
+package concator
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkInput はffprobeで入力ファイルを読み込み、結合できないファイルであれば理由を返す
+// 問題が無い場合は空文字列を返す
+func checkInput(file string) string {
+	info, err := os.Stat(file)
+	if err != nil {
+		return "ファイルを開けません"
+	}
+	if info.Size() == 0 {
+		return "ファイルが空です"
+	}
+	types, err := probeStreamTypes(file)
+	if err != nil {
+		return "ffprobeで読み込めません (破損している可能性があります)"
+	}
+	if !hasStreamType(types, "video") {
+		return "ビデオストリームがありません"
+	}
+	if d, err := probeDuration(file); err != nil || d <= 0 {
+		return "長さを取得できません (破損している可能性があります)"
+	}
+	return ""
+}
+
+// validateInputs は全ての入力ファイルをffprobeで確認し、問題のあるファイルを報告する
+// abortがfalseの場合は問題のあるファイルを除外し、trueの場合は全ての問題を報告した後にエラーを返す
+func validateInputs(files []string, abort bool) ([]string, error) {
+	var kept []string
+	invalid := 0
+	for _, file := range files {
+		reason := checkInput(file)
+		if reason == "" {
+			kept = append(kept, file)
+			continue
+		}
+		invalid++
+		if abort {
+			warnf("問題のある入力ファイル: %s (%s)", file, reason)
+		} else {
+			warnf("%s のためスキップします: %s", reason, file)
+		}
+	}
+	if abort && invalid > 0 {
+		return nil, fmt.Errorf("%d個の入力ファイルに問題があります。-on-error skip で除外して続行できます", invalid)
+	}
+	return kept, nil
+}
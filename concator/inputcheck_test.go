@@ -0,0 +1,66 @@
+package concator
+
+import (
+	"bytes"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// synthesize はffmpegのlavfiの入力からテスト用のファイルを作成する
+// ffmpegとffprobeが無い環境ではテストをスキップする
+func synthesize(t *testing.T, path string, args ...string) {
+	t.Helper()
+	if _, err := exec.LookPath(ffmpegPath); err != nil {
+		t.Skip("ffmpegが見つかりません")
+	}
+	if _, err := exec.LookPath(ffprobePath); err != nil {
+		t.Skip("ffprobeが見つかりません")
+	}
+	args = append([]string{"-v", "error", "-y"}, args...)
+	if out, err := exec.Command(ffmpegPath, append(args, path)...).CombinedOutput(); err != nil {
+		t.Fatalf("テスト用のファイルの作成に失敗しました: %v\n%s", err, out)
+	}
+}
+
+// captureLog はテストの間のログをバッファに書き出す
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	saved := logger
+	logger = slog.New(&textHandler{out: &buf, mu: new(sync.Mutex)})
+	t.Cleanup(func() { logger = saved })
+	return &buf
+}
+
+func TestValidateInputsAudioOnly(t *testing.T) {
+	dir := t.TempDir()
+	video := filepath.Join(dir, "video.mp4")
+	audio := filepath.Join(dir, "memo.mov")
+	synthesize(t, video, "-f", "lavfi", "-i", "testsrc=duration=1:size=160x120:rate=10", "-pix_fmt", "yuv420p")
+	synthesize(t, audio, "-f", "lavfi", "-i", "anullsrc=channel_layout=mono:sample_rate=8000", "-t", "1", "-c:a", "aac")
+
+	t.Run("skip", func(t *testing.T) {
+		buf := captureLog(t)
+		kept, err := validateInputs([]string{video, audio}, false)
+		if err != nil {
+			t.Fatalf("validateInputs: %v", err)
+		}
+		if len(kept) != 1 || kept[0] != video {
+			t.Errorf("kept = %v, want [%s]", kept, video)
+		}
+		if log := buf.String(); !strings.Contains(log, "警告:") || !strings.Contains(log, audio) {
+			t.Errorf("音声のみのファイルの警告がありません: %q", log)
+		}
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		captureLog(t)
+		if _, err := validateInputs([]string{video, audio}, true); err == nil {
+			t.Error("-on-error abort で音声のみのファイルがエラーになりません")
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package concator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+)
+
+// MediaInfo は動画ファイルの内容をまとめた情報
+type MediaInfo struct {
+	Path       string       `json:"path"`
+	Duration   float64      `json:"duration"` // 秒
+	Width      int          `json:"width"`    // 回転を考慮した表示上の幅
+	Height     int          `json:"height"`   // 回転を考慮した表示上の高さ
+	VideoCodec string       `json:"video_codec"`
+	PixFmt     string       `json:"pix_fmt"`
+	TimeBase   string       `json:"time_base"`
+	Framerate  float64      `json:"framerate"`                    // 公称のフレームレート (不明な場合は0)
+	VFR        bool         `json:"variable_framerate,omitempty"` // 可変フレームレート
+	Audio      *AudioFormat `json:"audio,omitempty"`              // 音声が無い場合はnil
+	Subtitles  []string     `json:"subtitles,omitempty"`
+	Problem    string       `json:"problem,omitempty"`    // 結合できない理由 (問題が無い場合は空)
+	Mismatches []string     `json:"mismatches,omitempty"` // 先頭のファイルと異なり、-copy で結合できない項目
+}
+
+// Probe はffprobeで動画ファイルを調べ、結合に関係する情報を返す
+// 結合できないファイルの場合はProblemに理由を設定し、分かる範囲の情報を返す
+func Probe(path string) (*MediaInfo, error) {
+	if !isFFprobeAvailable() {
+		return nil, errors.New("ffprobeが見つかりません。")
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info := &MediaInfo{Path: absPath}
+	if info.Problem = checkInput(absPath); info.Problem != "" {
+		return info, nil
+	}
+
+	if info.Duration, err = probeDuration(absPath); err != nil {
+		return nil, err
+	}
+	video, err := probeVideo(absPath)
+	if err != nil {
+		return nil, err
+	}
+	info.Width, info.Height = video.DisplaySize()
+	info.VideoCodec, info.PixFmt, info.TimeBase = video.Codec, video.PixFmt, video.TimeBase
+	info.Framerate = parseFrameRate(video.FrameRate)
+	if avg := parseFrameRate(video.AvgFrameRate); info.Framerate > 0 && avg > 0 {
+		info.VFR = math.Abs(info.Framerate-avg)/info.Framerate > vfrThreshold
+	}
+	if info.Audio, err = probeAudioFormat(absPath); err != nil {
+		return nil, err
+	}
+	if info.Subtitles, err = probeSubtitleCodecs(absPath); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// CompareInputs は各入力を先頭のファイルと比べ、ストリームコピー (-copy) で結合できない違いを Mismatches に設定する
+// 結合できない入力 (Problem が空でないもの) は比較しない。全ての入力が一致する場合は true を返す
+func CompareInputs(infos []*MediaInfo) bool {
+	var first *MediaInfo
+	same := true
+	for _, info := range infos {
+		if info.Problem != "" {
+			continue
+		}
+		if first == nil {
+			first = info
+			continue
+		}
+		info.Mismatches = nil
+		add := func(name string, a, b any) {
+			if a != b {
+				info.Mismatches = append(info.Mismatches, fmt.Sprintf("%s (%v、先頭は %v)", name, a, b))
+			}
+		}
+		add("映像コーデック", info.VideoCodec, first.VideoCodec)
+		add("解像度", fmt.Sprintf("%dx%d", info.Width, info.Height), fmt.Sprintf("%dx%d", first.Width, first.Height))
+		add("フレームレート", formatFramerate(info.Framerate), formatFramerate(first.Framerate))
+		add("ピクセルフォーマット", info.PixFmt, first.PixFmt)
+		add("タイムベース", info.TimeBase, first.TimeBase)
+		add("音声", formatAudio(info.Audio), formatAudio(first.Audio))
+		if len(info.Mismatches) > 0 {
+			same = false
+		}
+	}
+	return same
+}
+
+// formatFramerate はフレームレートを表示用の文字列に変換する
+func formatFramerate(fps float64) string {
+	if fps <= 0 {
+		return "不明"
+	}
+	return strconv.FormatFloat(math.Round(fps*100)/100, 'f', -1, 64) + "fps"
+}
+
+// formatAudio は音声の形式を表示用の文字列に変換する
+func formatAudio(a *AudioFormat) string {
+	if a == nil {
+		return "なし"
+	}
+	return fmt.Sprintf("%s %s %dHz", a.Codec, a.ChannelLayout, a.SampleRate)
+}
@@ -0,0 +1,277 @@
+package concator
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ffmpegBuildsURL は静的ビルドのffmpegを配布しているリリースのURL (BtbN/FFmpeg-Builds の最新のビルド)
+// アセットの名前がバージョンによって変わらない master のビルドを使う
+const ffmpegBuildsURL = "https://github.com/BtbN/FFmpeg-Builds/releases/download/latest/"
+
+// ffmpegBuildPlatforms はOS・アーキテクチャごとの静的ビルドのアセット名の一部
+var ffmpegBuildPlatforms = map[string]string{
+	"linux/amd64":   "linux64",
+	"linux/arm64":   "linuxarm64",
+	"windows/amd64": "win64",
+	"windows/arm64": "winarm64",
+}
+
+// managedToolsDir はダウンロードしたffmpeg・ffprobeを置くディレクトリを返す
+func managedToolsDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "video_concator", "ffmpeg", runtime.GOOS+"-"+runtime.GOARCH), nil
+}
+
+// executableName は実行ファイルの名前にOSに応じた拡張子を付ける
+func executableName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+// ManagedFFmpeg はダウンロード済みのffmpeg・ffprobeのパスを返す。ダウンロードしていない場合はokがfalseになる
+func ManagedFFmpeg() (ffmpeg, ffprobe string, ok bool) {
+	dir, err := managedToolsDir()
+	if err != nil {
+		return "", "", false
+	}
+	ffmpeg = filepath.Join(dir, executableName("ffmpeg"))
+	ffprobe = filepath.Join(dir, executableName("ffprobe"))
+	for _, path := range []string{ffmpeg, ffprobe} {
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return "", "", false
+		}
+	}
+	return ffmpeg, ffprobe, true
+}
+
+// UseManagedFFmpeg はPATHにffmpegが無い場合に、ダウンロード済みのffmpeg・ffprobeを使うよう設定する
+// autoInstall の場合は、ダウンロードしていなければダウンロードする
+func UseManagedFFmpeg(ctx context.Context, autoInstall bool) error {
+	if _, err := exec.LookPath("ffmpeg"); err == nil {
+		return nil
+	}
+	ffmpeg, ffprobe, ok := ManagedFFmpeg()
+	if !ok {
+		if !autoInstall {
+			return nil
+		}
+		infof("ffmpegが見つからないため、ダウンロードします。")
+		var err error
+		if ffmpeg, ffprobe, err = InstallFFmpeg(ctx); err != nil {
+			return err
+		}
+	}
+	debugf("ダウンロード済みのffmpegを使用します: %s", ffmpeg)
+	ffmpegPath = ffmpeg
+	// ffprobeを指定しておらずPATHにも無い場合は、一緒にダウンロードしたffprobeを使う
+	if ffprobePath == "ffprobe" && !isFFprobeAvailable() {
+		ffprobePath = ffprobe
+	}
+	return nil
+}
+
+// InstallFFmpeg は現在のOS・アーキテクチャ用の静的ビルドのffmpegをダウンロードし、チェックサムを確認してから展開する
+// 戻り値は展開したffmpeg・ffprobeのパス
+func InstallFFmpeg(ctx context.Context) (ffmpeg, ffprobe string, err error) {
+	platform, ok := ffmpegBuildPlatforms[runtime.GOOS+"/"+runtime.GOARCH]
+	if !ok {
+		if runtime.GOOS == "darwin" {
+			return "", "", errors.New("macOS用のffmpegはダウンロードできません。Homebrew (brew install ffmpeg) などでインストールしてください。")
+		}
+		return "", "", fmt.Errorf("%s/%s 用のffmpegはダウンロードできません。ffmpegをインストールしてください。", runtime.GOOS, runtime.GOARCH)
+	}
+	ext := ".tar.xz"
+	if runtime.GOOS == "windows" {
+		ext = ".zip"
+	}
+	asset := "ffmpeg-master-latest-" + platform + "-gpl" + ext
+
+	dir, err := managedToolsDir()
+	if err != nil {
+		return "", "", fmt.Errorf("ffmpegを置くディレクトリを決められません: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", fmt.Errorf("ディレクトリを作成できません: %s, %v", dir, err)
+	}
+	work, err := os.MkdirTemp(dir, "download-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(work)
+
+	checksum, err := fetchChecksum(ctx, asset)
+	if err != nil {
+		return "", "", err
+	}
+	archive := filepath.Join(work, asset)
+	infof("ダウンロード中: %s", ffmpegBuildsURL+asset)
+	if err := downloadVerified(ctx, ffmpegBuildsURL+asset, archive, checksum); err != nil {
+		return "", "", err
+	}
+	infof("チェックサムを確認しました (sha256: %s)", checksum)
+
+	extracted := filepath.Join(work, "extracted")
+	if err := extractFFmpegArchive(archive, extracted); err != nil {
+		return "", "", fmt.Errorf("ffmpegの展開に失敗しました: %v", err)
+	}
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		src, err := findExtractedBinary(extracted, executableName(name))
+		if err != nil {
+			return "", "", err
+		}
+		if err := os.Chmod(src, 0o755); err != nil {
+			return "", "", err
+		}
+		if err := os.Rename(src, filepath.Join(dir, executableName(name))); err != nil {
+			return "", "", fmt.Errorf("%sを配置できません: %v", name, err)
+		}
+	}
+	ffmpeg = filepath.Join(dir, executableName("ffmpeg"))
+	ffprobe = filepath.Join(dir, executableName("ffprobe"))
+	infof("ffmpegをインストールしました: %s", dir)
+	return ffmpeg, ffprobe, nil
+}
+
+// fetchChecksum はリリースの checksums.sha256 (sha256sum の形式) からアセットのSHA-256を取得する
+func fetchChecksum(ctx context.Context, asset string) (string, error) {
+	body, err := httpGet(ctx, ffmpegBuildsURL+"checksums.sha256")
+	if err != nil {
+		return "", fmt.Errorf("チェックサムを取得できません: %v", err)
+	}
+	defer body.Close()
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("チェックサムを取得できません: %v", err)
+	}
+	return "", fmt.Errorf("チェックサムの一覧に %s がありません。", asset)
+}
+
+// downloadVerified はURLの内容をpathに保存し、SHA-256がchecksumと一致するかを確認する
+func downloadVerified(ctx context.Context, url, path, checksum string) error {
+	body, err := httpGet(ctx, url)
+	if err != nil {
+		return fmt.Errorf("ダウンロードに失敗しました: %v", err)
+	}
+	defer body.Close()
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, h), body); err != nil {
+		return fmt.Errorf("ダウンロードに失敗しました: %v", err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != checksum {
+		return fmt.Errorf("チェックサムが一致しません: %s (期待値: %s、実際: %s)", filepath.Base(path), checksum, got)
+	}
+	return nil
+}
+
+// httpGet はURLをGETし、成功した場合は本文を返す
+func httpGet(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// extractFFmpegArchive はアーカイブをdirに展開する
+// zipは自前で展開し、tar.xzはGoの標準ライブラリでxzを扱えないためtarコマンドで展開する
+func extractFFmpegArchive(archive, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(archive, ".zip") {
+		out, err := exec.Command("tar", "-xJf", archive, "-C", dir).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%v\n%s", err, out)
+		}
+		return nil
+	}
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		// 実行ファイル以外 (ドキュメントや開発用のファイル) は展開しない
+		// zipの中のパスの区切りはOSに関わらず "/"
+		if f.FileInfo().IsDir() || path.Base(path.Dir(f.Name)) != "bin" {
+			continue
+		}
+		dest := filepath.Join(dir, path.Base(f.Name))
+		if err := extractZipFile(f, dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractZipFile はzipの1つのファイルをdestに書き出す
+func extractZipFile(f *zip.File, dest string) error {
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// findExtractedBinary は展開したディレクトリから実行ファイルを探す
+func findExtractedBinary(dir, name string) (string, error) {
+	var found string
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && d.Name() == name {
+			found = path
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if found == "" {
+		return "", fmt.Errorf("アーカイブに %s がありません。", name)
+	}
+	return found, nil
+}
@@ -0,0 +1,188 @@
+package concator
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// errReviewAborted は -interactive の確認画面で結合を中止した場合のエラー
+var errReviewAborted = errors.New("確認画面で中止しました")
+
+// reviewClip は -interactive の確認画面に表示するクリップ
+type reviewClip struct {
+	Path     string
+	Duration float64 // 秒 (不明な場合は0)
+	Width    int     // 表示上の幅 (不明な場合は0)
+	Height   int
+	Excluded bool
+}
+
+// reviewHelp は -interactive の確認画面で使えるコマンドの説明
+const reviewHelp = `コマンド:
+  m <番号> <移動先>  クリップを移動する
+  x <番号>...        クリップを除外する (除外済みの場合は元に戻す)
+  p <番号>           ffplayでクリップを再生する
+  l                  一覧を表示する
+  s                  この順序で結合を開始する
+  q                  結合せずに終了する
+  ?                  このヘルプを表示する
+`
+
+// probeReviewClips は確認画面に表示する各クリップの長さと解像度を取得する
+// ffprobeが無い場合や取得できない場合は不明として表示する
+func probeReviewClips(files []string, jobs int) []reviewClip {
+	clips := make([]reviewClip, len(files))
+	for i, file := range files {
+		clips[i].Path = file
+	}
+	if !isFFprobeAvailable() {
+		return clips
+	}
+	runParallel(len(clips), jobs, func(i int) error {
+		if d, err := probeDuration(clips[i].Path); err == nil {
+			clips[i].Duration = d
+		}
+		if info, err := probeVideo(clips[i].Path); err == nil {
+			clips[i].Width, clips[i].Height = info.DisplaySize()
+		}
+		return nil
+	})
+	return clips
+}
+
+// printReviewClips はクリップの一覧を番号付きで表示する
+func printReviewClips(w io.Writer, clips []reviewClip) {
+	var total float64
+	count := 0
+	for i, c := range clips {
+		mark := " "
+		if c.Excluded {
+			mark = "x"
+		} else {
+			total += c.Duration
+			count++
+		}
+		duration, res := "不明", "不明"
+		if c.Duration > 0 {
+			duration = formatClock(c.Duration)
+		}
+		if c.Width > 0 {
+			res = fmt.Sprintf("%dx%d", c.Width, c.Height)
+		}
+		fmt.Fprintf(w, "%s %3d. %-8s %-10s %s\n", mark, i+1, duration, res, filepath.Base(c.Path))
+	}
+	fmt.Fprintf(w, "結合するクリップ: %d個", count)
+	if total > 0 {
+		fmt.Fprintf(w, " (合計 %s)", formatClock(total))
+	}
+	fmt.Fprintln(w)
+}
+
+// reviewClips は結合するクリップの一覧を表示し、順序の入れ替えや除外、再生による確認を対話的に行う
+// 確定した順序の (除外したものを除く) ファイルを返す。中止した場合は errReviewAborted を返す
+func reviewClips(ctx context.Context, in io.Reader, out io.Writer, clips []reviewClip) ([]string, error) {
+	scanner := bufio.NewScanner(in)
+	printReviewClips(out, clips)
+	fmt.Fprint(out, reviewHelp)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			fmt.Fprintln(out)
+			return nil, errReviewAborted
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		// indexes はコマンドの引数の番号を0始まりのインデックスに変換する
+		indexes := func(args []string) ([]int, error) {
+			var result []int
+			for _, arg := range args {
+				n, err := strconv.Atoi(arg)
+				if err != nil || n < 1 || n > len(clips) {
+					return nil, fmt.Errorf("番号には1〜%dを指定してください: %s", len(clips), arg)
+				}
+				result = append(result, n-1)
+			}
+			return result, nil
+		}
+		args, err := indexes(fields[1:])
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		switch fields[0] {
+		case "m":
+			if len(args) != 2 {
+				fmt.Fprintln(out, "使い方: m <番号> <移動先>")
+				continue
+			}
+			clip := clips[args[0]]
+			clips = slices.Insert(slices.Delete(clips, args[0], args[0]+1), args[1], clip)
+			printReviewClips(out, clips)
+		case "x":
+			if len(args) == 0 {
+				fmt.Fprintln(out, "使い方: x <番号>...")
+				continue
+			}
+			for _, i := range args {
+				clips[i].Excluded = !clips[i].Excluded
+			}
+			printReviewClips(out, clips)
+		case "p":
+			if len(args) != 1 {
+				fmt.Fprintln(out, "使い方: p <番号>")
+				continue
+			}
+			if err := previewClip(ctx, clips[args[0]].Path); err != nil {
+				fmt.Fprintln(out, err)
+			}
+		case "l":
+			printReviewClips(out, clips)
+		case "s":
+			var files []string
+			for _, c := range clips {
+				if !c.Excluded {
+					files = append(files, c.Path)
+				}
+			}
+			if len(files) == 0 {
+				fmt.Fprintln(out, "全てのクリップが除外されています。")
+				continue
+			}
+			return files, nil
+		case "q":
+			return nil, errReviewAborted
+		case "?", "h", "help":
+			fmt.Fprint(out, reviewHelp)
+		default:
+			fmt.Fprintf(out, "不明なコマンドです: %s (? でヘルプを表示)\n", fields[0])
+		}
+	}
+}
+
+// previewClip はffplayでクリップを再生し、ウィンドウが閉じられるか再生が終わるまで待つ
+func previewClip(ctx context.Context, path string) error {
+	if _, err := exec.LookPath("ffplay"); err != nil {
+		return errors.New("再生にはffplayが必要です。")
+	}
+	cmd := exec.CommandContext(ctx, "ffplay", "-autoexit", "-loglevel", "error", "-window_title", filepath.Base(path), path)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffplayの実行に失敗しました: %s, %v", path, err)
+	}
+	return nil
+}
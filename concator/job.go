@@ -0,0 +1,2210 @@
+package concator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Job は動画ファイルの検索から結合・エンコードまでの一連の処理の設定
+// 各フィールドはコマンドラインの同名のオプションに対応する。NewJob で既定値を設定してから使用する
+type Job struct {
+	// 入力
+	Dir            string        // 動画ファイルが含まれるディレクトリ
+	Dirs           []string      // Dir と合わせて検索する追加のディレクトリ (-dir を繰り返し指定した場合)
+	Manifest       *Manifest     // 入力順序と設定を再現するマニフェスト (nilの場合は使用しない)
+	ManifestPath   string        // Manifest の読み込み元 (表示用)
+	Source         string        // チャプター一覧で分割して再編集する単一の動画ファイル
+	ChaptersText   string        // YouTube形式のチャプター一覧のファイル
+	ChaptersSelect string        // 結合するチャプターの番号をカンマ区切りで並べた順序
+	ListFile       string        // 1行に1つのパスを並べたプレイリストファイル
+	Files          []string      // 結合する動画ファイル (ListFile の後に続けて、指定順に結合する)。ディレクトリを含む場合は全体を検索して並べ替える
+	OnEmpty        string        // 動画ファイルが見つからない場合の動作 (error, skip, wait)
+	SkipOpenFiles  bool          // 他のプロセスが書き込み中のファイルを除外する
+	KeepDuplicates bool          // 別名の同じ内容のファイルも除外せずに結合する
+	MinDuration    time.Duration // この長さ未満のファイルを除外する (0の場合は制限しない)
+	MaxDuration    time.Duration // この長さを超えるファイルを除外する (0の場合は制限しない)
+	Since          string        // この日時以降のファイルのみを結合する (例: 2024-05-01、2024-05-01 13:30)
+	Until          string        // この日時より前のファイルのみを結合する (日付のみの場合はその日を含む)
+	Include        string        // 結合するファイル名のglobパターン (カンマ区切り)
+	Exclude        string        // 除外するファイル名のglobパターン (カンマ区切り)
+	IgnoreFile     string        // 入力ディレクトリ内で除外するパターンを記述したファイルの名前 (空の場合は使用しない)
+	MaxDepth       int           // 入力ディレクトリを検索する深さの上限 (1: 直下のみ、0: 無制限)
+	FollowSymlinks bool          // ディレクトリへのシンボリックリンクもたどる
+	IncludeHidden  bool          // 隠しファイル・ディレクトリも検索する
+	OnError        string        // 読み込めない入力ファイルがある場合の動作 (skip: 除外して続行, abort: エラー終了)
+
+	// 日時ごとに分けて別々の出力ファイルを作成する単位 (hour, day, week。空の場合は分けない)
+	// Output のテンプレートの {{.Date}} にグループの名前が入る
+	GroupBy string
+
+	// クリップの境目で分割して別々の出力ファイル (_part01、_part02 …) を作成する上限 (0、空の場合は分割しない)
+	SplitDuration time.Duration // 1つの出力の長さの上限
+	SplitSize     string        // 1つの出力のサイズの上限 (例: 4G)
+
+	// 並び順
+	Sort       string // time, mtime, ctime, name, metadata, weighted-shuffle
+	TimeSource string // Sort が time の場合に使用する日時 (mtime, btime)
+	Reverse    bool
+	Seed       uint64 // weighted-shuffle のシード値 (0の場合は実行ごとに変わる)
+
+	// 出力
+	Output         string
+	Resolution     string // "1920x1080" 形式、または auto
+	Framerate      int
+	Container      string // 出力のコンテナ形式 (auto, mp4, mov, mkv, webm, gif)。auto の場合は拡張子から判定
+	Codec          string // 映像コーデック (h265, h264, vp9, av1)。空の場合はコンテナ形式の既定
+	Encoder        string // 空の場合は動作するエンコーダーを自動選択
+	Poster         string
+	MaxBitrate     string
+	Bufsize        string
+	CRF            int    // -1の場合は指定しない
+	VideoBitrate   string // 平均ビットレート
+	TwoPass        bool   // 解析のパスと本番のパスの2回に分けてエンコードする
+	TargetSize     string // 出力の目標サイズ (例: 100M)。指定した場合は2パスでエンコードする
+	Preset         string
+	Tune           string
+	GPU            int // -1の場合は指定しない
+	TotalFrames    int64
+	AudioLayout    string
+	Audio          string   // 音声の出力方法 (aac: 再エンコード、copy: そのままコピー、none: 出力しない)
+	KeepSubtitles  bool     // -subtitles copy と同じ (互換性のため残している)
+	Subtitles      string   // 入力の字幕の扱い (none, copy, burn)
+	ListEOL        string   // lf または crlf
+	ExtraArgs      []string // 出力オプションとしてそのまま渡すffmpegの引数
+	ExtraInputArgs []string // 入力オプションとして各入力の -i の前にそのまま渡すffmpegの引数
+	WebVTTChapters string
+	EmbedChapters  bool     // クリップの境界ごとのチャプターを出力に埋め込む
+	Metadata       []string // 出力に書き込むメタデータ (key=value)。入力から引き継いだ値より優先する
+	StripMetadata  bool     // 入力の撮影日時・位置情報・機器の情報を出力に引き継がない
+	DumpMetadata   string
+	WriteManifest  bool // 完了後に出力ファイルの隣に <出力ファイル名>.json のマニフェストを書き出す
+	DumpGraph      string
+	ScrubSprites   bool
+	SpriteInterval float64
+	SpriteWidth    int
+	SpriteColumns  int
+
+	// 完了後に作成する一覧用の画像
+	Thumbnail           string // 出力の1フレームを書き出す画像ファイル (空の場合は作成しない)
+	ThumbnailTime       string // Thumbnail の時刻 (秒数、"H:MM:SS"、"50%" 形式。負の秒数は末尾から)
+	ContactSheet        string // 出力の全体から抜き出したフレームを並べた画像ファイル (空の場合は作成しない)
+	ContactSheetColumns int
+	ContactSheetRows    int
+	ContactSheetWidth   int // ContactSheet の1コマの幅 (ピクセル)
+
+	// ffmpegの入力オプション
+	ThreadQueueSize int
+	ProbeSize       string
+	AnalyzeDuration string
+
+	// クリップの加工
+	TrimBlack         bool
+	BlackThreshold    float64
+	BlackMinDuration  float64
+	MotionOnly        bool
+	MotionThreshold   float64
+	MotionMinLength   float64
+	AVTolerance       float64
+	ScenesMontage     bool
+	SceneThreshold    float64
+	SceneHold         float64
+	OrientationGroups bool
+	Fit               string  // 出力と向きが異なるクリップの収め方 (pad, crop, stretch)
+	ScaleMode         string  // 出力と向きが同じで縦横比が異なるクリップの収め方 (pad, crop, stretch)
+	VFRPolicy         string  // 可変フレームレートの入力の扱い (cfr, vsync-passthrough)
+	Tonemap           string  // HDRの入力の扱い (auto: 全て同じHDRなら保持しSDRと混在する場合はSDRに変換、sdr: 常にSDRに変換、none: 何もしない)
+	Intro             string  // 先頭に追加するクリップ (空の場合は追加しない)
+	Outro             string  // 末尾に追加するクリップ (空の場合は追加しない)
+	CutsFile          string  // クリップごとの結合する範囲を記述したカットリスト (CSV または JSON)
+	NormalizeAudio    bool    // クリップごとにラウドネスを測定し、音量を揃える
+	LoudnessTarget    float64 // NormalizeAudio の目標ラウドネス (LUFS)
+	Music             string  // 全体に流すBGMの音声ファイル (空の場合は流さない)
+	MusicVolume       float64 // BGMの音量の補正 (dB)
+	MusicMode         string  // mix (元の音声に重ねる) または replace (元の音声を置き換える)
+	MusicDuck         bool    // 元の音声がある間はBGMの音量を下げる
+	MusicDuckRatio    float64 // MusicDuck の圧縮率
+	Watermark         string  // 出力の全体に重ねるロゴ画像 (空の場合は重ねない)
+	WatermarkPosition string  // top-left, top-right, bottom-left, bottom-right, center
+	WatermarkOpacity  float64 // ロゴの不透明度 (0より大きく1以下)
+	WatermarkMargin   int     // ロゴと画面の端との余白 (ピクセル)
+	BurnTimestamp     bool    // 各クリップの録画日時を映像に焼き込む
+	TimestampFormat   string  // BurnTimestamp の日時の書式 (strftime形式)
+	TimestampFont     string  // BurnTimestamp のフォントファイル (空の場合はffmpegの既定)
+
+	// 各クリップの前に挿入するタイトルカード (撮影日の記録映像のまとめなどに使う)
+	TitleCards          bool    // 各クリップの前にファイル名や撮影日時を表示するタイトルカードを挿入する
+	TitleCardDuration   float64 // タイトルカードを表示する秒数
+	TitleCardBackground string  // 背景色 (ffmpegの色の名前か #RRGGBB)、または背景にする画像ファイル
+	TitleCardText       string  // 表示する文字列 ({name}: ファイル名、{date}: 撮影日時、{index}: クリップの番号、\n: 改行)
+	TitleCardDateFormat string  // {date} の書式 (strftime形式)
+	TitleCardFont       string  // フォントファイル (空の場合はffmpegの既定)
+	TitleCardColor      string  // 文字の色
+
+	// 再生速度 (タイムラプスなど)
+	Speed      string // 全てのクリップの再生速度の倍率 (例: 8x。空の場合は等速、カットリストの速度が優先される)
+	SpeedAudio string // 再生速度を変えたクリップの音声の扱い (tempo: 音程を変えずに速度を合わせる、drop: 無音にする)
+
+	// クリップごとの映像の補正 (古いビデオカメラの映像などの前処理)。結合の前にクリップごとに適用する
+	Deinterlace    bool   // インターレースのクリップをインターレース解除する
+	Denoise        string // ノイズ除去の強さ (light, medium, strong。空の場合は行わない)
+	Stabilize      bool   // 手ぶれを補正する (vid.stab による2パス)
+	CleanupInclude string // 補正するクリップのglobパターン (カンマ区切り、空の場合は全て)
+
+	// クリップ間のトランジション
+	Transition         string        // 空の場合は単純に結合、xfade の場合はクリップを重ねて切り替える
+	TransitionEffect   string        // xfadeのトランジション名 (fade, wipeleft, dissolve など)
+	TransitionDuration time.Duration // トランジションの長さ
+
+	// 出力の先頭と末尾のフェード (0の場合はフェードしない)
+	FadeIn  time.Duration // 出力の先頭で黒と無音からフェードインする長さ
+	FadeOut time.Duration // 出力の末尾で黒と無音へフェードアウトする長さ
+
+	// 実行方法
+	Copy        bool
+	Checkpoint  bool
+	Normalize   bool   // 各クリップを並列に中間ファイルへ正規化してから結合する
+	CacheDir    string // Normalize の中間ファイルを再利用するためのキャッシュディレクトリ (空の場合は使用しない)
+	Jobs        int    // クリップごとの解析処理の並列数
+	IOJobs      int    // 0の場合はストレージの種類から自動判定
+	Limits      ResourceLimits
+	StatsPeriod time.Duration // 0の場合は出力先に応じて自動選択
+	Progress    bool
+	Force       bool // 出力先の空き容量が足りない見込みでも警告のみで続行する
+
+	// 既存の出力ファイルの扱い (既定では端末で確認し、端末でなければエラーにする)
+	Overwrite    bool // 確認せずに上書きする
+	OutputSuffix bool // _1、_2 などの連番を付けた名前で出力する
+	NoPrompt     bool // 端末でも確認せずにエラーにする (APIから実行する場合など)
+
+	// 完了後の出力の検証
+	Verify          bool    // 出力の長さを入力から想定される長さと比較し、最後までデコードできるかを確認する
+	VerifyTolerance float64 // Verify で許容する長さの差(秒)
+
+	// Web配信向けの出力
+	Format          string  // file (1つのファイル)、hls、dash
+	SegmentDuration float64 // hls、dash の1セグメントの長さ(秒)
+	MasterPlaylist  bool    // hls のマスタープレイリストも書き出す
+	Renditions      string  // 同時に出力する解像度の一覧 (例: 1080p,720p,480p)。空の場合は -resolution のみ
+
+	// 実行せずに内容を表示する
+	Describe bool
+	DryRun   bool
+
+	// エンコード前にクリップの一覧を表示し、順序の入れ替えや除外を対話的に行う
+	Interactive bool
+
+	// Watch で新しいファイルの書き込みが止まってから再結合するまでの待機時間 (0の場合は10秒)
+	WatchSettle time.Duration
+
+	// 入力の検索の前と完了後に実行するシェルのコマンド (空の場合は実行しない)
+	PreHook  string
+	PostHook string // 成功・失敗に関わらず実行し、結果を環境変数で渡す
+
+	// 完了・失敗時に結果をPOSTするWebhookのURL (空の場合は通知しない)
+	NotifyURL    string
+	NotifyFormat string // auto (URLから判定)、generic (結果のJSON)、slack、discord
+
+	// 入力の一覧・ffprobeの結果・進捗・完了時の結果をJSON Linesで書き出す (nilの場合は書き出さない)
+	Events *EventWriter
+
+	groupName string     // GroupBy で分けたグループの名前 (Output の {{.Date}} に入る)
+	written   *outputSet // Watch で書き出した出力のパス (自身の出力を新しい入力として扱わないために使う)
+}
+
+// NewJob はコマンドラインのオプションと同じ既定値を設定したJobを返す
+func NewJob() *Job {
+	return &Job{
+		OnEmpty:             "error",
+		OnError:             "skip",
+		Sort:                "time",
+		TimeSource:          "mtime",
+		Resolution:          "1920x1080",
+		Framerate:           60,
+		Subtitles:           "none",
+		Container:           "auto",
+		GPU:                 -1,
+		CRF:                 -1,
+		AudioLayout:         "stereo",
+		Audio:               "aac",
+		Format:              "file",
+		SegmentDuration:     6,
+		ListEOL:             DefaultListEOL(),
+		SpriteInterval:      5,
+		SpriteWidth:         160,
+		SpriteColumns:       10,
+		ThumbnailTime:       defaultThumbnailTime,
+		ContactSheetColumns: 4,
+		ContactSheetRows:    4,
+		ContactSheetWidth:   320,
+		BlackThreshold:      0.10,
+		BlackMinDuration:    0.1,
+		MotionThreshold:     0.02,
+		MotionMinLength:     2.0,
+		AVTolerance:         0.1,
+		LoudnessTarget:      defaultLoudnessTarget,
+		Fit:                 "pad",
+		ScaleMode:           "pad",
+		VFRPolicy:           "cfr",
+		Tonemap:             "auto",
+		SpeedAudio:          "tempo",
+		MusicVolume:         -12,
+		MusicMode:           "mix",
+		MusicDuckRatio:      8,
+		WatermarkPosition:   "bottom-right",
+		WatermarkOpacity:    1.0,
+		WatermarkMargin:     20,
+		TimestampFormat:     defaultTimestampFormat,
+		TitleCardDuration:   3,
+		VerifyTolerance:     1,
+		TitleCardBackground: "black",
+		TitleCardText:       defaultTitleCardText,
+		TitleCardDateFormat: defaultTitleCardDateFormat,
+		TitleCardColor:      "white",
+		SceneThreshold:      0.3,
+		SceneHold:           0.5,
+		TransitionEffect:    "fade",
+		TransitionDuration:  time.Second,
+		Jobs:                runtime.NumCPU(),
+		Progress:            true,
+		WatchSettle:         defaultWatchSettle,
+		IgnoreFile:          defaultIgnoreFile,
+		NotifyFormat:        "auto",
+	}
+}
+
+// sortKey は Sort と TimeSource から findAndSortVideos に渡す並び順を求める
+func (j *Job) sortKey() (string, error) {
+	if j.TimeSource != "mtime" && j.TimeSource != "btime" {
+		return "", fmt.Errorf("-time-source には mtime または btime を指定してください: %s", j.TimeSource)
+	}
+	if j.Sort == "time" || j.Sort == "weighted-shuffle" {
+		return j.TimeSource, nil
+	}
+	key, ok := sortKeys[j.Sort]
+	if !ok {
+		return "", fmt.Errorf("-sort には time、mtime、ctime、name、metadata、weighted-shuffle のいずれかを指定してください: %s", j.Sort)
+	}
+	return key, nil
+}
+
+// inputFilter は Since、Until、Include、Exclude、IgnoreFile とディレクトリのたどり方から入力ディレクトリの絞り込み条件を求める
+func (j *Job) inputFilter() (InputFilter, error) {
+	var f InputFilter
+	var err error
+	if j.Since != "" {
+		if f.Since, err = parseTimestamp(j.Since, false); err != nil {
+			return f, fmt.Errorf("-since: %v", err)
+		}
+	}
+	if j.Until != "" {
+		if f.Until, err = parseTimestamp(j.Until, true); err != nil {
+			return f, fmt.Errorf("-until: %v", err)
+		}
+	}
+	if !f.Since.IsZero() && !f.Until.IsZero() && !f.Since.Before(f.Until) {
+		return f, errors.New("-since には -until より前の日時を指定してください。")
+	}
+	if f.Include, err = splitPatterns(j.Include); err != nil {
+		return f, fmt.Errorf("-include: %v", err)
+	}
+	if f.Exclude, err = splitPatterns(j.Exclude); err != nil {
+		return f, fmt.Errorf("-exclude: %v", err)
+	}
+	if strings.ContainsAny(j.IgnoreFile, `/\`) {
+		return f, fmt.Errorf("-ignore-file にはディレクトリを含まないファイル名を指定してください: %s", j.IgnoreFile)
+	}
+	f.IgnoreFile = j.IgnoreFile
+	if j.MaxDepth < 0 {
+		return f, fmt.Errorf("-max-depth には0以上の値を指定してください: %d", j.MaxDepth)
+	}
+	f.MaxDepth, f.FollowSymlinks, f.IncludeHidden = j.MaxDepth, j.FollowSymlinks, j.IncludeHidden
+	return f, nil
+}
+
+// filesIncludeDir は Files にディレクトリが含まれるかを返す
+func (j *Job) filesIncludeDir() bool {
+	for _, file := range j.Files {
+		if info, err := os.Stat(file); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// searchInputs は検索するディレクトリと、検索結果と合わせて並べ替えるファイルを返す
+// Files にディレクトリが含まれる場合は、Files のディレクトリも検索し、残りのファイルも合わせて並べ替える
+func (j *Job) searchInputs() (dirs, files []string) {
+	if j.Dir != "" {
+		dirs = append(dirs, j.Dir)
+	}
+	dirs = append(dirs, j.Dirs...)
+	if !j.filesIncludeDir() {
+		return dirs, nil
+	}
+	for _, file := range j.Files {
+		if info, err := os.Stat(file); err == nil && info.IsDir() {
+			dirs = append(dirs, file)
+		} else {
+			files = append(files, file)
+		}
+	}
+	return dirs, files
+}
+
+// explicitFiles は ListFile と Files で明示的に指定された入力ファイルを返す
+// 指定が無い場合や、Files にディレクトリが含まれ検索して並べ替える場合はnilを返す
+func (j *Job) explicitFiles() ([]string, error) {
+	if j.filesIncludeDir() {
+		if j.ListFile != "" {
+			return nil, errors.New("-list と引数のディレクトリは同時に指定できません。")
+		}
+		return nil, nil
+	}
+	var files []string
+	if j.ListFile != "" {
+		var err error
+		files, err = readPlaylist(j.ListFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("プレイリストに動画ファイルがありません: %s", j.ListFile)
+		}
+	}
+	return append(files, j.Files...), nil
+}
+
+// Preflight はエンコードを行わずに実行前の全ての確認を行い、結果をまとめて表示する
+// 全ての確認に通った場合はtrueを返す
+func (j *Job) Preflight() (bool, error) {
+	sortKey, err := j.sortKey()
+	if err != nil {
+		return false, err
+	}
+	files, err := j.explicitFiles()
+	if err != nil {
+		return false, err
+	}
+	filter, err := j.inputFilter()
+	if err != nil {
+		return false, err
+	}
+	dirs, searchFiles := j.searchInputs()
+	return runPreflight(PreflightConfig{
+		InputDirs:   dirs,
+		SearchFiles: searchFiles,
+		OutputFile:  j.Output,
+		Encoder:     j.Encoder,
+		Poster:      j.Poster,
+		SortKey:     sortKey,
+		Manifest:    j.Manifest,
+		Files:       files,
+		Filter:      filter,
+
+		Overwrite:    j.Overwrite,
+		OutputSuffix: j.OutputSuffix,
+
+		Limits: j.Limits,
+	}), nil
+}
+
+// Inputs はエンコードを行わずに、結合する入力ファイルを結合する順に返す
+func (j *Job) Inputs(ctx context.Context) ([]string, error) {
+	copied := *j
+	j = &copied
+	sortKey, err := j.sortKey()
+	if err != nil {
+		return nil, err
+	}
+	explicitFiles, err := j.explicitFiles()
+	if err != nil {
+		return nil, err
+	}
+	files, _, err := j.discoverInputs(ctx, sortKey, explicitFiles)
+	return files, err
+}
+
+// discoverInputs は入力ファイルを検索し、結合する順に並べて返す
+// -source の場合はチャプターごとの区間も返す。-on-empty skip で入力が無い場合は空の一覧を返す
+func (j *Job) discoverInputs(ctx context.Context, sortKey string, explicitFiles []string) ([]string, []ConcatEntry, error) {
+	// ファイルを明示的に指定した場合やマニフェストを使う場合は、指定された順序を変更しない
+	keepOrder := explicitFiles != nil || j.Manifest != nil
+	var videoFiles []string
+	var chapterEntries []ConcatEntry
+	var err error
+	if j.Source != "" {
+		// 単一の動画をチャプター一覧で分割して仮想クリップとして扱う
+		absSource, err := filepath.Abs(j.Source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("絶対パスの取得に失敗しました: %s, %v", j.Source, err)
+		}
+		if _, err := os.Stat(absSource); err != nil {
+			return nil, nil, fmt.Errorf("動画ファイルを開けません: %v", err)
+		}
+		chapters, err := parseChapterPaste(j.ChaptersText)
+		if err != nil {
+			return nil, nil, fmt.Errorf("チャプター一覧の読み込みに失敗しました: %v", err)
+		}
+		chapterEntries, err = buildChapterEntries(absSource, chapters, j.ChaptersSelect)
+		if err != nil {
+			return nil, nil, err
+		}
+		infof("%d個のチャプターから%d区間を結合します。", len(chapters), len(chapterEntries))
+		videoFiles = []string{absSource}
+	} else if explicitFiles != nil {
+		videoFiles, err = resolveExplicitInputs(explicitFiles)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(videoFiles) == 0 {
+			return nil, nil, errors.New("結合できる動画ファイルがありません。")
+		}
+	} else if j.Manifest != nil {
+		infof("マニフェスト '%s' から入力ファイルを復元中...", j.ManifestPath)
+		dirs, _ := j.searchInputs()
+		videoFiles, err = j.Manifest.resolveInputs(dirs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("マニフェストの入力ファイルの復元に失敗しました: %v", err)
+		}
+	} else {
+		filter, err := j.inputFilter()
+		if err != nil {
+			return nil, nil, err
+		}
+		dirs, searchFiles := j.searchInputs()
+		if len(dirs) > 1 || len(searchFiles) > 0 {
+			infof("%d個のディレクトリと%d個のファイルから動画ファイルを検索中...", len(dirs), len(searchFiles))
+		} else {
+			infof("動画ファイルを検索中...")
+		}
+		videoFiles, err = findAndSortVideos(dirs, searchFiles, sortKey, filter)
+		// -on-empty wait の場合は動画ファイルが現れるまでディレクトリを監視する
+		if err == nil && len(videoFiles) == 0 && j.OnEmpty == "wait" {
+			infof("ディレクトリ '%s' に動画ファイルが現れるまで待機します...", strings.Join(dirs, "', '"))
+			for err == nil && len(videoFiles) == 0 {
+				select {
+				case <-ctx.Done():
+					return nil, nil, ctx.Err()
+				case <-time.After(emptyPollInterval):
+				}
+				videoFiles, err = findAndSortVideos(dirs, searchFiles, sortKey, filter)
+			}
+		}
+		if errors.Is(err, errBirthTimeUnavailable) {
+			return nil, nil, fmt.Errorf("動画ファイルの検索に失敗しました: %v\nこのファイルシステムでは更新日時 (-sort mtime) を使用してください。", err)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("動画ファイルの検索に失敗しました: %v", err)
+		}
+		// 出力先が入力ディレクトリ内にある場合に、以前の出力を入力として扱わない
+		if absOutput, err := filepath.Abs(j.Output); err == nil {
+			videoFiles = slices.DeleteFunc(videoFiles, func(file string) bool {
+				return matchesOutput(absOutput, file) || j.written.contains(file)
+			})
+		}
+	}
+	if len(videoFiles) == 0 {
+		dirs, _ := j.searchInputs()
+		if j.OnEmpty == "skip" {
+			infof("ディレクトリ '%s' に動画ファイルが見つからないため、何もせずに終了します。", strings.Join(dirs, "', '"))
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("ディレクトリ '%s' に動画ファイルが見つかりませんでした。", strings.Join(dirs, "', '"))
+	}
+	infof("%d個の動画ファイルが見つかりました。", len(videoFiles))
+
+	// 並び順を逆にする
+	if j.Reverse && !keepOrder {
+		slices.Reverse(videoFiles)
+	}
+
+	// 書き込み中のファイルを除外
+	if j.SkipOpenFiles {
+		videoFiles = skipOpenFiles(videoFiles)
+		if len(videoFiles) == 0 {
+			return nil, nil, errors.New("書き込み中でない動画ファイルがありません。")
+		}
+	}
+
+	// 別名でコピーされた同じ内容のファイルを除外 (マニフェストは記録した入力をそのまま再現する)
+	if !j.KeepDuplicates && j.Source == "" && j.Manifest == nil {
+		kept, duplicates, err := removeDuplicates(videoFiles)
+		if err != nil {
+			return nil, nil, fmt.Errorf("重複の確認に失敗しました: %v", err)
+		}
+		for _, d := range duplicates {
+			infof("重複のためスキップします: %s (%s と同じ内容)", d.Path, d.Original)
+		}
+		if len(duplicates) > 0 {
+			infof("同じ内容のファイル%d個を除外しました (-keep-duplicates で全て結合します)。", len(duplicates))
+		}
+		videoFiles = kept
+	}
+
+	// 長さが範囲外のクリップ (ドライブレコーダーの数秒の断片など) を除外
+	if (j.MinDuration > 0 || j.MaxDuration > 0) && j.Source == "" {
+		if err := checkDurationFilter(j.MinDuration, j.MaxDuration); err != nil {
+			return nil, nil, err
+		}
+		videoFiles = filterByDuration(videoFiles, j.MinDuration, j.MaxDuration, j.Jobs)
+		if len(videoFiles) == 0 {
+			return nil, nil, errors.New("長さが -min-duration と -max-duration の範囲内の動画ファイルがありません。")
+		}
+	}
+
+	// 重み付きランダムで並べ替え
+	if j.Sort == "weighted-shuffle" && !keepOrder {
+		if j.Seed == 0 {
+			j.Seed = uint64(time.Now().UnixNano())
+		}
+		infof("重み付きランダムで並べ替えます (seed=%d)", j.Seed)
+		videoFiles, err = weightedShuffle(videoFiles, j.Seed)
+		if err != nil {
+			return nil, nil, fmt.Errorf("並べ替えに失敗しました: %v", err)
+		}
+	}
+	return videoFiles, chapterEntries, nil
+}
+
+// Run は入力の検索、リストファイルの作成、ffmpegによる結合とエンコードを行う
+// ctxが取り消された場合は実行中のffmpegを終了する。PreHook、PostHook がある場合は前後に実行し、NotifyURL がある場合は結果を通知する
+func (j *Job) Run(ctx context.Context) error {
+	// 実行中に補完する値で呼び出し元の設定を書き換えないようにコピーする
+	copied := *j
+	j = &copied
+	if j.PreHook != "" || j.PostHook != "" || j.NotifyURL != "" {
+		return j.runWithHooks(ctx)
+	}
+	return j.run(ctx)
+}
+
+// run は Run の本体で、コピーしたjの値を実行中に補完しながら結合を行う
+func (j *Job) run(ctx context.Context) error {
+	s := &runState{}
+	if err := j.checkInputOptions(s); err != nil {
+		return err
+	}
+	// 日時ごとのグループに分ける場合は、グループごとに改めて実行する
+	if j.GroupBy != "" {
+		return j.runGroups(ctx, s.sortKey, s.explicitFiles)
+	}
+	// 長さやサイズの上限で分割する場合は、パートごとに改めて実行する
+	if j.SplitDuration != 0 || j.SplitSize != "" {
+		return j.runSplit(ctx, s.sortKey, s.explicitFiles)
+	}
+	if err := j.checkOptions(s); err != nil {
+		return err
+	}
+
+	// 1. 動画ファイルを検索し、結合する順に並べる
+	if found, err := j.discover(ctx, s); err != nil || !found {
+		return err
+	}
+	if err := j.inspectInputs(s); err != nil {
+		return err
+	}
+	// 2. ffmpegのconcat demuxer用のリストファイルのエントリを作成
+	if err := j.buildEntries(s); err != nil {
+		return err
+	}
+	// 3. エンコーダーとフィルターを決定
+	if err := j.configureEncoder(ctx, s); err != nil {
+		return err
+	}
+	// 実行内容の説明のみを表示して終了
+	if j.Describe {
+		return j.describe(s)
+	}
+	// 4. ffmpegコマンドを組み立てて実行
+	defer func() {
+		for _, file := range s.tempFiles {
+			os.Remove(file)
+		}
+	}()
+	if err := j.buildEncodeJob(s); err != nil {
+		return err
+	}
+	if j.Copy {
+		return j.runCopy(ctx, s)
+	}
+	j.warnManifestSettings(s.encodeJob)
+	return j.runEncode(ctx, s)
+}
+
+// runState は Job.run の各段階で決まり、後の段階で使う値
+type runState struct {
+	// オプションの確認で決まる値
+	eol           string // リストファイルの改行コード
+	sortKey       string
+	explicitFiles []string
+	container     string
+	codec         string
+	posterMode    string
+	speed         float64
+	targetBytes   int64
+	streaming     *StreamingOutput
+	music         *Music
+	watermark     *Watermark
+	titleCard     *TitleCard
+
+	// 入力の検索と確認で決まる値
+	videoFiles     []string
+	chapterEntries []ConcatEntry
+	intro, outro   []string
+	allFiles       []string // イントロ・本編・アウトロの全てのクリップ
+	subtitleCodec  string
+	audioFilter    string
+	vfrFiles       []string
+	audioCopy      bool
+
+	// エントリの作成で決まる値
+	entries            []ConcatEntry
+	speedChanged       bool
+	timestampFormat    string
+	timestampDurations []float64
+
+	// エンコーダーとフィルターの決定で決まる値
+	chosenEncoder      string
+	rateControlArgs    []string
+	gpuArgs            *GPUArgs
+	shakeDetections    []shakeDetection
+	colorArgs          []string
+	hdr                *ColorInfo
+	speedNoAudio       bool
+	scaleFilter        string
+	videoFilter        string
+	vfrArgs            []string
+	verifyFramerate    int // 出力のフレーム数の検証に使うフレームレート
+	renditions         []Rendition
+	timebaseArgs       []string
+	outputMetadataArgs []string
+
+	encodeJob EncodeJob
+	tempFiles []string // 実行後に削除する一時ファイル
+}
+
+// checkInputOptions は入力の検索と並び順に関するオプションを確認する
+func (j *Job) checkInputOptions(s *runState) error {
+	var err error
+	if j.OnEmpty != "error" && j.OnEmpty != "skip" && j.OnEmpty != "wait" {
+		return fmt.Errorf("-on-empty には error、skip、wait のいずれかを指定してください: %s", j.OnEmpty)
+	}
+	s.eol = "\n"
+	switch j.ListEOL {
+	case "lf":
+	case "crlf":
+		s.eol = "\r\n"
+	default:
+		return fmt.Errorf("-list-eol には lf または crlf を指定してください: %s", j.ListEOL)
+	}
+	s.sortKey, err = j.sortKey()
+	if err != nil {
+		return err
+	}
+	if s.sortKey == "metadata" && !isFFprobeAvailable() {
+		return errors.New("-sort metadata にはffprobeが必要です。")
+	}
+	if j.OnError != "skip" && j.OnError != "abort" {
+		return fmt.Errorf("-on-error には skip または abort を指定してください: %s", j.OnError)
+	}
+	s.explicitFiles, err = j.explicitFiles()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkOptions は出力とエンコードに関するオプションを確認し、組み合わせられないものをエラーにする
+func (j *Job) checkOptions(s *runState) error {
+	var err error
+	if j.Limits.CPUs < 0 {
+		return errors.New("-cpu-limit には0以上の値を指定してください。")
+	}
+	j.Limits = j.Limits.withGroup()
+	if j.Overwrite && j.OutputSuffix {
+		return errors.New("-overwrite と -output-suffix は同時に指定できません。")
+	}
+
+	// 出力のコンテナ形式と映像コーデックを決める
+	if s.container, j.Output, err = resolveContainer(j.Container, j.Output); err != nil {
+		return err
+	}
+	if s.container == "gif" {
+		if j.Encoder != "" || j.Codec != "" {
+			return errors.New("アニメーションGIFの出力では -encoder、-codec は指定できません。")
+		}
+		if j.Copy || j.Transition != "" || j.Renditions != "" || j.Format != "file" || j.TwoPass || j.TargetSize != "" || j.Music != "" {
+			return errors.New("アニメーションGIFの出力では -copy、-transition、-renditions、-format、-two-pass、-target-size、-music は指定できません。")
+		}
+		if j.CRF >= 0 || j.VideoBitrate != "" || j.MaxBitrate != "" {
+			return errors.New("アニメーションGIFの出力では -crf、-vbitrate、-max-bitrate は指定できません。")
+		}
+		// GIFは音声を格納できない
+		j.Audio = "none"
+	}
+	s.codec, err = containerCodec(s.container, j.Codec, j.Encoder)
+	if err != nil {
+		return err
+	}
+
+	// ポスター画像の確認
+	s.posterMode = ""
+	if j.Poster != "" {
+		if j.Copy {
+			return errors.New("-copy ではカバー画像を埋め込めないため、-poster は指定できません。")
+		}
+		if err := validatePoster(j.Poster); err != nil {
+			return err
+		}
+		s.posterMode = posterContainer(j.Output)
+		if s.posterMode == "" {
+			warnf("出力形式 '%s' はカバー画像の埋め込みに対応していないため、-poster を無視します。", filepath.Ext(j.Output))
+		}
+	}
+
+	// ffmpeg・ffprobeの存在とバージョンを確認
+	if err := checkFFmpeg(); err != nil {
+		return err
+	}
+	if err := checkFFprobe(); err != nil {
+		return err
+	}
+	if j.WebVTTChapters != "" && !isFFprobeAvailable() {
+		return errors.New("-webvtt-chapters にはffprobeが必要です。")
+	}
+	if j.OrientationGroups && !isFFprobeAvailable() {
+		return errors.New("-orientation-groups にはffprobeが必要です。")
+	}
+	if j.OrientationGroups && (j.WebVTTChapters != "" || j.DumpMetadata != "" || j.Thumbnail != "" || j.ContactSheet != "" || j.WriteManifest) {
+		warnf("-orientation-groups では -webvtt-chapters、-dump-metadata、-thumbnail、-contact-sheet、-write-manifest は使用できないため無視します。")
+	}
+	if j.WriteManifest && !isFFprobeAvailable() {
+		return errors.New("-write-manifest にはffprobeが必要です。")
+	}
+	if j.Verify {
+		if !isFFprobeAvailable() {
+			return errors.New("-verify にはffprobeが必要です。")
+		}
+		if j.ScenesMontage {
+			return errors.New("-verify は -scenes-montage と同時に指定できません (出力の長さを事前に求められないため)。")
+		}
+		if j.VerifyTolerance <= 0 {
+			return fmt.Errorf("-verify-tolerance には正の値を指定してください: %g", j.VerifyTolerance)
+		}
+	}
+	if j.ScrubSprites {
+		if !isFFprobeAvailable() {
+			return errors.New("-scrub-sprites にはffprobeが必要です。")
+		}
+		if j.SpriteInterval <= 0 || j.SpriteWidth <= 0 || j.SpriteColumns <= 0 {
+			return errors.New("-sprite-interval、-sprite-width、-sprite-columns には正の値を指定してください。")
+		}
+	}
+	if j.Thumbnail != "" {
+		if !isFFprobeAvailable() {
+			return errors.New("-thumbnail にはffprobeが必要です。")
+		}
+		if err := validateImageOutput(j.Thumbnail, "-thumbnail"); err != nil {
+			return err
+		}
+		if _, _, err := parseThumbnailTime(j.ThumbnailTime); err != nil {
+			return fmt.Errorf("-thumbnail-time: %v", err)
+		}
+	}
+	if j.ContactSheet != "" {
+		if !isFFprobeAvailable() {
+			return errors.New("-contact-sheet にはffprobeが必要です。")
+		}
+		if err := validateImageOutput(j.ContactSheet, "-contact-sheet"); err != nil {
+			return err
+		}
+		if j.ContactSheetColumns <= 0 || j.ContactSheetRows <= 0 || j.ContactSheetWidth <= 0 {
+			return errors.New("-contact-sheet-columns、-contact-sheet-rows、-contact-sheet-width には正の値を指定してください。")
+		}
+	}
+	if j.TrimBlack && j.MotionOnly {
+		return errors.New("-trim-black と -motion-only は同時に指定できません。")
+	}
+	if j.CutsFile != "" && (j.TrimBlack || j.MotionOnly || j.Source != "") {
+		return errors.New("-cuts は -trim-black、-motion-only、-source と同時に指定できません。")
+	}
+	if j.Transition != "" {
+		if j.Transition != "xfade" {
+			return fmt.Errorf("-transition には xfade を指定してください: %s", j.Transition)
+		}
+		if j.TransitionDuration <= 0 {
+			return errors.New("-transition-duration には正の値を指定してください。")
+		}
+		if !isFFprobeAvailable() {
+			return errors.New("-transition にはffprobeが必要です。")
+		}
+		if j.Copy || j.Checkpoint || j.Normalize || j.OrientationGroups || j.ScenesMontage {
+			return errors.New("-transition は -copy、-checkpoint、-normalize、-orientation-groups、-scenes-montage と同時に指定できません。")
+		}
+	}
+	if j.FadeIn < 0 || j.FadeOut < 0 {
+		return errors.New("-fade-in、-fade-out には0以上の値を指定してください。")
+	}
+	if j.FadeIn > 0 || j.FadeOut > 0 {
+		if j.Copy || j.ScenesMontage {
+			return errors.New("-fade-in、-fade-out は -copy、-scenes-montage と同時に指定できません。")
+		}
+		if j.FadeOut > 0 && !isFFprobeAvailable() {
+			return errors.New("-fade-out にはffprobeが必要です。")
+		}
+	}
+	if j.Normalize && (j.Copy || j.Checkpoint || j.OrientationGroups || j.ScenesMontage) {
+		return errors.New("-normalize は -copy、-checkpoint、-orientation-groups、-scenes-montage と同時に指定できません。")
+	}
+	if j.EmbedChapters {
+		if !isFFprobeAvailable() {
+			return errors.New("-embed-chapters にはffprobeが必要です。")
+		}
+		if j.Copy || j.Checkpoint || j.Normalize || j.OrientationGroups || j.ScenesMontage {
+			warnf("-copy、-checkpoint、-normalize、-orientation-groups、-scenes-montage では -embed-chapters は使用できないため無視します。")
+			j.EmbedChapters = false
+		} else if !chapterContainer(j.Output) {
+			warnf("出力形式 '%s' はチャプターの格納に対応していないため、-embed-chapters を無視します。", filepath.Ext(j.Output))
+			j.EmbedChapters = false
+		}
+	}
+	if j.MotionOnly && !isFFprobeAvailable() {
+		return errors.New("-motion-only にはffprobeが必要です。")
+	}
+	if j.TrimBlack && !isFFprobeAvailable() {
+		return errors.New("-trim-black にはffprobeが必要です。")
+	}
+	if j.KeepSubtitles && j.Subtitles == "none" {
+		j.Subtitles = "copy"
+	}
+	switch j.Subtitles {
+	case "none":
+	case "copy", "burn":
+		if !isFFprobeAvailable() {
+			return fmt.Errorf("-subtitles %s にはffprobeが必要です。", j.Subtitles)
+		}
+		if j.Copy || j.ScenesMontage || j.OrientationGroups {
+			return fmt.Errorf("-subtitles %s は -copy、-scenes-montage、-orientation-groups と同時に指定できません。", j.Subtitles)
+		}
+	default:
+		return fmt.Errorf("-subtitles には none、copy、burn のいずれかを指定してください: %s", j.Subtitles)
+	}
+	if j.NormalizeAudio {
+		if !isFFprobeAvailable() {
+			return errors.New("-normalize-audio にはffprobeが必要です。")
+		}
+		if j.Copy || j.ScenesMontage {
+			return errors.New("-normalize-audio は -copy、-scenes-montage と同時に指定できません。")
+		}
+		if j.LoudnessTarget >= 0 {
+			return errors.New("-loudness-target には負の値 (LUFS) を指定してください。")
+		}
+	}
+	switch j.Audio {
+	case "aac":
+	case "copy":
+		if j.NormalizeAudio {
+			return errors.New("-normalize-audio は音声を再エンコードするため、-audio copy と同時に指定できません。")
+		}
+	case "none":
+		if j.NormalizeAudio {
+			return errors.New("-normalize-audio は -audio none と同時に指定できません。")
+		}
+		if j.Copy {
+			return errors.New("-copy では音声もそのままコピーするため、-audio none は指定できません。")
+		}
+	default:
+		return fmt.Errorf("-audio には aac、copy、none のいずれかを指定してください: %s", j.Audio)
+	}
+	switch j.VFRPolicy {
+	case "cfr":
+	case "vsync-passthrough":
+		if j.Transition != "" || j.ScenesMontage {
+			return errors.New("-vfr-policy vsync-passthrough は -transition、-scenes-montage と同時に指定できません。")
+		}
+	default:
+		return fmt.Errorf("-vfr-policy には cfr または vsync-passthrough を指定してください: %s", j.VFRPolicy)
+	}
+	switch j.Tonemap {
+	case "auto", "sdr", "none":
+	default:
+		return fmt.Errorf("-tonemap には auto、sdr、none のいずれかを指定してください: %s", j.Tonemap)
+	}
+	if err := j.checkCleanup(); err != nil {
+		return err
+	}
+	if j.Speed != "" {
+		if s.speed, err = parseSpeed(j.Speed); err != nil {
+			return fmt.Errorf("-speed: %v", err)
+		}
+	}
+	if j.SpeedAudio != "tempo" && j.SpeedAudio != "drop" {
+		return fmt.Errorf("-speed-audio には tempo または drop を指定してください: %s", j.SpeedAudio)
+	}
+	if j.Copy && s.speed != 0 {
+		return errors.New("-speed は -copy と同時に指定できません。")
+	}
+	if j.TargetSize != "" {
+		if s.targetBytes, err = ParseByteSize(j.TargetSize); err != nil {
+			return fmt.Errorf("-target-size の値が不正です: %v", err)
+		}
+		if j.VideoBitrate != "" {
+			return errors.New("-target-size と -vbitrate は同時に指定できません。")
+		}
+		if !isFFprobeAvailable() {
+			return errors.New("-target-size には出力の長さを求めるためにffprobeが必要です。")
+		}
+		j.TwoPass = true
+	}
+	if j.TwoPass {
+		if j.VideoBitrate == "" && j.TargetSize == "" {
+			return errors.New("-two-pass には -vbitrate か -target-size を指定してください。")
+		}
+		if j.CRF >= 0 {
+			return errors.New("-two-pass は -crf と同時に指定できません。")
+		}
+		if j.Copy || j.Normalize || j.Checkpoint || j.OrientationGroups || j.Renditions != "" {
+			return errors.New("-two-pass、-target-size は -copy、-normalize、-checkpoint、-orientation-groups、-renditions と同時に指定できません。")
+		}
+	}
+	if j.Format != "file" {
+		s.streaming = &StreamingOutput{Format: j.Format, SegmentDuration: j.SegmentDuration, MasterPlaylist: j.MasterPlaylist}
+		if err := s.streaming.validate(j.Output); err != nil {
+			return err
+		}
+		if j.Copy || j.Normalize || j.Checkpoint || j.OrientationGroups {
+			return fmt.Errorf("-format %s は -copy、-normalize、-checkpoint、-orientation-groups と同時に指定できません。", j.Format)
+		}
+	}
+	if j.Renditions != "" {
+		if j.Copy || j.Normalize || j.Checkpoint || j.OrientationGroups {
+			return errors.New("-renditions は -copy、-normalize、-checkpoint、-orientation-groups と同時に指定できません。")
+		}
+		if j.MasterPlaylist {
+			return errors.New("-renditions を指定した -format hls では -output がマスタープレイリストになるため、-master-playlist は指定できません。")
+		}
+	}
+	if j.Music != "" {
+		if !isFFprobeAvailable() {
+			return errors.New("-music にはffprobeが必要です。")
+		}
+		if j.Copy || j.Normalize || j.Checkpoint || j.OrientationGroups || j.ScenesMontage {
+			return errors.New("-music は -copy、-normalize、-checkpoint、-orientation-groups、-scenes-montage と同時に指定できません。")
+		}
+		if j.Audio == "none" {
+			return errors.New("-music は -audio none と同時に指定できません。")
+		}
+		if j.MusicMode != "mix" && j.MusicMode != "replace" {
+			return fmt.Errorf("-music-mode には mix または replace を指定してください: %s", j.MusicMode)
+		}
+		s.music = &Music{Path: j.Music, Volume: j.MusicVolume, Replace: j.MusicMode == "replace", Duck: j.MusicDuck, DuckRatio: j.MusicDuckRatio}
+		if err := s.music.validate(); err != nil {
+			return err
+		}
+	}
+	if j.Watermark != "" {
+		if j.Copy {
+			return errors.New("-watermark は -copy と同時に指定できません。")
+		}
+		s.watermark = &Watermark{Path: j.Watermark, Position: j.WatermarkPosition, Opacity: j.WatermarkOpacity, Margin: j.WatermarkMargin}
+		if err := s.watermark.validate(); err != nil {
+			return err
+		}
+	}
+	if j.BurnTimestamp {
+		if !isFFprobeAvailable() {
+			return errors.New("-burn-timestamp にはffprobeが必要です。")
+		}
+		if j.Copy || j.ScenesMontage {
+			return errors.New("-burn-timestamp は -copy、-scenes-montage と同時に指定できません。")
+		}
+		if j.TimestampFormat == "" {
+			return errors.New("-timestamp-format を空にすることはできません。")
+		}
+	}
+	if j.TitleCards {
+		if j.Copy || j.ScenesMontage {
+			return errors.New("-title-cards は -copy、-scenes-montage と同時に指定できません。")
+		}
+		s.titleCard = &TitleCard{
+			Duration:   j.TitleCardDuration,
+			Background: j.TitleCardBackground,
+			Text:       j.TitleCardText,
+			DateFormat: j.TitleCardDateFormat,
+			Font:       j.TitleCardFont,
+			FontColor:  j.TitleCardColor,
+		}
+		if err := s.titleCard.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discover は入力を検索して結合する順に並べ、出力ファイル名とイントロ・アウトロを決める
+// 結合する動画ファイルが無く正常終了する場合や、確認で中止した場合はfalseを返す
+func (j *Job) discover(ctx context.Context, s *runState) (bool, error) {
+	var err error
+	s.videoFiles, s.chapterEntries, err = j.discoverInputs(ctx, s.sortKey, s.explicitFiles)
+	if err != nil {
+		return false, err
+	}
+	if len(s.videoFiles) == 0 {
+		return false, nil
+	}
+
+	// 空のファイルや破損したファイル、ビデオストリームを持たないファイルを確認
+	if isFFprobeAvailable() {
+		infof("入力ファイルを確認中...")
+		s.videoFiles, err = validateInputs(s.videoFiles, j.OnError == "abort")
+		if err != nil {
+			return false, fmt.Errorf("入力ファイルの確認に失敗しました: %v", err)
+		}
+		if len(s.videoFiles) == 0 {
+			return false, errors.New("結合できる動画ファイルがありません。")
+		}
+	}
+
+	// 結合するクリップの順序と内容を確認してもらう
+	if j.Interactive {
+		if s.chapterEntries != nil {
+			return false, errors.New("-interactive は -source と同時に指定できません。")
+		}
+		clips := probeReviewClips(s.videoFiles, j.Jobs)
+		s.videoFiles, err = reviewClips(ctx, os.Stdin, os.Stdout, clips)
+		if errors.Is(err, errReviewAborted) {
+			infof("結合を中止しました。")
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("クリップの確認に失敗しました: %v", err)
+		}
+	}
+
+	// 出力ファイル名のテンプレートを展開
+	if isOutputTemplate(j.Output) {
+		data, err := j.outputNameData(s.videoFiles, s.sortKey)
+		if err != nil {
+			return false, err
+		}
+		if j.Output, err = renderOutputName(j.Output, data); err != nil {
+			return false, err
+		}
+		infof("出力ファイル: %s", j.Output)
+		if !j.DryRun && !j.Describe {
+			if err := os.MkdirAll(filepath.Dir(j.Output), 0o755); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	// 既存の出力ファイルを上書きしないか確認する
+	// 向きごとの出力と解像度ごとのファイルへの出力は、それぞれの出力先が決まった時点で確認する
+	if !j.OrientationGroups && (j.Renditions == "" || s.streaming != nil) {
+		if j.Output, err = j.resolveOutputConflict(j.Output, []string{""}); err != nil {
+			return false, err
+		}
+	}
+
+	// 解像度の自動判定
+	if j.Resolution == "auto" {
+		if !isFFprobeAvailable() {
+			return false, errors.New("-resolution auto にはffprobeが必要です。")
+		}
+		j.Resolution, err = detectModalResolution(s.videoFiles)
+		if err != nil {
+			return false, fmt.Errorf("解像度の自動判定に失敗しました: %v", err)
+		}
+	}
+
+	// イントロ・アウトロのクリップを確認 (解像度の自動判定や黒画面の除外などの対象にはしない)
+	s.intro, err = resolveBrandingClip(j.Intro, "-intro")
+	if err != nil {
+		return false, err
+	}
+	s.outro, err = resolveBrandingClip(j.Outro, "-outro")
+	if err != nil {
+		return false, err
+	}
+	// 入力ディレクトリ内にイントロ・アウトロがある場合は、本編として重複させない
+	s.videoFiles = slices.DeleteFunc(s.videoFiles, func(file string) bool {
+		return slices.Contains(s.intro, file) || slices.Contains(s.outro, file)
+	})
+	if len(s.videoFiles) == 0 {
+		return false, errors.New("イントロ・アウトロ以外に結合する動画ファイルがありません。")
+	}
+	s.allFiles = slices.Concat(s.intro, s.videoFiles, s.outro)
+	return true, nil
+}
+
+// inspectInputs は入力の長さ・字幕・音声形式・フレームレートを確認する
+func (j *Job) inspectInputs(s *runState) error {
+	var err error
+	// 総フレーム数の指定を入力の長さと照合
+	if j.TotalFrames < 0 {
+		return errors.New("-total-frames には0以上の値を指定してください。")
+	}
+	if j.TotalFrames > 0 && isFFprobeAvailable() {
+		available, err := countAvailableFrames(s.allFiles, j.Framerate)
+		if err != nil {
+			return fmt.Errorf("入力の長さの取得に失敗しました: %v", err)
+		}
+		if s.speed != 0 {
+			available = int64(float64(available) / s.speed)
+		}
+		if available < j.TotalFrames {
+			warnf("入力から得られるフレーム数は約%dフレームのため、-total-frames %d に届きません。", available, j.TotalFrames)
+		}
+	}
+
+	// 字幕ストリームの確認
+	s.subtitleCodec = ""
+	if j.Subtitles == "copy" {
+		if s.subtitleCodec = subtitleOutputCodec(j.Output); s.subtitleCodec == "" {
+			warnf("出力形式 '%s' は字幕の格納に対応していないため、字幕を引き継ぎません。", filepath.Ext(j.Output))
+		}
+	}
+	if j.Subtitles == "none" {
+		for _, file := range s.allFiles {
+			if findSidecarSubtitle(file) != "" {
+				infof("入力の隣に字幕ファイルがあります。出力に含めるには -subtitles copy または burn を指定してください。")
+				break
+			}
+		}
+	}
+
+	// 音声のチャンネルレイアウトが混在している場合は揃える
+	s.audioFilter = ""
+	if isFFprobeAvailable() {
+		mixed, err := hasMixedAudioLayouts(s.allFiles)
+		if err != nil {
+			return fmt.Errorf("音声形式の確認に失敗しました: %v", err)
+		}
+		if mixed {
+			infof("音声を %s, %dHz に揃えます。", j.AudioLayout, defaultAudioSampleRate)
+			s.audioFilter = buildAudioNormalizeFilter(j.AudioLayout)
+		}
+	}
+	// 可変フレームレートの入力がある場合は、-vfr-policy に従ってフレームとタイムスタンプを扱う
+	if isFFprobeAvailable() && !j.Copy {
+		if s.vfrFiles, err = detectVFRInputs(s.allFiles, j.Jobs); err != nil {
+			return fmt.Errorf("フレームレートの確認に失敗しました: %v", err)
+		}
+		for _, file := range s.vfrFiles {
+			infof("可変フレームレートの入力です: %s", filepath.Base(file))
+		}
+		if len(s.vfrFiles) > 0 {
+			if j.VFRPolicy == "cfr" {
+				infof("可変フレームレートの入力を %dfps の固定フレームレートに変換し、音声をタイムスタンプに同期させます。", j.Framerate)
+			} else {
+				infof("可変フレームレートの入力のタイムスタンプをそのまま使い、音声をタイムスタンプに同期させます。")
+			}
+			s.audioFilter = joinFilters(s.audioFilter, vfrAudioFilter)
+		}
+	}
+	// 音声をコピーできない場合はAACで再エンコードする
+	s.audioCopy = false
+	if j.Audio == "copy" && !j.Copy {
+		reason := ""
+		switch {
+		case !isFFprobeAvailable():
+			reason = "ffprobeが無く入力の音声を確認できない"
+		case len(s.vfrFiles) > 0:
+			reason = "可変フレームレートの入力に音声を同期させる"
+		case s.audioFilter != "":
+			reason = "音声形式を揃える必要がある"
+		case j.Transition != "":
+			reason = "トランジションで前後の音声を重ねる"
+		case s.music != nil:
+			reason = "BGMを合成する"
+		default:
+			if reason, err = audioCopyIncompatibility(s.allFiles, j.Output); err != nil {
+				return fmt.Errorf("音声形式の確認に失敗しました: %v", err)
+			}
+		}
+		if reason != "" {
+			warnf("%sため、音声をAACで再エンコードします。", reason)
+		} else {
+			infof("音声を再エンコードせずにコピーします。")
+			s.audioCopy = true
+		}
+	}
+	return nil
+}
+
+// buildEntries は結合するクリップのエントリを作成し、カット・黒画面の除外・動きの抽出・再生速度などを反映する
+func (j *Job) buildEntries(s *runState) error {
+	var err error
+	s.entries = fileEntries(s.videoFiles)
+	if s.chapterEntries != nil {
+		s.entries = s.chapterEntries
+	}
+	// カットリストで指定された範囲のみを結合する
+	if j.CutsFile != "" {
+		if err := applyCuts(s.entries, j.CutsFile); err != nil {
+			return fmt.Errorf("カットリストの適用に失敗しました: %v", err)
+		}
+	}
+	// クリップ先頭・末尾の黒画面を除外
+	if j.TrimBlack {
+		infof("黒画面を検出中...")
+		if j.IOJobs <= 0 {
+			j.IOJobs = defaultIOJobs(filepath.Dir(s.videoFiles[0]))
+		}
+		limiter := newIOLimiter(j.IOJobs)
+		err := runParallel(len(s.entries), j.Jobs, func(i int) error {
+			// 検出処理はクリップ全体を読み込むため、I/Oの同時実行数を制限する
+			limiter.acquire()
+			defer limiter.release()
+			in, out, err := detectBlackTrim(s.entries[i].Path, j.BlackThreshold, j.BlackMinDuration, j.Limits)
+			if err != nil {
+				return err
+			}
+			if in > 0 || out > 0 {
+				debugf("黒画面を除外します: %s (inpoint=%.3f, outpoint=%.3f)", filepath.Base(s.entries[i].Path), in, out)
+			}
+			s.entries[i].Inpoint, s.entries[i].Outpoint = in, out
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("黒画面の検出に失敗しました: %v", err)
+		}
+	}
+	// 映像と音声の長さのずれを補正
+	if j.AVTolerance > 0 && isFFprobeAvailable() {
+		if err := balanceAVDurations(s.entries, j.AVTolerance); err != nil {
+			return fmt.Errorf("映像と音声の長さの確認に失敗しました: %v", err)
+		}
+	}
+	// 動きのある区間のみを抽出
+	if j.MotionOnly {
+		infof("動きのある区間を検出中...")
+		if j.IOJobs <= 0 {
+			j.IOJobs = defaultIOJobs(filepath.Dir(s.videoFiles[0]))
+		}
+		limiter := newIOLimiter(j.IOJobs)
+		segments := make([][]ConcatEntry, len(s.entries))
+		err := runParallel(len(s.entries), j.Jobs, func(i int) error {
+			limiter.acquire()
+			defer limiter.release()
+			segs, err := detectMotionSegments(s.entries[i].Path, j.MotionThreshold, j.MotionMinLength, j.Limits)
+			if err != nil {
+				return err
+			}
+			debugf("%s: 動きのある区間 %d個", filepath.Base(s.entries[i].Path), len(segs))
+			segments[i] = segs
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("動きの検出に失敗しました: %v", err)
+		}
+		s.entries = nil
+		for _, segs := range segments {
+			s.entries = append(s.entries, segs...)
+		}
+		if len(s.entries) == 0 {
+			return errors.New("動きのある区間が見つかりませんでした。-motion-threshold を下げてください。")
+		}
+	}
+	// 再生速度を変える (イントロ・アウトロは等速のまま)
+	s.speedChanged = false
+	for i := range s.entries {
+		if s.entries[i].Speed == 0 {
+			s.entries[i].Speed = s.speed
+		}
+		if s.entries[i].playbackSpeed() != 1 {
+			s.speedChanged = true
+		}
+	}
+	if s.speedChanged {
+		if j.Copy {
+			return errors.New("カットリストで再生速度を指定したクリップがあるため、-copy は使用できません。")
+		}
+		if s.speed != 0 {
+			infof("再生速度を%g倍にします。", s.speed)
+		}
+		if s.audioCopy {
+			warnf("再生速度を変えるため、音声をAACで再エンコードします。")
+			s.audioCopy = false
+		}
+		if j.BurnTimestamp {
+			warnf("再生速度を変えたクリップでは、焼き込む録画日時が出力の時間の進み方で表示されます。")
+		}
+	}
+	// イントロ・アウトロを前後に追加し、以降は他のクリップと同じく出力の解像度に合わせて結合する
+	if s.intro != nil || s.outro != nil {
+		infof("イントロ・アウトロのクリップを追加します。")
+		s.entries = slices.Concat(fileEntries(s.intro), s.entries, fileEntries(s.outro))
+		s.videoFiles = s.allFiles
+	}
+	// クリップごとのラウドネスを測定し、目標値に揃えるための音量の補正値を求める
+	if j.NormalizeAudio {
+		infof("ラウドネスを測定中...")
+		if j.IOJobs <= 0 {
+			j.IOJobs = defaultIOJobs(filepath.Dir(s.videoFiles[0]))
+		}
+		limiter := newIOLimiter(j.IOJobs)
+		err := runParallel(len(s.entries), j.Jobs, func(i int) error {
+			limiter.acquire()
+			defer limiter.release()
+			integrated, truePeak, ok, err := measureLoudness(s.entries[i], j.LoudnessTarget, j.Limits)
+			if err != nil || !ok {
+				return err
+			}
+			s.entries[i].Gain = loudnessGain(integrated, truePeak, j.LoudnessTarget)
+			debugf("%s: %.1f LUFS → 音量を %+.1fdB 補正します。", filepath.Base(s.entries[i].Path), integrated, s.entries[i].Gain)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("ラウドネスの測定に失敗しました: %v", err)
+		}
+	}
+	// 各クリップの録画開始日時を求める (イントロ・アウトロには表示しない)
+	if j.BurnTimestamp {
+		infof("録画開始日時を取得中...")
+		if err := setRecordingStarts(s.entries, slices.Concat(s.intro, s.outro)); err != nil {
+			return err
+		}
+		if s.timestampDurations, err = entryDurations(s.entries); err != nil {
+			return fmt.Errorf("クリップの長さの取得に失敗しました: %v", err)
+		}
+		s.timestampFormat = j.TimestampFormat
+	}
+	return nil
+}
+
+// configureEncoder はエンコーダーを決め、映像・音声のフィルターと出力の引数を組み立てる
+func (j *Job) configureEncoder(ctx context.Context, s *runState) error {
+	var err error
+	s.chosenEncoder = j.Encoder
+	if s.chosenEncoder == "" {
+		if s.container == "gif" {
+			s.chosenEncoder = "gif"
+		} else if encoder, ok := codecEncoders[s.codec]; ok {
+			s.chosenEncoder = encoder
+		} else if j.TwoPass {
+			// ハードウェアエンコーダーは2パスに対応しないため、ソフトウェアエンコーダーを使う
+			s.chosenEncoder = "libx265"
+			if s.codec == "h264" {
+				s.chosenEncoder = "libx264"
+			}
+		} else {
+			infof("使用できるエンコーダーを確認中...")
+			s.chosenEncoder, err = detectEncoder(s.codec, j.Limits)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if j.TwoPass && !twoPassEncoders[s.chosenEncoder] {
+		return fmt.Errorf("-two-pass は libx264、libx265、libvpx、libvpx-vp9、libaom-av1 でのみ使用できます: %s", s.chosenEncoder)
+	}
+	infof("使用するエンコーダー: %s", s.chosenEncoder)
+	if (s.chosenEncoder == "libvpx-vp9" || s.chosenEncoder == "libaom-av1") && j.CRF < 0 && j.VideoBitrate == "" && j.TargetSize == "" {
+		infof("-crf と -vbitrate が指定されていないため、固定品質 (-crf %d) でエンコードします。", defaultVP9AV1CRF)
+		j.CRF = defaultVP9AV1CRF
+	}
+	s.rateControlArgs, err = buildRateControlArgs(s.chosenEncoder, j.MaxBitrate, j.Bufsize)
+	if err != nil {
+		return err
+	}
+	qualityArgs, err := buildQualityArgs(s.chosenEncoder, QualityOptions{
+		CRF:          j.CRF,
+		VideoBitrate: j.VideoBitrate,
+		Preset:       j.Preset,
+		Tune:         j.Tune,
+	}, s.rateControlArgs != nil)
+	if err != nil {
+		return err
+	}
+	s.rateControlArgs = append(s.rateControlArgs, qualityArgs...)
+	s.gpuArgs, err = buildGPUArgs(s.chosenEncoder, encoderGPUIndex(s.chosenEncoder, j.GPU))
+	if err != nil {
+		return err
+	}
+	// クリップごとにインターレース解除・ノイズ除去・手ぶれ補正を行う
+	if j.cleanupFilters() {
+		if s.shakeDetections, err = j.applyCleanup(s.entries); err != nil {
+			return err
+		}
+	}
+	// HDRの入力は、全て同じ種類のHDRであれば色の情報を保持し、SDRと混在する場合はSDRに変換する
+	if j.Tonemap != "none" && s.container != "gif" && !j.Copy && isFFprobeAvailable() {
+		if s.colorArgs, s.hdr, err = j.applyHDRPolicy(s.entries, s.chosenEncoder); err != nil {
+			return err
+		}
+		if s.hdr != nil {
+			s.gpuArgs = hdrGPUArgs(s.gpuArgs)
+		}
+	}
+	// 再生速度を変えるクリップに、映像と音声の速度を変えるフィルターを設定する
+	s.speedNoAudio = false
+	if s.speedChanged {
+		if s.speedNoAudio = applySpeedFilters(s.entries, j.SpeedAudio == "drop"); s.speedNoAudio {
+			infof("全てのクリップの再生速度を変えるため、音声を出力しません。")
+		}
+	}
+	// 各クリップの前にタイトルカードを挿入する (イントロ・アウトロには付けない)
+	if s.titleCard != nil {
+		if s.hdr != nil {
+			if missing, err := checkFilters("zscale"); err != nil {
+				return err
+			} else if missing != "" {
+				return errors.New("HDRを保持する出力にタイトルカードを挿入するには zscale フィルターに対応したffmpeg (libzimg付きのビルド) が必要です。-tonemap sdr でSDRに変換して出力できます。")
+			}
+		}
+		if s.entries, err = j.insertTitleCards(ctx, s.titleCard, s.entries, slices.Concat(s.intro, s.outro), s.hdr); err != nil {
+			return fmt.Errorf("タイトルカードの作成に失敗しました: %v", err)
+		}
+		if s.timestampDurations != nil {
+			if s.timestampDurations, err = entryDurations(s.entries); err != nil {
+				return fmt.Errorf("クリップの長さの取得に失敗しました: %v", err)
+			}
+		}
+		// タイトルカードは入力とコーデックが異なり、concat demuxerでまとめて読み込めないため、クリップごとに正規化する
+		if j.Transition == "" && !j.Checkpoint && !j.Normalize {
+			if j.OrientationGroups || j.EmbedChapters || s.music != nil || s.streaming != nil || j.Renditions != "" || j.TwoPass {
+				return errors.New("タイトルカードを挿入するため、-orientation-groups、-embed-chapters、-music、-format、-renditions、-two-pass は使用できません。")
+			}
+			infof("タイトルカードを挿入するため、クリップごとに正規化してから結合します。")
+			j.Normalize = true
+		}
+	}
+
+	s.scaleFilter, err = buildScaleFilter(j.Resolution, j.Fit, j.ScaleMode)
+	if err != nil {
+		return err
+	}
+	s.videoFilter = fmt.Sprintf("%s,fps=%d", s.scaleFilter, j.Framerate) + s.gpuArgs.FilterSuffix // 解像度とフレームレートを設定
+	// 可変フレームレートの入力をそのまま出力する場合は、フレームレートを揃えない
+	// その場合は出力のフレーム数が -framerate から決まらないため、出力の検証では空でないことのみを確認する
+	s.verifyFramerate = j.Framerate
+	if len(s.vfrFiles) > 0 {
+		s.vfrArgs = vfrOutputArgs(j.VFRPolicy)
+		if j.VFRPolicy == "vsync-passthrough" {
+			s.videoFilter = s.scaleFilter + s.gpuArgs.FilterSuffix
+			s.verifyFramerate = 0
+		}
+	}
+
+	// 出力の解像度で結合した映像を分岐し、解像度ごとに縮小して出力する
+	if j.Renditions != "" {
+		if s.posterMode == "attached_pic" {
+			return errors.New("-renditions ではカバーアートとしてのポスター画像は埋め込めません。")
+		}
+		if s.renditions, err = parseRenditions(j.Renditions, j.Resolution); err != nil {
+			return err
+		}
+		if s.streaming == nil {
+			suffixes := make([]string, len(s.renditions))
+			for i, r := range s.renditions {
+				suffixes[i] = "_" + r.Name
+			}
+			if j.Output, err = j.resolveOutputConflict(j.Output, suffixes); err != nil {
+				return err
+			}
+		}
+		var names []string
+		for i, r := range s.renditions {
+			if s.streaming == nil {
+				s.renditions[i].Output = suffixedOutputPath(j.Output, "_"+r.Name)
+			}
+			names = append(names, fmt.Sprintf("%s (%dx%d)", r.Name, r.Width, r.Height))
+		}
+		infof("%d個の解像度で同時に出力します: %s", len(s.renditions), strings.Join(names, "、"))
+	}
+
+	// 回転メタデータの異なるクリップが混在している場合は、クリップごとにエンコードして回転を反映させる
+	if isFFprobeAvailable() && j.Transition == "" && !j.Checkpoint && !j.Normalize {
+		mixed, err := hasMixedRotations(s.videoFiles)
+		if err != nil {
+			return fmt.Errorf("回転メタデータの確認に失敗しました: %v", err)
+		}
+		if mixed {
+			if j.OrientationGroups || j.ScenesMontage || j.EmbedChapters || s.music != nil || s.streaming != nil || j.Renditions != "" || j.TwoPass {
+				return errors.New("回転メタデータの異なるクリップが混在しているため、-orientation-groups、-scenes-montage、-embed-chapters、-music、-format、-renditions、-two-pass は使用できません。")
+			}
+			infof("回転メタデータの異なるクリップが混在しているため、クリップごとに正規化してから結合します。")
+			j.Normalize = true
+		}
+	}
+
+	// クリップ固有のフィルターは、全てのクリップで同じであれば結合後の映像・音声にまとめて適用する
+	// 異なる場合は、トランジションでは入力ごとのフィルターで、それ以外ではクリップごとに正規化して適用する
+	if video, audio, uniform := uniformEntryFilters(s.entries); uniform && (video != "" || audio != "") {
+		s.videoFilter = joinFilters(video, s.videoFilter)
+		s.audioFilter = joinFilters(audio, s.audioFilter)
+		for i := range s.entries {
+			s.entries[i].VideoFilter, s.entries[i].AudioFilter = "", ""
+		}
+	} else if !uniform && j.Transition == "" && !j.Checkpoint && !j.Normalize {
+		if j.OrientationGroups || j.ScenesMontage || j.EmbedChapters || s.music != nil || s.streaming != nil || j.Renditions != "" || j.TwoPass {
+			return errors.New("クリップごとに異なるフィルター (HDRの変換、再生速度など) を適用するため、-orientation-groups、-scenes-montage、-embed-chapters、-music、-format、-renditions、-two-pass は使用できません。")
+		}
+		infof("クリップごとに異なるフィルターを適用するため、クリップごとに正規化してから結合します。")
+		j.Normalize = true
+	}
+
+	// タイムベースが混在している場合はフィルターと出力の両方で揃える
+	if isFFprobeAvailable() {
+		mixed, err := hasMixedTimeBases(s.videoFiles)
+		if err != nil {
+			return fmt.Errorf("タイムベースの確認に失敗しました: %v", err)
+		}
+		if mixed {
+			warnf("タイムベースが異なる入力があるため、タイムベースを統一します。")
+			s.videoFilter = "settb=AVTB," + s.videoFilter
+			s.timebaseArgs = timescaleArgs(j.Output)
+		}
+	}
+
+	// 最初のクリップの撮影日時と、撮影場所・機器の情報を出力に引き継ぐ
+	var metadata map[string]string
+	if !j.StripMetadata && isFFprobeAvailable() {
+		if metadata, err = sourceMetadata(s.videoFiles); err != nil {
+			return fmt.Errorf("メタデータの取得に失敗しました: %v", err)
+		}
+	}
+	s.outputMetadataArgs, err = metadataArgs(metadata, j.Metadata, j.StripMetadata)
+	if err != nil {
+		return err
+	}
+	if j.DumpGraph != "" {
+		overlays := EncodeJob{Entries: s.entries, GPUArgs: s.gpuArgs, Watermark: s.watermark, TimestampFormat: s.timestampFormat, TimestampFont: j.TimestampFont, EntryDurations: s.timestampDurations}
+		if err := writeFilterGraph(j.DumpGraph, applyOverlays(s.videoFilter, overlays), s.audioFilter); err != nil {
+			return fmt.Errorf("フィルターグラフの書き出しに失敗しました: %v", err)
+		}
+		infof("フィルターグラフを書き出しました: %s", j.DumpGraph)
+	}
+	return nil
+}
+
+// describe は -describe として実行内容の説明を表示する
+func (j *Job) describe(s *runState) error {
+	plan := PlanDescription{
+		ClipCount:  len(s.videoFiles),
+		Source:     j.Dir,
+		Order:      map[string]string{"mtime": "更新日時順", "btime": "作成日時順", "name": "ファイル名順", "metadata": "撮影日時順"}[s.sortKey],
+		Resolution: j.Resolution,
+		Framerate:  j.Framerate,
+		Encoder:    s.chosenEncoder,
+		Output:     j.Output,
+	}
+	if dirs, searchFiles := j.searchInputs(); len(dirs) > 1 || len(searchFiles) > 0 {
+		plan.Source = strings.Join(slices.Concat(dirs, searchFiles), "、")
+	}
+	if j.Sort == "weighted-shuffle" {
+		plan.Order = "重み付きランダム順"
+	} else if j.Reverse {
+		plan.Order = "逆" + plan.Order
+	}
+	if j.Manifest != nil {
+		plan.Source = j.ManifestPath
+		plan.Order = "マニフェストに記録された順"
+	}
+	if s.explicitFiles != nil {
+		plan.Source = j.ListFile
+		if plan.Source == "" {
+			plan.Source = "コマンドラインで指定したファイル"
+		}
+		plan.Order = "指定された順"
+	}
+	if isFFprobeAvailable() {
+		if d, err := totalInputDuration(s.videoFiles); err == nil {
+			plan.TotalDuration = d
+		}
+	}
+	// 平均ビットレートかビットレートの上限が分かる場合のみ出力サイズを見積もる
+	bitrate := j.VideoBitrate
+	if bitrate == "" {
+		bitrate = j.MaxBitrate
+	}
+	if rate, err := parseBitrate(bitrate); err == nil && plan.TotalDuration > 0 {
+		plan.EstimatedBytes = int64(plan.TotalDuration * float64(rate+192000) / 8)
+	}
+	if s.targetBytes > 0 {
+		plan.EstimatedBytes = s.targetBytes
+	}
+	fmt.Print(describePlan(plan))
+	return nil
+}
+
+// buildEncodeJob はffmpegでのエンコードの設定を組み立てる
+func (j *Job) buildEncodeJob(s *runState) error {
+	var err error
+	if j.StatsPeriod <= 0 {
+		j.StatsPeriod = defaultStatsPeriod()
+	}
+	inputArgs := []string{"-stats_period", strconv.FormatFloat(j.StatsPeriod.Seconds(), 'f', -1, 64)}
+	if j.ThreadQueueSize > 0 {
+		inputArgs = append(inputArgs, "-thread_queue_size", strconv.Itoa(j.ThreadQueueSize))
+	}
+	if j.ProbeSize != "" {
+		inputArgs = append(inputArgs, "-probesize", j.ProbeSize)
+	}
+	if j.AnalyzeDuration != "" {
+		inputArgs = append(inputArgs, "-analyzeduration", j.AnalyzeDuration)
+	}
+	inputArgs = append(inputArgs, j.ExtraInputArgs...)
+	s.encodeJob = EncodeJob{
+		Entries:         s.entries,
+		Output:          j.Output,
+		VideoFilter:     s.videoFilter,
+		AudioFilter:     s.audioFilter,
+		Encoder:         s.chosenEncoder,
+		EOL:             s.eol,
+		InputArgs:       inputArgs,
+		Poster:          j.Poster,
+		PosterMode:      s.posterMode,
+		SubtitleCodec:   s.subtitleCodec,
+		TotalFrames:     j.TotalFrames,
+		RateControlArgs: s.rateControlArgs,
+		GPUArgs:         s.gpuArgs,
+		Limits:          j.Limits,
+		MetadataArgs:    s.outputMetadataArgs,
+		ExtraArgs:       slices.Concat(s.timebaseArgs, s.vfrArgs, s.colorArgs, j.ExtraArgs),
+		Watermark:       s.watermark,
+		TimestampFormat: s.timestampFormat,
+		TimestampFont:   j.TimestampFont,
+		EntryDurations:  s.timestampDurations,
+		NoAudio:         j.Audio == "none" || s.speedNoAudio,
+		Streaming:       s.streaming,
+		Renditions:      s.renditions,
+		AudioCopy:       s.audioCopy,
+		AudioCodec:      "aac",
+		GIF:             s.container == "gif",
+	}
+	if format, ok := containerFormats[s.container]; ok && format.AudioCodec != "" {
+		s.encodeJob.AudioCodec = format.AudioCodec
+	}
+	if j.NormalizeAudio && s.encodeJob.EntryDurations == nil {
+		// 結合後の音声で各クリップの区間を求めるために使う
+		s.encodeJob.EntryDurations, err = entryDurations(s.entries)
+		if err != nil {
+			return fmt.Errorf("クリップの長さの取得に失敗しました: %v", err)
+		}
+	}
+	if j.Progress && isFFprobeAvailable() {
+		s.encodeJob.Progress = true
+		s.encodeJob.StatsPeriod = j.StatsPeriod
+		s.encodeJob.Framerate = j.Framerate
+		s.encodeJob.Events = j.Events
+	}
+	if j.ScenesMontage {
+		if j.SceneHold <= 0 {
+			return errors.New("-scene-hold には正の値を指定してください。")
+		}
+		infof("シーンの切り替わりごとのダイジェスト映像を作成します。")
+		s.encodeJob.VideoFilter = buildSceneMontageFilter(j.SceneThreshold, j.SceneHold, s.videoFilter)
+		s.encodeJob.NoAudio = true
+		// 出力の長さが事前に分からないため進捗率は表示しない
+		s.encodeJob.Progress = false
+	}
+	// 隣り合うクリップをトランジションで重ねる
+	if j.Transition != "" && len(s.entries) > 1 {
+		durations, err := entryDurations(s.entries)
+		if err != nil {
+			return fmt.Errorf("クリップの長さの取得に失敗しました: %v", err)
+		}
+		transitionDuration := j.TransitionDuration.Seconds()
+		for i, d := range durations {
+			if d <= transitionDuration {
+				return fmt.Errorf("クリップ %s の長さ (%.1f秒) がトランジションの長さ以下です。-transition-duration を短くしてください。", filepath.Base(s.entries[i].Path), d)
+			}
+		}
+		// acrossfadeは全ての入力に音声が必要なため、音声の無いクリップがある場合は映像のみを出力する
+		for _, entry := range s.entries {
+			types, err := probeStreamTypes(entry.Path)
+			if err != nil {
+				return err
+			}
+			if !hasStreamType(types, "audio") {
+				warnf("音声の無いクリップがあるため、音声を出力しません: %s", filepath.Base(entry.Path))
+				s.encodeJob.NoAudio = true
+				break
+			}
+		}
+		infof("クリップ間に %s のトランジション (%.1f秒) を入れます。", j.TransitionEffect, transitionDuration)
+		s.encodeJob.Transition = j.TransitionEffect
+		s.encodeJob.TransitionDuration = transitionDuration
+		s.encodeJob.EntryDurations = durations
+	}
+	// BGMを出力の長さに合わせて合成する
+	if s.music != nil {
+		if !s.music.Replace && !s.encodeJob.NoAudio && s.encodeJob.Transition == "" {
+			hasAudio := false
+			for _, file := range s.videoFiles {
+				types, err := probeStreamTypes(file)
+				if err != nil {
+					return err
+				}
+				if hasStreamType(types, "audio") {
+					hasAudio = true
+					break
+				}
+			}
+			if !hasAudio {
+				infof("音声を持つクリップが無いため、BGMのみを出力します。")
+				s.music.Replace = true
+			}
+		}
+		if s.music.Duration, err = outputDuration(s.encodeJob, j.Framerate); err != nil {
+			return fmt.Errorf("出力の長さの取得に失敗しました: %v", err)
+		}
+		infof("BGMを合成します: %s (%.1f秒)", filepath.Base(s.music.Path), s.music.Duration)
+		s.encodeJob.Music = s.music
+	}
+	// クリップの境界ごとのチャプターを出力に埋め込む
+	if j.EmbedChapters {
+		chapters, err := computeChapters(s.entries, s.encodeJob.TransitionDuration)
+		if err != nil {
+			return fmt.Errorf("チャプターの計算に失敗しました: %v", err)
+		}
+		chaptersFile, err := createChapterMetadataFile(chapters)
+		if err != nil {
+			return fmt.Errorf("チャプターの書き出しに失敗しました: %v", err)
+		}
+		s.tempFiles = append(s.tempFiles, chaptersFile)
+		infof("%d個のチャプターを出力に埋め込みます。", len(chapters))
+		s.encodeJob.ChaptersFile = chaptersFile
+	}
+	// 各入力の字幕 (隣の字幕ファイルか埋め込まれた字幕) を結合後の時刻にずらして1つにまとめ、出力に格納するか映像に焼き込む
+	if s.subtitleCodec != "" || j.Subtitles == "burn" {
+		var paths []string
+		for _, entry := range s.entries {
+			paths = append(paths, entry.Path)
+		}
+		subtitles, err := loadInputSubtitles(paths, j.Jobs, j.Limits)
+		if err != nil {
+			return fmt.Errorf("字幕の読み込みに失敗しました: %v", err)
+		}
+		if len(subtitles) == 0 {
+			warnf("字幕ストリームまたは字幕ファイルを持つ入力がありません。")
+		} else {
+			cues, err := mergeSubtitles(s.entries, s.encodeJob.TransitionDuration, subtitles)
+			if err != nil {
+				return fmt.Errorf("字幕の結合に失敗しました: %v", err)
+			}
+			subtitleFile, err := createSubtitleFile(cues)
+			if err != nil {
+				return fmt.Errorf("字幕の書き出しに失敗しました: %v", err)
+			}
+			s.tempFiles = append(s.tempFiles, subtitleFile)
+			s.encodeJob.SubtitleFile = subtitleFile
+			s.encodeJob.BurnSubtitles = j.Subtitles == "burn"
+			if s.encodeJob.BurnSubtitles {
+				infof("%d個のファイルの字幕 (%d件) を映像に焼き込みます。", len(subtitles), len(cues))
+			} else {
+				infof("%d個のファイルの字幕 (%d件) を出力に格納します。", len(subtitles), len(cues))
+			}
+		}
+	}
+
+	// 目標サイズに収まるよう、出力の長さから映像の平均ビットレートを求める
+	if s.targetBytes > 0 {
+		duration, err := outputDuration(s.encodeJob, j.Framerate)
+		if err != nil {
+			return fmt.Errorf("出力の長さの取得に失敗しました: %v", err)
+		}
+		var audioBitrate int64
+		if !s.encodeJob.NoAudio || s.encodeJob.Music != nil {
+			audioBitrate = estimatedAudioBitrate
+		}
+		bitrate, err := targetSizeBitrate(s.targetBytes, duration, audioBitrate)
+		if err != nil {
+			return err
+		}
+		j.VideoBitrate = strconv.FormatInt(bitrate, 10)
+		s.encodeJob.RateControlArgs = append(s.encodeJob.RateControlArgs, "-b:v", j.VideoBitrate)
+		infof("目標サイズ %s に収めるため、映像のビットレートを %.0fkbps にします。", j.TargetSize, float64(bitrate)/1000)
+	}
+	s.encodeJob.TwoPass = j.TwoPass
+
+	// 出力の先頭と末尾をフェードさせる (フェードアウトの開始位置は出力の長さから求める)
+	if j.FadeIn > 0 || j.FadeOut > 0 {
+		if s.encodeJob.AudioCopy {
+			warnf("フェードさせるため、音声をAACで再エンコードします。")
+			s.encodeJob.AudioCopy = false
+		}
+		s.encodeJob.FadeIn = j.FadeIn.Seconds()
+		s.encodeJob.FadeOut = j.FadeOut.Seconds()
+		if j.FadeOut > 0 {
+			duration, err := outputDuration(s.encodeJob, j.Framerate)
+			if err != nil {
+				return fmt.Errorf("出力の長さの取得に失敗しました: %v", err)
+			}
+			s.encodeJob.FadeOutStart = max(duration-s.encodeJob.FadeOut, 0)
+		}
+		// クリップごとにエンコードする場合は、最初と最後のクリップの中でフェードさせる
+		if j.Normalize || j.Checkpoint {
+			if s.encodeJob.EntryDurations == nil {
+				if s.encodeJob.EntryDurations, err = entryDurations(s.entries); err != nil {
+					return fmt.Errorf("クリップの長さの取得に失敗しました: %v", err)
+				}
+			}
+			if s.encodeJob.FadeIn > s.encodeJob.EntryDurations[0] || s.encodeJob.FadeOut > s.encodeJob.EntryDurations[len(s.entries)-1] {
+				warnf("クリップごとにエンコードするため、フェードは最初と最後のクリップの長さまでに収まります。")
+			}
+		}
+		var fades []string
+		if s.encodeJob.FadeIn > 0 {
+			fades = append(fades, fmt.Sprintf("先頭で%.1f秒フェードイン", s.encodeJob.FadeIn))
+		}
+		if s.encodeJob.FadeOut > 0 {
+			fades = append(fades, fmt.Sprintf("末尾で%.1f秒フェードアウト", s.encodeJob.FadeOut))
+		}
+		infof("出力の%sします。", strings.Join(fades, "、"))
+	}
+	return nil
+}
+
+// runCopy は再エンコードせずにストリームコピーで結合する
+func (j *Job) runCopy(ctx context.Context, s *runState) error {
+	// 事前に全ての入力の構成が一致しているかを確認する
+	if !isFFprobeAvailable() {
+		return errors.New("-copy にはffprobeが必要です。")
+	}
+	infof("ストリームコピーできるか確認中...")
+	if err := checkCopyCompatible(s.videoFiles); err != nil {
+		return fmt.Errorf("ストリームコピーで結合できません: %v\n-copy を外して再エンコードしてください。", err)
+	}
+	if j.DryRun {
+		printDryRun(os.Stdout, s.videoFiles, s.entries, buildCopyArgs(dryRunListFile, j.Output, j.ExtraInputArgs, slices.Concat(s.outputMetadataArgs, j.ExtraArgs)))
+		return nil
+	}
+	if err := checkDiskSpace(j.Output, inputsSize(s.entries), "入力の合計サイズ", j.Force); err != nil {
+		return err
+	}
+	infof("再エンコードせずに結合します...")
+	j.Events.emitInputs(s.entries)
+	j.Events.emitProbes(s.videoFiles)
+	started := time.Now()
+	j.written.add(j.Output)
+	if err := concatCopy(ctx, s.entries, j.Output, s.eol, j.ExtraInputArgs, slices.Concat(s.outputMetadataArgs, j.ExtraArgs), j.Limits); err != nil {
+		return fmt.Errorf("ffmpegの実行に失敗しました: %v", err)
+	}
+	// ストリームコピーでは入力のフレームレートのままのため、出力のフレーム数は空でないことのみを確認する
+	return j.finishOutputs(ctx, builtOutputs{
+		outputs:          []string{j.Output},
+		entries:          s.entries,
+		intro:            s.intro,
+		outro:            s.outro,
+		expectedDuration: func() (float64, error) { return entriesDuration(s.entries) },
+		settings:         ManifestSettings{TimeSource: j.TimeSource},
+		encodeTime:       time.Since(started),
+	})
+}
+
+// runEncode はffmpegで結合とエンコードを行う
+func (j *Job) runEncode(ctx context.Context, s *runState) error {
+	// 実行内容を表示して終了
+	if j.DryRun {
+		if s.encodeJob.TwoPass {
+			first, second := twoPassJobs(s.encodeJob, dryRunPassLog)
+			printDryRun(os.Stdout, s.videoFiles, s.encodeJob.Entries, buildEncodeArgs(first, dryRunListFile), buildEncodeArgs(second, dryRunListFile))
+			return nil
+		}
+		printDryRun(os.Stdout, s.videoFiles, s.encodeJob.Entries, buildEncodeArgs(s.encodeJob, dryRunListFile))
+		return nil
+	}
+	if len(s.shakeDetections) > 0 {
+		if err := runShakeDetection(ctx, s.shakeDetections, j.Jobs, j.Limits); err != nil {
+			return fmt.Errorf("手ぶれの解析に失敗しました: %v", err)
+		}
+	}
+	if err := j.checkOutputSpace(ctx, s.encodeJob); err != nil {
+		return err
+	}
+	j.Events.emitInputs(s.entries)
+	j.Events.emitProbes(s.videoFiles)
+	infof("動画の結合とエンコードを開始します...")
+	started := time.Now()
+
+	// 向きごとに別々の出力ファイルを作成
+	if j.OrientationGroups {
+		landscape, portrait, err := groupByOrientation(s.entries)
+		if err != nil {
+			return fmt.Errorf("クリップの向きの判定に失敗しました: %v", err)
+		}
+		infof("横長: %d個、縦長: %d個", len(landscape), len(portrait))
+		groups := []struct {
+			entries  []ConcatEntry
+			portrait bool
+			suffix   string
+		}{
+			{landscape, false, "_landscape"},
+			{portrait, true, "_portrait"},
+		}
+		for _, g := range groups {
+			if len(g.entries) == 0 {
+				continue
+			}
+			res, err := orientedResolution(j.Resolution, g.portrait)
+			if err != nil {
+				return err
+			}
+			groupJob := s.encodeJob
+			groupJob.Entries = g.entries
+			if s.encodeJob.EntryDurations != nil {
+				if groupJob.EntryDurations, err = entryDurations(g.entries); err != nil {
+					return fmt.Errorf("クリップの長さの取得に失敗しました: %v", err)
+				}
+			}
+			if groupJob.FadeOut > 0 {
+				duration, err := outputDuration(groupJob, j.Framerate)
+				if err != nil {
+					return fmt.Errorf("出力の長さの取得に失敗しました: %v", err)
+				}
+				groupJob.FadeOutStart = max(duration-groupJob.FadeOut, 0)
+			}
+			output, err := j.resolveOutputConflict(j.Output, []string{g.suffix})
+			if err != nil {
+				return err
+			}
+			groupJob.Output = suffixedOutputPath(output, g.suffix)
+			j.written.add(groupJob.Output)
+			groupScale, err := buildScaleFilter(res, j.Fit, j.ScaleMode)
+			if err != nil {
+				return err
+			}
+			groupJob.VideoFilter = strings.Replace(s.videoFilter, s.scaleFilter, groupScale, 1)
+			infof("%s を %s で作成します...", groupJob.Output, res)
+			groupStarted := time.Now()
+			if err := runEncode(ctx, groupJob); err != nil {
+				return fmt.Errorf("ffmpegの実行に失敗しました: %v", err)
+			}
+			if err := checkOutputFrames(groupJob.Entries, groupJob.Output, s.verifyFramerate, j.TotalFrames, 0); err != nil {
+				return fmt.Errorf("出力ファイルの検証に失敗しました: %v", err)
+			}
+			if j.Verify {
+				expected, err := outputDuration(groupJob, j.Framerate)
+				if err != nil {
+					return fmt.Errorf("入力の長さの取得に失敗しました: %v", err)
+				}
+				if err := j.verifyOutputs(ctx, []string{groupJob.Output}, expected); err != nil {
+					return err
+				}
+			}
+			j.Events.emitSummary(groupJob.Output, time.Since(groupStarted))
+		}
+		infof("処理が完了しました。")
+		return nil
+	}
+
+	j.written.add(j.Output)
+	for _, r := range s.renditions {
+		j.written.add(r.Output)
+	}
+	if j.Checkpoint {
+		if j.Poster != "" || j.TotalFrames > 0 || j.Subtitles != "none" {
+			warnf("-checkpoint では -poster、-total-frames、-subtitles は使用できないため無視します。")
+		}
+		if err := runCheckpointEncode(ctx, s.encodeJob); err != nil {
+			return fmt.Errorf("ffmpegの実行に失敗しました: %v", err)
+		}
+	} else if j.Normalize {
+		if j.Poster != "" || j.TotalFrames > 0 || j.Subtitles != "none" {
+			warnf("-normalize では -poster、-total-frames、-subtitles は使用できないため無視します。")
+		}
+		// 中間ファイル同士をストリームコピーで結合できるよう、音声の形式も必ず揃える
+		if s.encodeJob.AudioCopy {
+			warnf("-normalize では音声の形式を揃えるため、音声をAACで再エンコードします。")
+			s.encodeJob.AudioCopy = false
+		}
+		if s.encodeJob.AudioFilter == "" {
+			s.encodeJob.AudioFilter = buildAudioNormalizeFilter(j.AudioLayout)
+		}
+		if err := runNormalizedEncode(ctx, s.encodeJob, j.Jobs, j.CacheDir); err != nil {
+			return fmt.Errorf("ffmpegの実行に失敗しました: %v", err)
+		}
+	} else if err := runEncode(ctx, s.encodeJob); err != nil {
+		return fmt.Errorf("ffmpegの実行に失敗しました: %v", err)
+	}
+	encodeTime := time.Since(started)
+
+	// 解像度ごとのファイルに出力した場合は、スプライトシートなどは最初に指定した解像度の出力から作成する
+	outputs := []string{j.Output}
+	if len(s.renditions) > 0 && s.streaming == nil {
+		outputs = nil
+		for _, r := range s.renditions {
+			outputs = append(outputs, r.Output)
+		}
+	}
+
+	// -checkpoint と -normalize では -total-frames で打ち切らない
+	expectedJob := s.encodeJob
+	if j.Checkpoint || j.Normalize {
+		expectedJob.TotalFrames = 0
+	}
+	return j.finishOutputs(ctx, builtOutputs{
+		outputs:            outputs,
+		entries:            s.entries,
+		intro:              s.intro,
+		outro:              s.outro,
+		framerate:          s.verifyFramerate,
+		overlap:            transitionOverlap(s.encodeJob),
+		transitionDuration: s.encodeJob.TransitionDuration,
+		expectedDuration:   func() (float64, error) { return outputDuration(expectedJob, j.Framerate) },
+		settings: ManifestSettings{
+			Resolution:         j.Resolution,
+			Framerate:          j.Framerate,
+			Encoder:            s.chosenEncoder,
+			TimeSource:         j.TimeSource,
+			Poster:             j.Poster,
+			VideoFilter:        s.encodeJob.VideoFilter,
+			AudioFilter:        s.encodeJob.AudioFilter,
+			EncoderArgs:        s.encodeJob.RateControlArgs,
+			Transition:         s.encodeJob.Transition,
+			TransitionDuration: s.encodeJob.TransitionDuration,
+		},
+		encodeTime: encodeTime,
+	})
+}
+
+// builtOutputs は作成した出力ファイルと、出力の作成後の処理に必要な情報
+type builtOutputs struct {
+	outputs            []string // 作成した出力ファイル (スプライトシートなどは先頭の出力から作成する)
+	entries            []ConcatEntry
+	intro, outro       []string
+	framerate          int     // 出力のフレーム数の検証に使うフレームレート (0の場合は空でないことのみを確認する)
+	overlap            float64 // トランジションで重なる長さの合計
+	transitionDuration float64
+	expectedDuration   func() (float64, error) // -verify で想定する出力の長さ
+	settings           ManifestSettings
+	encodeTime         time.Duration
+}
+
+// finishOutputs は作成した出力を検証し、チャプター・スプライトシート・サムネイル・マニフェストなどを書き出す
+func (j *Job) finishOutputs(ctx context.Context, built builtOutputs) error {
+	outputs := built.outputs
+
+	// ffmpegが正常終了しても出力がほぼ空になっていないかを確認
+	// ダイジェスト映像は入力より大幅に短くなるため対象外とする
+	if j.ScenesMontage {
+		infof("ダイジェスト映像のため、出力ファイルの検証をスキップします。")
+	} else if isFFprobeAvailable() {
+		for _, output := range outputs {
+			if err := checkOutputFrames(built.entries, output, built.framerate, j.TotalFrames, built.overlap); err != nil {
+				return fmt.Errorf("出力ファイルの検証に失敗しました: %v", err)
+			}
+		}
+	} else {
+		warnf("ffprobeが見つからないため、出力ファイルの検証をスキップします。")
+	}
+	if j.Verify {
+		expected, err := built.expectedDuration()
+		if err != nil {
+			return fmt.Errorf("入力の長さの取得に失敗しました: %v", err)
+		}
+		if err := j.verifyOutputs(ctx, outputs, expected); err != nil {
+			return err
+		}
+	}
+
+	// Webプレイヤー向けのチャプターファイルを書き出す
+	if j.WebVTTChapters != "" {
+		chapters, err := computeChapters(built.entries, built.transitionDuration)
+		if err != nil {
+			return fmt.Errorf("チャプターの計算に失敗しました: %v", err)
+		}
+		if err := writeWebVTTChapters(j.WebVTTChapters, chapters); err != nil {
+			return fmt.Errorf("WebVTTチャプターの書き出しに失敗しました: %v", err)
+		}
+		infof("WebVTTチャプターを書き出しました: %s", j.WebVTTChapters)
+	}
+
+	// シークプレビュー用のスプライトシートを作成
+	if j.ScrubSprites {
+		vttPath, err := generateScrubSprites(outputs[0], SpriteOptions{
+			Interval: j.SpriteInterval,
+			Width:    j.SpriteWidth,
+			Columns:  j.SpriteColumns,
+		}, j.Limits)
+		if err != nil {
+			return fmt.Errorf("スプライトシートの作成に失敗しました: %v", err)
+		}
+		infof("スプライトシートを作成しました: %s", vttPath)
+	}
+
+	// 一覧用のサムネイルとコンタクトシートを作成
+	if j.Thumbnail != "" {
+		if err := generateThumbnail(outputs[0], j.Thumbnail, j.ThumbnailTime, j.Limits); err != nil {
+			return fmt.Errorf("サムネイルの作成に失敗しました: %v", err)
+		}
+		infof("サムネイルを作成しました: %s", j.Thumbnail)
+	}
+	if j.ContactSheet != "" {
+		err := generateContactSheet(outputs[0], j.ContactSheet, ContactSheetOptions{
+			Columns: j.ContactSheetColumns,
+			Rows:    j.ContactSheetRows,
+			Width:   j.ContactSheetWidth,
+		}, j.Limits)
+		if err != nil {
+			return fmt.Errorf("コンタクトシートの作成に失敗しました: %v", err)
+		}
+		infof("コンタクトシートを作成しました: %s", j.ContactSheet)
+	}
+
+	// 入力と出力の時間軸でのクリップ、設定、チェックサムを記録する
+	if j.WriteManifest {
+		if err := j.writeOutputManifests(outputs, built.entries, built.intro, built.outro, built.settings, built.transitionDuration, built.encodeTime); err != nil {
+			return fmt.Errorf("マニフェストの書き出しに失敗しました: %v", err)
+		}
+	}
+
+	// 出力のメタデータを保存用に書き出す
+	if j.DumpMetadata != "" {
+		if err := dumpFFMetadata(outputs[0], j.DumpMetadata, j.Limits); err != nil {
+			return fmt.Errorf("メタデータの書き出しに失敗しました: %v", err)
+		}
+		infof("メタデータを書き出しました: %s", j.DumpMetadata)
+	}
+
+	infof("処理が完了しました。出力ファイル: %s", strings.Join(outputs, ", "))
+	for _, output := range outputs {
+		j.Events.emitSummary(output, built.encodeTime)
+	}
+	return nil
+}
+
+// checkOutputSpace はエンコード前に出力サイズを見積もり、出力先の空き容量が足りるかを確認する
+func (j *Job) checkOutputSpace(ctx context.Context, encodeJob EncodeJob) error {
+	bitrate := j.VideoBitrate
+	if bitrate == "" {
+		bitrate = j.MaxBitrate
+	}
+	encodeJob.Framerate = j.Framerate
+	infof("出力サイズを見積もっています...")
+	estimate, method, err := estimateOutputSize(ctx, encodeJob, bitrate)
+	if err != nil {
+		warnf("出力サイズを見積もれないため、空き容量の確認をスキップします: %v", err)
+		return nil
+	}
+	if len(encodeJob.Renditions) > 0 {
+		// 出力の解像度での見積もりを、全ての解像度の画素数の合計に比例させる
+		estimate = int64(float64(estimate) * renditionPixelRatio(encodeJob.Renditions, j.Resolution))
+		method += "、解像度ごとの画素数から換算"
+	}
+	return checkDiskSpace(j.Output, estimate, method, j.Force)
+}
+
+// verifyOutputs は -verify として各出力の長さと、最後までデコードできるかを確認する
+// 出力ファイルは調査できるよう削除せずに残す
+func (j *Job) verifyOutputs(ctx context.Context, outputs []string, expected float64) error {
+	for _, output := range outputs {
+		infof("出力を検証中: %s", output)
+		if err := verifyOutput(ctx, output, expected, j.VerifyTolerance, j.Limits); err != nil {
+			return fmt.Errorf("出力ファイルの検証に失敗しました (出力は途中で途切れているか破損している可能性があります): %s, %v", output, err)
+		}
+	}
+	infof("出力の検証に成功しました。")
+	return nil
+}
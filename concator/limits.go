@@ -0,0 +1,118 @@
+package concator
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ResourceLimits はffmpegの子プロセスに課すリソースの上限
+// 上限は子プロセスの起動前に設定し、1回の実行で起動するffmpeg (エンコード、ストリームコピー、解析、検証、画像の書き出し、
+// テストエンコード) の全てに適用する。ffprobeによる情報の取得とエンコーダー・フィルターの一覧の取得には適用しない
+type ResourceLimits struct {
+	MemoryBytes int64   // メモリ使用量の上限 (0は無制限)
+	CPUs        float64 // 使用できるCPUコア数 (0は無制限)
+
+	// group は上限を共有する子プロセスのグループ (1回の実行で1つ作成し、コピーしたEncodeJobの間で共有する)
+	group *limitGroup
+}
+
+// limitGroup は1回の実行で起動する全ての子プロセスに、まとめて上限を課すためのグループ
+// -normalize などで並列に起動した子プロセスも同じグループに追加し、合計の使用量を制限する
+type limitGroup struct {
+	mu     sync.Mutex
+	dir    string // 作成したcgroupのディレクトリ (子プロセスが無い間は空)
+	users  int    // グループ内で実行中の子プロセスの数
+	warned bool   // cgroupを利用できない旨の警告を表示したか
+}
+
+// withGroup は子プロセスの間で上限を共有するグループを割り当てた上限を返す
+func (l ResourceLimits) withGroup() ResourceLimits {
+	if !l.IsZero() {
+		l.group = &limitGroup{}
+	}
+	return l
+}
+
+// warnOnce はグループ内で最初の1回のみ警告を表示する
+func (g *limitGroup) warnOnce(format string, args ...any) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.warned {
+		warnf(format, args...)
+		g.warned = true
+	}
+}
+
+// IsZero は上限が1つも設定されていないかを返す
+func (l ResourceLimits) IsZero() bool {
+	return l.MemoryBytes == 0 && l.CPUs == 0
+}
+
+// limitCommand は起動する前のcmdにリソースの上限を設定する
+// 戻り値の関数はcmdの終了後に呼び出す
+func limitCommand(cmd *exec.Cmd, limits ResourceLimits) (func(), error) {
+	release, err := applyResourceLimits(cmd, limits)
+	if err != nil {
+		return nil, fmt.Errorf("リソース上限の適用に失敗しました: %v", err)
+	}
+	return release, nil
+}
+
+// runLimited はリソースの上限を設定してcmdを実行する (cmd.Run と同じ)
+func runLimited(cmd *exec.Cmd, limits ResourceLimits) error {
+	release, err := limitCommand(cmd, limits)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return cmd.Run()
+}
+
+// outputLimited はリソースの上限を設定してcmdを実行し、標準出力を返す (cmd.Output と同じ)
+func outputLimited(cmd *exec.Cmd, limits ResourceLimits) ([]byte, error) {
+	release, err := limitCommand(cmd, limits)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return cmd.Output()
+}
+
+// combinedOutputLimited はリソースの上限を設定してcmdを実行し、標準出力と標準エラー出力を返す (cmd.CombinedOutput と同じ)
+func combinedOutputLimited(cmd *exec.Cmd, limits ResourceLimits) ([]byte, error) {
+	release, err := limitCommand(cmd, limits)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return cmd.CombinedOutput()
+}
+
+// ParseByteSize は "512M"、"2G"、"4GB" 形式のサイズをバイト数に変換する
+func ParseByteSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	// "4GB"、"4GiB" のように単位に B を付けた指定も受け付ける
+	if trimmed := strings.TrimSuffix(strings.TrimSuffix(str, "B"), "I"); trimmed != "" && strings.ContainsAny(trimmed[len(trimmed)-1:], "KMG") {
+		str = trimmed
+	}
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(str, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(str, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(str, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		str = str[:len(str)-1]
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("サイズの形式が正しくありません: %s (例: 512M, 2G)", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
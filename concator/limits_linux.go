@@ -0,0 +1,127 @@
+//go:build linux
+
+package concator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+)
+
+// cgroupRoot はcgroup v2のマウント位置
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cpuPeriodMicros はcgroupのcpu.maxに設定する期間 (マイクロ秒)
+const cpuPeriodMicros = 100000
+
+// cgroupSeq はcgroupのディレクトリ名に付ける連番 (serve で同時に実行するジョブごとに別のグループにする)
+var cgroupSeq atomic.Int64
+
+// applyResourceLimits は起動する前の子プロセスのコマンドにリソースの上限を設定する
+// cgroup v2が利用できる場合は起動と同時に実行ごとのグループへ入れて (CLONE_INTO_CGROUP) メモリとCPUの両方を制限し、
+// 利用できない場合はシェルの ulimit -v を介して起動し、メモリ (アドレス空間) のみを制限する。
+// -cpu-limit はcgroupが無いと適用できないためエラーにする
+// 戻り値の関数は子プロセスの終了後 (起動に失敗した場合も) に呼び出して後片付けを行う
+func applyResourceLimits(cmd *exec.Cmd, limits ResourceLimits) (func(), error) {
+	if limits.IsZero() {
+		return func() {}, nil
+	}
+	if limits.group == nil {
+		limits = limits.withGroup()
+	}
+
+	cleanup, err := applyCgroupLimits(cmd, limits)
+	if err == nil {
+		return cleanup, nil
+	}
+	if limits.CPUs > 0 {
+		return nil, fmt.Errorf("cgroupを利用できないため、-cpu-limit を適用できません: %v", err)
+	}
+	limits.group.warnOnce("cgroupを利用できないため、ulimitで制限します: %v", err)
+
+	if cmd.Err != nil {
+		// コマンドが見つからない場合は、そのまま起動してエラーにする
+		return func() {}, nil
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return nil, fmt.Errorf("メモリ上限の設定に失敗しました: %v", err)
+	}
+	// ulimit -v の単位はKiB
+	script := fmt.Sprintf(`ulimit -v %d && exec "$0" "$@"`, max(limits.MemoryBytes>>10, 1))
+	cmd.Args = append([]string{"sh", "-c", script, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = sh
+	return func() {}, nil
+}
+
+// applyCgroupLimits は子プロセスが実行ごとのcgroup v2のグループの中で起動するように設定する
+// グループは最初の子プロセスで作成し、グループ内の子プロセスが全て終了したら削除する
+func applyCgroupLimits(cmd *exec.Cmd, limits ResourceLimits) (func(), error) {
+	g := limits.group
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.dir == "" {
+		dir, err := createCgroup(limits)
+		if err != nil {
+			return nil, err
+		}
+		g.dir = dir
+	}
+	dir, err := os.Open(g.dir)
+	if err != nil {
+		if g.users == 0 {
+			os.Remove(g.dir)
+			g.dir = ""
+		}
+		return nil, err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	g.users++
+
+	return func() {
+		dir.Close()
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.users--; g.users == 0 {
+			os.Remove(g.dir)
+			g.dir = ""
+		}
+	}, nil
+}
+
+// createCgroup はcgroup v2に上限を設定した専用のグループを作成する
+func createCgroup(limits ResourceLimits) (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", errors.New("cgroup v2がマウントされていません")
+	}
+	dir := filepath.Join(cgroupRoot, fmt.Sprintf("video_concator-%d-%d", os.Getpid(), cgroupSeq.Add(1)))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	if limits.MemoryBytes > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.FormatInt(limits.MemoryBytes, 10)), 0o644); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+	}
+	if limits.CPUs > 0 {
+		quota := int64(limits.CPUs * cpuPeriodMicros)
+		value := fmt.Sprintf("%d %d", quota, cpuPeriodMicros)
+		if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(value), 0o644); err != nil {
+			os.Remove(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package concator
+
+import "os/exec"
+
+// applyResourceLimits はこのOSではリソースの上限に対応していないため、警告のみ表示する
+func applyResourceLimits(cmd *exec.Cmd, limits ResourceLimits) (func(), error) {
+	if !limits.IsZero() {
+		if limits.group == nil {
+			limits = limits.withGroup()
+		}
+		limits.group.warnOnce("-mem-limit と -cpu-limit はLinuxでのみ有効です。")
+	}
+	return func() {}, nil
+}
@@ -0,0 +1,205 @@
+package concator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogOptions はログの出力の設定
+type LogOptions struct {
+	Verbose bool   // デバッグ用の詳細なログ (ffmpegのログを含む) も出力する
+	Quiet   bool   // 警告とエラーのみを出力する
+	File    string // ログの書き込み先のファイル (空の場合は標準エラー出力)
+	Format  string // text, json
+}
+
+// logLevel は出力するログの最低の重要度
+var logLevel = new(slog.LevelVar)
+
+// logger はこのパッケージのログの出力先 (SetupLogging を呼ばない場合は従来の形式で標準エラー出力に書き出す)
+var logger = slog.New(&textHandler{out: os.Stderr, mu: new(sync.Mutex)})
+
+// SetupLogging はログの重要度・形式・出力先を設定し、標準の log パッケージの出力もそれに従わせる
+// ログファイルはプロセスの終了まで開いたままにする
+func SetupLogging(opts LogOptions) error {
+	if opts.Verbose && opts.Quiet {
+		return errors.New("-verbose と -quiet は同時に指定できません。")
+	}
+	if opts.Format != "text" && opts.Format != "json" {
+		return fmt.Errorf("-log-format には text または json を指定してください: %s", opts.Format)
+	}
+	switch {
+	case opts.Verbose:
+		logLevel.Set(slog.LevelDebug)
+	case opts.Quiet:
+		logLevel.Set(slog.LevelWarn)
+	default:
+		logLevel.Set(slog.LevelInfo)
+	}
+
+	var out io.Writer = os.Stderr
+	if opts.File != "" {
+		file, err := os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("ログファイルを開けません: %v", err)
+		}
+		out = file
+	}
+
+	var handler slog.Handler
+	if opts.Format == "json" {
+		handler = slog.NewJSONHandler(out, &slog.HandlerOptions{Level: logLevel})
+	} else {
+		handler = &textHandler{out: out, mu: new(sync.Mutex)}
+	}
+	logger = slog.New(handler)
+	slog.SetDefault(logger)
+	return nil
+}
+
+// textHandler は従来の log パッケージと同じ「日時 メッセージ」の形式でログを書き出す
+// 警告とエラーはメッセージの前に「警告:」「エラー:」を付ける
+type textHandler struct {
+	out   io.Writer
+	mu    *sync.Mutex
+	attrs []slog.Attr
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("エラー: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("警告: ")
+	}
+	b.WriteString(r.Message)
+	writeAttr := func(a slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		writeAttr(a)
+	}
+	r.Attrs(writeAttr)
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &textHandler{out: h.out, mu: h.mu, attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h *textHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// debugf は詳細なログ (-verbose の場合のみ表示する) を出力する
+func debugf(format string, args ...any) {
+	logf(slog.LevelDebug, format, args...)
+}
+
+// infof は通常のログを出力する
+func infof(format string, args ...any) {
+	logf(slog.LevelInfo, format, args...)
+}
+
+// warnf は警告を出力する
+func warnf(format string, args ...any) {
+	logf(slog.LevelWarn, format, args...)
+}
+
+// errorf はエラーを出力する
+func errorf(format string, args ...any) {
+	logf(slog.LevelError, format, args...)
+}
+
+// logf は重要度levelのログを出力する。出力しない重要度の場合はメッセージを組み立てない
+func logf(level slog.Level, format string, args ...any) {
+	if !logger.Enabled(context.Background(), level) {
+		return
+	}
+	r := slog.NewRecord(time.Now(), level, strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"), 0)
+	logger.Handler().Handle(context.Background(), r)
+}
+
+// ffmpegLogLimit はエラーの際に表示するためにffmpegのログを保持する最大のバイト数 (超えた分は古い方から捨てる)
+const ffmpegLogLimit = 64 << 10
+
+// ffmpegLog はffmpegの標準エラー出力の書き込み先
+// -verbose の場合はデバッグのログとして1行ずつ出力し、それ以外は保持しておき失敗した場合のみエラーとして表示する
+type ffmpegLog struct {
+	mu      sync.Mutex
+	debug   bool
+	pending []byte       // debug の場合の、改行がまだ来ていない行
+	tail    bytes.Buffer // debug でない場合の、直近のログ
+}
+
+// ffmpegStderr はffmpegの標準エラー出力の書き込み先を返す
+// showLog がtrue (進捗バーの代わりにffmpegのログを表示する設定) で、-quiet でない場合はそのまま標準エラー出力に表示する
+// 戻り値の関数は失敗した場合に呼び出し、保持しているログを表示する
+func ffmpegStderr(showLog bool) (io.Writer, func()) {
+	level := logLevel.Level()
+	if showLog && level == slog.LevelInfo {
+		return os.Stderr, func() {}
+	}
+	l := &ffmpegLog{debug: level <= slog.LevelDebug}
+	return l, l.report
+}
+
+func (l *ffmpegLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.debug {
+		l.tail.Write(p)
+		if l.tail.Len() > 2*ffmpegLogLimit {
+			l.tail.Next(l.tail.Len() - ffmpegLogLimit)
+		}
+		return len(p), nil
+	}
+	// ffmpegの統計の行は "\r" で上書きするため、"\r" も行の区切りとする
+	l.pending = append(l.pending, p...)
+	for {
+		i := bytes.IndexAny(l.pending, "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(l.pending[:i])); line != "" {
+			debugf("ffmpeg: %s", line)
+		}
+		l.pending = l.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// report は保持しているffmpegのログをエラーとして表示する
+func (l *ffmpegLog) report() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.debug {
+		if line := strings.TrimSpace(string(l.pending)); line != "" {
+			debugf("ffmpeg: %s", line)
+		}
+		return
+	}
+	if out := strings.TrimSpace(l.tail.String()); out != "" {
+		errorf("ffmpegのログ:\n%s", out)
+	}
+}
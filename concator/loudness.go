@@ -0,0 +1,116 @@
+package concator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// defaultLoudnessTarget はEBU R128の目標ラウドネス (LUFS)
+const defaultLoudnessTarget = -23.0
+
+// loudnessTruePeak は音量を上げる際に超えないようにするトゥルーピーク (dBTP)
+const loudnessTruePeak = -1.0
+
+// loudnessStats はloudnormフィルターの1パス目で測定した値
+type loudnessStats struct {
+	InputI  string `json:"input_i"`  // 統合ラウドネス (LUFS)
+	InputTP string `json:"input_tp"` // トゥルーピーク (dBTP)
+}
+
+// measureLoudness はloudnormフィルターで区間の統合ラウドネスとトゥルーピークを測定する
+// 音声が無い、または無音の場合はokがfalseになる
+func measureLoudness(entry ConcatEntry, target float64, limits ResourceLimits) (integrated, truePeak float64, ok bool, err error) {
+	args := []string{"-hide_banner", "-nostats"}
+	if entry.Inpoint > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(entry.Inpoint, 'f', 3, 64))
+	}
+	if entry.Outpoint > 0 {
+		args = append(args, "-to", strconv.FormatFloat(entry.Outpoint, 'f', 3, 64))
+	}
+	args = append(args,
+		"-i", entry.Path,
+		"-vn",
+		"-af", fmt.Sprintf("loudnorm=I=%g:TP=%g:print_format=json", target, loudnessTruePeak),
+		"-f", "null",
+		"-",
+	)
+	var stderr bytes.Buffer
+	cmd := exec.Command(ffmpegPath, args...)
+	cmd.Stderr = &stderr
+	if err := runLimited(cmd, limits); err != nil {
+		return 0, 0, false, fmt.Errorf("ラウドネスの測定に失敗しました: %s, %v", entry.Path, err)
+	}
+
+	// 測定結果はログの末尾にJSONとして出力される (音声が無い場合は出力されない)
+	output := stderr.String()
+	start, end := strings.LastIndex(output, "{"), strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return 0, 0, false, nil
+	}
+	var stats loudnessStats
+	if err := json.Unmarshal([]byte(output[start:end+1]), &stats); err != nil {
+		return 0, 0, false, fmt.Errorf("ラウドネスの測定結果の解析に失敗しました: %s, %v", entry.Path, err)
+	}
+	integrated, err = strconv.ParseFloat(stats.InputI, 64)
+	if err != nil || math.IsInf(integrated, 0) {
+		// 無音の区間は "-inf" になる
+		return 0, 0, false, nil
+	}
+	truePeak, _ = strconv.ParseFloat(stats.InputTP, 64)
+	return integrated, truePeak, true, nil
+}
+
+// loudnessGain は測定値から目標ラウドネスに合わせるための音量の補正値 (dB) を求める
+// 音量を上げる場合は、トゥルーピークが上限を超えない範囲に抑える
+func loudnessGain(integrated, truePeak, target float64) float64 {
+	gain := target - integrated
+	if headroom := loudnessTruePeak - truePeak; gain > headroom {
+		gain = max(headroom, 0)
+	}
+	return gain
+}
+
+// volumeFilter は音量を補正するvolumeフィルターを返す
+func volumeFilter(gain float64) string {
+	return fmt.Sprintf("volume=%.2fdB", gain)
+}
+
+// buildLoudnessFilter は結合後の音声に対し、クリップごとに異なる音量の補正を行うフィルターを返す
+// concat demuxerでは入力ごとにフィルターを適用できないため、各クリップの区間だけ有効なvolumeフィルターを並べる
+// 補正が不要な場合は空文字列を返す
+func buildLoudnessFilter(job EncodeJob) string {
+	if len(job.Entries) == 1 {
+		if job.Entries[0].Gain == 0 {
+			return ""
+		}
+		return volumeFilter(job.Entries[0].Gain)
+	}
+	var filters []string
+	var offset float64
+	for i, entry := range job.Entries {
+		if entry.Gain != 0 && i < len(job.EntryDurations) {
+			filters = append(filters, fmt.Sprintf("%s:enable='gte(t,%.3f)*lt(t,%.3f)'",
+				volumeFilter(entry.Gain), offset, offset+job.EntryDurations[i]))
+		}
+		if i < len(job.EntryDurations) {
+			offset += job.EntryDurations[i]
+		}
+	}
+	return strings.Join(filters, ",")
+}
+
+// joinFilters は空でないフィルターをカンマで連結する
+func joinFilters(filters ...string) string {
+	var nonEmpty []string
+	for _, f := range filters {
+		if f != "" {
+			nonEmpty = append(nonEmpty, f)
+		}
+	}
+	return strings.Join(nonEmpty, ",")
+}
@@ -0,0 +1,290 @@
+package concator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Manifest は実行内容を記録したマニフェストファイルの構造体
+// 同じ入力順序と設定で結合を再現するために使用する
+type Manifest struct {
+	Output   string           `json:"output"`
+	Inputs   []ManifestInput  `json:"inputs"`
+	Settings ManifestSettings `json:"settings"`
+
+	// 出力の内容 (編集や監査のための記録で、-from-manifest では使用しない)
+	Clips      []ManifestClip `json:"clips,omitempty"`
+	Duration   float64        `json:"duration,omitempty"`    // 出力の長さ(秒)
+	EncodeTime float64        `json:"encode_time,omitempty"` // 結合とエンコードにかかった時間(秒)
+	SHA256     string         `json:"sha256,omitempty"`      // 出力ファイルのSHA-256
+	CreatedAt  time.Time      `json:"created_at,omitzero"`
+}
+
+// ManifestInput はマニフェストに記録された入力ファイルの情報
+type ManifestInput struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
+
+// ManifestSettings はマニフェストに記録されたエンコード設定
+type ManifestSettings struct {
+	Resolution string `json:"resolution,omitempty"`
+	Framerate  int    `json:"framerate,omitempty"`
+	Encoder    string `json:"encoder,omitempty"`
+	TimeSource string `json:"time_source,omitempty"`
+	Poster     string `json:"poster,omitempty"`
+
+	Transition         string  `json:"transition,omitempty"`          // xfadeのトランジション名 (空の場合はトランジション無し)
+	TransitionDuration float64 `json:"transition_duration,omitempty"` // トランジションの長さ(秒)
+
+	// 以下は他の設定から組み立てた結果の記録で、-from-manifest ではそのまま使わない
+	// 同じ設定から組み立てた結果が記録と異なる場合は警告する (warnManifestSettings)
+	VideoFilter string   `json:"video_filter,omitempty"`
+	AudioFilter string   `json:"audio_filter,omitempty"`
+	EncoderArgs []string `json:"encoder_args,omitempty"` // レート制御と品質のffmpegの引数
+}
+
+// ManifestClip は出力の時間軸に並んだクリップ (イントロ・アウトロ、タイトルカードを含む) の情報
+type ManifestClip struct {
+	Path     string  `json:"path"`
+	Kind     string  `json:"kind"` // clip, intro, outro, title_card
+	Inpoint  float64 `json:"inpoint,omitempty"`
+	Outpoint float64 `json:"outpoint,omitempty"`
+	Speed    float64 `json:"speed,omitempty"`
+	Offset   float64 `json:"offset"`   // 出力での開始時刻(秒)
+	Duration float64 `json:"duration"` // 出力での長さ(秒)
+}
+
+// LoadManifest はマニフェストファイルを読み込む
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("マニフェストの解析に失敗しました: %s, %v", path, err)
+	}
+	if len(m.Inputs) == 0 {
+		return nil, fmt.Errorf("マニフェストに入力ファイルが含まれていません: %s", path)
+	}
+	return &m, nil
+}
+
+// resolveInputs はマニフェストに記録された順序で入力ファイルの絶対パスを返す
+// ファイルが移動している場合は、searchDirs内から同じ内容のファイルを探す (findMovedFile)
+func (m *Manifest) resolveInputs(searchDirs []string) ([]string, error) {
+	var paths []string
+	var missing []string
+	for _, in := range m.Inputs {
+		if _, err := os.Stat(in.Path); err == nil {
+			paths = append(paths, in.Path)
+			continue
+		}
+		moved := ""
+		for _, dir := range searchDirs {
+			if moved = findMovedFile(dir, in); moved != "" {
+				break
+			}
+		}
+		if moved == "" {
+			missing = append(missing, in.Path)
+			continue
+		}
+		warnf("ファイルが移動しています: %s -> %s", in.Path, moved)
+		paths = append(paths, moved)
+	}
+	if len(missing) > 0 {
+		for _, p := range missing {
+			warnf("見つからないファイル: %s", p)
+		}
+		return nil, fmt.Errorf("マニフェストの%d個のファイルが見つかりません", len(missing))
+	}
+
+	var absPaths []string
+	for _, p := range paths {
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("絶対パスの取得に失敗しました: %s, %v", p, err)
+		}
+		absPaths = append(absPaths, absPath)
+	}
+	return absPaths, nil
+}
+
+// warnManifestSettings は -from-manifest で実行する際に、組み立てた映像・音声のフィルターとエンコーダーの引数が
+// マニフェストに記録された元の実行と異なる場合に警告する
+// これらは解像度やフレームレート、-crf などの設定から組み立てるため、コマンドラインで指定を変えた場合や
+// 元の実行で指定したオプションを今回指定していない場合に異なる
+func (j *Job) warnManifestSettings(job EncodeJob) {
+	if j.Manifest == nil {
+		return
+	}
+	ms := j.Manifest.Settings
+	if ms.VideoFilter != "" && ms.VideoFilter != job.VideoFilter {
+		warnf("映像のフィルターがマニフェストの記録と異なります:\n  記録: %s\n  今回: %s", ms.VideoFilter, job.VideoFilter)
+	}
+	if ms.AudioFilter != "" && ms.AudioFilter != job.AudioFilter {
+		warnf("音声のフィルターがマニフェストの記録と異なります:\n  記録: %s\n  今回: %s", ms.AudioFilter, job.AudioFilter)
+	}
+	if len(ms.EncoderArgs) > 0 && !slices.Equal(ms.EncoderArgs, job.RateControlArgs) {
+		warnf("エンコーダーの引数がマニフェストの記録と異なります:\n  記録: %s\n  今回: %s", strings.Join(ms.EncoderArgs, " "), strings.Join(job.RateControlArgs, " "))
+	}
+}
+
+// findMovedFile はdir以下から入力ファイルと同じ内容のファイルを探す
+// サイズが同じファイルを候補とし、記録されたSHA-256と一致するものを返す (名前が変わっていても見つけられる)
+// SHA-256が記録されていないマニフェストでは、同じファイル名・サイズのファイルが1つだけの場合にそれを返す
+func findMovedFile(dir string, in ManifestInput) string {
+	name := filepath.Base(in.Path)
+	var sameName, others []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Size() != in.Size {
+			return nil
+		}
+		if info.Name() == name {
+			sameName = append(sameName, path)
+		} else {
+			others = append(others, path)
+		}
+		return nil
+	})
+
+	if in.SHA256 == "" {
+		if len(sameName) == 1 {
+			return sameName[0]
+		}
+		return ""
+	}
+	// 名前が同じファイルの方が移動しただけの可能性が高いため、先に確認する
+	for _, path := range slices.Concat(sameName, others) {
+		sum, err := sha256File(path)
+		if err != nil {
+			debugf("ハッシュの計算に失敗しました: %s, %v", path, err)
+			continue
+		}
+		if sum == in.SHA256 {
+			return path
+		}
+	}
+	return ""
+}
+
+// sha256File はファイル全体のSHA-256を計算する
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// manifestClips は各エントリの出力での開始時刻と長さを求める
+// overlapはトランジションで隣り合うクリップが重なる長さ(秒)で、重なりは後のクリップの開始時刻を早める
+func manifestClips(entries []ConcatEntry, intro, outro []string, overlap float64) ([]ManifestClip, error) {
+	durations, err := entryDurations(entries)
+	if err != nil {
+		return nil, err
+	}
+	clips := make([]ManifestClip, len(entries))
+	var offset float64
+	for i, entry := range entries {
+		kind := "clip"
+		switch {
+		case entry.TitleCard:
+			kind = "title_card"
+		case slices.Contains(intro, entry.Path):
+			kind = "intro"
+		case slices.Contains(outro, entry.Path):
+			kind = "outro"
+		}
+		clips[i] = ManifestClip{
+			Path:     entry.Path,
+			Kind:     kind,
+			Inpoint:  entry.Inpoint,
+			Outpoint: entry.Outpoint,
+			Speed:    entry.Speed,
+			Offset:   offset,
+			Duration: durations[i],
+		}
+		offset += durations[i] - overlap
+	}
+	return clips, nil
+}
+
+// manifestPath は出力ファイルに対応するマニフェストのパスを返す
+func manifestPath(output string) string {
+	return output + ".json"
+}
+
+// writeOutputManifests は各出力ファイルの隣に、入力・出力の時間軸でのクリップ・設定・チェックサムを記録したマニフェスト (<出力ファイル名>.json) を書き出す
+// 入力には本編のクリップのみを記録し、-from-manifest で同じ順序の結合を再現できるようにする
+func (j *Job) writeOutputManifests(outputs []string, entries []ConcatEntry, intro, outro []string, settings ManifestSettings, overlap float64, encodeTime time.Duration) error {
+	clips, err := manifestClips(entries, intro, outro, overlap)
+	if err != nil {
+		return fmt.Errorf("クリップの長さの取得に失敗しました: %v", err)
+	}
+	var paths []string
+	for _, clip := range clips {
+		if clip.Kind == "clip" && !slices.Contains(paths, clip.Path) {
+			paths = append(paths, clip.Path)
+		}
+	}
+	inputs := make([]ManifestInput, len(paths))
+	err = runParallel(len(paths), j.Jobs, func(i int) error {
+		info, err := os.Stat(paths[i])
+		if err != nil {
+			return err
+		}
+		sum, err := sha256File(paths[i])
+		if err != nil {
+			return fmt.Errorf("チェックサムの計算に失敗しました: %s, %v", paths[i], err)
+		}
+		inputs[i] = ManifestInput{Path: paths[i], Size: info.Size(), ModTime: info.ModTime(), SHA256: sum}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, output := range outputs {
+		m := Manifest{
+			Output:     output,
+			Inputs:     inputs,
+			Settings:   settings,
+			Clips:      clips,
+			EncodeTime: encodeTime.Seconds(),
+			CreatedAt:  time.Now(),
+		}
+		if m.Duration, err = probeDuration(output); err != nil {
+			return err
+		}
+		if m.SHA256, err = sha256File(output); err != nil {
+			return fmt.Errorf("チェックサムの計算に失敗しました: %s, %v", output, err)
+		}
+		data, err := json.MarshalIndent(m, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(manifestPath(output), append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+		infof("マニフェストを書き出しました: %s", manifestPath(output))
+	}
+	return nil
+}
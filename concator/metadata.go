@@ -0,0 +1,140 @@
+package concator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// dumpFFMetadata は出力ファイルのメタデータ (チャプター、タグ) をffmetadata形式で書き出す
+func dumpFFMetadata(output, path string, limits ResourceLimits) error {
+	if _, err := os.Stat(output); err != nil {
+		return fmt.Errorf("出力ファイルが存在しません: %s", output)
+	}
+	cmd := exec.Command(
+		ffmpegPath,
+		"-v", "error",
+		"-i", output,
+		"-f", "ffmetadata",
+		"-y",
+		path,
+	)
+	out, err := combinedOutputLimited(cmd, limits)
+	if err != nil {
+		return fmt.Errorf("ffmetadataの書き出しに失敗しました: %v\n%s", err, out)
+	}
+	return nil
+}
+
+// sourceMetadataKeys は入力のクリップから出力に引き継ぐコンテナのメタデータのキー
+// 撮影場所 (ISO 6709形式の位置情報) と撮影した機器の情報
+var sourceMetadataKeys = []string{
+	"location",
+	"location-eng",
+	"make",
+	"model",
+	"com.apple.quicktime.location.ISO6709",
+	"com.apple.quicktime.make",
+	"com.apple.quicktime.model",
+	"com.apple.quicktime.software",
+	"com.android.manufacturer",
+	"com.android.model",
+}
+
+// standardMetadataKeys はiPhone・Android独自のキーを、MP4/MOVにも書き込める標準のキーに対応させる
+// ffmpegのMP4/MOVの出力は独自のキーを書き込まないため、標準のキーにも同じ値を設定する
+var standardMetadataKeys = map[string]string{
+	"com.apple.quicktime.location.ISO6709": "location",
+	"com.apple.quicktime.make":             "make",
+	"com.apple.quicktime.model":            "model",
+	"com.android.manufacturer":             "make",
+	"com.android.model":                    "model",
+}
+
+// probeFormatTags はffprobeでコンテナのメタデータを取得する
+func probeFormatTags(path string) (map[string]string, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-show_entries", "format_tags",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+	var parsed struct {
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, fmt.Errorf("ffprobeの出力の解析に失敗しました: %s, %v", path, err)
+	}
+	return parsed.Format.Tags, nil
+}
+
+// sourceMetadata は出力に引き継ぐメタデータを入力のクリップから集める
+// creation_time は最初のクリップの録画開始日時とし、位置情報と機器の情報は最初に記録されているクリップの値を使う
+func sourceMetadata(files []string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if len(files) == 0 {
+		return metadata, nil
+	}
+	start, err := recordingStart(files[0])
+	if err != nil {
+		return nil, err
+	}
+	metadata["creation_time"] = start.UTC().Format("2006-01-02T15:04:05.000000Z")
+	for _, file := range files {
+		tags, err := probeFormatTags(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range sourceMetadataKeys {
+			value := tags[key]
+			if value == "" {
+				continue
+			}
+			if _, ok := metadata[key]; !ok {
+				metadata[key] = value
+			}
+			if std, ok := standardMetadataKeys[key]; ok && metadata[std] == "" {
+				metadata[std] = value
+			}
+		}
+		// 撮影場所と機器が分かれば残りのクリップは調べない
+		if metadata["location"] != "" && metadata["make"] != "" && metadata["model"] != "" {
+			break
+		}
+	}
+	return metadata, nil
+}
+
+// metadataArgs は出力のメタデータを設定するffmpegの引数を組み立てる
+// userは -metadata で指定された key=value の一覧で、入力から引き継いだ値より優先する
+// stripの場合は入力のメタデータを出力に書き込まない
+func metadataArgs(source map[string]string, user []string, strip bool) ([]string, error) {
+	var args []string
+	if strip {
+		args = append(args, "-map_metadata", "-1")
+	}
+	keys := make([]string, 0, len(source))
+	for key := range source {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "-metadata", key+"="+source[key])
+	}
+	for _, pair := range user {
+		if key, _, ok := strings.Cut(pair, "="); !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("-metadata は key=value の形式で指定してください: %s", pair)
+		}
+		args = append(args, "-metadata", pair)
+	}
+	return args, nil
+}
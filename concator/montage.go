@@ -0,0 +1,10 @@
+package concator
+
+import "fmt"
+
+// buildSceneMontageFilter は結合した映像からシーンの切り替わりごとに1フレームを取り出し、
+// 各フレームをhold秒ずつ表示する映像に変換するフィルターを返す
+// 先頭のフレームは常に含める。scaleFilterは解像度・フレームレートを揃えるフィルター
+func buildSceneMontageFilter(threshold, hold float64, scaleFilter string) string {
+	return fmt.Sprintf("select='eq(n\\,0)+gt(scene\\,%g)',setpts=N*%g/TB,%s", threshold, hold, scaleFilter)
+}
@@ -0,0 +1,63 @@
+package concator
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// showinfoPTSPattern はshowinfoフィルターのログからフレームの時刻を抽出する正規表現
+var showinfoPTSPattern = regexp.MustCompile(`pts_time:\s*([0-9.]+)`)
+
+// motionPadding は動きを検出したフレームの前後に含める時間 (秒)
+const motionPadding = 1.0
+
+// detectMotionSegments はシーン変化量がthresholdを超えるフレームを動きとみなし、
+// 動きのある区間をクリップ内の時刻で返す。minLength秒未満の区間は除外する
+//
+// シーン変化量はフレーム間の差分に基づく簡易的な指標のため、照明の変化やノイズを
+// 動きとして拾ったり、小さな被写体の動きを見逃したりすることがある。
+func detectMotionSegments(path string, threshold, minLength float64, limits ResourceLimits) ([]ConcatEntry, error) {
+	duration, err := probeDuration(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(
+		ffmpegPath,
+		"-hide_banner",
+		"-i", path,
+		"-vf", fmt.Sprintf("select='gt(scene,%g)',showinfo", threshold),
+		"-an",
+		"-f", "null",
+		"-",
+	)
+	cmd.Stderr = &stderr
+	if err := runLimited(cmd, limits); err != nil {
+		return nil, fmt.Errorf("動きの検出に失敗しました: %s, %v", path, err)
+	}
+
+	// 動きのあるフレームの前後をまとめて区間にする
+	var segments []ConcatEntry
+	for _, m := range showinfoPTSPattern.FindAllStringSubmatch(stderr.String(), -1) {
+		t, _ := strconv.ParseFloat(m[1], 64)
+		start := max(t-motionPadding, 0)
+		end := min(t+motionPadding, duration)
+		if n := len(segments); n > 0 && start <= segments[n-1].Outpoint {
+			segments[n-1].Outpoint = max(segments[n-1].Outpoint, end)
+			continue
+		}
+		segments = append(segments, ConcatEntry{Path: path, Inpoint: start, Outpoint: end})
+	}
+
+	var kept []ConcatEntry
+	for _, seg := range segments {
+		if seg.Outpoint-seg.Inpoint >= minLength {
+			kept = append(kept, seg)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,89 @@
+package concator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Music は結合した動画の全体に流すBGMの設定
+type Music struct {
+	Path      string
+	Volume    float64 // BGMの音量の補正 (dB)
+	Replace   bool    // 元の音声をBGMに置き換える (falseの場合は元の音声に重ねる)
+	Duck      bool    // 元の音声がある間はBGMの音量を下げる (ダッキング)
+	DuckRatio float64 // ダッキングの圧縮率
+	Duration  float64 // 出力の長さ(秒)。BGMをループしてこの長さで切る
+}
+
+// musicDuckThreshold はダッキングでBGMの音量を下げ始める元の音声の大きさ (振幅、0.0〜1.0)
+const musicDuckThreshold = 0.05
+
+// validate はBGMのファイルが存在し、ダッキングの設定が正しいかを確認する
+func (m *Music) validate() error {
+	info, err := os.Stat(m.Path)
+	if err != nil {
+		return fmt.Errorf("BGMのファイルが見つかりません: %s, %v", m.Path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("BGMにディレクトリは指定できません: %s", m.Path)
+	}
+	if m.Duck && m.Replace {
+		return errors.New("-music-duck は -music-mode replace と同時に指定できません")
+	}
+	if m.Duck && (m.DuckRatio < 1 || m.DuckRatio > 20) {
+		return fmt.Errorf("-music-duck-ratio には1〜20の値を指定してください: %g", m.DuckRatio)
+	}
+	return nil
+}
+
+// musicInputArgs はBGMを出力の長さまで繰り返し読み込む入力オプションを返す
+func musicInputArgs(m *Music) []string {
+	return []string{"-stream_loop", "-1", "-i", m.Path}
+}
+
+// musicInputIndex はBGMの入力の番号を返す (クリップとポスター画像の後に置く)
+func musicInputIndex(job EncodeJob) int {
+	index := 1
+	if job.Transition != "" {
+		index = len(job.Entries)
+	}
+	if job.PosterMode == "attached_pic" {
+		index++
+	}
+	return index
+}
+
+// buildMusicFilter はmainのラベルの音声にBGMを合成し、[aout] に出力するフィルターを組み立てる
+// mainが空の場合 (元の音声が無い、または置き換える場合) はBGMのみを出力する
+// 出力のフェードはBGMを合成した後に適用する
+func buildMusicFilter(main string, job EncodeJob) string {
+	m := job.Music
+	out := "[aout]"
+	if fade := audioFadeFilter(job); fade != "" {
+		out = "," + fade + out
+	}
+	bgm := fmt.Sprintf("[%d:a:0]atrim=duration=%.3f,asetpts=PTS-STARTPTS,%s", musicInputIndex(job), m.Duration, volumeFilter(m.Volume))
+	if main == "" || m.Replace {
+		return bgm + out
+	}
+	if !m.Duck {
+		return fmt.Sprintf("%s[bgm];%s[bgm]amix=inputs=2:duration=first:dropout_transition=0:normalize=0%s", bgm, main, out)
+	}
+	// 元の音声をサイドチェインにしてBGMを圧縮し、話し声などがある間だけBGMを小さくする
+	return fmt.Sprintf("%s[bgm];%sasplit[amain][asc];[bgm][asc]sidechaincompress=threshold=%g:ratio=%s:attack=20:release=400[ducked];[amain][ducked]amix=inputs=2:duration=first:dropout_transition=0:normalize=0%s",
+		bgm, main, musicDuckThreshold, strconv.FormatFloat(m.DuckRatio, 'f', -1, 64), out)
+}
+
+// buildConcatMusicFilter はconcat demuxerで結合した音声にBGMを合成するフィルターを組み立てる
+// 音声のフィルター (-af に相当) はBGMを合成する前に適用する
+func buildConcatMusicFilter(job EncodeJob) string {
+	if job.NoAudio {
+		return buildMusicFilter("", job)
+	}
+	if af := joinFilters(job.AudioFilter, buildLoudnessFilter(job)); af != "" {
+		return "[0:a:0]" + af + "[asrc];" + buildMusicFilter("[asrc]", job)
+	}
+	return buildMusicFilter("[0:a:0]", job)
+}
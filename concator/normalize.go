@@ -0,0 +1,86 @@
+package concator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// runNormalizedEncode は各クリップを並列に同じ形式の中間ファイルへエンコードしてから、
+// それらをストリームコピーで結合する
+// コーデックやフレームレートが異なる入力でも、結合時にはすべて同じ形式に揃っている
+// cacheDirを指定した場合は中間ファイルをそこに残し、同じ入力と設定の中間ファイルがあれば再利用する
+func runNormalizedEncode(ctx context.Context, job EncodeJob, workers int, cacheDir string) error {
+	dir := cacheDir
+	if dir == "" {
+		tempDir, err := os.MkdirTemp("", "video_concator-normalize-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tempDir)
+		dir = tempDir
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	} else {
+		debugf("中間ファイルのキャッシュ: %s", dir)
+	}
+
+	// いずれかのクリップで失敗した場合は、残りのエンコードも止める
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	infof("%d個のクリップを最大%d並列で正規化します...", len(job.Entries), workers)
+	segments := make([]string, len(job.Entries))
+	var done atomic.Int32
+	err := runParallel(len(job.Entries), workers, func(i int) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name := filepath.Base(job.Entries[i].Path)
+		segments[i] = filepath.Join(dir, fmt.Sprintf("segment_%04d.mkv", i))
+		segJob := segmentJob(job, job.Entries[i], segments[i])
+		segmentFade(&segJob, job, i)
+		// 並列に実行するため、進捗バーやffmpegのログは表示しない
+		segJob.Progress = false
+		segJob.Quiet = true
+		if cacheDir != "" {
+			key, err := segmentCacheKey(segJob)
+			if err != nil {
+				cancel()
+				return fmt.Errorf("%s のハッシュの計算に失敗しました: %v", name, err)
+			}
+			segments[i] = filepath.Join(dir, key+".mkv")
+			if _, err := os.Stat(segments[i]); err == nil {
+				debugf("正規化 %d/%d キャッシュを使用: %s", done.Add(1), len(job.Entries), name)
+				return nil
+			}
+			// 中断時に不完全なファイルがキャッシュとして残らないよう、一時的な名前で書き出してから名前を変更する
+			segJob.Output = segments[i] + ".partial.mkv"
+		}
+		if err := runEncode(ctx, segJob); err != nil {
+			os.Remove(segJob.Output)
+			cancel()
+			return fmt.Errorf("%s の正規化に失敗しました: %v", name, err)
+		}
+		if segJob.Output != segments[i] {
+			if err := os.Rename(segJob.Output, segments[i]); err != nil {
+				cancel()
+				return err
+			}
+		}
+		infof("正規化 %d/%d 完了: %s", done.Add(1), len(job.Entries), name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	infof("中間ファイルを結合中...")
+	entries := make([]ConcatEntry, len(segments))
+	for i, segment := range segments {
+		entries[i] = ConcatEntry{Path: segment}
+	}
+	return concatCopy(ctx, entries, job.Output, job.EOL, nil, job.MetadataArgs, job.Limits)
+}
@@ -0,0 +1,117 @@
+package concator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// notifyTimeout は通知の送信を待つ時間
+const notifyTimeout = 30 * time.Second
+
+// notifyFormats は -notify-format に指定できる形式
+var notifyFormats = []string{"auto", "generic", "slack", "discord"}
+
+// notification は完了・失敗時に -notify-url へ送信する結果 (generic の場合はそのままJSONで送る)
+type notification struct {
+	Status   string  `json:"status"` // success, failure, interrupted
+	Output   string  `json:"output"`
+	Duration float64 `json:"duration"` // 処理にかかった時間 (秒)
+	Error    string  `json:"error,omitempty"`
+	Host     string  `json:"host,omitempty"`
+}
+
+// validateNotify は通知先のURLと形式を確認し、auto の場合はURLから判定した形式を返す
+func validateNotify(rawURL, format string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("-notify-url には http または https のURLを指定してください: %s", rawURL)
+	}
+	switch format {
+	case "auto":
+		host := strings.ToLower(u.Hostname())
+		switch {
+		case host == "hooks.slack.com":
+			return "slack", nil
+		case (host == "discord.com" || host == "discordapp.com") && strings.HasPrefix(u.Path, "/api/webhooks/"):
+			return "discord", nil
+		}
+		return "generic", nil
+	case "generic", "slack", "discord":
+		return format, nil
+	}
+	return "", fmt.Errorf("-notify-format には %s のいずれかを指定してください: %s", strings.Join(notifyFormats, "、"), format)
+}
+
+// text は Slack・Discord に投稿する文章を組み立てる
+func (n notification) text() string {
+	elapsed := (time.Duration(n.Duration) * time.Second).String()
+	var b strings.Builder
+	switch n.Status {
+	case "success":
+		fmt.Fprintf(&b, "結合が完了しました: %s (処理時間 %s)", filepath.Base(n.Output), elapsed)
+	case "interrupted":
+		fmt.Fprintf(&b, "結合が中断されました: %s (処理時間 %s)", filepath.Base(n.Output), elapsed)
+	default:
+		fmt.Fprintf(&b, "結合に失敗しました: %s (処理時間 %s)\n%s", filepath.Base(n.Output), elapsed, n.Error)
+	}
+	fmt.Fprintf(&b, "\n出力先: %s", n.Output)
+	if n.Host != "" {
+		fmt.Fprintf(&b, "\nホスト: %s", n.Host)
+	}
+	return b.String()
+}
+
+// payload は通知の形式に合わせた送信するJSONを返す
+func (n notification) payload(format string) ([]byte, error) {
+	switch format {
+	case "slack":
+		return json.Marshal(map[string]string{"text": n.text()})
+	case "discord":
+		// Discordのメッセージは2000文字までのため、長いエラーは切り詰める
+		text := []rune(n.text())
+		if len(text) > 2000 {
+			text = append(text[:1999], '…')
+		}
+		return json.Marshal(map[string]string{"content": string(text)})
+	}
+	return json.Marshal(n)
+}
+
+// sendNotification は結果をURLへPOSTする
+func sendNotification(ctx context.Context, rawURL, format string, n notification) error {
+	n.Host, _ = os.Hostname()
+	body, err := n.payload(format)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// エラーにはURLが含まれるため、WebhookのURLに含まれるトークンをログに残さないよう取り除く
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
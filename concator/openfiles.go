@@ -0,0 +1,54 @@
+package concator
+
+import (
+	"os"
+	"time"
+)
+
+// sizeStabilityWait はサイズの変化で書き込み中かを判定する際の待機時間
+const sizeStabilityWait = 2 * time.Second
+
+// skipOpenFiles は他のプロセスが書き込み中のファイル (録画中のファイルなど) を除外する
+// OSの機能で書き込み中かを判定できない場合は、一定時間の間にサイズや更新日時が
+// 変化したかどうかで判定する
+func skipOpenFiles(files []string) []string {
+	inUse, supported := findFilesOpenForWriting(files)
+	if !supported {
+		infof("書き込み中のファイルを検出できないため、サイズの変化で判定します...")
+		inUse = findGrowingFiles(files)
+	}
+
+	var kept []string
+	for _, file := range files {
+		if inUse[file] {
+			warnf("書き込み中のためスキップします: %s", file)
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept
+}
+
+// findGrowingFiles は一定時間待機し、その間にサイズまたは更新日時が変化したファイルを返す
+func findGrowingFiles(files []string) map[string]bool {
+	before := map[string]os.FileInfo{}
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			before[file] = info
+		}
+	}
+	time.Sleep(sizeStabilityWait)
+
+	growing := map[string]bool{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		prev, ok := before[file]
+		if err != nil || !ok {
+			continue
+		}
+		if info.Size() != prev.Size() || !info.ModTime().Equal(prev.ModTime()) {
+			growing[file] = true
+		}
+	}
+	return growing
+}
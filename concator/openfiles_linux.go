@@ -0,0 +1,85 @@
+//go:build linux
+
+package concator
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// findFilesOpenForWriting は/procを走査し、書き込みモードで開かれているファイルを返す
+// 他のユーザーのプロセスを権限により確認できない場合は、そのプロセスが書き込み中かを判定できないため、判定不能を返す
+func findFilesOpenForWriting(files []string) (map[string]bool, bool) {
+	targets := map[string]string{} // 実体のパス -> 元のパス
+	for _, file := range files {
+		resolved, err := filepath.EvalSymlinks(file)
+		if err != nil {
+			resolved = file
+		}
+		targets[resolved] = file
+	}
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, false
+	}
+	inUse := map[string]bool{}
+	for _, proc := range procs {
+		if _, err := strconv.Atoi(proc.Name()); err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if errors.Is(err, fs.ErrPermission) {
+			debugf("プロセス %s のファイルを確認できません: %v", proc.Name(), err)
+			return nil, false
+		}
+		if err != nil {
+			// 走査中に終了したプロセス
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if errors.Is(err, fs.ErrPermission) {
+				debugf("プロセス %s のファイルを確認できません: %v", proc.Name(), err)
+				return nil, false
+			}
+			if err != nil {
+				continue
+			}
+			original, ok := targets[link]
+			if !ok {
+				continue
+			}
+			if isWriteFD(filepath.Join("/proc", proc.Name(), "fdinfo", fd.Name())) {
+				inUse[original] = true
+			}
+		}
+	}
+	return inUse, true
+}
+
+// isWriteFD はfdinfoのflagsからファイルディスクリプタが書き込み可能なモードで開かれているかを判定する
+func isWriteFD(fdinfoPath string) bool {
+	data, err := os.ReadFile(fdinfoPath)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		value, ok := strings.CutPrefix(line, "flags:")
+		if !ok {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimSpace(value), 8, 64)
+		if err != nil {
+			return false
+		}
+		// O_ACCMODEのうちO_WRONLY(1)またはO_RDWR(2)
+		return flags&3 != 0
+	}
+	return false
+}
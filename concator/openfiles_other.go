@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+
+package concator
+
+// findFilesOpenForWriting はこのOSでは書き込み中のファイルを検出できないため、判定不能を返す
+func findFilesOpenForWriting(files []string) (map[string]bool, bool) {
+	return nil, false
+}
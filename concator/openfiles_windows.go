@@ -0,0 +1,26 @@
+//go:build windows
+
+package concator
+
+import "golang.org/x/sys/windows"
+
+// findFilesOpenForWriting は書き込みの共有を許可せずにファイルを開き、
+// 共有違反になるファイルを他のプロセスが書き込み中とみなして返す
+func findFilesOpenForWriting(files []string) (map[string]bool, bool) {
+	inUse := map[string]bool{}
+	for _, file := range files {
+		p, err := windows.UTF16PtrFromString(file)
+		if err != nil {
+			continue
+		}
+		h, err := windows.CreateFile(p, windows.GENERIC_READ, windows.FILE_SHARE_READ, nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+		if err == windows.ERROR_SHARING_VIOLATION {
+			inUse[file] = true
+			continue
+		}
+		if err == nil {
+			windows.CloseHandle(h)
+		}
+	}
+	return inUse, true
+}
@@ -0,0 +1,84 @@
+package concator
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// groupByOrientation は回転を考慮した表示上の向きでエントリを横長と縦長に分ける
+// 正方形のクリップは横長として扱う
+func groupByOrientation(entries []ConcatEntry) (landscape, portrait []ConcatEntry, err error) {
+	orientations := map[string]bool{} // パスごとの縦長判定のキャッシュ
+	for _, entry := range entries {
+		isPortrait, ok := orientations[entry.Path]
+		if !ok {
+			probe, err := probeVideo(entry.Path)
+			if err != nil {
+				return nil, nil, err
+			}
+			w, h := probe.DisplaySize()
+			isPortrait = h > w
+			orientations[entry.Path] = isPortrait
+		}
+		if isPortrait {
+			portrait = append(portrait, entry)
+		} else {
+			landscape = append(landscape, entry)
+		}
+	}
+	return landscape, portrait, nil
+}
+
+// parseResolution は "1920x1080" 形式の解像度を幅と高さに分解する
+func parseResolution(res string) (int, int, error) {
+	parts := strings.Split(strings.ToLower(res), "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("解像度の形式が正しくありません: %s (例: 1920x1080)", res)
+	}
+	w, err1 := strconv.Atoi(parts[0])
+	h, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("解像度の形式が正しくありません: %s (例: 1920x1080)", res)
+	}
+	return w, h, nil
+}
+
+// orientedResolution は解像度を指定した向き (縦長または横長) に合わせて返す
+func orientedResolution(res string, portrait bool) (string, error) {
+	w, h, err := parseResolution(res)
+	if err != nil {
+		return "", err
+	}
+	long, short := max(w, h), min(w, h)
+	if portrait {
+		return fmt.Sprintf("%dx%d", short, long), nil
+	}
+	return fmt.Sprintf("%dx%d", long, short), nil
+}
+
+// suffixedOutputPath は出力ファイル名の拡張子の前に接尾辞を付けたパスを返す
+func suffixedOutputPath(output, suffix string) string {
+	ext := filepath.Ext(output)
+	return strings.TrimSuffix(output, ext) + suffix + ext
+}
+
+// normalizeRotation は回転メタデータの角度を0〜359度に揃える (-90 と 270 を同じ回転として扱う)
+func normalizeRotation(rotation int) int {
+	return (rotation%360 + 360) % 360
+}
+
+// hasMixedRotations は回転メタデータの角度が異なる入力が混在しているかを確認する
+// concat demuxerは最初のファイルの回転メタデータしか引き継がないため、混在していると後のクリップが正しく回転されない
+func hasMixedRotations(files []string) (bool, error) {
+	rotations := map[int]bool{}
+	for _, file := range files {
+		probe, err := probeVideo(file)
+		if err != nil {
+			return false, err
+		}
+		rotations[normalizeRotation(probe.Rotation)] = true
+	}
+	return len(rotations) > 1, nil
+}
@@ -0,0 +1,144 @@
+package concator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// outputTemplateAction は -output のテンプレートの {{...}} 部分にマッチする正規表現
+var outputTemplateAction = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// OutputNameData は -output のテンプレートで使える値
+// 例: -output "trip_{{.FirstDate}}_{{.ClipCount}}.mp4"
+type OutputNameData struct {
+	Date      string // -group-by のグループの名前 (グループに分けない場合は空)
+	FirstDate string // 最も古いクリップの日付 (2006-01-02)
+	LastDate  string // 最も新しいクリップの日付 (2006-01-02)
+	ClipCount int    // 結合するクリップの数
+	DirName   string // 入力ディレクトリの名前 (-dir を指定しない場合は最初のクリップのディレクトリ)
+
+	files []string
+}
+
+// TotalDuration は結合するクリップの長さの合計を "1h2m3s" の形式で返す (ffprobeが必要)
+// テンプレートで使われた場合のみ計算する
+func (d OutputNameData) TotalDuration() (string, error) {
+	if !isFFprobeAvailable() {
+		return "", errors.New("{{.TotalDuration}} にはffprobeが必要です。")
+	}
+	total, err := totalInputDuration(d.files)
+	if err != nil {
+		return "", err
+	}
+	return (time.Duration(total * float64(time.Second))).Round(time.Second).String(), nil
+}
+
+// isOutputTemplate は -output がテンプレートを含むかを返す
+func isOutputTemplate(output string) bool {
+	return strings.Contains(output, "{{")
+}
+
+// outputTemplateGlob は -output のテンプレートから、展開後の出力ファイル名にマッチするglobパターンを作る
+// 以前の実行で作成した出力を入力として扱わないために使う
+func outputTemplateGlob(output string) string {
+	return outputTemplateAction.ReplaceAllString(output, "*")
+}
+
+// matchesOutput はfileが出力ファイル (テンプレートの場合は展開後のいずれか) かを返す
+// absOutputとfileはどちらも絶対パスで指定する
+// ファイル名が拡張子以外テンプレートのみの場合は全ての入力にマッチしてしまうため、出力とはみなさない
+func matchesOutput(absOutput, file string) bool {
+	if !isOutputTemplate(absOutput) {
+		return file == absOutput
+	}
+	glob := outputTemplateGlob(absOutput)
+	name := filepath.Base(glob)
+	if strings.Trim(strings.TrimSuffix(name, filepath.Ext(name)), "*") == "" {
+		return false
+	}
+	matched, _ := filepath.Match(glob, file)
+	return matched
+}
+
+// renderOutputName は -output のテンプレートを展開する。テンプレートを含まない場合はそのまま返す
+func renderOutputName(output string, data OutputNameData) (string, error) {
+	if !isOutputTemplate(output) {
+		return output, nil
+	}
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(output)
+	if err != nil {
+		return "", fmt.Errorf("-output のテンプレートが正しくありません: %v", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("-output のテンプレートを展開できません: %v", err)
+	}
+	return b.String(), nil
+}
+
+// clipTimeKey はクリップの日付に使う日時の種類を返す (ファイル名順の場合は -time-source の日時)
+func (j *Job) clipTimeKey(sortKey string) string {
+	if sortKey == "name" {
+		return j.TimeSource
+	}
+	return sortKey
+}
+
+// clipTimes は各ファイルのtimeKeyに対応する日時を返す
+func clipTimes(files []string, timeKey string) ([]time.Time, error) {
+	times := make([]time.Time, len(files))
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if times[i], err = fileTime(file, info, timeKey); err != nil {
+			return nil, fmt.Errorf("日時の取得に失敗しました: %s, %v", file, err)
+		}
+	}
+	return times, nil
+}
+
+// outputNameData は結合するファイルから -output のテンプレートの値を求める
+func (j *Job) outputNameData(files []string, sortKey string) (OutputNameData, error) {
+	data := OutputNameData{Date: j.groupName, ClipCount: len(files), files: files}
+	times, err := clipTimes(files, j.clipTimeKey(sortKey))
+	if err != nil {
+		return data, err
+	}
+	first, last := times[0], times[0]
+	for _, t := range times[1:] {
+		first, last = minTime(first, t), maxTime(last, t)
+	}
+	data.FirstDate, data.LastDate = first.Format("2006-01-02"), last.Format("2006-01-02")
+	dir := j.Dir
+	if dir == "" {
+		dir = filepath.Dir(files[0])
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		data.DirName = filepath.Base(abs)
+	}
+	return data, nil
+}
+
+// minTime は早い方の日時を返す
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// maxTime は遅い方の日時を返す
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
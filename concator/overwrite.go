@@ -0,0 +1,69 @@
+package concator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// existingOutputs はoutputにsuffixesの各接尾辞を付けた出力のうち、既に存在するものを返す
+func existingOutputs(output string, suffixes []string) []string {
+	var existing []string
+	for _, suffix := range suffixes {
+		path := suffixedOutputPath(output, suffix)
+		if _, err := os.Stat(path); err == nil {
+			existing = append(existing, path)
+		}
+	}
+	return existing
+}
+
+// availableOutputPath はoutputに _1、_2 ... の連番を付け、suffixesの各接尾辞を付けた出力がいずれも存在しない名前を返す
+func availableOutputPath(output string, suffixes []string) string {
+	for n := 1; ; n++ {
+		candidate := suffixedOutputPath(output, "_"+strconv.Itoa(n))
+		if len(existingOutputs(candidate, suffixes)) == 0 {
+			return candidate
+		}
+	}
+}
+
+// confirmOverwrite は端末で既存の出力ファイルを上書きするかを確認する
+func confirmOverwrite(paths []string) bool {
+	fmt.Fprintf(os.Stderr, "出力ファイルが既に存在します: %s\n上書きしますか? [y/N]: ", strings.Join(paths, ", "))
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
+// resolveOutputConflict はoutputにsuffixesの各接尾辞を付けた出力が既に存在する場合の扱いを決め、書き出す出力のパスを返す
+// -overwrite の場合はそのまま上書きし、-output-suffix の場合は連番を付けた名前に変える
+// それ以外は端末であれば上書きするかを確認し、端末でなければエラーにする (エラーの場合もoutputをそのまま返す)
+func (j *Job) resolveOutputConflict(output string, suffixes []string) (string, error) {
+	if j.Overwrite {
+		return output, nil
+	}
+	existing := existingOutputs(output, suffixes)
+	if len(existing) == 0 {
+		return output, nil
+	}
+	if j.OutputSuffix {
+		renamed := availableOutputPath(output, suffixes)
+		infof("出力ファイルが既に存在するため、%s に出力します。", renamed)
+		return renamed, nil
+	}
+	// ファイルを書き出さないため、確認せずに警告のみ表示する
+	if j.DryRun || j.Describe {
+		warnf("出力ファイルが既に存在します: %s", strings.Join(existing, ", "))
+		return output, nil
+	}
+	if !j.NoPrompt && isTerminal(os.Stdin) && isTerminal(os.Stderr) {
+		if confirmOverwrite(existing) {
+			return output, nil
+		}
+		return output, fmt.Errorf("出力ファイルを上書きしないため、中止しました: %s", strings.Join(existing, ", "))
+	}
+	return output, fmt.Errorf("出力ファイルが既に存在します: %s (上書きする場合は -overwrite、連番を付けた名前で出力する場合は -output-suffix を指定してください)", strings.Join(existing, ", "))
+}
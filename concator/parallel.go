@@ -0,0 +1,61 @@
+package concator
+
+import (
+	"sync"
+)
+
+// runParallel はfnを0からn-1までの各インデックスについて最大jobs個並列に実行する
+// いずれかがエラーを返した場合、最初のエラーを返す
+func runParallel(n, jobs int, fn func(i int) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fn(i); err != nil {
+					once.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return firstErr
+}
+
+// ioLimiter はディスクI/Oを伴う処理の同時実行数を制限するセマフォ
+type ioLimiter chan struct{}
+
+// newIOLimiter は同時にn個までのI/O処理を許可するioLimiterを作成する
+func newIOLimiter(n int) ioLimiter {
+	if n < 1 {
+		n = 1
+	}
+	return make(ioLimiter, n)
+}
+
+// acquire はI/O処理の実行枠を確保する
+func (l ioLimiter) acquire() { l <- struct{}{} }
+
+// release はI/O処理の実行枠を解放する
+func (l ioLimiter) release() { <-l }
+
+// defaultIOJobs はパスが置かれたストレージの種類からI/Oの同時実行数の既定値を決める
+// HDDではシークによる競合を避けるため1、SSDや判定できない場合は4とする
+func defaultIOJobs(path string) int {
+	if rotational, ok := isRotationalStorage(path); ok && rotational {
+		return 1
+	}
+	return 4
+}
@@ -0,0 +1,63 @@
+package concator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readPlaylist は1行に1つのパスを並べたプレイリストファイルを読み込む
+// 空行と "#" で始まる行は無視するため、M3U形式のプレイリストもそのまま読み込める
+// 相対パスはプレイリストファイルのあるディレクトリからの相対パスとして扱う
+func readPlaylist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\uFEFF"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(filepath.Dir(path), line)
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("プレイリストの読み込みに失敗しました: %s, %v", path, err)
+	}
+	return paths, nil
+}
+
+// resolveExplicitInputs は指定された順序のまま入力ファイルの絶対パスを返す
+// 存在しないファイルがある場合はエラーとする
+func resolveExplicitInputs(paths []string) ([]string, error) {
+	var absPaths []string
+	for _, p := range paths {
+		absPath, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("絶対パスの取得に失敗しました: %s, %v", p, err)
+		}
+		info, err := os.Stat(absPath)
+		if err != nil {
+			return nil, fmt.Errorf("動画ファイルを開けません: %v", err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("ディレクトリは指定できません: %s", p)
+		}
+		// シェルのglobで動画と一緒に指定された付属ファイルは結合しない
+		if isCompanionFile(absPath) {
+			infof("カメラの付属ファイルのためスキップします: %s", p)
+			continue
+		}
+		absPaths = append(absPaths, absPath)
+	}
+	return absPaths, nil
+}
@@ -0,0 +1,63 @@
+package concator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// posterMimeTypes はポスター画像として受け付ける拡張子とMIMEタイプの対応
+var posterMimeTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+}
+
+// validatePoster はポスター画像が存在し、対応形式であるかを確認する
+func validatePoster(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("ポスター画像を開けません: %s, %v", path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("ポスター画像がディレクトリです: %s", path)
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if _, ok := posterMimeTypes[ext]; !ok {
+		return fmt.Errorf("対応していない画像形式です: %s (jpg, png のみ対応)", path)
+	}
+	return nil
+}
+
+// posterContainer は出力ファイルの拡張子からカバーアートの埋め込み方法を判定する
+// "attached_pic" (MP4/MOV系)、"attachment" (MKV)、または非対応の場合は空文字列を返す
+func posterContainer(outputFile string) string {
+	switch strings.ToLower(filepath.Ext(outputFile)) {
+	case ".mp4", ".m4v", ".mov":
+		return "attached_pic"
+	case ".mkv":
+		return "attachment"
+	default:
+		return ""
+	}
+}
+
+// posterCodec はattached_picとして再エンコードする際の画像コーデックを返す
+func posterCodec(path string) string {
+	if strings.ToLower(filepath.Ext(path)) == ".png" {
+		return "png"
+	}
+	return "mjpeg"
+}
+
+// buildPosterAttachArgs はMKVにポスター画像を添付ファイルとして埋め込むための出力オプションを返す
+func buildPosterAttachArgs(path string) []string {
+	ext := strings.ToLower(filepath.Ext(path))
+	return []string{
+		"-attach", path,
+		"-metadata:s:t", "mimetype=" + posterMimeTypes[ext],
+		// 多くのプレイヤーは "cover" という名前の添付画像をカバーアートとして扱う
+		"-metadata:s:t", "filename=cover" + ext,
+	}
+}
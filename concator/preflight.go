@@ -0,0 +1,180 @@
+package concator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// PreflightConfig は -preflight-only で確認する実行設定
+type PreflightConfig struct {
+	InputDirs   []string
+	SearchFiles []string // InputDirs の検索結果と合わせて並べ替える入力ファイル
+	OutputFile  string
+	Encoder     string
+	Poster      string
+	SortKey     string
+	Manifest    *Manifest
+	Files       []string // 明示的に指定された入力ファイル (指定順に結合する)
+	Filter      InputFilter
+
+	Overwrite    bool // 既存の出力ファイルを上書きする
+	OutputSuffix bool // 既存の出力ファイルがある場合は連番を付けた名前で出力する
+
+	Limits ResourceLimits // テストエンコードに課すリソースの上限
+}
+
+// preflightReport は事前確認の結果を集計して表示する
+type preflightReport struct {
+	failed bool
+}
+
+// pass は問題の無い確認項目を表示する
+func (r *preflightReport) pass(name, detail string) {
+	fmt.Printf("[OK]   %s: %s\n", name, detail)
+}
+
+// warn は実行は可能だが注意が必要な確認項目を表示する
+func (r *preflightReport) warn(name, detail string) {
+	fmt.Printf("[WARN] %s: %s\n", name, detail)
+}
+
+// fail は実行が失敗する確認項目を表示する
+func (r *preflightReport) fail(name, detail string) {
+	r.failed = true
+	fmt.Printf("[FAIL] %s: %s\n", name, detail)
+}
+
+// tool はffmpeg・ffprobeの存在とバージョンを確認して表示する
+func (r *preflightReport) tool(name, path string) bool {
+	version, err := checkTool(name, path)
+	if err != nil {
+		r.fail(name, err.Error())
+		return false
+	}
+	if version == "" {
+		r.pass(name, "利用可能")
+	} else {
+		r.pass(name, fmt.Sprintf("利用可能 (バージョン %s)", version))
+	}
+	return true
+}
+
+// runPreflight はエンコードを行わずに実行前の全ての確認を行い、結果をまとめて表示する
+// 全ての確認に通った場合はtrueを返す
+func runPreflight(cfg PreflightConfig) bool {
+	r := &preflightReport{}
+
+	// ffmpeg/ffprobeの存在
+	ffmpegOK := r.tool("ffmpeg", ffmpegPath)
+	ffprobeOK := r.tool("ffprobe", ffprobePath)
+
+	// エンコーダー
+	r.pass("ハードウェア", detectHardware().String())
+	encoder := cfg.Encoder
+	if ffmpegOK && encoder == "" {
+		if detected, err := detectEncoder("h265", cfg.Limits); err != nil {
+			r.fail("エンコーダー", err.Error())
+		} else {
+			r.pass("エンコーダー", fmt.Sprintf("%s (自動選択)", detected))
+		}
+	} else if ffmpegOK {
+		if ok, err := isEncoderAvailable(encoder); err != nil {
+			r.fail("エンコーダー", fmt.Sprintf("%s を確認できません: %v", encoder, err))
+		} else if ok {
+			r.pass("エンコーダー", encoder)
+		} else {
+			r.fail("エンコーダー", fmt.Sprintf("ffmpegが %s に対応していません", encoder))
+		}
+	}
+
+	// ポスター画像
+	if cfg.Poster != "" {
+		if err := validatePoster(cfg.Poster); err != nil {
+			r.fail("ポスター画像", err.Error())
+		} else {
+			r.pass("ポスター画像", cfg.Poster)
+		}
+	}
+
+	// 入力ファイル
+	var files []string
+	var err error
+	if cfg.Files != nil {
+		files, err = resolveExplicitInputs(cfg.Files)
+	} else if cfg.Manifest != nil {
+		files, err = cfg.Manifest.resolveInputs(cfg.InputDirs)
+	} else {
+		files, err = findAndSortVideos(cfg.InputDirs, cfg.SearchFiles, cfg.SortKey, cfg.Filter)
+	}
+	switch {
+	case err != nil:
+		r.fail("入力ファイル", err.Error())
+	case len(files) == 0:
+		r.fail("入力ファイル", "動画ファイルが見つかりません")
+	default:
+		r.pass("入力ファイル", fmt.Sprintf("%d個", len(files)))
+	}
+
+	// 入力ファイルの内容と互換性
+	if len(files) > 0 && ffprobeOK {
+		invalid := 0
+		for _, file := range files {
+			if reason := checkInput(file); reason != "" {
+				invalid++
+				r.fail("入力の検証", fmt.Sprintf("%s: %s", reason, file))
+			}
+		}
+		if invalid == 0 {
+			r.pass("入力の検証", "全てのファイルを読み込めました")
+			if mixed, err := hasMixedAudioLayouts(files); err == nil && mixed {
+				r.warn("互換性", "音声形式が混在しているため変換して揃えます")
+			} else {
+				r.pass("互換性", "問題は見つかりませんでした")
+			}
+		}
+	}
+
+	// ディスクの空き容量 (再エンコード後の出力は概ね入力の合計サイズ以下になる)
+	var inputBytes uint64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			inputBytes += uint64(info.Size())
+		}
+	}
+	outputDir := filepath.Dir(cfg.OutputFile)
+	if free, err := freeDiskSpace(outputDir); err != nil {
+		r.fail("空き容量", fmt.Sprintf("出力先 %s を確認できません: %v", outputDir, err))
+	} else if free < inputBytes {
+		r.fail("空き容量", fmt.Sprintf("空き %s に対して入力の合計が %s あります", formatApproxSize(int64(free)), formatApproxSize(int64(inputBytes))))
+	} else {
+		r.pass("空き容量", fmt.Sprintf("空き %s", formatApproxSize(int64(free))))
+	}
+
+	// 出力ファイルの衝突
+	absOutput, _ := filepath.Abs(cfg.OutputFile)
+	collides := false
+	for _, file := range files {
+		if file == absOutput {
+			collides = true
+		}
+	}
+	if collides {
+		r.fail("出力ファイル", fmt.Sprintf("入力ファイルと同じパスです: %s", cfg.OutputFile))
+	} else if _, err := os.Stat(cfg.OutputFile); err != nil {
+		r.pass("出力ファイル", cfg.OutputFile)
+	} else if cfg.Overwrite {
+		r.warn("出力ファイル", fmt.Sprintf("既に存在するため上書きされます: %s", cfg.OutputFile))
+	} else if cfg.OutputSuffix {
+		r.pass("出力ファイル", fmt.Sprintf("既に存在するため連番を付けた名前で出力されます: %s", cfg.OutputFile))
+	} else {
+		r.warn("出力ファイル", fmt.Sprintf("既に存在します (-overwrite を指定しない場合は実行時に確認またはエラーになります): %s", cfg.OutputFile))
+	}
+
+	if r.failed {
+		fmt.Println("事前確認: 失敗")
+		return false
+	}
+	fmt.Println("事前確認: 成功")
+	return true
+}
@@ -0,0 +1,287 @@
+package concator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProbeResult はffprobeで取得した動画ファイルの情報を格納する構造体
+type ProbeResult struct {
+	Width    int
+	Height   int
+	Rotation int    // 回転メタデータ (度)
+	TimeBase string // タイムベース (例: "1/30000")
+	Codec    string // コーデック名 (例: "h264")
+	PixFmt   string // ピクセルフォーマット (例: "yuv420p")
+
+	FrameRate    string // 公称のフレームレート (例: "30000/1001")
+	AvgFrameRate string // 平均フレームレート
+}
+
+// DisplaySize は回転を考慮した表示上の解像度を返す
+func (p *ProbeResult) DisplaySize() (int, int) {
+	if p.Rotation%180 != 0 {
+		return p.Height, p.Width
+	}
+	return p.Width, p.Height
+}
+
+// ffprobeOutput はffprobeのJSON出力のうち必要な部分
+type ffprobeOutput struct {
+	Streams []struct {
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		TimeBase     string            `json:"time_base"`
+		CodecName    string            `json:"codec_name"`
+		PixFmt       string            `json:"pix_fmt"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		Tags         map[string]string `json:"tags"`
+		SideData     []struct {
+			Rotation int `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+}
+
+// isFFprobeAvailable はffprobeコマンドが利用可能かを確認する
+func isFFprobeAvailable() bool {
+	_, err := exec.LookPath(ffprobePath)
+	return err == nil
+}
+
+// probeVideo はffprobeで動画ファイルの最初のビデオストリームの情報を取得する
+func probeVideo(path string) (*ProbeResult, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height,time_base,codec_name,pix_fmt,r_frame_rate,avg_frame_rate:stream_tags=rotate:stream_side_data=rotation",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+
+	var parsed ffprobeOutput
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, fmt.Errorf("ffprobeの出力の解析に失敗しました: %s, %v", path, err)
+	}
+	if len(parsed.Streams) == 0 {
+		return nil, fmt.Errorf("ビデオストリームが見つかりません: %s", path)
+	}
+
+	stream := parsed.Streams[0]
+	result := &ProbeResult{
+		Width:    stream.Width,
+		Height:   stream.Height,
+		TimeBase: stream.TimeBase,
+		Codec:    stream.CodecName,
+		PixFmt:   stream.PixFmt,
+
+		FrameRate:    stream.RFrameRate,
+		AvgFrameRate: stream.AvgFrameRate,
+	}
+	// 回転情報は古い形式ではタグ、新しい形式ではside dataに格納されている
+	if rotate, ok := stream.Tags["rotate"]; ok {
+		result.Rotation, _ = strconv.Atoi(rotate)
+	}
+	for _, sd := range stream.SideData {
+		if sd.Rotation != 0 {
+			result.Rotation = sd.Rotation
+		}
+	}
+	return result, nil
+}
+
+// probeDuration はffprobeで動画ファイルの長さ(秒)を取得する
+func probeDuration(path string) (float64, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("長さを取得できません: %s", path)
+	}
+	return duration, nil
+}
+
+// probeFrameCount はffprobeでビデオストリームのパケットを数え、フレーム数を取得する
+func probeFrameCount(path string) (int64, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-count_packets",
+		"-show_entries", "stream=nb_read_packets",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+	frames, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		// ビデオストリームが無い場合は空の出力になる
+		return 0, nil
+	}
+	return frames, nil
+}
+
+// probeStreamTypes はffprobeで動画ファイルに含まれるストリームの種類 (video, audio, subtitle など) を取得する
+func probeStreamTypes(path string) ([]string, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-show_entries", "stream=codec_type",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// hasStreamType はストリームの種類の一覧に指定した種類が含まれるかを返す
+func hasStreamType(types []string, want string) bool {
+	for _, t := range types {
+		if t == want {
+			return true
+		}
+	}
+	return false
+}
+
+// probeSubtitleCodecs はffprobeで動画ファイルに含まれる字幕ストリームのコーデック名を取得する
+func probeSubtitleCodecs(path string) ([]string, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-select_streams", "s",
+		"-show_entries", "stream=codec_name",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// AudioFormat はffprobeで取得した音声ストリームの形式
+type AudioFormat struct {
+	Codec         string `json:"codec"`
+	ChannelLayout string `json:"channel_layout"`
+	Channels      int    `json:"channels"`
+	SampleRate    int    `json:"sample_rate"`
+}
+
+// probeAudioFormat はffprobeで動画ファイルの最初の音声ストリームの形式を取得する
+// 音声ストリームが無い場合はnilを返す
+func probeAudioFormat(path string) (*AudioFormat, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=codec_name,channel_layout,channels,sample_rate",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+
+	var parsed struct {
+		Streams []struct {
+			CodecName     string `json:"codec_name"`
+			ChannelLayout string `json:"channel_layout"`
+			Channels      int    `json:"channels"`
+			SampleRate    string `json:"sample_rate"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, fmt.Errorf("ffprobeの出力の解析に失敗しました: %s, %v", path, err)
+	}
+	if len(parsed.Streams) == 0 {
+		return nil, nil
+	}
+	stream := parsed.Streams[0]
+	sampleRate, _ := strconv.Atoi(stream.SampleRate)
+	return &AudioFormat{
+		Codec:         stream.CodecName,
+		ChannelLayout: stream.ChannelLayout,
+		Channels:      stream.Channels,
+		SampleRate:    sampleRate,
+	}, nil
+}
+
+// probeStreamDurations はffprobeで最初のビデオストリームと最初の音声ストリームの長さ(秒)を取得する
+// 音声ストリームが無い、または長さが不明な場合、audioは0になる
+func probeStreamDurations(path string) (video, audio float64, err error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-show_entries", "stream=codec_type,duration",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+
+	var parsed struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			Duration  string `json:"duration"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return 0, 0, fmt.Errorf("ffprobeの出力の解析に失敗しました: %s, %v", path, err)
+	}
+	for _, stream := range parsed.Streams {
+		d, _ := strconv.ParseFloat(stream.Duration, 64)
+		switch {
+		case stream.CodecType == "video" && video == 0:
+			video = d
+		case stream.CodecType == "audio" && audio == 0:
+			audio = d
+		}
+	}
+	return video, audio, nil
+}
+
+// probeCreationTime はffprobeでコンテナのメタデータに記録された撮影日時 (creation_time) を取得する
+// 記録されていない場合はゼロ値を返す
+func probeCreationTime(path string) (time.Time, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-show_entries", "format_tags=creation_time",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+	value := strings.TrimSpace(string(out))
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("creation_timeの形式が正しくありません: %s, %s", path, value)
+	}
+	return t, nil
+}
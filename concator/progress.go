@@ -0,0 +1,114 @@
+package concator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// progressBarWidth は進捗バーの幅 (文字数)
+const progressBarWidth = 30
+
+// progressReporter はffmpegの -progress 出力を解析し、進捗率・速度・残り時間を表示する
+type progressReporter struct {
+	total  float64       // 出力の想定される長さ (秒)
+	period time.Duration // 表示を更新する最小間隔
+	out    io.Writer
+	tty    bool
+	last   time.Time
+	events *EventWriter // nilでない場合は進捗バーの代わりにイベントとして書き出す
+}
+
+// newProgressReporter はtotal秒の出力に対する進捗を標準エラー出力に表示するprogressReporterを作成する
+// -quiet の場合は進捗を表示しない
+func newProgressReporter(total float64, period time.Duration) *progressReporter {
+	var out io.Writer = os.Stderr
+	if logLevel.Level() > slog.LevelInfo {
+		out = io.Discard
+	}
+	return &progressReporter{
+		total:  total,
+		period: period,
+		out:    out,
+		tty:    isTerminal(os.Stderr),
+	}
+}
+
+// consume はffmpegの -progress 出力 (key=value 形式の行) を読み込み、区切りごとに進捗を表示する
+func (p *progressReporter) consume(r io.Reader) {
+	var outTime float64
+	speed := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				outTime = float64(us) / 1e6
+			}
+		case "speed":
+			speed = strings.TrimSpace(value)
+		case "progress":
+			done := value == "end"
+			if done || time.Since(p.last) >= p.period {
+				p.render(outTime, speed, done)
+				p.last = time.Now()
+			}
+		}
+	}
+}
+
+// render は現在の進捗を1行で表示する。端末の場合は同じ行を上書きする
+func (p *progressReporter) render(outTime float64, speed string, done bool) {
+	ratio := 0.0
+	if p.total > 0 {
+		ratio = min(outTime/p.total, 1)
+	}
+	if done {
+		ratio = 1
+	}
+	filled := int(ratio * progressBarWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled)
+
+	eta := "--:--:--"
+	x, err := strconv.ParseFloat(strings.TrimSuffix(speed, "x"), 64)
+	if err == nil && x > 0 && p.total > 0 {
+		eta = formatClock((p.total - outTime) / x)
+	}
+	if p.events != nil {
+		ev := progressEvent{Event: "progress", OutTime: outTime, Total: p.total, Percent: ratio * 100, Done: done}
+		if err == nil && x > 0 {
+			ev.Speed = x
+			ev.ETA = max(p.total-outTime, 0) / x
+		}
+		p.events.emit(ev)
+		return
+	}
+	if speed == "" || speed == "N/A" {
+		speed = "-"
+	}
+
+	line := fmt.Sprintf("[%s] %5.1f%% 速度 %s 残り %s", bar, ratio*100, speed, eta)
+	switch {
+	case p.tty && done:
+		fmt.Fprintf(p.out, "\r%s\n", line)
+	case p.tty:
+		fmt.Fprintf(p.out, "\r%s", line)
+	default:
+		fmt.Fprintln(p.out, line)
+	}
+}
+
+// formatClock は秒数を HH:MM:SS 形式に変換する
+func formatClock(seconds float64) string {
+	s := int(max(seconds, 0))
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s%3600/60, s%60)
+}
@@ -0,0 +1,226 @@
+package concator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseBitrate は "5M"、"4500k"、"3000000" 形式のビットレートをbps単位の数値に変換する
+func parseBitrate(s string) (int64, error) {
+	str := strings.TrimSpace(s)
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(str, "k"), strings.HasSuffix(str, "K"):
+		multiplier = 1000
+		str = str[:len(str)-1]
+	case strings.HasSuffix(str, "m"), strings.HasSuffix(str, "M"):
+		multiplier = 1000 * 1000
+		str = str[:len(str)-1]
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("ビットレートの形式が正しくありません: %s (例: 5M, 4500k)", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// buildRateControlArgs は -max-bitrate と -bufsize からVBV制約付きエンコードのオプションを組み立てる
+// ハードウェアエンコーダーごとのレート制御の違いもここで吸収する
+func buildRateControlArgs(encoder, maxBitrate, bufsize string) ([]string, error) {
+	if maxBitrate == "" && bufsize == "" {
+		return nil, nil
+	}
+	if maxBitrate == "" {
+		return nil, fmt.Errorf("-bufsize は -max-bitrate と一緒に指定してください")
+	}
+	maxrate, err := parseBitrate(maxBitrate)
+	if err != nil {
+		return nil, err
+	}
+	if bufsize == "" {
+		// 一般的な目安としてバッファサイズは最大ビットレートの2倍とする
+		bufsize = strconv.FormatInt(maxrate*2, 10)
+	}
+	buf, err := parseBitrate(bufsize)
+	if err != nil {
+		return nil, err
+	}
+	if buf < maxrate {
+		warnf("-bufsize (%s) が -max-bitrate (%s) より小さいため、画質が不安定になる可能性があります。", bufsize, maxBitrate)
+	}
+
+	switch {
+	case strings.HasSuffix(encoder, "_videotoolbox"):
+		// VideoToolboxは -maxrate/-bufsize に対応していないため、平均ビットレートとして近似する
+		warnf("%s はVBV制約に対応していないため、-max-bitrate を平均ビットレートとして使用します。", encoder)
+		return []string{"-b:v", maxBitrate}, nil
+	case strings.HasSuffix(encoder, "_nvenc"):
+		// NVENCは可変ビットレートモードでのみ -maxrate を上限として扱う
+		return []string{"-rc", "vbr", "-maxrate", maxBitrate, "-bufsize", bufsize}, nil
+	case strings.HasSuffix(encoder, "_amf"):
+		// AMFはピーク制約付きの可変ビットレートモードで -maxrate を上限として扱う
+		return []string{"-rc", "vbr_peak", "-maxrate", maxBitrate, "-bufsize", bufsize}, nil
+	default:
+		// libx264/libx265、VAAPI、QSVなどは -maxrate/-bufsize をそのまま解釈する
+		return []string{"-maxrate", maxBitrate, "-bufsize", bufsize}, nil
+	}
+}
+
+// QualityOptions はエンコードの画質に関する設定
+type QualityOptions struct {
+	CRF          int    // 固定品質の値 (0〜51、小さいほど高画質)。-1の場合は指定しない
+	VideoBitrate string // 平均ビットレート (例: 8M)
+	Preset       string // 速度と圧縮率のプリセット (x264/x265の名前、NVENCの p1〜p7、またはAMFの speed/balanced/quality)
+	Tune         string // 映像の種類に応じた調整 (film, animation, grain, zerolatency など)
+}
+
+// nvencPresets はx264/x265のプリセット名に相当するNVENCのプリセット
+var nvencPresets = map[string]string{
+	"ultrafast": "p1",
+	"superfast": "p1",
+	"veryfast":  "p2",
+	"faster":    "p3",
+	"fast":      "p4",
+	"medium":    "p5",
+	"slow":      "p6",
+	"slower":    "p7",
+	"veryslow":  "p7",
+}
+
+// nvencTunes はx264/x265のチューニング名に相当するNVENCのチューニング
+var nvencTunes = map[string]string{
+	"film":        "hq",
+	"animation":   "hq",
+	"grain":       "hq",
+	"stillimage":  "hq",
+	"fastdecode":  "ll",
+	"zerolatency": "ull",
+}
+
+// amfQualities はx264/x265のプリセット名に相当するAMFの -quality
+var amfQualities = map[string]string{
+	"ultrafast": "speed",
+	"superfast": "speed",
+	"veryfast":  "speed",
+	"faster":    "speed",
+	"fast":      "balanced",
+	"medium":    "balanced",
+	"slow":      "quality",
+	"slower":    "quality",
+	"veryslow":  "quality",
+}
+
+// buildQualityArgs はCRF・ビットレート・プリセット・チューニングをエンコーダーごとのオプションに変換する
+// vbvが真の場合は buildRateControlArgs でレート制御モードを指定済みとして扱う
+func buildQualityArgs(encoder string, q QualityOptions, vbv bool) ([]string, error) {
+	if q.CRF >= 0 && q.VideoBitrate != "" {
+		return nil, fmt.Errorf("-crf と -vbitrate は同時に指定できません")
+	}
+	if q.CRF > 51 {
+		return nil, fmt.Errorf("-crf には0〜51の値を指定してください: %d", q.CRF)
+	}
+	if q.VideoBitrate != "" {
+		if _, err := parseBitrate(q.VideoBitrate); err != nil {
+			return nil, err
+		}
+	}
+
+	var args []string
+	crf := strconv.Itoa(q.CRF)
+	switch {
+	case strings.HasSuffix(encoder, "_nvenc"):
+		if q.CRF >= 0 {
+			// NVENCは可変ビットレートモードの -cq で固定品質に近い動作になる
+			if !vbv {
+				args = append(args, "-rc", "vbr")
+			}
+			args = append(args, "-cq", crf, "-b:v", "0")
+		}
+		if q.Preset != "" {
+			preset := q.Preset
+			if p, ok := nvencPresets[preset]; ok {
+				preset = p
+			}
+			args = append(args, "-preset", preset)
+		}
+		if q.Tune != "" {
+			tune := q.Tune
+			if t, ok := nvencTunes[tune]; ok {
+				tune = t
+			}
+			args = append(args, "-tune", tune)
+		}
+	case strings.HasSuffix(encoder, "_qsv"):
+		if q.CRF >= 0 {
+			// QSVはICQモードの -global_quality で固定品質を指定する
+			args = append(args, "-global_quality", crf)
+		}
+		if q.Preset != "" {
+			preset := q.Preset
+			if preset == "ultrafast" || preset == "superfast" {
+				preset = "veryfast"
+			}
+			args = append(args, "-preset", preset)
+		}
+		if q.Tune != "" {
+			warnf("%s は -tune に対応していないため無視します。", encoder)
+		}
+	case strings.HasSuffix(encoder, "_amf"):
+		if q.CRF >= 0 {
+			// AMFは固定QPモードでフレームの種類ごとにQPを指定する (HEVCはBフレームを使わない)
+			if !vbv {
+				args = append(args, "-rc", "cqp")
+			}
+			args = append(args, "-qp_i", crf, "-qp_p", crf)
+			if strings.HasPrefix(encoder, "h264") {
+				args = append(args, "-qp_b", crf)
+			}
+		}
+		if q.Preset != "" {
+			quality := q.Preset
+			if v, ok := amfQualities[quality]; ok {
+				quality = v
+			}
+			args = append(args, "-quality", quality)
+		}
+		if q.Tune != "" {
+			warnf("%s は -tune に対応していないため無視します。", encoder)
+		}
+	case strings.HasSuffix(encoder, "_vaapi"):
+		if q.CRF >= 0 {
+			args = append(args, "-qp", crf)
+		}
+		if q.Preset != "" || q.Tune != "" {
+			warnf("%s は -preset と -tune に対応していないため無視します。", encoder)
+		}
+	case strings.HasSuffix(encoder, "_videotoolbox"):
+		if q.CRF >= 0 {
+			// VideoToolboxの -q:v は1〜100で大きいほど高画質のため、CRFの値を換算する
+			quality := max(1, 100-q.CRF*100/51)
+			args = append(args, "-q:v", strconv.Itoa(quality))
+		}
+		if q.Preset != "" || q.Tune != "" {
+			warnf("%s は -preset と -tune に対応していないため無視します。", encoder)
+		}
+	default:
+		// libx264/libx265などのソフトウェアエンコーダーは名前をそのまま解釈する
+		if q.CRF >= 0 {
+			args = append(args, "-crf", crf)
+			if strings.HasPrefix(encoder, "libvpx") || encoder == "libaom-av1" {
+				// libvpx、libaomは -b:v 0 のときのみ固定品質モードになる
+				args = append(args, "-b:v", "0")
+			}
+		}
+		if q.Preset != "" {
+			args = append(args, "-preset", q.Preset)
+		}
+		if q.Tune != "" {
+			args = append(args, "-tune", q.Tune)
+		}
+	}
+	if q.VideoBitrate != "" {
+		args = append(args, "-b:v", q.VideoBitrate)
+	}
+	return args, nil
+}
@@ -0,0 +1,210 @@
+package concator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Rendition は同じ入力から1回の読み込みで同時にエンコードする、解像度違いの出力の1つ
+type Rendition struct {
+	Name   string // 720p など。出力ファイル名の接尾辞やHLSのストリーム名に使う
+	Width  int
+	Height int
+	Output string // -format file の場合の出力ファイル
+}
+
+// parseRenditions は "1080p,720p,480p" や "1280x720" 形式の解像度の一覧を解析する
+// "720p" のような指定は短辺の長さとみなし、長辺は出力の解像度 (res) の縦横比から求める
+func parseRenditions(spec, res string) ([]Rendition, error) {
+	w, h, err := parseResolution(res)
+	if err != nil {
+		return nil, err
+	}
+	var renditions []Rendition
+	names := map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		r := Rendition{Name: item}
+		if short, ok := strings.CutSuffix(item, "p"); ok {
+			n, err := strconv.Atoi(short)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("-renditions の形式が正しくありません: %s (例: 1080p,720p または 1280x720)", item)
+			}
+			// 長辺は縦横比を保ち、エンコーダーが扱えるよう偶数に丸める
+			long := int(math.Round(float64(n)*float64(max(w, h))/float64(min(w, h))/2)) * 2
+			if w >= h {
+				r.Width, r.Height = long, n
+			} else {
+				r.Width, r.Height = n, long
+			}
+		} else if r.Width, r.Height, err = parseResolution(item); err != nil {
+			return nil, fmt.Errorf("-renditions の形式が正しくありません: %s (例: 1080p,720p または 1280x720)", item)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("-renditions に同じ解像度が重複しています: %s", item)
+		}
+		names[r.Name] = true
+		renditions = append(renditions, r)
+	}
+	if len(renditions) == 0 {
+		return nil, fmt.Errorf("-renditions に解像度が指定されていません: %s", spec)
+	}
+	return renditions, nil
+}
+
+// renditionPixelRatio は出力の解像度 (res) に対する、全ての解像度の出力の画素数の合計の比を返す
+// 出力サイズの見積もりに使う
+func renditionPixelRatio(renditions []Rendition, res string) float64 {
+	w, h, err := parseResolution(res)
+	if err != nil {
+		return float64(len(renditions))
+	}
+	var ratio float64
+	for _, r := range renditions {
+		ratio += float64(r.Width*r.Height) / float64(w*h)
+	}
+	return ratio
+}
+
+// buildRenditionVideoFilter は結合した映像をsplitで分岐し、各解像度に縮小するフィルターを組み立てる
+// source は映像の入力のラベル付きのフィルター (例: "[0:v:0]scale=...")、出力は [rv0]、[rv1]、...
+// GPUへのアップロードは分岐して縮小した後に行う
+func buildRenditionVideoFilter(source string, job EncodeJob) string {
+	var b strings.Builder
+	b.WriteString(source)
+	fmt.Fprintf(&b, ",split=%d", len(job.Renditions))
+	for i := range job.Renditions {
+		fmt.Fprintf(&b, "[rs%d]", i)
+	}
+	for i, r := range job.Renditions {
+		fmt.Fprintf(&b, ";[rs%d]scale=%d:%d,setsar=1%s[rv%d]", i, r.Width, r.Height, job.GPUArgs.FilterSuffix, i)
+	}
+	return b.String()
+}
+
+// buildRenditionArgs は複数の解像度の出力を1回のffmpegの実行でエンコードする引数を組み立てる
+// -format file の場合は解像度ごとのファイル、hls の場合はストリームごとのプレイリストとマスタープレイリスト、
+// dash の場合は全ての解像度を含む1つのマニフェストを出力する
+func buildRenditionArgs(job EncodeJob, listFilePath string) []string {
+	args, chaptersInput, subtitlesInput := buildEncodeInputArgs(job, listFilePath)
+	n := len(job.Renditions)
+	hasAudio := !job.NoAudio || job.Music != nil
+	// dash では全ての解像度で1つの音声を共有し、それ以外は解像度ごとに音声を分岐する
+	audioOutputs := n
+	if job.Streaming != nil && job.Streaming.Format == "dash" {
+		audioOutputs = 1
+	}
+
+	// 映像 (と、トランジション・BGMを使う場合は音声) のフィルター
+	// GPUへのアップロードは解像度ごとに縮小した後に行うため、結合部分のフィルターからは取り除く
+	base := job
+	base.VideoFilter = strings.TrimSuffix(job.VideoFilter, job.GPUArgs.FilterSuffix)
+	gpu := *job.GPUArgs
+	gpu.FilterSuffix = ""
+	base.GPUArgs = &gpu
+	audioLabel := ""
+	var graph string
+	switch {
+	case job.Transition != "":
+		graph = buildTransitionFilter(base) + ";" + buildRenditionVideoFilter("[vout]null", job)
+		if hasAudio {
+			audioLabel = "[aout]"
+		}
+	default:
+		graph = buildRenditionVideoFilter("[0:v:0]"+applyOverlays(base.VideoFilter, base), job)
+		if job.Music != nil {
+			graph += ";" + buildConcatMusicFilter(job)
+			audioLabel = "[aout]"
+		}
+	}
+	if audioLabel != "" && audioOutputs > 1 {
+		graph += fmt.Sprintf(";%sasplit=%d", audioLabel, audioOutputs)
+		for i := range audioOutputs {
+			graph += fmt.Sprintf("[ra%d]", i)
+		}
+	}
+	args = append(args, "-filter_complex", graph)
+
+	// audioMap はi番目の出力に対応する音声のマッピングを返す
+	audioMap := func(i int) string {
+		switch {
+		case audioLabel == "":
+			return "0:a:0?"
+		case audioOutputs > 1:
+			return fmt.Sprintf("[ra%d]", i)
+		default:
+			return audioLabel
+		}
+	}
+	// audioArgs は音声のエンコードのオプションを返す (フィルターの中で合成していない場合のみ -af を付ける)
+	audioArgs := func() []string {
+		if !hasAudio {
+			return []string{"-an"}
+		}
+		if job.AudioCopy {
+			return []string{"-c:a", "copy"}
+		}
+		var a []string
+		if audioLabel == "" {
+			if af := joinFilters(job.AudioFilter, buildLoudnessFilter(job), audioFadeFilter(job)); af != "" {
+				a = append(a, "-af", af)
+			}
+		}
+		return append(a, "-c:a", job.AudioCodec, "-b:a", "192k")
+	}
+	// videoArgs はビデオエンコーダーとレート制御のオプションを返す
+	videoArgs := func() []string {
+		a := []string{"-c:v", job.Encoder}
+		if job.TotalFrames > 0 {
+			a = append(a, "-frames:v", strconv.FormatInt(job.TotalFrames, 10))
+		}
+		a = append(a, job.RateControlArgs...)
+		return append(a, job.GPUArgs.Output...)
+	}
+
+	if job.Streaming != nil {
+		// 全ての解像度を1つの出力にまとめる
+		for i := range n {
+			args = append(args, "-map", fmt.Sprintf("[rv%d]", i))
+		}
+		if hasAudio {
+			for i := range audioOutputs {
+				args = append(args, "-map", audioMap(i))
+			}
+		}
+		args = append(args, videoArgs()...)
+		args = append(args, audioArgs()...)
+		args = append(args, job.Streaming.renditionArgs(job.Output, job.Renditions, hasAudio)...)
+		args = append(args, job.MetadataArgs...)
+		args = append(args, job.ExtraArgs...)
+		return append(args, "-y", job.Streaming.renditionTarget(job.Output))
+	}
+
+	// 解像度ごとに別々のファイルへ出力する
+	for i, r := range job.Renditions {
+		args = append(args, "-map", fmt.Sprintf("[rv%d]", i))
+		if hasAudio {
+			args = append(args, "-map", audioMap(i))
+		}
+		if chaptersInput >= 0 {
+			args = append(args, "-map_chapters", strconv.Itoa(chaptersInput))
+		}
+		if subtitlesInput >= 0 {
+			args = append(args, "-map", strconv.Itoa(subtitlesInput)+":s:0", "-c:s", job.SubtitleCodec)
+		}
+		args = append(args, videoArgs()...)
+		if job.PosterMode == "attachment" {
+			args = append(args, buildPosterAttachArgs(job.Poster)...)
+		}
+		args = append(args, audioArgs()...)
+		args = append(args, job.MetadataArgs...)
+		args = append(args, job.ExtraArgs...)
+		args = append(args, "-y", r.Output)
+	}
+	return args
+}
@@ -0,0 +1,34 @@
+package concator
+
+import (
+	"fmt"
+)
+
+// detectModalResolution は全入力ファイルをプローブし、最も多く使われている表示解像度を返す
+// 同数の場合は画素数の大きい解像度を優先する
+func detectModalResolution(files []string) (string, error) {
+	type size struct{ w, h int }
+	counts := map[size]int{}
+	for _, file := range files {
+		probe, err := probeVideo(file)
+		if err != nil {
+			return "", err
+		}
+		w, h := probe.DisplaySize()
+		counts[size{w, h}]++
+	}
+
+	var best size
+	bestCount := 0
+	for s, c := range counts {
+		if c > bestCount || (c == bestCount && s.w*s.h > best.w*best.h) {
+			best, bestCount = s, c
+		}
+	}
+	if bestCount == 0 {
+		return "", fmt.Errorf("解像度を判定できる動画ファイルがありません")
+	}
+
+	infof("最も多い解像度 %dx%d を使用します (%d/%d個のファイル)", best.w, best.h, bestCount, len(files))
+	return fmt.Sprintf("%dx%d", best.w, best.h), nil
+}
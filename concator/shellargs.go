@@ -0,0 +1,77 @@
+package concator
+
+import (
+	"errors"
+	"strings"
+)
+
+// SplitShellArgs はシェルと同じように空白で区切った引数を分割する
+// シングルクォートの中はそのまま、ダブルクォートの中は \" と \\ のみをエスケープとして扱い、
+// クォートの外のバックスラッシュは次の1文字をそのまま引数に含める
+// 例: -metadata "title=My Video" は ["-metadata", "title=My Video"] になる
+func SplitShellArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("引用符が閉じられていません")
+	}
+	if escaped {
+		return nil, errors.New("末尾のバックスラッシュの後に文字がありません")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// JoinShellArgs は SplitShellArgs で元の引数に戻せるよう、必要に応じてクォートして引数を空白で連結する
+func JoinShellArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
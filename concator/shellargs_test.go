@@ -0,0 +1,47 @@
+package concator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShellArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{name: "plain", in: "-movflags +faststart", want: []string{"-movflags", "+faststart"}},
+		{name: "double quoted", in: `-metadata "title=My Video"`, want: []string{"-metadata", "title=My Video"}},
+		{name: "single quoted", in: `-vf 'drawtext=text=Hello World'`, want: []string{"-vf", "drawtext=text=Hello World"}},
+		{name: "escaped space", in: `-i /videos/My\ Clip.mp4`, want: []string{"-i", "/videos/My Clip.mp4"}},
+		{name: "escapes in double quotes", in: `"say \"hi\"" "a\b"`, want: []string{`say "hi"`, `a\b`}},
+		{name: "quote inside word", in: `title='it'\''s'`, want: []string{"title=it's"}},
+		{name: "empty argument", in: `-metadata ''`, want: []string{"-metadata", ""}},
+		{name: "extra spaces", in: "  -an \t -sn ", want: []string{"-an", "-sn"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitShellArgs(tt.in)
+			if err != nil {
+				t.Fatalf("SplitShellArgs(%q): %v", tt.in, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitShellArgs(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			// 連結した文字列を分割し直すと元の引数に戻る (設定の書き出しと読み込み)
+			again, err := SplitShellArgs(JoinShellArgs(got))
+			if err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("SplitShellArgs(JoinShellArgs(%q)) = %q, %v", got, again, err)
+			}
+		})
+	}
+}
+
+func TestSplitShellArgsInvalid(t *testing.T) {
+	for _, in := range []string{`-metadata "title=My Video`, `'abc`, `abc\`} {
+		if _, err := SplitShellArgs(in); err == nil {
+			t.Errorf("SplitShellArgs(%q) がエラーになりません", in)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package concator
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// weightedShuffle は重み付きの非復元抽出でファイルの順序をランダムに並べ替える
+//
+// Efraimidis-Spirakisの方法を用いる: 各ファイルに一様乱数u (0<u<1) と重みwから
+// キー u^(1/w) を割り当て、キーの大きい順に並べる。重みの大きいファイルほど
+// 前方に来やすくなるが、順序は確定しない。重みは各ファイルのサイドカーの
+// weightフィールドから読み込み、省略時または0の場合は1とする。同じseedでは同じ順序になる。
+func weightedShuffle(files []string, seed uint64) ([]string, error) {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	keys := make([]float64, len(files))
+	for i, file := range files {
+		sc, err := loadSidecar(file)
+		if err != nil {
+			return nil, err
+		}
+		weight := 1.0
+		if sc.Weight != nil && *sc.Weight != 0 {
+			weight = *sc.Weight
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("weightには0以上の値を指定してください: %s (%g)", sidecarPath(file), weight)
+		}
+		u := 1 - rng.Float64() // (0, 1]
+		keys[i] = math.Pow(u, 1/weight)
+	}
+
+	indexes := make([]int, len(files))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return keys[indexes[a]] > keys[indexes[b]]
+	})
+
+	shuffled := make([]string, len(files))
+	for i, idx := range indexes {
+		shuffled[i] = files[idx]
+	}
+	return shuffled, nil
+}
@@ -0,0 +1,79 @@
+package concator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestClips はdirに空の動画ファイルを作成し、weightsの各値をサイドカーに書き出す
+// weightsの値が空文字列のクリップにはサイドカーを作らない
+func writeTestClips(t *testing.T, dir string, weights map[string]string) []string {
+	t.Helper()
+	var files []string
+	for _, name := range []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4", "e.mp4"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if w := weights[name]; w != "" {
+			if err := os.WriteFile(sidecarPath(path), []byte(`{"weight": `+w+`}`), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+func TestWeightedShuffleSeed(t *testing.T) {
+	files := writeTestClips(t, t.TempDir(), map[string]string{"a.mp4": "5", "c.mp4": "0.5"})
+
+	first, err := weightedShuffle(files, 42)
+	if err != nil {
+		t.Fatalf("weightedShuffle: %v", err)
+	}
+	second, err := weightedShuffle(files, 42)
+	if err != nil {
+		t.Fatalf("weightedShuffle: %v", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("同じシード値で順序が変わりました: %v, %v", first, second)
+	}
+	if len(first) != len(files) {
+		t.Errorf("len = %d, want %d", len(first), len(files))
+	}
+}
+
+func TestWeightedShuffleDefaultWeight(t *testing.T) {
+	// 重みが0または省略されたクリップは重み1として扱われ、重みを全て1にした場合と同じ順序になる
+	withDefaults := writeTestClips(t, t.TempDir(), map[string]string{"a.mp4": "0", "b.mp4": "1"})
+	explicit := writeTestClips(t, t.TempDir(), map[string]string{
+		"a.mp4": "1", "b.mp4": "1", "c.mp4": "1", "d.mp4": "1", "e.mp4": "1",
+	})
+
+	for _, seed := range []uint64{1, 7, 42} {
+		got, err := weightedShuffle(withDefaults, seed)
+		if err != nil {
+			t.Fatalf("weightedShuffle: %v", err)
+		}
+		want, err := weightedShuffle(explicit, seed)
+		if err != nil {
+			t.Fatalf("weightedShuffle: %v", err)
+		}
+		for i := range got {
+			if filepath.Base(got[i]) != filepath.Base(want[i]) {
+				t.Errorf("seed %d: 順序 %v が重み1の場合の順序 %v と異なります", seed, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestWeightedShuffleNegativeWeight(t *testing.T) {
+	files := writeTestClips(t, t.TempDir(), map[string]string{"b.mp4": "-1"})
+	if _, err := weightedShuffle(files, 1); err == nil {
+		t.Error("負の重みがエラーになりません")
+	}
+}
@@ -0,0 +1,37 @@
+package concator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Sidecar は動画ファイルごとの補足情報 (<動画ファイル名>.concat.json) の構造体
+type Sidecar struct {
+	// Weight は -sort weighted-shuffle で前方に配置されやすくする重み (省略時または0の場合は1)
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// sidecarPath は動画ファイルに対応するサイドカーファイルのパスを返す
+// 出力ファイルのマニフェスト (<出力ファイル名>.json) と区別するため、.concat.json を付ける
+func sidecarPath(videoPath string) string {
+	return videoPath + ".concat.json"
+}
+
+// loadSidecar は動画ファイルに対応するサイドカーファイルを読み込む
+// サイドカーファイルが無い場合は空のSidecarを返す
+func loadSidecar(videoPath string) (*Sidecar, error) {
+	data, err := os.ReadFile(sidecarPath(videoPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Sidecar{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sc Sidecar
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("サイドカーファイルの解析に失敗しました: %s, %v", sidecarPath(videoPath), err)
+	}
+	return &sc, nil
+}
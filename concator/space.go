@@ -0,0 +1,120 @@
+package concator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// sampleEncodeSeconds は目標ビットレートが無い場合に、出力サイズを見積もるため試しにエンコードする長さ(秒)
+const sampleEncodeSeconds = 5.0
+
+// estimatedAudioBitrate は出力サイズの見積もりに使う音声のビットレート (bps)
+const estimatedAudioBitrate = 192000
+
+// spaceMarginRatio は見積もりの誤差を見込んで、見積もったサイズに上乗せする割合
+const spaceMarginRatio = 1.1
+
+// estimateOutputSize は出力ファイルのサイズ(バイト)を見積もり、見積もりの方法と合わせて返す
+// 目標ビットレートがあれば出力の長さから計算し、無ければ一番長いクリップの一部を試しにエンコードして求める
+// ffprobeが無く長さを取得できない場合は入力の合計サイズで代用する
+func estimateOutputSize(ctx context.Context, job EncodeJob, bitrate string) (int64, string, error) {
+	if !isFFprobeAvailable() {
+		return inputsSize(job.Entries), "入力の合計サイズ", nil
+	}
+	durations, err := entryDurations(job.Entries)
+	if err != nil {
+		return 0, "", err
+	}
+	var total float64
+	longest := 0
+	for i, d := range durations {
+		total += d
+		if d > durations[longest] {
+			longest = i
+		}
+	}
+	total -= transitionOverlap(job)
+	if job.TotalFrames > 0 && job.Framerate > 0 {
+		total = min(total, float64(job.TotalFrames)/float64(job.Framerate))
+	}
+
+	if bitrate != "" {
+		rate, err := parseBitrate(bitrate)
+		if err != nil {
+			return 0, "", err
+		}
+		return int64(total * float64(rate+estimatedAudioBitrate) / 8), "目標ビットレート", nil
+	}
+
+	// クリップの中央付近を試しにエンコードし、1秒あたりのサイズから全体を求める
+	entry := job.Entries[longest]
+	length := min(sampleEncodeSeconds, durations[longest])
+	if length <= 0 {
+		return 0, "", errors.New("試しにエンコードするクリップの長さが0です")
+	}
+	// durations は出力上の長さのため、再生速度を変えたクリップでは入力上の長さに戻す
+	speed := entry.playbackSpeed()
+	entry.Inpoint += (durations[longest] - length) / 2 * speed
+	entry.Outpoint = entry.Inpoint + length*speed
+	// HLS/DASHのプレイリストではなく、1つのファイルとして試しにエンコードする
+	ext := filepath.Ext(job.Output)
+	if job.Streaming != nil {
+		ext = ".mp4"
+	}
+	sample, err := os.CreateTemp("", "video_concator-sample-*"+ext)
+	if err != nil {
+		return 0, "", err
+	}
+	sample.Close()
+	defer os.Remove(sample.Name())
+
+	sampleJob := segmentJob(job, entry, sample.Name())
+	sampleJob.EntryDurations = nil
+	sampleJob.Progress = false
+	sampleJob.Quiet = true
+	sampleJob.Events = nil
+	if err := runEncode(ctx, sampleJob); err != nil {
+		return 0, "", fmt.Errorf("試しのエンコードに失敗しました: %v", err)
+	}
+	info, err := os.Stat(sample.Name())
+	if err != nil {
+		return 0, "", err
+	}
+	return int64(float64(info.Size()) / length * total), fmt.Sprintf("%.0f秒の試しのエンコード", length), nil
+}
+
+// inputsSize はエントリの入力ファイルの合計サイズ(バイト)を返す
+func inputsSize(entries []ConcatEntry) int64 {
+	var total int64
+	for _, entry := range entries {
+		if info, err := os.Stat(entry.Path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// checkDiskSpace は見積もった出力サイズと出力先の空き容量を比べ、足りない場合はエラーを返す
+// forceの場合は警告のみ表示して続行する
+func checkDiskSpace(output string, estimate int64, method string, force bool) error {
+	dir := filepath.Dir(output)
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		warnf("出力先の空き容量を確認できません: %s, %v", dir, err)
+		return nil
+	}
+	need := int64(float64(estimate) * spaceMarginRatio)
+	infof("出力サイズの見積もり: %s (%s)、出力先の空き容量: %s", formatApproxSize(estimate), method, formatApproxSize(int64(free)))
+	if uint64(need) <= free {
+		return nil
+	}
+	msg := fmt.Sprintf("出力先 %s の空き容量 %s に対して、出力に約 %s 必要です", dir, formatApproxSize(int64(free)), formatApproxSize(need))
+	if force {
+		warnf("%s。-force が指定されているため続行します。", msg)
+		return nil
+	}
+	return fmt.Errorf("%s。空き容量を確保するか、-force を指定してください", msg)
+}
@@ -0,0 +1,71 @@
+package concator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxSpeed は -speed とカットリストの速度に指定できる倍率の上限
+const maxSpeed = 1000
+
+// parseSpeed は "8x"、"0.5x"、"2" 形式の再生速度の倍率を解析する
+func parseSpeed(s string) (float64, error) {
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(s), "x"), "X")
+	speed, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || speed <= 0 || speed > maxSpeed {
+		return 0, fmt.Errorf("再生速度は0より大きく%d以下の倍率で指定してください (例: 8x、0.5x): %s", maxSpeed, s)
+	}
+	return speed, nil
+}
+
+// playbackSpeed はエントリの再生速度の倍率を返す (指定が無い場合は等速の1)
+func (e ConcatEntry) playbackSpeed() float64 {
+	if e.Speed <= 0 {
+		return 1
+	}
+	return e.Speed
+}
+
+// speedVideoFilter は映像の再生速度を変えるフィルターを返す
+// フレームの時刻のみを変え、出力のフレームレートへの間引き・補完は後に続くfpsフィルターで行う
+func speedVideoFilter(speed float64) string {
+	return fmt.Sprintf("setpts=(PTS-STARTPTS)/%g", speed)
+}
+
+// speedAudioFilter は音声の再生速度を音程を変えずに変えるフィルターを返す
+// atempoの倍率は1つあたり0.5〜100の範囲のため、範囲外の場合は複数つなげる
+func speedAudioFilter(speed float64) string {
+	var filters []string
+	for speed > 100 {
+		filters = append(filters, "atempo=100")
+		speed /= 100
+	}
+	for speed < 0.5 {
+		filters = append(filters, "atempo=0.5")
+		speed /= 0.5
+	}
+	filters = append(filters, fmt.Sprintf("atempo=%g", speed))
+	return strings.Join(filters, ",")
+}
+
+// applySpeedFilters は再生速度が等速でないエントリに、速度を変える映像と音声のフィルターを設定する
+// dropAudio の場合は速度を変えたクリップの音声を無音にする。全てのクリップの速度を変える場合は、音声を出力しないためtrueを返す
+func applySpeedFilters(entries []ConcatEntry, dropAudio bool) bool {
+	changed := 0
+	for i, entry := range entries {
+		speed := entry.playbackSpeed()
+		if speed == 1 {
+			continue
+		}
+		changed++
+		entries[i].VideoFilter = joinFilters(entry.VideoFilter, speedVideoFilter(speed))
+		audio := speedAudioFilter(speed)
+		if dropAudio {
+			// 他のクリップと音声の有無を揃えるため、音声は長さを合わせてから無音にする
+			audio = joinFilters(audio, "volume=0")
+		}
+		entries[i].AudioFilter = joinFilters(entry.AudioFilter, audio)
+	}
+	return dropAudio && changed == len(entries)
+}
@@ -0,0 +1,129 @@
+package concator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// splitParts は各クリップの長さ (秒) と見積もりサイズ (バイト) から、クリップの境目で分割した各パートの範囲を返す
+// 上限を超える場合は次のクリップから新しいパートにする。1つのクリップで上限を超える場合はそのクリップのみのパートになる
+func splitParts(durations []float64, sizes []int64, maxDuration float64, maxBytes int64) [][2]int {
+	var parts [][2]int
+	start := 0
+	var duration float64
+	var bytes int64
+	for i := range durations {
+		over := (maxDuration > 0 && duration+durations[i] > maxDuration) || (maxBytes > 0 && bytes+sizes[i] > maxBytes)
+		if over && i > start {
+			parts = append(parts, [2]int{start, i})
+			start, duration, bytes = i, 0, 0
+		}
+		duration += durations[i]
+		bytes += sizes[i]
+	}
+	if start < len(durations) {
+		parts = append(parts, [2]int{start, len(durations)})
+	}
+	return parts
+}
+
+// splitClipSizes は各クリップを結合した後の出力サイズを見積もる
+// -copy の場合は入力ファイルのサイズ、ビットレートが分かる場合は長さとビットレートから求め、それ以外は入力ファイルのサイズで代用する
+func (j *Job) splitClipSizes(files []string, durations []float64) ([]int64, error) {
+	bitrate := j.VideoBitrate
+	if bitrate == "" {
+		bitrate = j.MaxBitrate
+	}
+	rate, err := parseBitrate(bitrate)
+	useBitrate := !j.Copy && bitrate != "" && err == nil
+	if !j.Copy && !useBitrate {
+		infof("ビットレートが指定されていないため、出力サイズを入力ファイルのサイズで見積もります。")
+	}
+	sizes := make([]int64, len(files))
+	for i, file := range files {
+		if useBitrate {
+			sizes[i] = int64(durations[i] * float64(rate+192000) / 8)
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = info.Size()
+	}
+	return sizes, nil
+}
+
+// runSplit は入力ファイルをクリップの境目で -split-duration、-split-size 以下のパートに分け、パートごとに別々の出力ファイルを作成する
+// 出力ファイル名には _part01、_part02 … を付け加える
+func (j *Job) runSplit(ctx context.Context, sortKey string, explicitFiles []string) error {
+	if j.Source != "" || j.OrientationGroups || j.Format != "file" {
+		return errors.New("-split-duration、-split-size は -source、-orientation-groups、-format hls/dash と同時に指定できません。")
+	}
+	if j.SplitDuration < 0 {
+		return errors.New("-split-duration には正の値を指定してください。")
+	}
+	var maxBytes int64
+	if j.SplitSize != "" {
+		if j.TargetSize != "" {
+			return errors.New("-split-size と -target-size は同時に指定できません。")
+		}
+		var err error
+		if maxBytes, err = ParseByteSize(j.SplitSize); err != nil {
+			return fmt.Errorf("-split-size: %v", err)
+		}
+	}
+	if !isFFprobeAvailable() {
+		return errors.New("-split-duration、-split-size にはffprobeが必要です。")
+	}
+	files, _, err := j.discoverInputs(ctx, sortKey, explicitFiles)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	durations := make([]float64, len(files))
+	err = runParallel(len(files), j.Jobs, func(i int) error {
+		var err error
+		durations[i], err = probeDuration(files[i])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// カットリストの速度はクリップごとの分割を決めた後に適用されるため、ここでは -speed のみを考慮する
+	if j.Speed != "" {
+		speed, err := parseSpeed(j.Speed)
+		if err != nil {
+			return fmt.Errorf("-speed: %v", err)
+		}
+		for i := range durations {
+			durations[i] /= speed
+		}
+	}
+	sizes, err := j.splitClipSizes(files, durations)
+	if err != nil {
+		return err
+	}
+	parts := splitParts(durations, sizes, j.SplitDuration.Seconds(), maxBytes)
+	infof("%d個の動画ファイルを%d個のパートに分けて結合します。", len(files), len(parts))
+
+	for n, part := range parts {
+		partFiles := files[part[0]:part[1]]
+		if len(partFiles) == 1 && ((j.SplitDuration > 0 && durations[part[0]] > j.SplitDuration.Seconds()) || (maxBytes > 0 && sizes[part[0]] > maxBytes)) {
+			warnf("クリップ %s は1つで上限を超えますが、クリップの途中では分割しません。", filepath.Base(partFiles[0]))
+		}
+		partJob := *j
+		partJob.SplitDuration, partJob.SplitSize = 0, ""
+		// 検索済みのファイルを指定順に結合する
+		partJob.Files, partJob.ListFile, partJob.Manifest = partFiles, "", nil
+		partJob.Output = suffixedOutputPath(j.Output, fmt.Sprintf("_part%02d", n+1))
+		infof("パート %d/%d (%d個) を結合します...", n+1, len(parts), len(partFiles))
+		if err := partJob.Run(ctx); err != nil {
+			return fmt.Errorf("パート %d: %v", n+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package concator
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// spriteRows はスプライトシート1枚あたりの行数
+const spriteRows = 10
+
+// SpriteOptions はシークプレビュー用スプライトシートの設定
+type SpriteOptions struct {
+	Interval float64 // サムネイルの間隔 (秒)
+	Width    int     // サムネイルの幅 (ピクセル)
+	Columns  int     // スプライトシートの列数
+}
+
+// generateScrubSprites は出力動画から一定間隔のサムネイルを抽出してスプライトシートに並べ、
+// 各時間範囲とスプライト内の領域 (#xywh) を対応付けるWebVTTファイルを書き出す
+// 書き出したVTTファイルのパスを返す
+func generateScrubSprites(output string, opts SpriteOptions, limits ResourceLimits) (string, error) {
+	probe, err := probeVideo(output)
+	if err != nil {
+		return "", err
+	}
+	duration, err := probeDuration(output)
+	if err != nil {
+		return "", err
+	}
+	w, h := probe.DisplaySize()
+	thumbWidth := opts.Width
+	// 高さは縦横比を保ち、エンコーダーが扱える偶数に丸める
+	thumbHeight := int(math.Round(float64(thumbWidth)*float64(h)/float64(w)/2)) * 2
+
+	base := strings.TrimSuffix(output, filepath.Ext(output)) + "_sprites"
+	pattern := base + "_%03d.jpg"
+	cmd := exec.Command(
+		ffmpegPath,
+		"-v", "error",
+		"-i", output,
+		"-vf", fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d", opts.Interval, thumbWidth, thumbHeight, opts.Columns, spriteRows),
+		"-q:v", "3",
+		"-y",
+		pattern,
+	)
+	out, err := combinedOutputLimited(cmd, limits)
+	if err != nil {
+		return "", fmt.Errorf("スプライトシートの作成に失敗しました: %v\n%s", err, out)
+	}
+
+	vttPath := base + ".vtt"
+	file, err := os.Create(vttPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprint(writer, "WEBVTT\n")
+	perSheet := opts.Columns * spriteRows
+	count := int(math.Ceil(duration / opts.Interval))
+	for i := 0; i < count; i++ {
+		start := float64(i) * opts.Interval
+		end := math.Min(start+opts.Interval, duration)
+		pos := i % perSheet
+		sheet := filepath.Base(fmt.Sprintf(pattern, i/perSheet+1))
+		x := (pos % opts.Columns) * thumbWidth
+		y := (pos / opts.Columns) * thumbHeight
+		fmt.Fprintf(writer, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			formatVTTTimestamp(start), formatVTTTimestamp(end), sheet, x, y, thumbWidth, thumbHeight)
+	}
+	if err := writer.Flush(); err != nil {
+		return "", err
+	}
+	return vttPath, nil
+}
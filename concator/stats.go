@@ -0,0 +1,24 @@
+package concator
+
+import (
+	"os"
+	"time"
+)
+
+// isTerminal はファイルが端末 (TTY) に接続されているかを返す
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// defaultStatsPeriod は進捗の表示間隔の既定値を返す
+// 端末では応答性を優先して1秒、ログファイルなどへの出力では行数を抑えるため10秒とする
+func defaultStatsPeriod() time.Duration {
+	if isTerminal(os.Stderr) {
+		return time.Second
+	}
+	return 10 * time.Second
+}
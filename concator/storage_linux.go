@@ -0,0 +1,30 @@
+//go:build linux
+
+package concator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// isRotationalStorage はパスが置かれたブロックデバイスが回転式ディスク (HDD) かを判定する
+// 判定できない場合、2つ目の戻り値はfalseになる
+func isRotationalStorage(path string) (bool, bool) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return false, false
+	}
+	dev := fmt.Sprintf("/sys/dev/block/%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev))
+	// パーティションの場合は親デバイスのqueueを参照する
+	for _, p := range []string{filepath.Join(dev, "queue", "rotational"), filepath.Join(dev, "..", "queue", "rotational")} {
+		data, err := os.ReadFile(p)
+		if err == nil {
+			return strings.TrimSpace(string(data)) == "1", true
+		}
+	}
+	return false, false
+}
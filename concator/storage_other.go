@@ -0,0 +1,8 @@
+//go:build !linux
+
+package concator
+
+// isRotationalStorage はこのOSではストレージの種類を判定できないため常に判定不能を返す
+func isRotationalStorage(path string) (bool, bool) {
+	return false, false
+}
@@ -0,0 +1,119 @@
+package concator
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// StreamingOutput はWeb配信向けにプレイリストとセグメントへ分割して出力する設定
+type StreamingOutput struct {
+	Format          string  // hls または dash
+	SegmentDuration float64 // 1セグメントの長さ(秒)
+	MasterPlaylist  bool    // HLSのマスタープレイリストも書き出す
+}
+
+// streamingExtensions は配信形式ごとのプレイリスト (マニフェスト) の拡張子
+var streamingExtensions = map[string]string{
+	"hls":  ".m3u8",
+	"dash": ".mpd",
+}
+
+// validate は配信形式と出力先のプレイリストの拡張子、セグメントの長さが正しいかを確認する
+func (s *StreamingOutput) validate(output string) error {
+	ext, ok := streamingExtensions[s.Format]
+	if !ok {
+		return fmt.Errorf("-format には file、hls、dash のいずれかを指定してください: %s", s.Format)
+	}
+	if !strings.EqualFold(filepath.Ext(output), ext) {
+		return fmt.Errorf("-format %s では -output に %s のプレイリストを指定してください: %s", s.Format, ext, output)
+	}
+	if s.SegmentDuration <= 0 {
+		return errors.New("-segment-duration には正の値を指定してください。")
+	}
+	if s.MasterPlaylist && s.Format != "hls" {
+		return errors.New("-master-playlist は -format hls でのみ指定できます (DASHのマニフェストは常に全ての表現を含みます)。")
+	}
+	return nil
+}
+
+// masterPlaylistName はHLSのマスタープレイリストのファイル名を返す (プレイリストと同じディレクトリに書き出す)
+func masterPlaylistName(output string) string {
+	base := filepath.Base(output)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "_master.m3u8"
+}
+
+// outputArgs はプレイリストとセグメントを書き出すffmpegの出力オプションを組み立てる
+// セグメントはプレイリストと同じディレクトリに、プレイリストの名前を元にした連番のファイル名で書き出す
+func (s *StreamingOutput) outputArgs(output string) []string {
+	args := s.formatArgs(output, "_%05d.ts")
+	if s.Format == "hls" && s.MasterPlaylist {
+		args = append(args, "-master_pl_name", masterPlaylistName(output))
+	}
+	return args
+}
+
+// formatArgs は配信形式ごとの共通の出力オプションを組み立てる
+// hlsSegment はHLSのセグメントのファイル名のうち、プレイリストの名前に続く部分
+func (s *StreamingOutput) formatArgs(output, hlsSegment string) []string {
+	base := strings.TrimSuffix(output, filepath.Ext(output))
+	segment := strconv.FormatFloat(s.SegmentDuration, 'f', -1, 64)
+	// セグメントの境界でキーフレームが始まるようにする
+	args := []string{"-force_key_frames", "expr:gte(t,n_forced*" + segment + ")"}
+	switch s.Format {
+	case "hls":
+		args = append(args,
+			"-f", "hls",
+			"-hls_time", segment,
+			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", base+hlsSegment,
+		)
+	case "dash":
+		name := filepath.Base(base)
+		args = append(args,
+			"-f", "dash",
+			"-seg_duration", segment,
+			"-use_template", "1",
+			"-use_timeline", "1",
+			"-init_seg_name", name+"_init_$RepresentationID$.m4s",
+			"-media_seg_name", name+"_$RepresentationID$_$Number%05d$.m4s",
+		)
+	}
+	return args
+}
+
+// renditionArgs は複数の解像度を1つの出力にまとめる出力オプションを組み立てる
+// hls では output をマスタープレイリストとし、解像度ごとのプレイリストを <名前>_<解像度>.m3u8 に書き出す
+// dash では映像と音声をそれぞれ1つのアダプテーションセットにまとめる
+func (s *StreamingOutput) renditionArgs(output string, renditions []Rendition, hasAudio bool) []string {
+	if s.Format == "dash" {
+		sets := "id=0,streams=v"
+		if hasAudio {
+			sets += " id=1,streams=a"
+		}
+		return append(s.formatArgs(output, ""), "-adaptation_sets", sets)
+	}
+	var streams []string
+	for i, r := range renditions {
+		stream := fmt.Sprintf("v:%d", i)
+		if hasAudio {
+			stream += fmt.Sprintf(",a:%d", i)
+		}
+		streams = append(streams, stream+",name:"+r.Name)
+	}
+	return append(s.formatArgs(output, "_%v_%05d.ts"),
+		"-master_pl_name", filepath.Base(output),
+		"-var_stream_map", strings.Join(streams, " "),
+	)
+}
+
+// renditionTarget は複数の解像度をまとめて出力する際にffmpegに渡す出力先を返す
+// hls では解像度ごとのプレイリストの名前のパターンになる
+func (s *StreamingOutput) renditionTarget(output string) string {
+	if s.Format == "hls" {
+		return strings.TrimSuffix(output, filepath.Ext(output)) + "_%v.m3u8"
+	}
+	return output
+}
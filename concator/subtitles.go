@@ -0,0 +1,257 @@
+package concator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bitmapSubtitleCodecs は画像ベースでテキスト形式に変換できない字幕コーデック
+var bitmapSubtitleCodecs = map[string]bool{
+	"dvd_subtitle":      true,
+	"hdmv_pgs_subtitle": true,
+	"dvb_subtitle":      true,
+}
+
+// subtitleCue は字幕の1つの表示区間
+type subtitleCue struct {
+	Start float64 // 秒
+	End   float64
+	Text  string
+}
+
+// parseSRTTimestamp は "HH:MM:SS,mmm" 形式のSRTのタイムスタンプを秒数に変換する
+func parseSRTTimestamp(s string) (float64, error) {
+	s = strings.Replace(strings.TrimSpace(s), ",", ".", 1)
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("タイムスタンプの形式が正しくありません: %s", s)
+	}
+	var seconds float64
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("タイムスタンプの形式が正しくありません: %s", s)
+		}
+		seconds = seconds*60 + v
+	}
+	return seconds, nil
+}
+
+// formatSRTTimestamp は秒数をSRTのタイムスタンプ形式 (HH:MM:SS,mmm) に変換する
+func formatSRTTimestamp(seconds float64) string {
+	return strings.Replace(formatVTTTimestamp(seconds), ".", ",", 1)
+}
+
+// parseSRT はSRT形式の字幕を解析する
+// 番号の行は使わず、"-->" を含む行から次の空行までを1つの表示区間とする
+func parseSRT(data string) ([]subtitleCue, error) {
+	var cues []subtitleCue
+	var current *subtitleCue
+	var text []string
+	flush := func() {
+		if current != nil {
+			current.Text = strings.Join(text, "\n")
+			cues = append(cues, *current)
+		}
+		current, text = nil, nil
+	}
+	scanner := bufio.NewScanner(strings.NewReader(strings.TrimPrefix(data, "\ufeff")))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if start, end, ok := strings.Cut(line, "-->"); ok {
+			flush()
+			s, err := parseSRTTimestamp(start)
+			if err != nil {
+				return nil, err
+			}
+			// 終了時刻の後に位置の指定が続く場合がある
+			fields := strings.Fields(end)
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("終了時刻がありません: %s", line)
+			}
+			e, err := parseSRTTimestamp(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			current = &subtitleCue{Start: s, End: e}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		text = append(text, line)
+	}
+	flush()
+	return cues, scanner.Err()
+}
+
+// formatSRT は表示区間をSRT形式の文字列に変換する
+func formatSRT(cues []subtitleCue) string {
+	var b strings.Builder
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatSRTTimestamp(cue.Start), formatSRTTimestamp(cue.End), cue.Text)
+	}
+	return b.String()
+}
+
+// extractSubtitleCues はffmpegで動画ファイルの最初の字幕ストリームをSRTに変換して読み込む
+func extractSubtitleCues(path string, limits ResourceLimits) ([]subtitleCue, error) {
+	cmd := exec.Command(ffmpegPath, "-v", "error", "-i", path, "-map", "0:s:0", "-f", "srt", "pipe:1")
+	out, err := outputLimited(cmd, limits)
+	if err != nil {
+		return nil, fmt.Errorf("字幕の読み込みに失敗しました: %s, %v", path, err)
+	}
+	cues, err := parseSRT(string(out))
+	if err != nil {
+		return nil, fmt.Errorf("字幕の解析に失敗しました: %s, %v", path, err)
+	}
+	return cues, nil
+}
+
+// sidecarSubtitleExts は入力の動画ファイルの隣から探す字幕ファイルの拡張子 (優先順)
+var sidecarSubtitleExts = []string{".srt", ".ass", ".ssa"}
+
+// findSidecarSubtitle は動画ファイルと同じ名前で拡張子の異なる字幕ファイルを探す (見つからない場合は空文字列)
+// 例: clip001.mp4 に対する clip001.srt
+func findSidecarSubtitle(path string) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range sidecarSubtitleExts {
+		for _, candidate := range []string{base + ext, base + strings.ToUpper(ext)} {
+			if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+
+// loadSidecarSubtitle は字幕ファイルを読み込む
+// SRTはそのまま解析し、ASS/SSAはffmpegでSRTに変換する (装飾や位置の指定は失われる)
+func loadSidecarSubtitle(path string, limits ResourceLimits) ([]subtitleCue, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".srt") {
+		return extractSubtitleCues(path, limits)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cues, err := parseSRT(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("字幕の解析に失敗しました: %s, %v", path, err)
+	}
+	return cues, nil
+}
+
+// loadInputSubtitles は各入力ファイルの字幕を読み込む
+// 隣に同じ名前の字幕ファイルがある場合はそれを優先し、無ければ動画ファイルに埋め込まれた字幕を使う
+// 字幕の無いファイルと、テキストに変換できない画像ベースの字幕のファイルは空になる
+func loadInputSubtitles(files []string, jobs int, limits ResourceLimits) (map[string][]subtitleCue, error) {
+	var unique []string
+	seen := map[string]bool{}
+	for _, file := range files {
+		if !seen[file] {
+			seen[file] = true
+			unique = append(unique, file)
+		}
+	}
+	results := make([][]subtitleCue, len(unique))
+	err := runParallel(len(unique), jobs, func(i int) error {
+		if sidecar := findSidecarSubtitle(unique[i]); sidecar != "" {
+			debugf("字幕ファイルを使用します: %s", filepath.Base(sidecar))
+			var err error
+			results[i], err = loadSidecarSubtitle(sidecar, limits)
+			return err
+		}
+		codecs, err := probeSubtitleCodecs(unique[i])
+		if err != nil || len(codecs) == 0 {
+			return err
+		}
+		if bitmapSubtitleCodecs[codecs[0]] {
+			warnf("画像ベースの字幕 (%s) はテキストに変換できないため引き継ぎません: %s", codecs[0], filepath.Base(unique[i]))
+			return nil
+		}
+		results[i], err = extractSubtitleCues(unique[i], limits)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	subtitles := map[string][]subtitleCue{}
+	for i, file := range unique {
+		if len(results[i]) > 0 {
+			subtitles[file] = results[i]
+		}
+	}
+	return subtitles, nil
+}
+
+// mergeSubtitles は各エントリの字幕を結合後の時刻にずらし、1つの字幕にまとめる
+// エントリの inpoint/outpoint の範囲外の表示区間は切り詰め、トランジションで重なる分 (overlap) も考慮する
+func mergeSubtitles(entries []ConcatEntry, overlap float64, subtitles map[string][]subtitleCue) ([]subtitleCue, error) {
+	durations, err := entryDurations(entries)
+	if err != nil {
+		return nil, err
+	}
+	var merged []subtitleCue
+	var offset float64
+	for i, entry := range entries {
+		for _, cue := range subtitles[entry.Path] {
+			// 再生速度を変えたクリップでは、字幕の時刻も同じ倍率で縮める
+			speed := entry.playbackSpeed()
+			start := max((cue.Start-entry.Inpoint)/speed, 0)
+			end := min((cue.End-entry.Inpoint)/speed, durations[i])
+			if end <= start {
+				continue
+			}
+			merged = append(merged, subtitleCue{Start: offset + start, End: offset + end, Text: cue.Text})
+		}
+		offset += durations[i] - overlap
+	}
+	sort.SliceStable(merged, func(a, b int) bool { return merged[a].Start < merged[b].Start })
+	return merged, nil
+}
+
+// createSubtitleFile は字幕をSRT形式の一時ファイルに書き出す
+func createSubtitleFile(cues []subtitleCue) (string, error) {
+	tempFile, err := os.CreateTemp("", "subtitles-*.srt")
+	if err != nil {
+		return "", err
+	}
+	defer tempFile.Close()
+
+	if _, err := tempFile.WriteString(formatSRT(cues)); err != nil {
+		return "", err
+	}
+	return tempFile.Name(), nil
+}
+
+// subtitleOutputCodec は出力コンテナからSRTの字幕を格納する際の字幕コーデックを決める
+// 対応していないコンテナの場合は空文字列を返す
+func subtitleOutputCodec(outputFile string) string {
+	switch strings.ToLower(filepath.Ext(outputFile)) {
+	case ".mp4", ".m4v", ".mov":
+		// MP4系はテキスト字幕をmov_textとしてのみ格納できる
+		return "mov_text"
+	case ".mkv":
+		return "srt"
+	case ".webm":
+		return "webvtt"
+	default:
+		return ""
+	}
+}
+
+// subtitlesBurnFilter は字幕ファイルを映像に焼き込むフィルターを返す
+func subtitlesBurnFilter(path string) string {
+	return "subtitles=" + escapeFilterArg(path)
+}
@@ -0,0 +1,123 @@
+package concator
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultThumbnailTime は -thumbnail-time の既定値
+// 先頭のフェードインやタイトルカードを避けるため、少し進んだ位置から切り出す
+const defaultThumbnailTime = "10%"
+
+// ContactSheetOptions は出力の全体から等間隔にフレームを抜き出して並べたコンタクトシートの設定
+type ContactSheetOptions struct {
+	Columns int // 列数
+	Rows    int // 行数
+	Width   int // 1コマの幅 (ピクセル)
+}
+
+// validateImageOutput は画像の出力先の拡張子が対応形式 (jpg, png) かを確認する
+func validateImageOutput(path, flagName string) error {
+	if _, ok := posterMimeTypes[strings.ToLower(filepath.Ext(path))]; !ok {
+		return fmt.Errorf("%s には .jpg または .png のファイルを指定してください: %s", flagName, path)
+	}
+	return nil
+}
+
+// parseThumbnailTime は -thumbnail-time の指定を解析する
+// "50%" 形式の場合は出力の長さに対する割合 (0〜100) を、それ以外は parseCutTime と同じ形式の秒数を返す
+func parseThumbnailTime(s string) (value float64, percent bool, err error) {
+	s = strings.TrimSpace(s)
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		value, err := strconv.ParseFloat(p, 64)
+		if err != nil || value < 0 || value > 100 {
+			return 0, false, fmt.Errorf("割合は0%%〜100%%で指定してください: %s", s)
+		}
+		return value, true, nil
+	}
+	value, err = parseCutTime(s)
+	return value, false, err
+}
+
+// thumbnailPosition は -thumbnail-time の指定を出力の時刻(秒)に変換する
+// 負の秒数は末尾からの時刻とし、出力の範囲外の場合は範囲内に収める
+func thumbnailPosition(s string, duration float64) (float64, error) {
+	value, percent, err := parseThumbnailTime(s)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case percent:
+		value = duration * value / 100
+	case value < 0:
+		value += duration
+	}
+	// 末尾ちょうどではフレームを取り出せないため、最後のフレームの手前に収める
+	return math.Max(0, math.Min(value, duration-0.1)), nil
+}
+
+// generateThumbnail は出力動画の指定した時刻のフレームを画像として書き出す
+func generateThumbnail(output, path, at string, limits ResourceLimits) error {
+	duration, err := probeDuration(output)
+	if err != nil {
+		return err
+	}
+	position, err := thumbnailPosition(at, duration)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(
+		ffmpegPath,
+		"-v", "error",
+		"-ss", strconv.FormatFloat(position, 'f', 3, 64),
+		"-i", output,
+		"-frames:v", "1",
+		"-q:v", "2",
+		"-update", "1",
+		"-y",
+		path,
+	)
+	out, err := combinedOutputLimited(cmd, limits)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, out)
+	}
+	return nil
+}
+
+// generateContactSheet は出力動画の全体から等間隔に抜き出したフレームを、格子状に並べた1枚の画像として書き出す
+// 各コマは区間の中央のフレームとする
+func generateContactSheet(output, path string, opts ContactSheetOptions, limits ResourceLimits) error {
+	probe, err := probeVideo(output)
+	if err != nil {
+		return err
+	}
+	duration, err := probeDuration(output)
+	if err != nil {
+		return err
+	}
+	w, h := probe.DisplaySize()
+	// 高さは縦横比を保ち、エンコーダーが扱える偶数に丸める
+	height := int(math.Round(float64(opts.Width)*float64(h)/float64(w)/2)) * 2
+	interval := duration / float64(opts.Columns*opts.Rows)
+	cmd := exec.Command(
+		ffmpegPath,
+		"-v", "error",
+		"-ss", strconv.FormatFloat(interval/2, 'f', 3, 64),
+		"-i", output,
+		"-vf", fmt.Sprintf("fps=1/%f,scale=%d:%d,tile=%dx%d:padding=4:margin=4", interval, opts.Width, height, opts.Columns, opts.Rows),
+		"-frames:v", "1",
+		"-q:v", "2",
+		"-update", "1",
+		"-y",
+		path,
+	)
+	out, err := combinedOutputLimited(cmd, limits)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package concator
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// uniformTimescale はタイムベースを揃える際に使用するタイムスケール (MPEG-TSと同じ90kHz)
+const uniformTimescale = "90000"
+
+// hasMixedTimeBases は入力ファイルのビデオストリームのタイムベースが混在しているかを返す
+func hasMixedTimeBases(files []string) (bool, error) {
+	first := ""
+	for _, file := range files {
+		probe, err := probeVideo(file)
+		if err != nil {
+			return false, err
+		}
+		if first == "" {
+			first = probe.TimeBase
+			continue
+		}
+		if probe.TimeBase != first {
+			infof("タイムベースが混在しています: %s (%s)、最初のファイルは %s", file, probe.TimeBase, first)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// timescaleArgs は出力のタイムスケールを統一するための出力オプションを返す
+// -video_track_timescale はMP4/MOV系のmuxerのみが解釈する
+func timescaleArgs(outputFile string) []string {
+	switch strings.ToLower(filepath.Ext(outputFile)) {
+	case ".mp4", ".m4v", ".mov":
+		return []string{"-video_track_timescale", uniformTimescale}
+	default:
+		return nil
+	}
+}
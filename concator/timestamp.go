@@ -0,0 +1,98 @@
+package concator
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultTimestampFormat は -burn-timestamp で表示する日時の既定の書式 (strftime形式)
+const defaultTimestampFormat = "%Y-%m-%d %H:%M:%S"
+
+// recordingStart はクリップの録画を開始した日時を返す
+// メタデータの撮影日時 (creation_time) を優先し、記録されていない場合は
+// 書き込みが終わった時点である更新日時からクリップの長さを引いて求める
+func recordingStart(path string) (time.Time, error) {
+	t, err := probeCreationTime(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !t.IsZero() {
+		return t, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	d, err := probeDuration(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime().Add(-time.Duration(d * float64(time.Second))), nil
+}
+
+// setRecordingStarts は各エントリの録画開始日時を設定する
+// excludeに含まれるクリップ (オープニングなど) は日時を表示しないためゼロ値のままにする
+func setRecordingStarts(entries []ConcatEntry, exclude []string) error {
+	starts := make(map[string]time.Time)
+	for i := range entries {
+		path := entries[i].Path
+		if slices.Contains(exclude, path) {
+			continue
+		}
+		start, ok := starts[path]
+		if !ok {
+			var err error
+			if start, err = recordingStart(path); err != nil {
+				return fmt.Errorf("録画開始日時の取得に失敗しました: %s, %v", path, err)
+			}
+			starts[path] = start
+		}
+		entries[i].RecordedAt = start
+	}
+	return nil
+}
+
+// buildTimestampFilter は各クリップの区間に録画日時を焼き込むdrawtextフィルターを組み立てる
+// 日時はフレームの時刻から求めるため、クリップの区間ごとに出力の時刻との差をdrawtextに渡す
+func buildTimestampFilter(job EncodeJob) string {
+	// 各クリップが出力に現れる区間 (トランジションの重なりは次のクリップに含める)
+	starts := make([]float64, len(job.Entries)+1)
+	for i := range job.Entries {
+		starts[i+1] = starts[i]
+		if i < len(job.EntryDurations) {
+			starts[i+1] += job.EntryDurations[i]
+			if i < len(job.Entries)-1 && job.Transition != "" {
+				starts[i+1] -= job.TransitionDuration
+			}
+		}
+	}
+	var filters []string
+	for i, entry := range job.Entries {
+		if entry.RecordedAt.IsZero() {
+			continue
+		}
+		// 出力の時刻 t のフレームは、録画開始から inpoint + (t - 区間の開始) 秒後に撮影されたもの
+		epoch := float64(entry.RecordedAt.UnixNano())/1e9 + entry.Inpoint - starts[i]
+		filter := drawtextFilter(job, epoch)
+		if len(job.Entries) > 1 {
+			filter += fmt.Sprintf(":enable='gte(t,%.3f)*lt(t,%.3f)'", starts[i], starts[i+1])
+		}
+		filters = append(filters, filter)
+	}
+	return strings.Join(filters, ",")
+}
+
+// drawtextFilter はepochを起点としたフレームの日時を左上に表示するdrawtextフィルターを組み立てる
+func drawtextFilter(job EncodeJob, epoch float64) string {
+	// %{pts:localtime:起点:書式} の引数はコロンと } で区切られるため、書式の中ではエスケープする
+	format := strings.NewReplacer(`\`, `\\`, `:`, `\:`, `}`, `\}`).Replace(job.TimestampFormat)
+	text := fmt.Sprintf("%%{pts:localtime:%.3f:%s}", epoch, format)
+	filter := "drawtext=text=" + escapeFilterArg(text)
+	if job.TimestampFont != "" {
+		filter += ":fontfile=" + escapeFilterArg(job.TimestampFont)
+	}
+	return filter + ":fontsize=h/24:fontcolor=white:box=1:boxcolor=black@0.5:boxborderw=8:x=20:y=20"
+}
@@ -0,0 +1,266 @@
+package concator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTitleCardText は -title-card-text の既定の文字列
+const defaultTitleCardText = `{name}\n{date}`
+
+// defaultTitleCardDateFormat は -title-card-date-format の既定の書式 (strftime形式)
+const defaultTitleCardDateFormat = "%Y-%m-%d %H:%M"
+
+// TitleCard は各クリップの前に挿入するタイトルカードの設定
+type TitleCard struct {
+	Duration   float64 // 表示する秒数
+	Background string  // 背景色 (ffmpegの色の名前か #RRGGBB)、または背景にする画像ファイル
+	Text       string  // 表示する文字列 ({name}、{date}、{index} をクリップごとに置き換え、\n で改行する)
+	DateFormat string  // {date} の書式 (strftime形式)
+	Font       string  // フォントファイル (空の場合はffmpegの既定)
+	FontColor  string  // 文字の色
+}
+
+// validate は表示する秒数と文字列が正しく、必要なフィルターにffmpegが対応しているかを確認する
+func (c *TitleCard) validate() error {
+	if c.Duration <= 0 {
+		return fmt.Errorf("-title-card-duration には正の値を指定してください: %g", c.Duration)
+	}
+	if strings.TrimSpace(c.Text) == "" {
+		return errors.New("-title-card-text を空にすることはできません。")
+	}
+	if c.usesDate() && !isFFprobeAvailable() {
+		return errors.New("-title-card-text の {date} にはffprobeが必要です。")
+	}
+	if c.Font != "" {
+		if _, err := os.Stat(c.Font); err != nil {
+			return fmt.Errorf("-title-card-font のファイルを開けません: %v", err)
+		}
+	}
+	missing, err := checkFilters("drawtext")
+	if err != nil {
+		return err
+	}
+	if missing != "" {
+		return errors.New("-title-cards には drawtext フィルターに対応したffmpeg (libfreetype付きのビルド) が必要です。")
+	}
+	return nil
+}
+
+// usesDate は文字列にクリップの撮影日時を表示するかを返す
+func (c *TitleCard) usesDate() bool {
+	return strings.Contains(c.Text, "{date}")
+}
+
+// backgroundImage は背景に画像ファイルを使うかを返す
+func (c *TitleCard) backgroundImage() bool {
+	info, err := os.Stat(c.Background)
+	return err == nil && !info.IsDir()
+}
+
+// text はクリップの番号、ファイル名、撮影日時を埋め込んだタイトルカードの文字列を返す
+func (c *TitleCard) text(index int, path string, recordedAt time.Time) string {
+	date := ""
+	if !recordedAt.IsZero() {
+		date = formatStrftime(recordedAt, c.DateFormat)
+	}
+	return strings.NewReplacer(
+		`\n`, "\n",
+		"{index}", strconv.Itoa(index),
+		"{name}", strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		"{date}", date,
+	).Replace(c.Text)
+}
+
+// formatStrftime はstrftime形式の書式のうち、-timestamp-format と同じく日時の表示に使う指定子で日時を書式化する
+// 対応していない指定子はそのまま残す
+func formatStrftime(t time.Time, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'y':
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'b':
+			b.WriteString(t.Format("Jan"))
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+// titleCardKey はタイトルカードの文字列と設定、出力の形式から生成するファイルの名前を求める
+func (c *TitleCard) titleCardKey(text string, width, height, framerate int, hdr *ColorInfo) (string, error) {
+	h := sha256.New()
+	fmt.Fprintln(h, text, c.Duration, c.Background, c.Font, c.FontColor, width, height, framerate)
+	if c.backgroundImage() {
+		fp, err := contentFingerprint(c.Background)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(h, fp)
+	}
+	if hdr != nil {
+		fmt.Fprintln(h, hdr.Primaries, hdr.Transfer, hdr.Space)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32], nil
+}
+
+// titleCardFilter はタイトルカードの背景を出力の解像度に合わせ、文字列を中央に描くフィルターを組み立てる
+// HDRを保持して出力する場合は、SDRで描いたカードを出力と同じHDRの特性に変換する
+func (c *TitleCard) titleCardFilter(textFile string, width, height int, hdr *ColorInfo) string {
+	var filters []string
+	if c.backgroundImage() {
+		filters = append(filters, fmt.Sprintf("scale=%[1]d:%[2]d:force_original_aspect_ratio=increase,crop=%[1]d:%[2]d", width, height))
+	}
+	drawtext := "drawtext=textfile=" + escapeFilterArg(textFile) + ":expansion=none"
+	if c.Font != "" {
+		drawtext += ":fontfile=" + escapeFilterArg(c.Font)
+	}
+	drawtext += ":fontcolor=" + escapeFilterArg(c.FontColor) + ":fontsize=h/14:line_spacing=h/40:x=(w-text_w)/2:y=(h-text_h)/2"
+	filters = append(filters, "setsar=1", drawtext)
+	if hdr != nil {
+		// SDRの白が参照白 (203cd/m²) になるよう変換する
+		filters = append(filters, fmt.Sprintf("zscale=tin=bt709:pin=bt709:min=bt709:t=%s:p=%s:m=%s:npl=203,format=yuv420p10le", hdr.Transfer, hdr.Primaries, hdr.Space))
+	} else {
+		filters = append(filters, "format=yuv420p")
+	}
+	return strings.Join(filters, ",")
+}
+
+// generate はタイトルカードを無音の音声付きの動画ファイルとして書き出す
+func (c *TitleCard) generate(ctx context.Context, text, output string, width, height, framerate int, hdr *ColorInfo, limits ResourceLimits) error {
+	textFile := output + ".txt"
+	if err := os.WriteFile(textFile, []byte(text), 0o644); err != nil {
+		return err
+	}
+	defer os.Remove(textFile)
+
+	duration := strconv.FormatFloat(c.Duration, 'f', -1, 64)
+	var args []string
+	if c.backgroundImage() {
+		args = []string{"-loop", "1", "-framerate", strconv.Itoa(framerate), "-t", duration, "-i", c.Background}
+	} else {
+		args = []string{"-f", "lavfi", "-i", fmt.Sprintf("color=c=%s:s=%dx%d:r=%d:d=%s", c.Background, width, height, framerate, duration)}
+	}
+	// 8bitのカードは静止画のため、フレーム間の圧縮が効くmpeg4で、HDRの10bitのカードはffv1で書き出す
+	codecArgs := []string{"-c:v", "mpeg4", "-q:v", "2"}
+	if hdr != nil {
+		codecArgs = slices.Concat([]string{"-c:v", "ffv1"}, hdrColorTags(hdr))
+	}
+	// 中断時に不完全なファイルが残らないよう、一時的な名前で書き出してから名前を変更する
+	partial := output + ".partial.mkv"
+	cmd := newFFmpegCommand(ctx, slices.Concat(
+		[]string{"-hide_banner", "-nostats", "-loglevel", "error"},
+		args,
+		[]string{"-f", "lavfi", "-i", "anullsrc=r=48000:cl=stereo"},
+		[]string{"-vf", c.titleCardFilter(textFile, width, height, hdr), "-map", "0:v:0", "-map", "1:a:0", "-t", duration},
+		codecArgs,
+		[]string{"-c:a", "aac", "-b:a", "192k", "-y", partial},
+	)...)
+	if out, err := combinedOutputLimited(cmd, limits); err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("%v\n%s", err, strings.TrimSpace(string(out)))
+	}
+	return os.Rename(partial, output)
+}
+
+// insertTitleCards は各クリップの最初のエントリの前に、そのクリップのタイトルカードのエントリを挿入する
+// excludeに含まれるクリップ (イントロ・アウトロ) にはタイトルカードを付けない
+// 以降の処理でクリップの長さなどを確認できるよう、タイトルカードは挿入する時点で生成する (生成済みのカードは再利用する)
+func (j *Job) insertTitleCards(ctx context.Context, card *TitleCard, entries []ConcatEntry, exclude []string, hdr *ColorInfo) ([]ConcatEntry, error) {
+	width, height, err := parseResolution(j.Resolution)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for i, entry := range entries {
+		if slices.Contains(exclude, entry.Path) || (i > 0 && entries[i-1].Path == entry.Path) {
+			continue
+		}
+		paths = append(paths, entry.Path)
+	}
+	if len(paths) == 0 {
+		return entries, nil
+	}
+
+	dir := j.CacheDir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "video_concator-titlecards")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	infof("%d個のタイトルカードを作成中...", len(paths))
+	cards := make([]string, len(paths))
+	err = runParallel(len(paths), j.Jobs, func(i int) error {
+		name := filepath.Base(paths[i])
+		var recordedAt time.Time
+		if card.usesDate() {
+			var err error
+			if recordedAt, err = recordingStart(paths[i]); err != nil {
+				return fmt.Errorf("録画開始日時の取得に失敗しました: %s, %v", name, err)
+			}
+		}
+		text := card.text(i+1, paths[i], recordedAt)
+		key, err := card.titleCardKey(text, width, height, j.Framerate, hdr)
+		if err != nil {
+			return fmt.Errorf("%s のタイトルカードのハッシュの計算に失敗しました: %v", name, err)
+		}
+		cards[i] = filepath.Join(dir, "titlecard_"+key+".mkv")
+		if _, err := os.Stat(cards[i]); err == nil {
+			debugf("タイトルカードを再利用します: %s", name)
+			return nil
+		}
+		if err := card.generate(ctx, text, cards[i], width, height, j.Framerate, hdr, j.Limits); err != nil {
+			return fmt.Errorf("%s のタイトルカードの作成に失敗しました: %v", name, err)
+		}
+		debugf("タイトルカードを作成しました: %s", name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ConcatEntry
+	next := 0
+	for i, entry := range entries {
+		if next < len(paths) && entry.Path == paths[next] && (i == 0 || entries[i-1].Path != entry.Path) {
+			result = append(result, ConcatEntry{Path: cards[next], TitleCard: true})
+			next++
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package concator
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ffmpegPath と ffprobePath は実行するffmpeg・ffprobeのパス (名前のみの場合はPATHから探す)
+var (
+	ffmpegPath  = "ffmpeg"
+	ffprobePath = "ffprobe"
+)
+
+// minToolVersion はffmpeg・ffprobeに必要な最低のバージョン (-fps_mode は5.1で追加された)
+var minToolVersion = [2]int{5, 1}
+
+// SetToolPaths は実行するffmpeg・ffprobeのパスを設定する (空の場合は既定の名前をPATHから探す)
+// ffprobeを省略してffmpegをディレクトリ付きで指定した場合は、同じディレクトリのffprobeがあればそれを使う
+func SetToolPaths(ffmpeg, ffprobe string) {
+	ffmpegPath, ffprobePath = "ffmpeg", "ffprobe"
+	if ffmpeg != "" {
+		ffmpegPath = ffmpeg
+	}
+	if ffprobe != "" {
+		ffprobePath = ffprobe
+		return
+	}
+	if dir := filepath.Dir(ffmpeg); ffmpeg != "" && dir != "." {
+		// Windowsでは ffmpeg.exe に対して ffprobe.exe を探す
+		sibling := filepath.Join(dir, "ffprobe"+filepath.Ext(ffmpeg))
+		if _, err := exec.LookPath(sibling); err == nil {
+			ffprobePath = sibling
+		}
+	}
+}
+
+// toolVersionPattern は "-version" の1行目のバージョン番号 (例: "6.1.1-3ubuntu5"、"n7.0") に一致する
+// 開発版のビルド (例: "N-113000-g…"、"2024-03-11-git-…") は一致しない
+var toolVersionPattern = regexp.MustCompile(`^n?(\d{1,2})\.(\d+)`)
+
+// toolVersion はffmpeg・ffprobeの "-version" からバージョンの文字列と、解析できた場合はメジャー・マイナーの番号を返す
+func toolVersion(path string) (string, [2]int, bool, error) {
+	out, err := exec.Command(path, "-version").Output()
+	if err != nil {
+		return "", [2]int{}, false, err
+	}
+	// 1行目は "ffmpeg version 6.1.1-3ubuntu5 Copyright (c) …" の形式
+	firstLine, _, _ := strings.Cut(string(out), "\n")
+	fields := strings.Fields(firstLine)
+	if len(fields) < 3 || fields[1] != "version" {
+		return "", [2]int{}, false, nil
+	}
+	version := fields[2]
+	m := toolVersionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return version, [2]int{}, false, nil
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return version, [2]int{major, minor}, true, nil
+}
+
+// checkTool はffmpeg・ffprobe (name) が見つかり、必要なバージョンを満たしているかを確認する
+// 戻り値はバージョンの文字列 (分からない場合は空文字列)
+func checkTool(name, path string) (string, error) {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		if path == name {
+			return "", fmt.Errorf("%sが見つかりません。%sをインストールしてPATHに追加するか、-%s-path で指定してください (video_concator setup でダウンロードすることもできます)。", name, name, name)
+		}
+		return "", fmt.Errorf("%sが見つかりません: %s", name, path)
+	}
+	version, number, ok, err := toolVersion(resolved)
+	if err != nil {
+		return "", fmt.Errorf("%sのバージョンを確認できません: %s, %v", name, resolved, err)
+	}
+	if !ok {
+		// 開発版のビルドはバージョン番号を比較できないため、そのまま使う
+		debugf("%sのバージョンを判定できないため、確認を省略します: %s (%s)", name, resolved, version)
+		return version, nil
+	}
+	if number[0] < minToolVersion[0] || number[0] == minToolVersion[0] && number[1] < minToolVersion[1] {
+		return version, fmt.Errorf("%sのバージョンが古すぎます: %s (見つかったバージョン: %s、必要なバージョン: %d.%d以上)", name, resolved, version, minToolVersion[0], minToolVersion[1])
+	}
+	debugf("%s: %s (バージョン %s)", name, resolved, version)
+	return version, nil
+}
+
+// checkFFmpeg はffmpegが見つかり、必要なバージョンを満たしているかを確認する
+func checkFFmpeg() error {
+	_, err := checkTool("ffmpeg", ffmpegPath)
+	return err
+}
+
+// checkFFprobe はffprobeがある場合に、必要なバージョンを満たしているかを確認する
+// ffprobeが無い場合は、ffprobeを使う機能ごとに改めて確認するためエラーにしない
+func checkFFprobe() error {
+	if !isFFprobeAvailable() {
+		return nil
+	}
+	_, err := checkTool("ffprobe", ffprobePath)
+	return err
+}
@@ -0,0 +1,79 @@
+package concator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// transitionOverlap はトランジションでクリップ同士が重なり、出力が短くなる合計時間(秒)を返す
+func transitionOverlap(job EncodeJob) float64 {
+	if job.Transition == "" || len(job.Entries) < 2 {
+		return 0
+	}
+	return job.TransitionDuration * float64(len(job.Entries)-1)
+}
+
+// buildTransitionInputArgs はトランジションを使う場合の入力オプションを組み立てる
+// concat demuxerの代わりに各クリップを個別の入力とし、inpoint/outpointは -ss/-to で指定する
+func buildTransitionInputArgs(job EncodeJob) []string {
+	var args []string
+	for _, entry := range job.Entries {
+		args = append(args, job.InputArgs...)
+		if entry.Inpoint > 0 {
+			args = append(args, "-ss", strconv.FormatFloat(entry.Inpoint, 'f', 3, 64))
+		}
+		if entry.Outpoint > 0 {
+			args = append(args, "-to", strconv.FormatFloat(entry.Outpoint, 'f', 3, 64))
+		}
+		args = append(args, "-i", entry.Path)
+	}
+	return args
+}
+
+// buildTransitionFilter は隣り合うクリップをxfade/acrossfadeで重ねて結合するfilter_complexを組み立てる
+// 出力は映像が [vout]、音声が [aout] (NoAudioの場合は無し)
+func buildTransitionFilter(job EncodeJob) string {
+	// xfadeは全ての入力の解像度・フレームレート・ピクセルフォーマットが一致している必要がある
+	// GPUへのアップロードは全てのクリップを重ねた後に行う
+	scaleFilter := strings.TrimSuffix(job.VideoFilter, job.GPUArgs.FilterSuffix)
+	var chains []string
+	for i, entry := range job.Entries {
+		chains = append(chains, fmt.Sprintf("[%d:v:0]%s,setsar=1,format=yuv420p[v%d]", i, joinFilters(entry.VideoFilter, scaleFilter), i))
+		if !job.NoAudio {
+			audioFilter := joinFilters(entry.AudioFilter, job.AudioFilter)
+			if entry.Gain != 0 {
+				audioFilter = joinFilters(audioFilter, volumeFilter(entry.Gain))
+			}
+			if audioFilter == "" {
+				audioFilter = "anull"
+			}
+			chains = append(chains, fmt.Sprintf("[%d:a:0]%s[a%d]", i, audioFilter, i))
+		}
+	}
+
+	video, audio := "[v0]", "[a0]"
+	elapsed := 0.0
+	for i := 1; i < len(job.Entries); i++ {
+		// 直前までの出力の末尾でトランジションが終わるように開始位置を決める
+		elapsed += job.EntryDurations[i-1] - job.TransitionDuration
+		chains = append(chains, fmt.Sprintf("%s[v%d]xfade=transition=%s:duration=%.3f:offset=%.3f[xv%d]",
+			video, i, job.Transition, job.TransitionDuration, elapsed, i))
+		video = fmt.Sprintf("[xv%d]", i)
+		if !job.NoAudio {
+			chains = append(chains, fmt.Sprintf("%s[a%d]acrossfade=d=%.3f[xa%d]", audio, i, job.TransitionDuration, i))
+			audio = fmt.Sprintf("[xa%d]", i)
+		}
+	}
+
+	chains = append(chains, applyOverlays(video+"null"+job.GPUArgs.FilterSuffix, job)+"[vout]")
+	switch {
+	case job.Music != nil && job.NoAudio:
+		chains = append(chains, buildMusicFilter("", job))
+	case job.Music != nil:
+		chains = append(chains, buildMusicFilter(audio, job))
+	case !job.NoAudio:
+		chains = append(chains, fmt.Sprintf("%s%s[aout]", audio, joinFilters("anull", audioFadeFilter(job))))
+	}
+	return strings.Join(chains, ";")
+}
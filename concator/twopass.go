@@ -0,0 +1,91 @@
+package concator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// twoPassEncoders は2パスエンコードに対応しているエンコーダー
+// ハードウェアエンコーダーは別々の実行でパスログを引き継げないため対象外
+var twoPassEncoders = map[string]bool{
+	"libx264":    true,
+	"libx265":    true,
+	"libvpx":     true,
+	"libvpx-vp9": true,
+	"libaom-av1": true,
+}
+
+// dryRunPassLog は -dry-run の表示でパスログの代わりに使う名前
+const dryRunPassLog = "ffmpeg2pass"
+
+// targetSizeBitrate は出力を目標サイズに収めるための映像の平均ビットレート (bps) を求める
+// 音声のビットレートを差し引き、コンテナのオーバーヘッドの分として2%の余裕を持たせる
+func targetSizeBitrate(targetBytes int64, duration float64, audioBitrate int64) (int64, error) {
+	if duration <= 0 {
+		return 0, fmt.Errorf("出力の長さが分からないため、目標サイズからビットレートを求められません")
+	}
+	bitrate := int64(float64(targetBytes)*8*0.98/duration) - audioBitrate
+	if bitrate < 100_000 {
+		return 0, fmt.Errorf("-target-size が出力の長さ (%.1f秒) に対して小さすぎます (映像のビットレートが %dbps になります)", duration, bitrate)
+	}
+	return bitrate, nil
+}
+
+// passLogPrefix はパスログのファイル名の接頭辞を返す
+// x265は -x265-params の区切りに ":" を使うため、ドライブ名を含まないよう可能であれば作業ディレクトリからの相対パスにする
+func passLogPrefix(dir string) string {
+	prefix := filepath.Join(dir, "pass")
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, prefix); err == nil {
+			return rel
+		}
+	}
+	return prefix
+}
+
+// passArgs は2パスエンコードのpass回目のオプションを返す
+func passArgs(encoder string, pass int, prefix string) []string {
+	if encoder == "libx265" {
+		// ffmpegのlibx265は -pass を解釈しないため、x265のオプションとして渡す
+		return []string{"-x265-params", fmt.Sprintf("pass=%d:stats=%s.log", pass, filepath.ToSlash(prefix))}
+	}
+	return []string{"-pass", strconv.Itoa(pass), "-passlogfile", prefix}
+}
+
+// twoPassJobs は2パスエンコードの1パス目 (解析) と2パス目の設定を返す
+// 1パス目は映像の統計のみが必要なため、音声や付加情報は出力せずに破棄する
+func twoPassJobs(job EncodeJob, prefix string) (EncodeJob, EncodeJob) {
+	first := job
+	first.Pass, first.PassLogFile = 1, prefix
+	first.Output = os.DevNull
+	first.NoAudio, first.AudioCopy, first.Music = true, false, nil
+	first.Poster, first.PosterMode = "", ""
+	first.SubtitleCodec = ""
+	first.ChaptersFile = ""
+	first.Streaming = nil
+
+	second := job
+	second.Pass, second.PassLogFile = 2, prefix
+	return first, second
+}
+
+// runTwoPassEncode は解析のパスと本番のパスの2回に分けてエンコードする
+// パスログは一時ディレクトリに作成し、終了時に削除する
+func runTwoPassEncode(ctx context.Context, job EncodeJob) error {
+	dir, err := os.MkdirTemp("", "video_concator-pass-")
+	if err != nil {
+		return fmt.Errorf("パスログのディレクトリを作成できません: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	first, second := twoPassJobs(job, passLogPrefix(dir))
+	infof("1パス目 (解析) を実行中...")
+	if err := runEncode(ctx, first); err != nil {
+		return fmt.Errorf("1パス目のエンコードに失敗しました: %v", err)
+	}
+	infof("2パス目を実行中...")
+	return runEncode(ctx, second)
+}
@@ -0,0 +1,132 @@
+package concator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// minFrameRatio は期待されるフレーム数に対して出力に最低限必要なフレーム数の割合
+// ffmpegが正常終了しても、不正な入力により出力がほぼ空になる場合を検出するための閾値
+const minFrameRatio = 0.5
+
+// totalInputDuration は入力ファイルの長さの合計(秒)を返す
+func totalInputDuration(inputs []string) (float64, error) {
+	var total float64
+	for _, file := range inputs {
+		d, err := probeDuration(file)
+		if err != nil {
+			return 0, err
+		}
+		total += d
+	}
+	return total, nil
+}
+
+// countAvailableFrames は入力の合計時間と出力フレームレートから得られるフレーム数を返す
+func countAvailableFrames(inputs []string, framerate int) (int64, error) {
+	total, err := totalInputDuration(inputs)
+	if err != nil {
+		return 0, err
+	}
+	return int64(total * float64(framerate)), nil
+}
+
+// entryDurations はinpoint/outpointと再生速度を考慮したconcatリストの各エントリの出力上の長さ(秒)を返す
+func entryDurations(entries []ConcatEntry) ([]float64, error) {
+	durations := make([]float64, len(entries))
+	for i, entry := range entries {
+		end := entry.Outpoint
+		if end == 0 {
+			d, err := probeDuration(entry.Path)
+			if err != nil {
+				return nil, err
+			}
+			end = d
+		}
+		durations[i] = (end - entry.Inpoint) / entry.playbackSpeed()
+	}
+	return durations, nil
+}
+
+// entriesDuration はinpoint/outpointを考慮したconcatリストのエントリの長さの合計(秒)を返す
+func entriesDuration(entries []ConcatEntry) (float64, error) {
+	durations, err := entryDurations(entries)
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, d := range durations {
+		total += d
+	}
+	return total, nil
+}
+
+// outputDuration は出力の想定される長さ(秒)を返す
+// トランジションで重なる分を差し引き、総フレーム数が指定されている場合はその長さで打ち切る
+func outputDuration(job EncodeJob, framerate int) (float64, error) {
+	total, err := entriesDuration(job.Entries)
+	if err != nil {
+		return 0, err
+	}
+	total -= transitionOverlap(job)
+	if job.TotalFrames > 0 && framerate > 0 {
+		total = min(total, float64(job.TotalFrames)/float64(framerate))
+	}
+	return total, nil
+}
+
+// checkOutputFrames は出力ファイルのフレーム数がconcatリストの合計時間から見て妥当かを確認する
+// frameLimitが正の場合は -total-frames による上限として想定フレーム数に反映する
+// overlapはクリップ間のトランジションで重なり、出力が短くなる合計時間(秒)
+func checkOutputFrames(entries []ConcatEntry, output string, framerate int, frameLimit int64, overlap float64) error {
+	totalDuration, err := entriesDuration(entries)
+	if err != nil {
+		return err
+	}
+	totalDuration -= overlap
+
+	frames, err := probeFrameCount(output)
+	if err != nil {
+		return err
+	}
+	expected := int64(totalDuration * float64(framerate))
+	if frameLimit > 0 && frameLimit < expected {
+		expected = frameLimit
+	}
+	if frames == 0 || float64(frames) < float64(expected)*minFrameRatio {
+		return fmt.Errorf("出力のフレーム数が少なすぎます: %dフレーム (入力の合計 %.1f秒から約%dフレームを想定)", frames, totalDuration, expected)
+	}
+	return nil
+}
+
+// maxDecodeErrorLines は -verify でデコードのエラーとして表示する最大の行数
+const maxDecodeErrorLines = 5
+
+// verifyOutput は -verify として、出力の長さが入力から想定される長さと許容誤差の範囲で一致し、最後までエラー無くデコードできるかを確認する
+func verifyOutput(ctx context.Context, output string, expected, tolerance float64, limits ResourceLimits) error {
+	duration, err := probeDuration(output)
+	if err != nil {
+		return err
+	}
+	if math.Abs(duration-expected) > tolerance {
+		return fmt.Errorf("出力の長さが想定と異なります: %.2f秒 (入力から想定される長さは%.2f秒、許容誤差は%g秒)", duration, expected, tolerance)
+	}
+	// 出力を破棄して全てのストリームをデコードし、エラーが出力されないかを確認する
+	cmd := newFFmpegCommand(ctx,
+		"-hide_banner", "-nostats", "-v", "error",
+		"-i", output,
+		"-map", "0:v?", "-map", "0:a?",
+		"-f", "null", "-",
+	)
+	out, err := combinedOutputLimited(cmd, limits)
+	if err != nil {
+		return fmt.Errorf("出力のデコードに失敗しました: %v\n%s", err, strings.TrimSpace(string(out)))
+	}
+	if msg := strings.TrimSpace(string(out)); msg != "" {
+		lines := strings.Split(msg, "\n")
+		return fmt.Errorf("出力のデコード中に%d件のエラーが発生しました:\n%s", len(lines), strings.Join(lines[:min(len(lines), maxDecodeErrorLines)], "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package concator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// vfrThreshold は可変フレームレートとみなす、公称のフレームレートと平均フレームレートの差の割合
+// スマートフォンの録画では平均フレームレートが公称値から数%ずれる
+const vfrThreshold = 0.005
+
+// vfrAudioFilter は可変フレームレートの入力で、音声をタイムスタンプに合わせて伸縮・補完するフィルター
+// 映像のフレームの間隔が揺らいでも、結合後に音声が徐々にずれないようにする
+const vfrAudioFilter = "aresample=async=1000:first_pts=0"
+
+// parseFrameRate は "30000/1001" 形式のフレームレートを数値に変換する (不明な場合は0)
+func parseFrameRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// isVariableFrameRate はffprobeで動画ファイルが可変フレームレートかを判定する
+// 公称のフレームレート (r_frame_rate) と平均フレームレート (avg_frame_rate) の差で判定する
+func isVariableFrameRate(path string) (bool, error) {
+	out, err := exec.Command(
+		ffprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=r_frame_rate,avg_frame_rate",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return false, fmt.Errorf("ffprobeの実行に失敗しました: %s, %v", path, err)
+	}
+	var parsed struct {
+		Streams []struct {
+			RFrameRate   string `json:"r_frame_rate"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return false, fmt.Errorf("ffprobeの出力の解析に失敗しました: %s, %v", path, err)
+	}
+	if len(parsed.Streams) == 0 {
+		return false, nil
+	}
+	r := parseFrameRate(parsed.Streams[0].RFrameRate)
+	avg := parseFrameRate(parsed.Streams[0].AvgFrameRate)
+	if r <= 0 || avg <= 0 {
+		return false, nil
+	}
+	return math.Abs(r-avg)/r > vfrThreshold, nil
+}
+
+// detectVFRInputs は可変フレームレートの入力ファイルを返す
+func detectVFRInputs(files []string, jobs int) ([]string, error) {
+	vfr := make([]bool, len(files))
+	err := runParallel(len(files), jobs, func(i int) error {
+		var err error
+		vfr[i], err = isVariableFrameRate(files[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for i, file := range files {
+		if vfr[i] {
+			result = append(result, file)
+		}
+	}
+	return result, nil
+}
+
+// vfrOutputArgs は -vfr-policy に応じた出力のフレームの扱いのオプションを返す
+// cfr: fpsフィルターで揃えたフレームを一定の間隔で出力する
+// vsync-passthrough: 入力のタイムスタンプをそのまま使い、フレームの複製や間引きをしない
+func vfrOutputArgs(policy string) []string {
+	if policy == "vsync-passthrough" {
+		return []string{"-fps_mode", "passthrough"}
+	}
+	return []string{"-fps_mode", "cfr"}
+}
@@ -0,0 +1,101 @@
+package concator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// companionExtensions はGoProなどのカメラが動画と一緒に記録する付属ファイルの拡張子
+// .lrv (プレビュー用の低解像度の動画) と .thm (サムネイル) は結合する動画としては扱わない
+var companionExtensions = map[string]bool{
+	".lrv": true,
+	".thm": true,
+}
+
+// isCompanionFile はパスがカメラの付属ファイルかを返す
+func isCompanionFile(path string) bool {
+	return companionExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// isHiddenName はファイル名が隠しファイル (. で始まる名前) のものかを返す
+// macOSがFAT/exFATのSDカードに作る ._ で始まるファイルもこれに含まれる
+func isHiddenName(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// walkInputDir はroot以下のファイルとディレクトリを名前順にたどり、それぞれについてfnを呼び出す
+// relはrootからの相対パス (root自身は ".")。fnがディレクトリに対して filepath.SkipDir を返すと、その中はたどらない
+// filterの IncludeHidden が無い場合は隠しファイル・ディレクトリを、MaxDepth を超える深さのディレクトリはたどらない
+// FollowSymlinks の場合はディレクトリへのシンボリックリンクもたどる (同じディレクトリは1回のみ)。
+// ファイルへのシンボリックリンクは常にリンク先のファイルとして扱う
+func walkInputDir(root string, filter InputFilter, fn func(path, rel string, info os.FileInfo) error) error {
+	visited := map[string]bool{}
+	var walk func(path, rel string, info os.FileInfo, depth int) error
+	walk = func(path, rel string, info os.FileInfo, depth int) error {
+		if err := fn(path, rel, info); err != nil {
+			if info.IsDir() && err == filepath.SkipDir {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if filter.FollowSymlinks {
+			// シンボリックリンクが上位のディレクトリを指している場合に、無限にたどらないようにする
+			real, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				return err
+			}
+			if visited[real] {
+				debugf("既にたどったディレクトリのためスキップします: %s", path)
+				return nil
+			}
+			visited[real] = true
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !filter.IncludeHidden && isHiddenName(name) {
+				continue
+			}
+			child := filepath.Join(path, name)
+			childRel := name
+			if rel != "." {
+				childRel = filepath.Join(rel, name)
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				target, err := os.Stat(child)
+				if err != nil {
+					warnf("リンク先を開けないためスキップします: %s, %v", child, err)
+					continue
+				}
+				if target.IsDir() && !filter.FollowSymlinks {
+					continue
+				}
+				info = target
+			}
+			if info.IsDir() && filter.MaxDepth > 0 && depth+1 >= filter.MaxDepth {
+				continue
+			}
+			if err := walk(child, childRel, info, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	return walk(root, ".", info, 0)
+}
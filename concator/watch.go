@@ -0,0 +1,192 @@
+package concator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultWatchSettle は新しいファイルの書き込みが止まってから再結合するまでの待機時間
+const defaultWatchSettle = 10 * time.Second
+
+// outputSet は Watch の各実行で書き出した出力ファイルの絶対パスの集合
+// テンプレートや -orientation-groups、-renditions の出力は名前が実行時に決まるため、書き出す際に記録する
+// nilの場合は記録しない
+type outputSet struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+// add は出力ファイルのパスを記録する
+func (o *outputSet) add(paths ...string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, path := range paths {
+		if absPath, err := filepath.Abs(path); err == nil {
+			o.paths[absPath] = true
+		}
+	}
+}
+
+// contains はpathがこれまでに書き出した出力ファイルかを返す
+func (o *outputSet) contains(path string) bool {
+	if o == nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.paths[absPath]
+}
+
+// addWatchRecursive はdir以下の、filterのたどり方で検索するディレクトリを監視対象に追加する
+func addWatchRecursive(watcher *fsnotify.Watcher, dir string, filter InputFilter) error {
+	return walkInputDir(dir, filter, func(path, rel string, info os.FileInfo) error {
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// stableFiles は書き込みが終わっているファイルのみを返す
+func stableFiles(files []string) []string {
+	inUse, supported := findFilesOpenForWriting(files)
+	if !supported {
+		inUse = findGrowingFiles(files)
+	}
+	var stable []string
+	for _, file := range files {
+		if !inUse[file] {
+			stable = append(stable, file)
+		}
+	}
+	return stable
+}
+
+// Watch は一度結合を行った後も入力ディレクトリを監視し続け、新しい動画ファイルが現れて
+// 書き込みが終わるたびに出力を作り直す。ctxが取り消されるまで戻らない
+func (j *Job) Watch(ctx context.Context) error {
+	if (j.Dir == "" && len(j.Dirs) == 0) || j.Manifest != nil || j.ListFile != "" || len(j.Files) > 0 || j.Source != "" {
+		return errors.New("watch は -dir で入力ディレクトリを指定した場合のみ使用できます。")
+	}
+	if j.Describe || j.DryRun || j.Interactive {
+		return errors.New("watch は -describe、-dry-run、-interactive と同時に指定できません。")
+	}
+	settle := j.WatchSettle
+	if settle <= 0 {
+		settle = defaultWatchSettle
+	}
+	// 空のディレクトリから監視を始められるよう、動画ファイルが無い場合はエラーにしない
+	runJob := *j
+	runJob.OnEmpty = "skip"
+	runJob.written = &outputSet{paths: map[string]bool{}}
+	// 作り直すたびに同じ出力ファイルを上書きできるよう、既存の出力ファイルの扱いは監視を始める前に決める
+	// (テンプレートや向き・解像度ごとの出力は名前が実行時に決まるため、最初の実行で確認する)
+	fixedOutput := !isOutputTemplate(j.Output) && !j.OrientationGroups && j.Renditions == ""
+	if fixedOutput {
+		var err error
+		if runJob.Output, err = j.resolveOutputConflict(j.Output, []string{""}); err != nil {
+			return err
+		}
+		runJob.Overwrite, runJob.OutputSuffix = true, false
+	}
+	absOutput, err := filepath.Abs(runJob.Output)
+	if err != nil {
+		return err
+	}
+
+	filter, err := j.inputFilter()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	dirs, _ := j.searchInputs()
+	for _, dir := range dirs {
+		if err := addWatchRecursive(watcher, dir, filter); err != nil {
+			return err
+		}
+	}
+
+	if err := runJob.Run(ctx); err != nil {
+		return err
+	}
+	if !fixedOutput {
+		// 作り直す際は、確認せずに出力ファイルを上書きする
+		runJob.Overwrite, runJob.OutputSuffix = true, false
+	}
+	infof("ディレクトリ '%s' を監視しています...", strings.Join(dirs, "', '"))
+
+	pending := map[string]bool{}
+	timer := time.NewTimer(settle)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-watcher.Errors:
+			warnf("ディレクトリの監視中にエラーが発生しました: %v", err)
+		case ev := <-watcher.Events:
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if !filter.IncludeHidden && isHiddenName(filepath.Base(ev.Name)) {
+						continue
+					}
+					if err := addWatchRecursive(watcher, ev.Name, filter); err != nil {
+						warnf("ディレクトリを監視できません: %s, %v", ev.Name, err)
+					}
+					continue
+				}
+			}
+			if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+				continue
+			}
+			if !isVideoFile(ev.Name) || (!filter.IncludeHidden && isHiddenName(filepath.Base(ev.Name))) {
+				continue
+			}
+			// 自身の出力ファイルの書き込みで再結合しない
+			if path, err := filepath.Abs(ev.Name); err != nil || matchesOutput(absOutput, path) {
+				continue
+			}
+			pending[ev.Name] = true
+			timer.Reset(settle)
+		case <-timer.C:
+			var files []string
+			for file := range pending {
+				files = append(files, file)
+			}
+			if len(stableFiles(files)) < len(files) {
+				// 書き込み中のファイルがあれば、終わるまで待つ
+				timer.Reset(settle)
+				continue
+			}
+			pending = map[string]bool{}
+			infof("%d個の新しい動画ファイルを検出したため、出力を作り直します。", len(files))
+			if err := runJob.Run(ctx); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				// 一時的な失敗で監視を止めないよう、エラーを表示して次の変更を待つ
+				warnf("結合に失敗しました: %v", err)
+			}
+			infof("ディレクトリ '%s' を監視しています...", strings.Join(dirs, "', '"))
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package concator
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Watermark は出力の全体に重ねるロゴ画像の設定
+type Watermark struct {
+	Path     string
+	Position string  // top-left, top-right, bottom-left, bottom-right, center
+	Opacity  float64 // 0より大きく1以下 (1の場合は画像のまま)
+	Margin   int     // 画面の端からの余白 (ピクセル)
+}
+
+// watermarkPositions は -watermark-position に指定できる値と、overlayフィルターの座標の対応
+// %[1]d には余白が入る
+var watermarkPositions = map[string]string{
+	"top-left":     "x=%[1]d:y=%[1]d",
+	"top-right":    "x=W-w-%[1]d:y=%[1]d",
+	"bottom-left":  "x=%[1]d:y=H-h-%[1]d",
+	"bottom-right": "x=W-w-%[1]d:y=H-h-%[1]d",
+	"center":       "x=(W-w)/2:y=(H-h)/2",
+}
+
+// validate はロゴ画像が存在し、位置と不透明度が正しいかを確認する
+func (w *Watermark) validate() error {
+	if _, ok := watermarkPositions[w.Position]; !ok {
+		return fmt.Errorf("-watermark-position が正しくありません: %s (top-left, top-right, bottom-left, bottom-right, center のいずれか)", w.Position)
+	}
+	if w.Opacity <= 0 || w.Opacity > 1 {
+		return fmt.Errorf("-watermark-opacity には0より大きく1以下の値を指定してください: %g", w.Opacity)
+	}
+	if w.Margin < 0 {
+		return fmt.Errorf("-watermark-margin には0以上の値を指定してください: %d", w.Margin)
+	}
+	info, err := os.Stat(w.Path)
+	if err != nil {
+		return fmt.Errorf("ロゴ画像が見つかりません: %s, %v", w.Path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("ロゴ画像にディレクトリは指定できません: %s", w.Path)
+	}
+	return nil
+}
+
+// filter はinputのラベルの映像にロゴを重ねるフィルターを組み立てる
+// ロゴは movie フィルターで読み込むため、ffmpegの入力を増やさずに済む
+func (w *Watermark) filter(input string) string {
+	logo := "movie=" + escapeFilterArg(w.Path) + ",format=rgba"
+	if w.Opacity < 1 {
+		logo += fmt.Sprintf(",colorchannelmixer=aa=%g", w.Opacity)
+	}
+	position := fmt.Sprintf(watermarkPositions[w.Position], w.Margin)
+	return fmt.Sprintf("%s[wm];%s[wm]overlay=%s", logo, input, position)
+}
+
+// applyOverlays は映像のフィルターの末尾で字幕、録画日時、ロゴを重ね、出力の先頭と末尾をフェードさせる
+// GPUへのアップロードより前に重ねる必要があるため、FilterSuffixを付け直す
+func applyOverlays(videoFilter string, job EncodeJob) string {
+	burn := job.BurnSubtitles && job.SubtitleFile != ""
+	fade := videoFadeFilter(job)
+	if job.Watermark == nil && job.TimestampFormat == "" && !burn && fade == "" {
+		return videoFilter
+	}
+	suffix := job.GPUArgs.FilterSuffix
+	filter := strings.TrimSuffix(videoFilter, suffix)
+	if burn {
+		filter += "," + subtitlesBurnFilter(job.SubtitleFile)
+	}
+	if job.TimestampFormat != "" {
+		if ts := buildTimestampFilter(job); ts != "" {
+			filter += "," + ts
+		}
+	}
+	if job.Watermark != nil {
+		filter += "[wmbase];" + job.Watermark.filter("[wmbase]")
+	}
+	if fade != "" {
+		// ロゴなども含めた画面全体をフェードさせる
+		filter += "," + fade
+	}
+	return filter + suffix
+}
+
+// escapeFilterArg はフィルターの引数に埋め込む文字列をエスケープする
+// 引数の区切り (:) と、フィルターグラフの区切り (, ; [ ]) の2段階をエスケープする
+func escapeFilterArg(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `,`, `\,`, `;`, `\;`, `[`, `\[`, `]`, `\]`).Replace(s)
+}
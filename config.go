@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig は設定ファイルを読み込み、フラグ名と値の対応を返す
+// 拡張子が .toml の場合はTOML、それ以外はYAMLとして解析する
+func loadConfig(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]any{}
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		err = toml.Unmarshal(data, &raw)
+	} else {
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("設定ファイルの解析に失敗しました: %s, %v", path, err)
+	}
+	return flagValues(raw, "設定ファイル")
+}
+
+// flagValues は設定ファイルやリクエストから読み込んだ値を、フラグ名と値の文字列の対応に変換する
+func flagValues(raw map[string]any, source string) (map[string]string, error) {
+	values := map[string]string{}
+	for name, v := range raw {
+		switch v.(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("%sの %s には文字列・数値・真偽値を指定してください", source, name)
+		}
+		values[name] = fmt.Sprint(v)
+	}
+	return values, nil
+}
+
+// setFlagNames はコマンドラインで明示的に指定されたフラグ名の一覧を返す
+func setFlagNames(fs *flag.FlagSet) map[string]bool {
+	names := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { names[f.Name] = true })
+	return names
+}
+
+// applyFlagValues はフラグ名と値の対応をフラグに設定する
+// skipに含まれるフラグ (コマンドラインで指定されたものなど) は変更しない
+func applyFlagValues(fs *flag.FlagSet, values map[string]string, skip map[string]bool, source string) error {
+	for name, value := range values {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%sに不明なオプションがあります: %s", source, name)
+		}
+		if skip[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%sのオプション %s の値が正しくありません: %v", source, name, err)
+		}
+	}
+	return nil
+}
+
+// dumpConfig は現在有効なオプションを設定ファイルとして読み込めるYAML形式で書き出す
+func dumpConfig(fs *flag.FlagSet, w io.Writer) error {
+	values := map[string]any{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		v := f.Value.(flag.Getter).Get()
+		if d, ok := v.(time.Duration); ok {
+			v = d.String()
+		}
+		values[f.Name] = v
+	})
+	// マップのキーは名前順に出力される
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -1,3 +1,10 @@
 module github.com/rkun123/video_concator
 
 go 1.25.0
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/fsnotify/fsnotify v1.9.0
+	golang.org/x/sys v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
+)
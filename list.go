@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/rkun123/video_concator/concator"
+)
+
+// newListFlags は list サブコマンドのフラグを定義する
+func newListFlags() (*flag.FlagSet, *concator.Job) {
+	job := concator.NewJob()
+	fs := newCommandFlags("list", "[オプション] [動画ファイルまたはディレクトリ...]")
+	bindInputFlags(fs, job)
+	bindCommonFlags(fs)
+	return fs, job
+}
+
+// runList は結合する入力ファイルを結合する順に1行に1つずつ表示する
+// 出力はそのまま -list のプレイリストとして使える
+func runList(args []string) {
+	fs, job := newListFlags()
+	fs.Parse(args)
+	applyCommonFlags()
+	job.Files = fs.Args()
+	checkInputFlags(fs, job, false)
+
+	files, err := job.Inputs(context.Background())
+	if err != nil {
+		fatalf("エラー: %v", err)
+	}
+	for _, file := range files {
+		fmt.Println(file)
+	}
+}
@@ -1,181 +1,157 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
-	"sort"
 	"strings"
-	"time"
+
+	"github.com/rkun123/video_concator/concator"
 )
 
-// VideoInfo は動画ファイルの情報を格納する構造体
-type VideoInfo struct {
-	Path    string
-	ModTime time.Time
+// exitInterrupted はシグナルにより中断した場合の終了コード (128 + SIGINT)
+const exitInterrupted = 130
+
+// command はサブコマンドの定義
+type command struct {
+	name     string
+	summary  string
+	newFlags func() *flag.FlagSet // サブコマンドのフラグ (シェル補完の生成にも使う)
+	run      func(args []string)
 }
 
-func main() {
-	// コマンドライン引数を定義
-	inputDir := flag.String("dir", "", "動画ファイルが含まれるディレクトリ (必須)")
-	outputFile := flag.String("output", "", "出力ファイル名 (必須)")
-	resolution := flag.String("resolution", "1920x1080", "解像度 (例: 1920x1080)")
-	framerate := flag.Int("framerate", 60, "フレームレート")
-	encoder := flag.String("encoder", "", "ビデオエンコーダー (デフォルトはOSに応じて自動選択)")
-	flag.Parse()
-
-	// 必須引数のチェック
-	if *inputDir == "" || *outputFile == "" {
-		fmt.Println("エラー: -dir と -output は必須です。")
-		flag.Usage()
-		os.Exit(1)
+// commands はサブコマンドの一覧 (helpから参照するため、initで設定する)
+var commands []command
+
+func init() {
+	commands = []command{
+		{"concat", "動画ファイルを結合する (サブコマンドを省略した場合の動作)", func() *flag.FlagSet { fs, _ := newConcatFlags("concat"); return fs }, runConcat},
+		{"watch", "結合後も -dir を監視し、新しい動画ファイルの書き込みが終わるたびに出力を作り直す", func() *flag.FlagSet { fs, _ := newConcatFlags("watch"); return fs }, runWatch},
+		{"probe", "入力ファイルの長さ・解像度・フレームレート・コーデックなどを表示し、-copy で結合できるかを確認する", func() *flag.FlagSet { fs, _ := newProbeFlags(); return fs }, runProbe},
+		{"list", "結合する入力ファイルを結合する順に表示する", func() *flag.FlagSet { fs, _ := newListFlags(); return fs }, runList},
+		{"queue", "ジョブファイルに記述した複数の結合ジョブを並列に実行し、結果をまとめて表示する", func() *flag.FlagSet { fs, _ := newQueueFlags(); return fs }, runQueue},
+		{"serve", "結合ジョブを登録・確認・中止・ダウンロードできるHTTP APIのサーバーを起動する", func() *flag.FlagSet { fs, _ := newServeFlags(); return fs }, runServe},
+		{"config", "設定ファイル・レシピ・コマンドラインを反映した有効な設定を表示する", func() *flag.FlagSet { fs, _ := newConcatFlags("config"); return fs }, runConfig},
+		{"setup", "静的ビルドのffmpeg・ffprobeをダウンロードし、ffmpegが見つからない場合に使うようにする", func() *flag.FlagSet { fs, _ := newSetupFlags(); return fs }, runSetup},
+		{"completion", "シェル補完のスクリプトを出力する (bash, zsh, fish)", func() *flag.FlagSet { return newCompletionFlags() }, runCompletion},
+		{"help", "コマンドの一覧、またはコマンドの使い方を表示する", func() *flag.FlagSet { return flag.NewFlagSet("help", flag.ExitOnError) }, runHelp},
 	}
+}
 
-	// ffmpegコマンドの存在を確認
-	if !isFFmpegAvailable() {
-		log.Fatal("エラー: ffmpegが見つかりません。ffmpegをインストールし、PATHに追加してください。")
+// findCommand は名前に対応するサブコマンドを返す。見つからない場合はnilを返す
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
 	}
+	return nil
+}
 
-	// 1. ディレクトリ内の動画ファイルを検索し、日付順にソート
-	log.Println("動画ファイルを検索中...")
-	videoFiles, err := findAndSortVideos(*inputDir)
-	if err != nil {
-		log.Fatalf("動画ファイルの検索に失敗しました: %v", err)
-	}
-	if len(videoFiles) == 0 {
-		log.Fatalf("ディレクトリ '%s' に動画ファイルが見つかりませんでした。", *inputDir)
+// newCommandFlags はサブコマンド用のフラグセットを作成する
+func newCommandFlags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "使い方: video_concator %s %s\n\nオプション:\n", name, usage)
+		fs.PrintDefaults()
 	}
-	log.Printf("%d個の動画ファイルが見つかりました。\n", len(videoFiles))
+	return fs
+}
 
-	// 2. ffmpegのconcat demuxer用のリストファイルを作成
-	listFilePath, err := createConcatListFile(videoFiles)
-	if err != nil {
-		log.Fatalf("結合リストファイルの作成に失敗しました: %v", err)
-	}
-	// プログラム終了時にリストファイルを削除
-	defer os.Remove(listFilePath)
+// logOptions はログの出力の設定 (各サブコマンドで共通)
+var logOptions = concator.LogOptions{Format: "text"}
 
-	// 3. エンコーダーを決定
-	chosenEncoder := *encoder
-	if chosenEncoder == "" {
-		chosenEncoder = getDefaultEncoder()
-	}
-	log.Printf("使用するエンコーダー: %s\n", chosenEncoder)
-
-	// 4. ffmpegコマンドを組み立てて実行
-	log.Println("動画の結合とエンコードを開始します...")
-	cmd := exec.Command(
-		"ffmpeg",
-		"-f", "concat", // concat demuxerを使用
-		"-safe", "0", // 絶対パスを許可
-		"-i", listFilePath, // 入力リストファイル
-		"-vf", fmt.Sprintf("scale=%s,fps=%d", *resolution, *framerate), // 解像度とフレームレートを設定
-		"-c:v", chosenEncoder, // ビデオエンコーダー
-		"-c:a", "aac", // 音声コーデック（再エンコード）
-		"-b:a", "192k", // 音声ビットレート
-		"-y", // 出力ファイルを上書き
-		*outputFile,
-	)
-
-	// ffmpegの標準出力と標準エラー出力をコンソールに表示
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err = cmd.Run()
-	if err != nil {
-		log.Fatalf("ffmpegの実行に失敗しました: %v", err)
-	}
+// ffmpegPath と ffprobePath は実行するffmpeg・ffprobeのパス (各サブコマンドで共通)
+var ffmpegPath, ffprobePath = os.Getenv("FFMPEG_PATH"), os.Getenv("FFPROBE_PATH")
 
-	log.Printf("処理が完了しました。出力ファイル: %s\n", *outputFile)
-}
+// autoInstallFFmpeg はffmpegが見つからない場合にダウンロードするか
+var autoInstallFFmpeg bool
 
-// isFFmpegAvailable はffmpegコマンドが利用可能かを確認する
-func isFFmpegAvailable() bool {
-	_, err := exec.LookPath("ffmpeg")
-	return err == nil
+// bindCommonFlags はログの出力とffmpegのパスに関するフラグを定義する
+func bindCommonFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&logOptions.Verbose, "verbose", logOptions.Verbose, "詳細なログを表示する。ffmpegのログも全て表示する")
+	fs.BoolVar(&logOptions.Quiet, "quiet", logOptions.Quiet, "警告とエラーのみを表示する (進捗も表示しない)")
+	fs.StringVar(&logOptions.File, "log-file", logOptions.File, "ログを標準エラー出力の代わりに書き込むファイル (追記する)")
+	fs.StringVar(&logOptions.Format, "log-format", logOptions.Format, "ログの形式 (text, json: 1行に1つのJSON)")
+	fs.StringVar(&ffmpegPath, "ffmpeg-path", ffmpegPath, "使用するffmpegのパス (省略時は環境変数 FFMPEG_PATH、空の場合はPATHから探す)")
+	fs.BoolVar(&autoInstallFFmpeg, "auto-install-ffmpeg", autoInstallFFmpeg, "ffmpegが見つからない場合に、静的ビルドのffmpegをダウンロードして使う (video_concator setup と同じ)")
+	fs.StringVar(&ffprobePath, "ffprobe-path", ffprobePath, "使用するffprobeのパス (省略時は環境変数 FFPROBE_PATH、空の場合は -ffmpeg-path と同じディレクトリかPATHから探す)")
 }
 
-// findAndSortVideos は指定されたディレクトリ内の動画ファイルを検索し、更新日時順にソートする
-func findAndSortVideos(dir string) ([]string, error) {
-	var videos []VideoInfo
-	supportedExtensions := map[string]bool{
-		".mp4": true,
-		".mov": true,
-		".mkv": true,
-		".avi": true,
+// applyCommonFlags はフラグで指定されたログの出力とffmpegのパスを設定する
+func applyCommonFlags() {
+	if err := concator.SetupLogging(logOptions); err != nil {
+		fatalf("エラー: %v", err)
 	}
-
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			ext := strings.ToLower(filepath.Ext(path))
-			if supportedExtensions[ext] {
-				videos = append(videos, VideoInfo{Path: path, ModTime: info.ModTime()})
-			}
+	concator.SetToolPaths(ffmpegPath, ffprobePath)
+	// パスを指定していない場合は、PATHに無ければ setup でダウンロードしたffmpegを使う
+	if ffmpegPath == "" {
+		if err := concator.UseManagedFFmpeg(context.Background(), autoInstallFFmpeg); err != nil {
+			fatalf("エラー: %v", err)
 		}
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
 	}
+}
 
-	// ModTime（更新日時）でソート
-	sort.Slice(videos, func(i, j int) bool {
-		return videos[i].ModTime.Before(videos[j].ModTime)
-	})
+// infof は通常のログを出力する
+func infof(format string, args ...any) {
+	slog.Info(fmt.Sprintf(format, args...))
+}
 
-	var sortedPaths []string
-	for _, v := range videos {
-		absPath, err := filepath.Abs(v.Path)
-		if err != nil {
-			return nil, fmt.Errorf("絶対パスの取得に失敗しました: %s, %v", v.Path, err)
-		}
-		sortedPaths = append(sortedPaths, absPath)
-	}
+// warnf は警告を出力する
+func warnf(format string, args ...any) {
+	slog.Warn(fmt.Sprintf(format, args...))
+}
 
-	return sortedPaths, nil
+// fatalf はエラーを出力して終了する (-quiet の場合も表示する)
+func fatalf(format string, args ...any) {
+	slog.Error(strings.TrimPrefix(fmt.Sprintf(format, args...), "エラー: "))
+	os.Exit(1)
 }
 
-// createConcatListFile はffmpegのconcat demuxerが読み込むための一時的なリストファイルを作成する
-func createConcatListFile(files []string) (string, error) {
-	tempFile, err := os.CreateTemp("", "concat-list-*.txt")
-	if err != nil {
-		return "", err
+// printCommands はサブコマンドの一覧を表示する
+func printCommands() {
+	fmt.Fprintln(os.Stderr, "使い方: video_concator <コマンド> [オプション]")
+	fmt.Fprintln(os.Stderr, "\nコマンド:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", cmd.name, cmd.summary)
 	}
-	defer tempFile.Close()
-
-	writer := bufio.NewWriter(tempFile)
-	for _, file := range files {
-		// パスに含まれるシングルクォートをエスケープ
-		escapedPath := strings.ReplaceAll(file, "'", "'\\''")
-		// file 'path' というフォーマットで書き込む
-		_, err := writer.WriteString(fmt.Sprintf("file '%s'\n", escapedPath))
-		if err != nil {
-			return "", err
-		}
+	fmt.Fprintln(os.Stderr, "\n各コマンドのオプションは video_concator help <コマンド> で表示できます。")
+}
+
+// runHelp はコマンドの一覧、または指定したコマンドの使い方を表示する
+func runHelp(args []string) {
+	if len(args) == 0 {
+		printCommands()
+		return
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fatalf("エラー: 不明なコマンドです: %s", args[0])
 	}
-	writer.Flush()
-	return tempFile.Name(), nil
+	cmd.newFlags().Usage()
 }
 
-// getDefaultEncoder は実行中のOSに基づいてデフォルトのエンコーダーを返す
-func getDefaultEncoder() string {
-	switch runtime.GOOS {
-	case "windows":
-		// NVIDIA GPUが存在するかどうかを簡易的にチェックすることも可能だが、
-		// まずはhevc_nvencを試し、失敗したらffmpegがエラーを返すというアプローチがシンプル。
-		return "hevc_nvenc"
-	case "darwin": // macOS
-		return "hevc_videotoolbox"
-	default: // Linuxなど
-		return "libx265"
+func main() {
+	// フラグを解析するまでは既定の設定でログを出力する
+	applyCommonFlags()
+	args := os.Args[1:]
+	// サブコマンドを省略した場合や、先頭がオプションの場合は concat として扱う
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		runConcat(args)
+		return
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		// 以前のように動画ファイルを直接並べた場合も結合する
+		if _, err := os.Stat(args[0]); err == nil {
+			runConcat(args)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "エラー: 不明なコマンドです: %s\n\n", args[0])
+		printCommands()
+		os.Exit(2)
 	}
+	cmd.run(args[1:])
 }
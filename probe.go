@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rkun123/video_concator/concator"
+)
+
+// probeOptions は probe サブコマンドのオプション
+type probeOptions struct {
+	job      *concator.Job
+	jsonMode bool
+}
+
+// newProbeFlags は probe サブコマンドのフラグを定義する
+func newProbeFlags() (*flag.FlagSet, *probeOptions) {
+	o := &probeOptions{job: concator.NewJob()}
+	fs := newCommandFlags("probe", "[オプション] [動画ファイルまたはディレクトリ...]")
+	bindInputFlags(fs, o.job)
+	fs.BoolVar(&o.jsonMode, "json", false, "結果をJSON形式で出力する")
+	bindCommonFlags(fs)
+	return fs, o
+}
+
+// runProbe は入力ファイルを結合する順にffprobeで調べ、結果を表示する
+func runProbe(args []string) {
+	fs, o := newProbeFlags()
+	fs.Parse(args)
+	applyCommonFlags()
+	o.job.Files = fs.Args()
+	checkInputFlags(fs, o.job, false)
+
+	files, err := o.job.Inputs(context.Background())
+	if err != nil {
+		fatalf("エラー: %v", err)
+	}
+	infos := []*concator.MediaInfo{}
+	for _, file := range files {
+		info, err := concator.Probe(file)
+		if err != nil {
+			fatalf("エラー: %v", err)
+		}
+		infos = append(infos, info)
+	}
+
+	copyable := concator.CompareInputs(infos)
+
+	if o.jsonMode {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(infos); err != nil {
+			fatalf("エラー: %v", err)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ファイル\t長さ\t解像度\tフレームレート\t映像\t音声\t字幕\t問題")
+	problems := 0
+	for _, info := range infos {
+		if info.Problem != "" {
+			problems++
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\t-\t%s\n", info.Path, info.Problem)
+			continue
+		}
+		audio := "なし"
+		if info.Audio != nil {
+			audio = fmt.Sprintf("%s %s %dHz", info.Audio.Codec, info.Audio.ChannelLayout, info.Audio.SampleRate)
+		}
+		subtitles := "なし"
+		if len(info.Subtitles) > 0 {
+			subtitles = fmt.Sprint(info.Subtitles)
+		}
+		framerate := "不明"
+		if info.Framerate > 0 {
+			framerate = strconv.FormatFloat(math.Round(info.Framerate*100)/100, 'f', -1, 64)
+			if info.VFR {
+				framerate += " (可変)"
+			}
+		}
+		notes := "-"
+		if len(info.Mismatches) > 0 {
+			notes = "先頭と異なる: " + strings.Join(info.Mismatches, "、")
+		}
+		fmt.Fprintf(w, "%s\t%.2f秒\t%dx%d\t%s\t%s %s\t%s\t%s\t%s\n",
+			info.Path, info.Duration, info.Width, info.Height, framerate, info.VideoCodec, info.PixFmt, audio, subtitles, notes)
+	}
+	w.Flush()
+
+	fmt.Println()
+	switch {
+	case problems > 0:
+		fmt.Printf("%d個のファイルは結合できません。\n", problems)
+	case !copyable:
+		fmt.Println("ストリーム構成が先頭のファイルと異なる入力があるため、-copy では結合できません (再エンコードが必要です)。")
+	default:
+		fmt.Println("全ての入力のストリーム構成が一致しているため、-copy で再エンコードせずに結合できます。")
+	}
+}
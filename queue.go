@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// queueOptions は queue サブコマンドのオプション
+type queueOptions struct {
+	concurrency int
+	logDir      string
+}
+
+// queueJob はジョブファイルに記述した1つの結合ジョブ
+type queueJob struct {
+	name    string
+	args    []string // concat サブコマンドに渡す引数
+	logPath string
+
+	state    string // 成功、失敗、中断、未実行
+	err      error
+	elapsed  time.Duration
+	finished bool
+}
+
+// queueFile はジョブファイルの構造体
+// 各ジョブは設定ファイルと同じオプション名と値の対応で、name (表示名) と files (動画ファイルの配列) も指定できる
+type queueFile struct {
+	Jobs []map[string]any `yaml:"jobs" toml:"jobs"`
+}
+
+// queueStopTimeout は中断時に実行中のジョブへ終了を要求してから強制終了するまでの待機時間
+// ジョブ側でffmpegの終了を待つ時間より長くする
+const queueStopTimeout = 30 * time.Second
+
+// newQueueFlags は queue サブコマンドのフラグを定義する
+func newQueueFlags() (*flag.FlagSet, *queueOptions) {
+	o := &queueOptions{}
+	fs := newCommandFlags("queue", "[オプション] <ジョブファイル>")
+	fs.IntVar(&o.concurrency, "concurrency", 1, "同時に実行するジョブの数")
+	fs.StringVar(&o.logDir, "log-dir", "queue-logs", "ジョブごとのログを書き出すディレクトリ")
+	bindCommonFlags(fs)
+	return fs, o
+}
+
+// loadQueueJobs はジョブファイルを読み込み、各ジョブの concat サブコマンドの引数を組み立てる
+// 拡張子が .toml の場合はTOML ([[jobs]] の配列)、それ以外はYAML (jobs: のリスト) として解析する
+// ログとffmpegのパスは全てのジョブで共通のため、ジョブごとには指定できない (commonArgsを各ジョブの引数の前に付ける)
+func loadQueueJobs(path string, commonArgs []string) ([]*queueJob, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var qf queueFile
+	if strings.ToLower(filepath.Ext(path)) == ".toml" {
+		err = toml.Unmarshal(data, &qf)
+	} else {
+		err = yaml.Unmarshal(data, &qf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ジョブファイルの解析に失敗しました: %s, %v", path, err)
+	}
+	if len(qf.Jobs) == 0 {
+		return nil, fmt.Errorf("ジョブファイルにジョブがありません: %s", path)
+	}
+
+	// 共通のフラグの名前を調べるためのみに使い、値は設定しない
+	common := flag.NewFlagSet("", flag.ContinueOnError)
+	bindCommonFlags(common)
+
+	var jobs []*queueJob
+	for i, settings := range qf.Jobs {
+		job := &queueJob{name: fmt.Sprintf("job%d", i+1)}
+		raw := map[string]any{}
+		var files []string
+		for key, v := range settings {
+			switch key {
+			case "name":
+				job.name = fmt.Sprint(v)
+			case "files":
+				list, ok := v.([]any)
+				if !ok {
+					return nil, fmt.Errorf("ジョブ %d の files には動画ファイルのパスの配列を指定してください", i+1)
+				}
+				for _, item := range list {
+					files = append(files, fmt.Sprint(item))
+				}
+			default:
+				raw[key] = v
+			}
+		}
+		values, err := flagValues(raw, fmt.Sprintf("ジョブ %d ", i+1))
+		if err != nil {
+			return nil, err
+		}
+		// 実行前に全てのジョブのオプション名と値を確認する
+		fs, _ := newJobFlags("queue")
+		for name := range values {
+			if fs.Lookup(name) == nil && common.Lookup(name) != nil {
+				return nil, fmt.Errorf("ジョブ %d の %s は指定できません。queue のオプションとして指定してください", i+1, name)
+			}
+		}
+		if err := applyFlagValues(fs, values, nil, fmt.Sprintf("ジョブ %d ", i+1)); err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			job.args = append(job.args, "-"+name+"="+values[name])
+		}
+		job.args = slices.Concat(commonArgs, job.args, files)
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// run はジョブを concat サブコマンドとして別のプロセスで実行し、出力をログファイルに書き出す
+// ログが混ざらないよう、ジョブごとにプロセスを分ける
+func (qj *queueJob) run(ctx context.Context, exe string) error {
+	logFile, err := os.Create(qj.logPath)
+	if err != nil {
+		return fmt.Errorf("ログファイルを作成できません: %v", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.CommandContext(ctx, exe, append([]string{"concat"}, qj.args...)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	// ジョブ側で書きかけの出力を削除できるよう、いきなり強制終了せずに割り込みを送る
+	cmd.Cancel = func() error {
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	cmd.WaitDelay = queueStopTimeout
+	return cmd.Run()
+}
+
+// printQueueSummary は全てのジョブの結果を表示する
+func printQueueSummary(jobs []*queueJob) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ジョブ\t結果\t時間\tログ")
+	for _, qj := range jobs {
+		elapsed := "-"
+		if qj.finished {
+			elapsed = qj.elapsed.Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", qj.name, qj.state, elapsed, qj.logPath)
+	}
+	w.Flush()
+}
+
+// runQueue は queue サブコマンドを実行する
+// ジョブファイルの各ジョブを最大 -concurrency 個ずつ並列に実行し、最後に結果をまとめて表示する
+func runQueue(args []string) {
+	fs, o := newQueueFlags()
+	fs.Parse(args)
+	applyCommonFlags()
+	if fs.NArg() != 1 {
+		fmt.Println("エラー: ジョブファイルを1つ指定してください。")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if o.concurrency < 1 {
+		fatalf("エラー: -concurrency には1以上の値を指定してください。")
+	}
+	// ログとffmpegのパスの指定は各ジョブの concat にも渡す
+	// ログはジョブごとのファイルに書き出すため、-log-file は渡さない
+	var commonArgs []string
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "concurrency", "log-dir", "log-file":
+			return
+		}
+		commonArgs = append(commonArgs, "-"+f.Name+"="+f.Value.String())
+	})
+	jobs, err := loadQueueJobs(fs.Arg(0), commonArgs)
+	if err != nil {
+		fatalf("エラー: %v", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf("エラー: 実行ファイルのパスを取得できません: %v", err)
+	}
+	if err := os.MkdirAll(o.logDir, 0o755); err != nil {
+		fatalf("ログディレクトリの作成に失敗しました: %v", err)
+	}
+	for i, qj := range jobs {
+		qj.state = "未実行"
+		qj.logPath = filepath.Join(o.logDir, fmt.Sprintf("%03d_%s.log", i+1, sanitizeLogName(qj.name)))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	infof("%d個のジョブを最大%d個ずつ並列に実行します。", len(jobs), o.concurrency)
+	slots := make(chan struct{}, o.concurrency)
+	var wg sync.WaitGroup
+	for i, qj := range jobs {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			infof("[%d/%d] %s を開始します (ログ: %s)", i+1, len(jobs), qj.name, qj.logPath)
+			started := time.Now()
+			err := qj.run(ctx, exe)
+			qj.elapsed, qj.finished = time.Since(started), true
+			var exitErr *exec.ExitError
+			switch {
+			case ctx.Err() != nil:
+				qj.state = "中断"
+			case errors.As(err, &exitErr):
+				qj.state = "失敗 (終了コード " + strconv.Itoa(exitErr.ExitCode()) + ")"
+			case err != nil:
+				qj.state = "失敗"
+				qj.err = err
+			default:
+				qj.state = "成功"
+			}
+			if qj.err != nil {
+				infof("[%d/%d] %s: %s: %v", i+1, len(jobs), qj.name, qj.state, qj.err)
+			} else {
+				infof("[%d/%d] %s: %s (%s)", i+1, len(jobs), qj.name, qj.state, qj.elapsed.Round(time.Second))
+			}
+		}()
+	}
+	wg.Wait()
+
+	printQueueSummary(jobs)
+	if ctx.Err() != nil {
+		infof("中断されました。")
+		os.Exit(exitInterrupted)
+	}
+	for _, qj := range jobs {
+		if qj.state != "成功" {
+			os.Exit(1)
+		}
+	}
+}
+
+// sanitizeLogName はジョブ名をログファイル名に使える文字列に変換する
+func sanitizeLogName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Recipe はユーザーが定義した再利用可能なオプションの組み合わせ
+type Recipe struct {
+	Description string            `json:"description,omitempty"`
+	Options     map[string]string `json:"options,omitempty"`     // フラグ名と値 (例: "resolution": "1280x720")
+	FFmpegArgs  []string          `json:"ffmpeg_args,omitempty"` // 出力オプションとしてそのまま渡すffmpegの引数
+}
+
+// recipeFile はレシピファイルの構造体
+type recipeFile struct {
+	Recipes map[string]Recipe `json:"recipes"`
+}
+
+// defaultRecipePath はユーザーの設定ディレクトリにあるレシピファイルのパスを返す
+func defaultRecipePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "video_concator", "recipes.json")
+}
+
+// loadRecipes はレシピファイルを読み込む。ファイルが無い場合は空の一覧を返す
+func loadRecipes(path string) (map[string]Recipe, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]Recipe{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rf recipeFile
+	if err := json.Unmarshal(data, &rf); err != nil {
+		return nil, fmt.Errorf("レシピファイルの解析に失敗しました: %s, %v", path, err)
+	}
+	return rf.Recipes, nil
+}
+
+// printRecipes はレシピの一覧を名前順に表示する
+func printRecipes(recipes map[string]Recipe) {
+	var names []string
+	for name := range recipes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-20s %s\n", name, recipes[name].Description)
+	}
+}
+
+// applyRecipe はレシピのオプションをフラグに設定する
+// skipに含まれるフラグ (コマンドラインで明示的に指定されたもの) はレシピの値より優先する
+func applyRecipe(fs *flag.FlagSet, recipe Recipe, skip map[string]bool) error {
+	return applyFlagValues(fs, recipe.Options, skip, "レシピ")
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rkun123/video_concator/concator"
+)
+
+// serveOptions は serve サブコマンドのオプション
+type serveOptions struct {
+	listen    string
+	outputDir string
+	maxJobs   int
+	token     string
+}
+
+// serveShutdownTimeout は終了時に処理中のリクエストの完了を待つ時間
+const serveShutdownTimeout = 10 * time.Second
+
+// serveAllowedOptions はAPIから指定できるオプション
+// 設定ファイル・レシピ・マニフェストの読み込み、フックや通知、ffmpegの追加の引数、ログとffmpegのパス、
+// 標準入出力を使うもの、エンコードせずに終了するものはここに含めず、受け付けない
+var serveAllowedOptions = map[string]bool{
+	"dir": true, "list": true, "source": true, "chapters-text": true, "chapters-select": true, "ignore-file": true, "include": true, "exclude": true, "include-hidden": true, "follow-symlinks": true, "max-depth": true,
+	"since": true, "until": true, "min-duration": true, "max-duration": true, "sort": true, "seed": true, "reverse": true, "time-source": true, "skip-open-files": true, "keep-duplicates": true, "cuts": true, "on-error": true, "strict": true,
+	"output": true, "output-suffix": true, "overwrite": true, "container": true, "format": true, "segment-duration": true, "master-playlist": true, "renditions": true, "orientation-groups": true, "group-by": true,
+	"split-duration": true, "split-size": true, "target-size": true, "force": true, "list-eol": true, "write-manifest": true,
+	"codec": true, "encoder": true, "preset": true, "tune": true, "crf": true, "vbitrate": true, "max-bitrate": true, "bufsize": true, "two-pass": true, "gpu": true, "framerate": true, "resolution": true, "fit": true, "scale-mode": true,
+	"tonemap": true, "vfr-policy": true, "total-frames": true, "speed": true, "speed-audio": true, "copy": true, "normalize": true, "normalize-audio": true, "cache": true, "cache-dir": true, "checkpoint": true,
+	"jobs": true, "io-jobs": true, "cpu-limit": true, "mem-limit": true, "analyzeduration": true, "probesize": true, "thread-queue-size": true, "stats-period": true,
+	"audio": true, "audio-layout": true, "av-tolerance": true, "loudness-target": true, "music": true, "music-mode": true, "music-volume": true, "music-duck": true, "music-duck-ratio": true,
+	"transition": true, "transition-effect": true, "transition-duration": true, "fade-in": true, "fade-out": true, "intro": true, "outro": true,
+	"title-cards": true, "title-card-text": true, "title-card-duration": true, "title-card-font": true, "title-card-color": true, "title-card-background": true, "title-card-date-format": true,
+	"burn-timestamp": true, "timestamp-format": true, "timestamp-font": true, "watermark": true, "watermark-position": true, "watermark-opacity": true, "watermark-margin": true,
+	"deinterlace": true, "denoise": true, "stabilize": true, "cleanup-include": true, "trim-black": true, "black-threshold": true, "black-min-duration": true,
+	"motion-only": true, "motion-threshold": true, "motion-min-length": true, "scenes-montage": true, "scene-threshold": true, "scene-hold": true,
+	"subtitles": true, "keep-subtitles": true, "embed-chapters": true, "metadata": true, "strip-metadata": true, "poster": true, "verify": true, "verify-tolerance": true,
+	"webvtt-chapters": true, "dump-metadata": true, "dump-graph": true, "thumbnail": true, "thumbnail-time": true, "scrub-sprites": true, "sprite-interval": true, "sprite-columns": true, "sprite-width": true,
+	"contact-sheet": true, "contact-sheet-columns": true, "contact-sheet-rows": true, "contact-sheet-width": true,
+}
+
+// serveOutputPathOptions はファイルやディレクトリを書き出すパスを指定するオプション
+// output と同じく、-output-dir 内の名前として扱う
+var serveOutputPathOptions = []string{"webvtt-chapters", "dump-metadata", "dump-graph", "thumbnail", "contact-sheet", "cache-dir"}
+
+// newServeFlags は serve サブコマンドのフラグを定義する
+func newServeFlags() (*flag.FlagSet, *serveOptions) {
+	o := &serveOptions{}
+	fs := newCommandFlags("serve", "[オプション]")
+	fs.StringVar(&o.listen, "listen", ":8080", "APIを待ち受けるアドレス")
+	fs.StringVar(&o.outputDir, "output-dir", "", "出力ファイルを書き出すディレクトリ (必須)。ジョブの output はこのディレクトリ内のファイル名として扱う")
+	fs.IntVar(&o.maxJobs, "max-jobs", 1, "同時に実行するジョブの数 (超えたジョブは待機する)")
+	fs.StringVar(&o.token, "token", os.Getenv("VIDEO_CONCATOR_TOKEN"), "APIの呼び出しに必要なBearerトークン (省略時は環境変数 VIDEO_CONCATOR_TOKEN、空の場合は認証しない)")
+	bindCommonFlags(fs)
+	return fs, o
+}
+
+// serverJob はAPIから登録された1つの結合ジョブ
+type serverJob struct {
+	mu       sync.Mutex
+	id       string
+	state    string // queued, running, done, failed, canceled
+	settings map[string]any
+	percent  float64
+	eta      float64
+	outputs  []string // 作成した出力ファイル (summaryイベントの順)
+	err      string
+	created  time.Time
+	started  time.Time
+	finished time.Time
+	cancel   context.CancelFunc
+}
+
+// jobStatus はAPIが返すジョブの状態
+type jobStatus struct {
+	ID       string         `json:"id"`
+	State    string         `json:"state"`
+	Settings map[string]any `json:"settings"`
+	Percent  float64        `json:"percent"`
+	ETA      float64        `json:"eta,omitempty"`
+	Outputs  []string       `json:"outputs,omitempty"` // ダウンロードできる出力ファイル名
+	Error    string         `json:"error,omitempty"`
+	Created  time.Time      `json:"created"`
+	Started  *time.Time     `json:"started,omitempty"`
+	Finished *time.Time     `json:"finished,omitempty"`
+}
+
+// status はジョブの現在の状態を返す
+func (sj *serverJob) status() jobStatus {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	st := jobStatus{ID: sj.id, State: sj.state, Settings: sj.settings, Percent: sj.percent, ETA: sj.eta, Error: sj.err, Created: sj.created}
+	for _, output := range sj.outputs {
+		st.Outputs = append(st.Outputs, filepath.Base(output))
+	}
+	if !sj.started.IsZero() {
+		st.Started = &sj.started
+	}
+	if !sj.finished.IsZero() {
+		st.Finished = &sj.finished
+	}
+	return st
+}
+
+// Write はジョブが書き出すJSON Linesのイベントを受け取り、進捗と出力ファイルを記録する
+// EventWriterは1つのイベントを1回のWriteで書き出す
+func (sj *serverJob) Write(p []byte) (int, error) {
+	var ev struct {
+		Event   string  `json:"event"`
+		Percent float64 `json:"percent"`
+		ETA     float64 `json:"eta"`
+		Output  string  `json:"output"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(p), &ev); err != nil {
+		return len(p), nil
+	}
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	switch ev.Event {
+	case "progress":
+		sj.percent, sj.eta = ev.Percent, ev.ETA
+	case "summary":
+		sj.outputs = append(sj.outputs, ev.Output)
+	}
+	return len(p), nil
+}
+
+// finish はジョブの実行結果を記録する
+func (sj *serverJob) finish(ctx context.Context, err error) {
+	sj.mu.Lock()
+	defer sj.mu.Unlock()
+	sj.finished = time.Now()
+	switch {
+	case ctx.Err() != nil:
+		sj.state = "canceled"
+	case err != nil:
+		sj.state = "failed"
+		sj.err = err.Error()
+	default:
+		sj.state = "done"
+		sj.percent, sj.eta = 100, 0
+	}
+}
+
+// jobServer はジョブの登録・進捗の確認・中止・出力のダウンロードを行うHTTP APIのサーバー
+type jobServer struct {
+	opts  *serveOptions
+	ctx   context.Context // サーバーの終了時に取り消され、実行中のジョブを中止する
+	slots chan struct{}   // 同時に実行できるジョブの数のセマフォ
+	wg    sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[string]*serverJob
+	nextID int
+}
+
+// newJob はリクエストの設定から結合ジョブを作成する
+// 設定は設定ファイルと同じくオプション名と値の対応で、"files" のみ動画ファイルのパスの配列を指定できる
+func (s *jobServer) newJob(settings map[string]any) (*concator.Job, error) {
+	raw := map[string]any{}
+	var files []string
+	for name, v := range settings {
+		if name != "files" {
+			raw[name] = v
+			continue
+		}
+		list, ok := v.([]any)
+		if !ok {
+			return nil, errors.New("files には動画ファイルのパスの配列を指定してください")
+		}
+		for _, item := range list {
+			file, ok := item.(string)
+			if !ok {
+				return nil, errors.New("files には動画ファイルのパスの配列を指定してください")
+			}
+			files = append(files, file)
+		}
+	}
+	values, err := flagValues(raw, "リクエスト")
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range values {
+		if !serveAllowedOptions[name] {
+			return nil, fmt.Errorf("serve ではオプション %s は指定できません", name)
+		}
+		// 出力先は -output-dir の中に限る
+		if name == "output" || slices.Contains(serveOutputPathOptions, name) {
+			if value == "" {
+				continue
+			}
+			if filepath.Base(value) != value || value == "." || value == ".." {
+				return nil, fmt.Errorf("%s にはディレクトリを含まないファイル名を指定してください: %s", name, value)
+			}
+			values[name] = filepath.Join(s.opts.outputDir, value)
+		}
+	}
+
+	// ログとffmpegのパスはサーバー全体で共通のため、ジョブのフラグには定義しない
+	fs, o := newJobFlags("serve")
+	if err := applyFlagValues(fs, values, nil, "リクエスト"); err != nil {
+		return nil, err
+	}
+	job := o.job
+	job.Files = files
+	if job.Dir == "" && job.Source == "" && job.ListFile == "" && len(job.Files) == 0 {
+		return nil, errors.New("dir、source、list、files のいずれかを指定してください")
+	}
+	if (job.Source == "") != (job.ChaptersText == "") {
+		return nil, errors.New("source と chapters-text は一緒に指定してください")
+	}
+	if job.Output == "" {
+		return nil, errors.New("output は必須です")
+	}
+
+	if o.useCache {
+		if !job.Normalize {
+			return nil, errors.New("cache は normalize と一緒に指定してください")
+		}
+		job.CacheDir = o.cacheDir
+	}
+	if o.strict {
+		job.OnError = "abort"
+	}
+	if o.memLimit != "" {
+		if job.Limits.MemoryBytes, err = concator.ParseByteSize(o.memLimit); err != nil {
+			return nil, err
+		}
+	}
+	job.Limits.CPUs = o.cpuLimit
+	job.OnEmpty = "error"
+	// サーバーの端末で確認を待たないよう、既存の出力ファイルは overwrite か output-suffix の指定が無ければエラーにする
+	job.NoPrompt = true
+	return job, nil
+}
+
+// submit はジョブを登録し、実行できる枠が空き次第実行する
+func (s *jobServer) submit(settings map[string]any, job *concator.Job) *serverJob {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.mu.Lock()
+	s.nextID++
+	sj := &serverJob{id: strconv.Itoa(s.nextID), state: "queued", settings: settings, created: time.Now(), cancel: cancel}
+	s.jobs[sj.id] = sj
+	s.mu.Unlock()
+
+	job.Progress = true
+	job.Events = concator.NewEventWriter(sj)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		case <-ctx.Done():
+			sj.finish(ctx, nil)
+			return
+		}
+		sj.mu.Lock()
+		sj.state = "running"
+		sj.started = time.Now()
+		sj.mu.Unlock()
+		infof("ジョブ %s を開始します: %s", sj.id, job.Output)
+		err := job.Run(ctx)
+		sj.finish(ctx, err)
+		infof("ジョブ %s が終了しました: %s", sj.id, sj.status().State)
+	}()
+	return sj
+}
+
+// lookup はIDに対応するジョブを返す。見つからない場合はnilを返す
+func (s *jobServer) lookup(id string) *serverJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// writeJSON はvをJSONとしてレスポンスに書き出す
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeError はエラーをJSONとしてレスポンスに書き出す
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// routes はAPIのハンドラーを登録する
+//
+//	POST /jobs                 ジョブを登録する (本文は設定ファイルと同じオプション名と値のJSON)
+//	GET  /jobs                 全てのジョブの状態を返す
+//	GET  /jobs/{id}            ジョブの状態と進捗を返す
+//	POST /jobs/{id}/cancel     ジョブを中止する
+//	GET  /jobs/{id}/output     出力ファイルをダウンロードする (複数ある場合は ?name= で選ぶ)
+func (s *jobServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		var settings map[string]any
+		dec := json.NewDecoder(r.Body)
+		// 大きな整数が指数表記にならないよう、数値は元の表記のまま扱う
+		dec.UseNumber()
+		if err := dec.Decode(&settings); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("リクエストの解析に失敗しました: %v", err))
+			return
+		}
+		job, err := s.newJob(settings)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		sj := s.submit(settings, job)
+		writeJSON(w, http.StatusAccepted, sj.status())
+	})
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		jobs := make([]*serverJob, 0, len(s.jobs))
+		for _, sj := range s.jobs {
+			jobs = append(jobs, sj)
+		}
+		s.mu.Unlock()
+		// 登録順に並べる
+		slices.SortFunc(jobs, func(a, b *serverJob) int { return a.created.Compare(b.created) })
+		statuses := []jobStatus{}
+		for _, sj := range jobs {
+			statuses = append(statuses, sj.status())
+		}
+		writeJSON(w, http.StatusOK, statuses)
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		sj := s.lookup(r.PathValue("id"))
+		if sj == nil {
+			writeError(w, http.StatusNotFound, errors.New("ジョブが見つかりません"))
+			return
+		}
+		writeJSON(w, http.StatusOK, sj.status())
+	})
+	mux.HandleFunc("POST /jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		sj := s.lookup(r.PathValue("id"))
+		if sj == nil {
+			writeError(w, http.StatusNotFound, errors.New("ジョブが見つかりません"))
+			return
+		}
+		sj.cancel()
+		writeJSON(w, http.StatusAccepted, sj.status())
+	})
+	mux.HandleFunc("GET /jobs/{id}/output", func(w http.ResponseWriter, r *http.Request) {
+		sj := s.lookup(r.PathValue("id"))
+		if sj == nil {
+			writeError(w, http.StatusNotFound, errors.New("ジョブが見つかりません"))
+			return
+		}
+		st := sj.status()
+		if st.State != "done" || len(st.Outputs) == 0 {
+			writeError(w, http.StatusConflict, fmt.Errorf("ジョブの出力はまだありません (状態: %s)", st.State))
+			return
+		}
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = st.Outputs[0]
+		}
+		sj.mu.Lock()
+		i := slices.IndexFunc(sj.outputs, func(output string) bool { return filepath.Base(output) == name })
+		path := ""
+		if i >= 0 {
+			path = sj.outputs[i]
+		}
+		sj.mu.Unlock()
+		if path == "" {
+			writeError(w, http.StatusNotFound, fmt.Errorf("出力ファイルが見つかりません: %s", name))
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		http.ServeFile(w, r, path)
+	})
+	if s.opts.token == "" {
+		return mux
+	}
+	expected := []byte("Bearer " + s.opts.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("認証に失敗しました"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// runServe は serve サブコマンドを実行する
+// SIGINT/SIGTERMを受け取ったら新しいリクエストの受け付けを止め、実行中のジョブを中止してから終了する
+func runServe(args []string) {
+	fs, o := newServeFlags()
+	fs.Parse(args)
+	applyCommonFlags()
+	if o.outputDir == "" {
+		fmt.Println("エラー: -output-dir は必須です。")
+		fs.Usage()
+		os.Exit(1)
+	}
+	if o.maxJobs < 1 {
+		fatalf("エラー: -max-jobs には1以上の値を指定してください。")
+	}
+	outputDir, err := filepath.Abs(o.outputDir)
+	if err != nil {
+		fatalf("エラー: %v", err)
+	}
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		fatalf("出力ディレクトリの作成に失敗しました: %v", err)
+	}
+	o.outputDir = outputDir
+	if o.token == "" {
+		warnf("-token が指定されていないため、APIは認証なしで誰でも呼び出せます。")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	s := &jobServer{opts: o, ctx: ctx, slots: make(chan struct{}, o.maxJobs), jobs: map[string]*serverJob{}}
+	server := &http.Server{Addr: o.listen, Handler: s.routes()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	infof("APIを %s で待ち受けています (出力先: %s)", o.listen, o.outputDir)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatalf("エラー: %v", err)
+	}
+	// 実行中のジョブはctxの取り消しで中止されるため、書きかけの出力の削除を待つ
+	s.wg.Wait()
+	infof("終了しました。")
+}
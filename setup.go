@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rkun123/video_concator/concator"
+)
+
+// setupOptions は setup サブコマンドのオプション
+type setupOptions struct {
+	force bool
+}
+
+// newSetupFlags は setup サブコマンドのフラグを定義する
+func newSetupFlags() (*flag.FlagSet, *setupOptions) {
+	o := &setupOptions{}
+	fs := newCommandFlags("setup", "[オプション]")
+	fs.BoolVar(&o.force, "force", false, "ダウンロード済みの場合も最新のビルドをダウンロードし直す")
+	bindCommonFlags(fs)
+	return fs, o
+}
+
+// runSetup は静的ビルドのffmpeg・ffprobeをダウンロードする
+// ダウンロードしたffmpegは、PATHにffmpegが無く -ffmpeg-path も指定していない場合に使われる
+func runSetup(args []string) {
+	fs, o := newSetupFlags()
+	fs.Parse(args)
+	applyCommonFlags()
+
+	// 中断された場合もダウンロード中の一時ファイルを削除する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ffmpeg, ffprobe, ok := concator.ManagedFFmpeg()
+	if !ok || o.force {
+		var err error
+		ffmpeg, ffprobe, err = concator.InstallFFmpeg(ctx)
+		if err != nil {
+			fatalf("エラー: %v", err)
+		}
+	} else {
+		fmt.Println("ffmpegはダウンロード済みです (-force でダウンロードし直します)。")
+	}
+	fmt.Printf("ffmpeg:  %s\nffprobe: %s\n", ffmpeg, ffprobe)
+}